@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wptomd/wptomdx"
+)
+
+// configFromEnv builds the run configuration from the environment over base,
+// the defaults or a config file, keeping base for every variable that isn't set
+func configFromEnv(base wptomdx.Config) (wptomdx.Config, error) {
+	cfg := base
+
+	for name, value := range map[string]*string{
+		"DB_HOST":                 &cfg.DBHost,
+		"DB_PORT":                 &cfg.DBPort,
+		"DB_USER":                 &cfg.DBUser,
+		"DB_PASSWORD":             &cfg.DBPassword,
+		"DB_NAME":                 &cfg.DBName,
+		"TABLE_PREFIX":            &cfg.TablePrefix,
+		"WP_BASE_URL":             &cfg.BaseURL,
+		"WP_API_BASE":             &cfg.APIBase,
+		"PERMALINK_STRUCTURE":     &cfg.PermalinkStructure,
+		"POSTS_OUTPUT_DIR":        &cfg.PostsOutputDir,
+		"PAGES_OUTPUT_DIR":        &cfg.PagesOutputDir,
+		"OUTPUT_HTML_DIR":         &cfg.HTMLOutputDir,
+		"MEDIA_OUTPUT_DIR":        &cfg.MediaOutputDir,
+		"MANIFEST_OUTPUT":         &cfg.ManifestPath,
+		"JSON_OUTPUT":             &cfg.JSONOutput,
+		"JSON_OUTPUT_FILE":        &cfg.JSONOutputPath,
+		"MEDIA_FAILURES_OUTPUT":   &cfg.MediaFailuresPath,
+		"UNRESOLVED_MEDIA_OUTPUT": &cfg.UnresolvedMediaPath,
+		"AUTHORS_OUTPUT":          &cfg.AuthorsPath,
+		"METRICS_OUTPUT":          &cfg.MetricsPath,
+		"OUTPUT_EXTENSION":        &cfg.OutputExtension,
+		"PASSWORD_PROTECTED":      &cfg.PasswordProtected,
+		"DATE_OUTPUT_FORMAT":      &cfg.DateOutputFormat,
+		"FRONTMATTER_FORMAT":      &cfg.FrontmatterFormat,
+		"MORE_TAG_MODE":           &cfg.MoreTagMode,
+		"IMAGE_SYNTAX":            &cfg.ImageSyntax,
+		"HEADING_STYLE":           &cfg.Convert.HeadingStyle,
+		"EMPHASIS_DELIMITER":      &cfg.Convert.EmphasisDelimiter,
+		"BULLET_CHAR":             &cfg.Convert.BulletChar,
+		"HIGHLIGHT_SYNTAX":        &cfg.Convert.HighlightSyntax,
+		"INCLUDE_COMMENTS":        &cfg.IncludeComments,
+		"CATEGORY_INDEX_NAME":     &cfg.CategoryIndexName,
+		"FORMAT_COMMAND":          &cfg.FormatCommand,
+		"MEDIA_USER_AGENT":        &cfg.MediaUserAgent,
+		"MEDIA_PROXY":             &cfg.MediaProxy,
+		"COLUMNS_COMPONENT":       &cfg.Convert.ColumnsComponent,
+		"COLUMN_COMPONENT":        &cfg.Convert.ColumnComponent,
+		"GROUP_COMPONENT":         &cfg.Convert.GroupComponent,
+		"QUOTE_COMPONENT":         &cfg.Convert.QuoteComponent,
+		"PULLQUOTE_COMPONENT":     &cfg.Convert.PullquoteComponent,
+		"SERIES_META_KEY":         &cfg.Series.MetaKey,
+		"SERIES_ORDER_META_KEY":   &cfg.Series.OrderMetaKey,
+		"BUTTON_COMPONENT":        &cfg.Convert.ButtonComponent,
+		"INTERNAL_LINK_PREFIX":    &cfg.Convert.InternalLinkPrefix,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			*value = raw
+		}
+	}
+
+	cfg.BaseURL = wptomdx.NormalizeBaseURL(cfg.BaseURL)
+
+	// Toggles are enabled by "1"
+	for name, value := range map[string]*bool{
+		"TRANSLITERATE_SLUGS":        &cfg.TransliterateSlugs,
+		"NORMALIZE_FILENAMES":        &cfg.NormalizeFilenames,
+		"COLOCATE_MEDIA":             &cfg.ColocateMedia,
+		"DATE_USE_GMT":               &cfg.DateUseGMT,
+		"DATE_INCLUDE_TIME":          &cfg.DateIncludeTime,
+		"FOLLOW_LINK_REDIRECTS":      &cfg.Convert.FollowLinkRedirects,
+		"INCLUDE_READING_TIME":       &cfg.ReadingTime,
+		"INCLUDE_CANONICAL":          &cfg.IncludeCanonical,
+		"INCLUDE_SLUG":               &cfg.IncludeSlug,
+		"SKIP_EMPTY":                 &cfg.SkipEmpty,
+		"EMBED_SOURCE_HTML":          &cfg.EmbedSourceHTML,
+		"APPLY_WPAUTOP":              &cfg.ApplyWpautop,
+		"STRICT_MEDIA_CONTENT_TYPE":  &cfg.StrictMediaContentType,
+		"FIX_MEDIA_EXTENSIONS":       &cfg.FixMediaExtensions,
+		"FOLLOW_MEDIA_REDIRECTS":     &cfg.FollowMediaRedirects,
+		"DEDUPE_FEATURED_IN_CONTENT": &cfg.DedupeFeaturedInContent,
+		"RESUME":                     &cfg.Resume,
+		"STREAM_POSTS":               &cfg.StreamPosts,
+		"DERIVE_ALT_FROM_FILENAME":   &cfg.Convert.DeriveAltFromFilename,
+		"MEDIA_CHECKSUMS":            &cfg.MediaChecksums,
+		"GENERATE_CATEGORY_INDEXES":  &cfg.CategoryIndexes,
+		"EXPORT_AUTHORS":             &cfg.ExportAuthors,
+		"KEEP_ABSOLUTE_MEDIA_URLS":   &cfg.KeepAbsoluteMediaURLs,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			*value = raw == "1"
+		}
+	}
+
+	if raw := os.Getenv("BLOG_ID"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 1 {
+			return cfg, fmt.Errorf("invalid BLOG_ID %q: must be a positive integer", raw)
+		}
+		cfg.BlogID = id
+	}
+
+	if raw := os.Getenv("READING_WPM"); raw != "" {
+		wpm, err := strconv.Atoi(raw)
+		if err != nil || wpm < 1 {
+			return cfg, fmt.Errorf("invalid READING_WPM %q: must be a positive integer", raw)
+		}
+		cfg.ReadingWPM = wpm
+	}
+
+	if raw := os.Getenv("LIST_INDENT"); raw != "" {
+		indent, err := strconv.Atoi(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LIST_INDENT %q: must be 2 or 4", raw)
+		}
+		cfg.Convert.ListIndent = indent
+	}
+
+	// Optionally only process a subset of the posts and pages, tune how hard
+	// the API is retried before giving up on it, and inline small SVGs
+	for name, value := range map[string]*int{
+		"LIMIT":                     &cfg.Window.Limit,
+		"OFFSET":                    &cfg.Window.Offset,
+		"API_UNREACHABLE_THRESHOLD": &cfg.APIFailureThreshold,
+		"INLINE_SVG_UNDER_BYTES":    &cfg.InlineSVGUnderBytes,
+	} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid %s %q: must be a non-negative integer", name, raw)
+		}
+		*value = n
+	}
+
+	if raw := os.Getenv("DOWNLOAD_BANDWIDTH_LIMIT"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 0 {
+			return cfg, fmt.Errorf("invalid DOWNLOAD_BANDWIDTH_LIMIT %q: must be a non-negative number of bytes per second", raw)
+		}
+		cfg.DownloadBandwidthLimit = limit
+	}
+
+	// The first try of a request isn't a retry
+	if raw := os.Getenv("API_RETRIES"); raw != "" {
+		retries, err := strconv.Atoi(raw)
+		if err != nil || retries < 0 {
+			return cfg, fmt.Errorf("invalid API_RETRIES %q: must be a non-negative integer", raw)
+		}
+		cfg.APIRetry.Attempts = retries + 1
+	}
+
+	if raw := os.Getenv("API_RETRY_BACKOFF"); raw != "" {
+		backoff, err := time.ParseDuration(raw)
+		if err != nil || backoff < 0 {
+			return cfg, fmt.Errorf("invalid API_RETRY_BACKOFF %q: must be a duration such as 500ms", raw)
+		}
+		cfg.APIRetry.Backoff = backoff
+	}
+
+	// Only process posts in (or not in) some categories and tags
+	for name, value := range map[string]*[]string{
+		"INCLUDE_CATEGORIES": &cfg.Taxonomy.IncludeCategories,
+		"INCLUDE_TAGS":       &cfg.Taxonomy.IncludeTags,
+		"EXCLUDE_CATEGORIES": &cfg.Taxonomy.ExcludeCategories,
+		"EXCLUDE_TAGS":       &cfg.Taxonomy.ExcludeTags,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			*value = splitList(raw)
+		}
+	}
+	switch mode := os.Getenv("TAXONOMY_FILTER_MODE"); mode {
+	case "":
+	case "or":
+		cfg.Taxonomy.MatchAll = false
+	case "and":
+		cfg.Taxonomy.MatchAll = true
+	default:
+		return cfg, fmt.Errorf("invalid TAXONOMY_FILTER_MODE %q: must be and or or", mode)
+	}
+
+	// WordPress files posts without a category under "Uncategorized"
+	if raw := os.Getenv("TAXONOMY_RENAME"); raw != "" || cfg.TaxonomyRename == nil {
+		cfg.TaxonomyRename = wptomdx.ParseTaxonomyRename(raw)
+	}
+	if _, ok := cfg.TaxonomyRename["uncategorized"]; !ok && os.Getenv("DROP_UNCATEGORIZED") == "1" {
+		cfg.TaxonomyRename["uncategorized"] = ""
+	}
+
+	if raw := os.Getenv("MEDIA_HEADERS"); raw != "" || cfg.MediaHeaders == nil {
+		cfg.MediaHeaders = wptomdx.ParseHeaders(raw)
+	}
+	for name, value := range map[string]*[]string{
+		"PATH_RESOLUTION_ORDER":     &cfg.PathResolutionOrder,
+		"MEDIA_ALLOWED_HOSTS":       &cfg.MediaHosts.Allowed,
+		"MEDIA_DENIED_HOSTS":        &cfg.MediaHosts.Denied,
+		"STRIP_QUERY_PARAMS":        &cfg.Convert.StripQueryParams,
+		"SHORTCODE_CAPTION_ALIASES": &cfg.Convert.CaptionShortcodes,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			*value = splitList(raw)
+		}
+	}
+
+	if mappingFile := os.Getenv("FRONTMATTER_FIELDS"); mappingFile != "" {
+		mapping, err := wptomdx.LoadFieldMapping(mappingFile)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.FieldMapping = mapping
+	}
+
+	// Paths to skip, from the environment and optionally an ignore file
+	if raw := os.Getenv("IGNORE_PATHS"); raw != "" {
+		cfg.IgnorePaths = wptomdx.ParseIgnorePatterns(raw)
+	}
+	if ignoreFile := os.Getenv("IGNORE_FILE"); ignoreFile != "" {
+		raw, err := os.ReadFile(ignoreFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read IGNORE_FILE: %v", err)
+		}
+		cfg.IgnorePaths = append(cfg.IgnorePaths, wptomdx.ParseIgnorePatterns(string(raw))...)
+	}
+
+	if cfg.Convert.ColumnsComponent != "" && cfg.Convert.ColumnComponent == "" {
+		cfg.Convert.ColumnComponent = "Column"
+	}
+	if raw := os.Getenv("SHORTCODE_MAP"); raw != "" {
+		cfg.Shortcodes.Components = wptomdx.ParseShortcodeMap(raw)
+	}
+	if raw := os.Getenv("UNKNOWN_SHORTCODES"); raw != "" {
+		cfg.Shortcodes.Strip = raw == "strip"
+	}
+	if raw := os.Getenv("PDF_COMPONENT"); raw != "" {
+		cfg.Shortcodes.PDFComponent = raw
+	}
+	if raw := os.Getenv("SHORTCODES_ULTIMATE"); raw != "" {
+		cfg.Shortcodes.Ultimate = raw == "1"
+	}
+	if cfg.Shortcodes.Ultimate {
+		// The defaults, overridden by the config file and then SU_SHORTCODE_MAP
+		components := wptomdx.DefaultUltimateComponents()
+		for name, component := range cfg.Shortcodes.UltimateComponents {
+			components[name] = component
+		}
+		for name, component := range wptomdx.ParseShortcodeMap(os.Getenv("SU_SHORTCODE_MAP")) {
+			components[name] = component
+		}
+		cfg.Shortcodes.UltimateComponents = components
+	}
+	return cfg, nil
+}
+
+// validateConfig fails fast on settings that would only break later on: base
+// URLs without a scheme, missing database settings and unwritable output
+// directories, which are created when missing
+func validateConfig(cfg wptomdx.Config, wxrPath string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	for _, setting := range [][2]string{{"WP_BASE_URL", cfg.BaseURL}, {"WP_API_BASE", cfg.APIBase}} {
+		name, value := setting[0], setting[1]
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s %q must be an absolute URL such as https://example.com", name, value)
+		}
+	}
+
+	// The database isn't used when reading an export
+	if wxrPath == "" {
+		for _, setting := range [][2]string{{"DB_HOST", cfg.DBHost}, {"DB_USER", cfg.DBUser}, {"DB_NAME", cfg.DBName}} {
+			if setting[1] == "" {
+				return fmt.Errorf("%s is not set; set it or pass --wxr to read an export instead", setting[0])
+			}
+		}
+	}
+
+	for _, dir := range []string{cfg.PostsOutputDir, cfg.PagesOutputDir, cfg.HTMLOutputDir, cfg.MediaOutputDir} {
+		if err := checkWritableDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWritableDir creates dir if needed and checks that files can be written to it
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory %s: %v", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// settingFlags collects the -set flags, key=value pairs of config file keys
+// applied over the environment in order
+type settingFlags []string
+
+func (s *settingFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *settingFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("must be key=value, such as convert.list_indent=4")
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+// apply changes cfg by every setting in turn
+func (s settingFlags) apply(cfg *wptomdx.Config) error {
+	for _, setting := range s {
+		key, value, _ := strings.Cut(setting, "=")
+		if err := cfg.Set(strings.TrimSpace(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping blank entries
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"wptomd/wptomdx"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(t *testing.T, cfg wptomdx.Config)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !reflect.DeepEqual(cfg.Window, wptomdx.QueryWindow{}) || cfg.OutputExtension != wptomdx.DefaultConfig().OutputExtension {
+					t.Errorf("defaults changed without any variable set: %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "strings",
+			env:  map[string]string{"WP_BASE_URL": "https://example.com/", "OUTPUT_EXTENSION": ".md", "FRONTMATTER_FORMAT": "toml", "HEADING_STYLE": "setext"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.BaseURL != "https://example.com" || cfg.OutputExtension != ".md" || cfg.FrontmatterFormat != "toml" || cfg.Convert.HeadingStyle != "setext" {
+					t.Errorf("got base %q, extension %q, format %q, heading style %q", cfg.BaseURL, cfg.OutputExtension, cfg.FrontmatterFormat, cfg.Convert.HeadingStyle)
+				}
+			},
+		},
+		{
+			name: "toggles",
+			env:  map[string]string{"COLOCATE_MEDIA": "1", "DATE_USE_GMT": "0", "KEEP_ABSOLUTE_MEDIA_URLS": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !cfg.ColocateMedia || cfg.DateUseGMT || !cfg.KeepAbsoluteMediaURLs {
+					t.Errorf("got colocate %v, GMT %v, keep absolute %v", cfg.ColocateMedia, cfg.DateUseGMT, cfg.KeepAbsoluteMediaURLs)
+				}
+			},
+		},
+		{
+			name: "numbers",
+			env:  map[string]string{"LIMIT": "10", "OFFSET": "5", "BLOG_ID": "2", "API_RETRIES": "0"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.Window != (wptomdx.QueryWindow{Limit: 10, Offset: 5}) || cfg.BlogID != 2 || cfg.APIRetry.Attempts != 1 {
+					t.Errorf("got window %+v, blog %d, attempts %d", cfg.Window, cfg.BlogID, cfg.APIRetry.Attempts)
+				}
+			},
+		},
+		{
+			name: "lists",
+			env:  map[string]string{"INCLUDE_TAGS": "go, sql,,", "PATH_RESOLUTION_ORDER": "slug,api"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !reflect.DeepEqual(cfg.Taxonomy.IncludeTags, []string{"go", "sql"}) || !reflect.DeepEqual(cfg.PathResolutionOrder, []string{"slug", "api"}) {
+					t.Errorf("got tags %q, order %q", cfg.Taxonomy.IncludeTags, cfg.PathResolutionOrder)
+				}
+			},
+		},
+		{
+			name: "caption aliases",
+			env:  map[string]string{"SHORTCODE_CAPTION_ALIASES": "caption, img_caption"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !reflect.DeepEqual(cfg.Convert.CaptionShortcodes, []string{"caption", "img_caption"}) {
+					t.Errorf("got caption shortcodes %q", cfg.Convert.CaptionShortcodes)
+				}
+			},
+		},
+		{
+			name: "taxonomy rename",
+			env:  map[string]string{"TAXONOMY_RENAME": "News=updates, Old Stuff=", "DROP_UNCATEGORIZED": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				want := wptomdx.TaxonomyRename{"news": "updates", "old stuff": "", "uncategorized": ""}
+				if !reflect.DeepEqual(cfg.TaxonomyRename, want) {
+					t.Errorf("got taxonomy rename %q, want %q", cfg.TaxonomyRename, want)
+				}
+			},
+		},
+		{
+			name: "uncategorized renamed",
+			env:  map[string]string{"TAXONOMY_RENAME": "Uncategorized=misc", "DROP_UNCATEGORIZED": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if got := cfg.TaxonomyRename["uncategorized"]; got != "misc" {
+					t.Errorf("uncategorized becomes %q, want the explicit rename %q", got, "misc")
+				}
+			},
+		},
+		{
+			name: "series",
+			env:  map[string]string{"SERIES_META_KEY": "series", "SERIES_ORDER_META_KEY": "series_part"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.Series != (wptomdx.SeriesOptions{MetaKey: "series", OrderMetaKey: "series_part"}) {
+					t.Errorf("got series %+v", cfg.Series)
+				}
+			},
+		},
+		{
+			name: "shortcodes ultimate",
+			env:  map[string]string{"SHORTCODES_ULTIMATE": "1", "SU_SHORTCODE_MAP": "su_note=Callout,su_row=Row"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				got := cfg.Shortcodes.UltimateComponents
+				if !cfg.Shortcodes.Ultimate || got["su_note"] != "Callout" || got["su_row"] != "Row" || got["su_tabs"] != "Tabs" {
+					t.Errorf("got ultimate %v, components %q", cfg.Shortcodes.Ultimate, got)
+				}
+			},
+		},
+		{
+			name: "date output format",
+			env:  map[string]string{"DATE_OUTPUT_FORMAT": "Jan 2, 2006"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.DateOutputFormat != "Jan 2, 2006" {
+					t.Errorf("got date output format %q", cfg.DateOutputFormat)
+				}
+			},
+		},
+		{
+			name: "media hosts",
+			env: map[string]string{
+				"MEDIA_ALLOWED_HOSTS": "cdn.example.com, *.wp.com",
+				"MEDIA_DENIED_HOSTS":  "ads.example.com,",
+			},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if got := cfg.MediaHosts.Allowed; len(got) != 2 || got[0] != "cdn.example.com" || got[1] != "*.wp.com" {
+					t.Errorf("got allowed hosts %q", got)
+				}
+				if got := cfg.MediaHosts.Denied; len(got) != 1 || got[0] != "ads.example.com" {
+					t.Errorf("got denied hosts %q", got)
+				}
+			},
+		},
+		{
+			name: "include slug",
+			env:  map[string]string{"INCLUDE_SLUG": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !cfg.IncludeSlug {
+					t.Error("slug not included")
+				}
+			},
+		},
+		{
+			name: "skip empty",
+			env:  map[string]string{"SKIP_EMPTY": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !cfg.SkipEmpty {
+					t.Error("empty posts not skipped")
+				}
+			},
+		},
+		{
+			name: "unresolved media output",
+			env:  map[string]string{"UNRESOLVED_MEDIA_OUTPUT": "unresolved.txt"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.UnresolvedMediaPath != "unresolved.txt" {
+					t.Errorf("got unresolved media path %q", cfg.UnresolvedMediaPath)
+				}
+			},
+		},
+		{
+			name: "embed source HTML",
+			env:  map[string]string{"EMBED_SOURCE_HTML": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !cfg.EmbedSourceHTML {
+					t.Error("source HTML not embedded")
+				}
+			},
+		},
+		{
+			name: "apply wpautop",
+			env:  map[string]string{"APPLY_WPAUTOP": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !cfg.ApplyWpautop {
+					t.Error("wpautop not applied")
+				}
+			},
+		},
+		{
+			name: "normalize filenames",
+			env:  map[string]string{"NORMALIZE_FILENAMES": "1"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if !cfg.NormalizeFilenames {
+					t.Error("filenames not normalized")
+				}
+			},
+		},
+		{
+			name: "markdown style",
+			env:  map[string]string{"HEADING_STYLE": "setext", "EMPHASIS_DELIMITER": "*", "BULLET_CHAR": "+"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.Convert.HeadingStyle != "setext" || cfg.Convert.EmphasisDelimiter != "*" || cfg.Convert.BulletChar != "+" {
+					t.Errorf("got heading style %q, emphasis %q, bullet %q", cfg.Convert.HeadingStyle, cfg.Convert.EmphasisDelimiter, cfg.Convert.BulletChar)
+				}
+			},
+		},
+		{
+			name: "internal link prefix",
+			env:  map[string]string{"INTERNAL_LINK_PREFIX": "/blog"},
+			check: func(t *testing.T, cfg wptomdx.Config) {
+				if cfg.Convert.InternalLinkPrefix != "/blog" {
+					t.Errorf("got internal link prefix %q", cfg.Convert.InternalLinkPrefix)
+				}
+			},
+		},
+		{name: "negative limit", env: map[string]string{"LIMIT": "-1"}, wantErr: true},
+		{name: "invalid blog id", env: map[string]string{"BLOG_ID": "main"}, wantErr: true},
+		{name: "negative retries", env: map[string]string{"API_RETRIES": "-1"}, wantErr: true},
+		{name: "invalid backoff", env: map[string]string{"API_RETRY_BACKOFF": "soon"}, wantErr: true},
+		{name: "invalid filter mode", env: map[string]string{"TAXONOMY_FILTER_MODE": "xor"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := configFromEnv(wptomdx.DefaultConfig())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+// testConfig returns a valid configuration writing into a temporary directory
+func testConfig(t *testing.T) wptomdx.Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := wptomdx.DefaultConfig()
+	cfg.BaseURL = "https://example.com"
+	cfg.APIBase = "https://example.com/wp-json/wp/v2"
+	cfg.DBHost, cfg.DBUser, cfg.DBName = "localhost", "wp", "wordpress"
+	cfg.PostsOutputDir = filepath.Join(dir, "posts")
+	cfg.PagesOutputDir = filepath.Join(dir, "pages")
+	cfg.HTMLOutputDir = filepath.Join(dir, "html")
+	cfg.MediaOutputDir = filepath.Join(dir, "media")
+	return cfg
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	const file = "wp_base_url: https://file.example.com/\nposts_output_dir: file-posts\npages_output_dir: file-pages\nwindow:\n  limit: 10\n"
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base, err := wptomdx.LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment overrides the file and -set overrides both
+	t.Setenv("POSTS_OUTPUT_DIR", "env-posts")
+	t.Setenv("PAGES_OUTPUT_DIR", "env-pages")
+	cfg, err := configFromEnv(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := settingFlags{"pages_output_dir=set-pages", "window.limit=20"}
+	if err := settings.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// A base URL set last is normalized too
+	withBaseURL := cfg
+	if err := (settingFlags{"wp_base_url=https://set.example.com/"}).apply(&withBaseURL); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting string
+		got     interface{}
+		want    interface{}
+	}{
+		{"wp_base_url", cfg.BaseURL, "https://file.example.com"},
+		{"posts_output_dir", cfg.PostsOutputDir, "env-posts"},
+		{"pages_output_dir", cfg.PagesOutputDir, "set-pages"},
+		{"window.limit", cfg.Window.Limit, 20},
+		{"media_output_dir", cfg.MediaOutputDir, wptomdx.DefaultConfig().MediaOutputDir},
+		{"wp_base_url set with a trailing slash", withBaseURL.BaseURL, "https://set.example.com"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSettingFlags(t *testing.T) {
+	var settings settingFlags
+	if err := settings.Set("convert.list_indent=4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.Set("list_indent"); err == nil {
+		t.Error("Set() error = nil, want one for a setting without a value")
+	}
+	if err := (settingFlags{"convert.list_indnt=4"}).apply(&wptomdx.Config{}); err == nil {
+		t.Error("apply() error = nil, want one for an unknown key")
+	}
+	cfg := wptomdx.DefaultConfig()
+	if err := settings.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Convert.ListIndent != 4 {
+		t.Errorf("list indent = %d, want 4", cfg.Convert.ListIndent)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(t *testing.T, cfg *wptomdx.Config)
+		wxrPath   string
+		wantErr   string
+	}{
+		{name: "valid"},
+		{
+			name:      "missing scheme",
+			configure: func(t *testing.T, cfg *wptomdx.Config) { cfg.BaseURL = "example.com" },
+			wantErr:   "WP_BASE_URL",
+		},
+		{
+			name:      "relative API base",
+			configure: func(t *testing.T, cfg *wptomdx.Config) { cfg.APIBase = "/wp-json/wp/v2" },
+			wantErr:   "WP_API_BASE",
+		},
+		{
+			name:      "missing database",
+			configure: func(t *testing.T, cfg *wptomdx.Config) { cfg.DBHost = "" },
+			wantErr:   "DB_HOST",
+		},
+		{
+			name:      "export without database",
+			configure: func(t *testing.T, cfg *wptomdx.Config) { cfg.DBHost, cfg.DBUser, cfg.DBName = "", "", "" },
+			wxrPath:   "export.xml",
+		},
+		{
+			name: "unwritable dir",
+			configure: func(t *testing.T, cfg *wptomdx.Config) {
+				// A directory can't be created below a file, whoever runs the test
+				file := filepath.Join(t.TempDir(), "file")
+				if err := os.WriteFile(file, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				cfg.MediaOutputDir = filepath.Join(file, "media")
+			},
+			wantErr: "output directory",
+		},
+		{
+			name:      "invalid setting",
+			configure: func(t *testing.T, cfg *wptomdx.Config) { cfg.OutputExtension = ".txt" },
+			wantErr:   "output extension",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.configure != nil {
+				tt.configure(t, &cfg)
+			}
+			err := validateConfig(cfg, tt.wxrPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateConfig() error = %v", err)
+				}
+				if _, err := os.Stat(cfg.PostsOutputDir); err != nil {
+					t.Errorf("output directory not created: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateConfig() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
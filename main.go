@@ -1,387 +1,449 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
+
+	"wptomd/wptomdx"
 )
 
-func ProcessContent(content []Post, outputDir string, htmlOutputDir string, wpAPIBase string, isPage bool, db *sqlx.DB) []string {
-	var mediaUrls []string
+func main() {
+	wxrPath := flag.String("wxr", "", "Read posts and pages from a WordPress XML (WXR) export instead of the database")
+	failOnMediaError := flag.Bool("fail-on-media-error", false, "Exit with an error status when any media file fails to download")
+	prune := flag.Bool("prune", false, "Delete files in the output directories that this run didn't generate")
+	reportOrphans := flag.Bool("report-orphans", false, "List files in the output directories that this run didn't generate")
+	validateMDX := flag.Bool("validate-mdx", false, "Check the generated MDX files for likely syntax errors and exit with an error status if any are found")
+	clean := flag.Bool("clean", false, "Remove the contents of the output directories before converting")
+	configPath := flag.String("config", "", "Read the settings from a YAML file; environment variables override it")
+	var settings settingFlags
+	flag.Var(&settings, "set", "Change a setting, named by its config file key, over the config file and environment, e.g. -set convert.list_indent=4; repeatable")
+	verifyMedia := flag.Bool("verify-media", false, "Check downloaded media against the checksums in the manifest instead of converting")
+	flag.Parse()
 
-	for _, item := range content {
-		// Get the full URL from WordPress API just before creating the file
-		var fullURL string
-		var urlErr error
-		if isPage {
-			fullURL, urlErr = GetPageURL(wpAPIBase, item.ID)
-		} else {
-			fullURL, urlErr = GetPostURL(wpAPIBase, item.ID)
-		}
-		if urlErr != nil {
-			log.Printf("Warning: Could not get URL for %d: %v", item.ID, urlErr)
-			continue
+	// Load variables from .env file into the environment
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found; using environment variables")
+	}
+
+	base := wptomdx.DefaultConfig()
+	if *configPath != "" {
+		var err error
+		if base, err = wptomdx.LoadConfigFile(*configPath); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
 		}
+	}
+	cfg, err := configFromEnv(base)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := settings.apply(&cfg); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-		// Extract the path from the URL
-		u, parseErr := url.Parse(fullURL)
-		if parseErr != nil {
-			log.Printf("Warning: Could not parse URL %s: %v", fullURL, parseErr)
-			continue
+	// Verify an earlier run's media and stop; this needs no database
+	if *verifyMedia {
+		entries, err := wptomdx.ReadManifest(cfg.ManifestPath)
+		if err != nil {
+			log.Fatalf("Failed to verify media: %v", err)
 		}
-		path := strings.TrimPrefix(u.Path, "/")
-		if path == "" {
-			path = "index"
+		failures := wptomdx.VerifyMedia(entries, cfg.BaseURL, cfg.MediaOutputDir)
+		if len(failures) > 0 {
+			fmt.Print(wptomdx.MediaFailureReport("Corrupt media", failures))
+			os.Exit(1)
 		}
-		// Remove any trailing slash from the path
-		path = strings.TrimSuffix(path, "/")
-
-		inputHtml := item.Content
-
-		// Create HTML file path
-		htmlFilePath := fmt.Sprintf("%s/%s.html", htmlOutputDir, path)
+		log.Printf("All recorded media matches its checksum")
+		return
+	}
 
-		// Create the directory path if it doesn't exist
-		dirPath := filepath.Dir(htmlFilePath)
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			log.Printf("Failed to create directory %s: %v", dirPath, err)
-			continue
-		}
+	if err := validateConfig(cfg, *wxrPath); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	// Media only referenced by skipped items isn't known, so it would be pruned
+	if *prune && cfg.Resume {
+		log.Fatalf("Invalid configuration: --prune can't be combined with RESUME")
+	}
 
-		// Write HTML file
-		if err := os.WriteFile(htmlFilePath, []byte(inputHtml), 0644); err != nil {
-			log.Printf("WriteFile error for HTML %s: %v", htmlFilePath, err)
-			continue
+	// Start from empty output directories so renamed items leave nothing behind
+	if *clean {
+		if err := wptomdx.CleanOutputDirs([]string{cfg.PostsOutputDir, cfg.PagesOutputDir, cfg.HTMLOutputDir, cfg.MediaOutputDir}); err != nil {
+			log.Fatalf("Failed to clean output directories: %v", err)
 		}
+	}
 
-		// Convert HTML to Markdown
-		markdown, htmlMediaUrls, err := ConvertHTMLToMarkdown(inputHtml)
+	// Time each phase of the run
+	metrics := &wptomdx.Metrics{}
+	runStart := time.Now()
+
+	// Read posts and pages from a WXR export or the database
+	var posts, pages []wptomdx.Post
+	var attachments wptomdx.AttachmentResolver
+	var stream func(fn func(wptomdx.Post, bool)) error
+	var postSlugs map[string]bool
+	var authors []wptomdx.Author
+	if *wxrPath != "" {
+		export, err := wptomdx.ParseWXRFile(*wxrPath)
 		if err != nil {
-			log.Printf("Warning: Failed to convert %d to markdown: %v", item.ID, err)
-			continue
+			log.Fatalf("Failed to read WXR export: %v", err)
 		}
-		mediaUrls = append(mediaUrls, htmlMediaUrls...)
-
-		markdown, ppMediaUrls := PostProcessMarkdownLines(markdown, db)
-		mediaUrls = append(mediaUrls, ppMediaUrls...)
-
-		item.Content = markdown
-
-		// Add featured image to imageURLs if it exists
-		if item.FeaturedImage != "" {
-			mediaUrls = append(mediaUrls, item.FeaturedImage)
+		posts, pages = cfg.Window.Apply(cfg.Taxonomy.Apply(export.Posts)), cfg.Window.Apply(export.Pages)
+		attachments = export
+		authors = export.Authors
+	} else {
+		// Connect to database
+		db, err := wptomdx.ConnectDB(cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
 		}
+		defer db.Close()
 
-		// Create markdown file path
-		filePath := fmt.Sprintf("%s/%s.mdx", outputDir, path)
-
-		// Parse dates
-		publishDate, dateErr := ParseWordPressDate(item.PublishedDate)
-		if dateErr != nil {
-			log.Printf("Warning: Could not parse publish date '%s': %v", item.PublishedDate, dateErr)
-			publishDate = time.Now() // fallback to current time
+		// Multisite blogs have their own tables but share the users tables
+		tables := wptomdx.Tables{
+			Prefix:      wptomdx.TablePrefix(cfg.TablePrefix, cfg.BlogID),
+			UsersPrefix: cfg.TablePrefix,
 		}
-
-		updatedDate, updateErr := ParseWordPressDate(item.UpdatedDate)
-		if updateErr != nil {
-			log.Printf("Warning: Could not parse update date '%s': %v", item.UpdatedDate, updateErr)
-			// If we can't parse the updated date, we'll omit it from the frontmatter
+		opts := wptomdx.LoadOptions{
+			Tables:   tables,
+			Window:   cfg.Window,
+			Taxonomy: cfg.Taxonomy,
+			MetaKeys: append(cfg.FieldMapping.MetaKeys(), cfg.Series.MetaKeys()...),
+			Comments: cfg.IncludeComments == "export",
 		}
-
-		// Generate frontmatter
-		frontmatter := GenerateFrontmatter(item, publishDate, updatedDate)
-
-		// Create markdown content with frontmatter
-		markdownWithFrontmatter := frontmatter + item.Content
-
-		dir := filepath.Dir(filePath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Printf("MkdirAll error for %s: %v", dir, err)
-			continue
+		// Large sites are read while they're processed rather than up front,
+		// with only the slugs of the posts, for internal links, read first
+		if cfg.StreamPosts {
+			stream = func(fn func(wptomdx.Post, bool)) error {
+				return wptomdx.StreamFromDatabase(db, opts, fn)
+			}
+			if postSlugs, err = wptomdx.FetchPostSlugs(db, tables, cfg.Window, cfg.Taxonomy); err != nil {
+				log.Fatalf("Failed to load post slugs from database: %v", err)
+			}
+		} else if posts, pages, err = wptomdx.LoadFromDatabase(db, opts); err != nil {
+			log.Fatalf("Failed to load content from database: %v", err)
 		}
+		attachments = wptomdx.DBAttachments{DB: db, Tables: tables}
 
-		// Write the markdown file
-		if err := os.WriteFile(filePath, []byte(markdownWithFrontmatter), 0644); err != nil {
-			log.Printf("WriteFile error for %s: %v", filePath, err)
-			continue
-		} else {
-			log.Printf("Wrote file: %s", filePath)
+		if cfg.ExportAuthors {
+			if authors, err = wptomdx.FetchAuthors(db, tables); err != nil {
+				log.Fatalf("Failed to load authors: %v", err)
+			}
 		}
-
-		// Print item information
-		contentLen := min(len(item.Content), 20)
-		fmt.Printf(
-			"Title: %s\nDate: %s\nTags: %s\nURL: %s\nHTML File: %s\nMarkdown File: %s\nFeatured Image: %s\nContent snippet: %.60s...\n\n",
-			item.Title,
-			item.PublishedDate,
-			strings.Join(item.Tags, ", "),
-			fullURL,
-			htmlFilePath,
-			filePath,
-			item.FeaturedImage,
-			item.Content[:contentLen],
-		)
-	}
-
-	return mediaUrls
-}
-
-func DownloadImage(src string, baseURL string, outputDir string) error {
-	// Strip the base URL to get the path
-	path := strings.TrimPrefix(src, baseURL)
-	
-	// Create the full output path
-	outputPath := filepath.Join(outputDir, path)
-	
-	// Create directories
-	dir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory %s: %v", dir, err)
 	}
-	
-	// Download the file
-	resp, err := http.Get(src)
-	if err != nil {
-		return fmt.Errorf("failed to download %s: %v", src, err)
-	}
-	defer resp.Body.Close()
-	
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
-	
-	// Create the file
-	out, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", outputPath, err)
-	}
-	defer out.Close()
-	
-	// Write the file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write file %s: %v", outputPath, err)
+	authorSlugs := make(map[int]string)
+	if cfg.ExportAuthors {
+		authorSlugs = wptomdx.AuthorSlugs(authors)
+		if err := wptomdx.WriteAuthors(cfg.AuthorsPath, authors); err != nil {
+			log.Fatalf("Failed to write authors: %v", err)
+		}
+		log.Printf("Wrote authors: %s", cfg.AuthorsPath)
 	}
-	
-	return nil
-}
+	metrics.Phase("fetch", runStart)
 
-func main() {
-	// Load variables from .env file into the environment
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found; using environment variables")
-	}
+	// Set up concurrency limiting
+	nCPU := runtime.NumCPU()
+	sem := make(chan struct{}, nCPU)
+	var wg sync.WaitGroup
 
-	// Read connection parameters from environment
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	postsOutputDir := os.Getenv("POSTS_OUTPUT_DIR")
-	pagesOutputDir := os.Getenv("PAGES_OUTPUT_DIR")
-	htmlOutputDir := os.Getenv("OUTPUT_HTML_DIR")
-	wpAPIBase := os.Getenv("WP_API_BASE")
-
-	// Default values if not set
-	if postsOutputDir == "" {
-		postsOutputDir = "./output-posts"
+	// The converter is shared by all workers so output paths stay unique
+	converter := wptomdx.NewConverter(cfg)
+	converter.Attachments = attachments
+	if stream == nil {
+		postSlugs = wptomdx.PostSlugs(posts)
 	}
-	if pagesOutputDir == "" {
-		pagesOutputDir = "./output-pages"
+	converter.PostSlugs = postSlugs
+
+	// Stop early when the API is down instead of failing every lookup. With a
+	// strategy to fall back on, an unreachable API is given up on instead of
+	// stopping the run. The API is never asked when it isn't in the order.
+	api := wptomdx.APIClient{Base: cfg.APIBase, Retry: cfg.APIRetry}
+	apiMonitor := &wptomdx.APIMonitor{Threshold: cfg.APIFailureThreshold}
+	var apiFallbacks []string
+	urlOrder := cfg.URLResolutionOrder()
+	if i := slices.Index(urlOrder, wptomdx.ResolveFromAPI); i >= 0 {
+		apiFallbacks = urlOrder[i+1:]
 	}
-	if htmlOutputDir == "" {
-		htmlOutputDir = "./output-html"
-	}
-	if wpAPIBase == "" {
-		wpAPIBase = "http://localhost:8082/wp-json/wp/v2"
-	}
-
-	// Create output directories if they don't exist
-	for _, dir := range []string{postsOutputDir, pagesOutputDir, htmlOutputDir} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Fatalf("Failed to create output directory %s: %v", dir, err)
+	var apiWarning sync.Once
+	converter.LookupURL = func(id int, isPage bool) (string, error) {
+		if apiMonitor.Unreachable() {
+			return "", fmt.Errorf("WordPress API unreachable at %s", cfg.APIBase)
 		}
+		getURL := api.PostURL
+		if isPage {
+			getURL = api.PageURL
+		}
+		url, err := getURL(id)
+		if apiMonitor.Observe(err) {
+			if len(apiFallbacks) == 0 {
+				log.Fatalf("WordPress API unreachable at %s: %v", cfg.APIBase, err)
+			}
+			apiWarning.Do(func() {
+				log.Printf("Warning: WordPress API unreachable at %s; falling back to %s", cfg.APIBase, strings.Join(apiFallbacks, ", "))
+			})
+		}
+		return url, err
 	}
 
-	// Connect to database
-	db, err := ConnectDB(host, port, user, password, dbName)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-	defer db.Close()
+	// Channel to collect manifest entries from each goroutine
+	entryCh := make(chan []wptomdx.ManifestEntry, max(len(posts)+len(pages), nCPU))
 
-	// Fetch posts and pages
-	posts, err := FetchPosts(db)
-	if err != nil {
-		log.Fatalf("Failed to fetch posts: %v", err)
-	}
-	pages, err := FetchPages(db)
+	downloader, err := wptomdx.NewDownloader(cfg)
 	if err != nil {
-		log.Fatalf("Failed to fetch pages: %v", err)
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-
-	// Set up concurrency limiting
-	nCPU := runtime.NumCPU()
-	sem := make(chan struct{}, nCPU)
-	var wg sync.WaitGroup
-
-	// Channel to collect image-URL slices from each goroutine
-	imageCh := make(chan []string, len(posts)+len(pages))
-
-	// Process each post end-to-end in parallel
-	for i := range posts {
-		p := &posts[i]
-		wg.Add(1)
-		sem <- struct{}{}
-
-		go func(p *Post) {
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			// Enrich metadata
-			if tags, err := FetchPostTags(db, p.ID); err != nil {
-				log.Printf("Warning fetching tags for post %d: %v", p.ID, err)
-			} else {
-				p.Tags = tags
+	downloader.Metrics = metrics
+	converter.Downloader = downloader
+
+	// Download media as soon as processed items reference it
+	var entries []wptomdx.ManifestEntry
+	var downloaded map[wptomdx.MediaTarget]bool
+	var resultsMu sync.Mutex
+	var failures []wptomdx.MediaFailure
+	checksums := make(map[wptomdx.MediaTarget]string)
+	mediaDone := make(chan struct{})
+	go func() {
+		defer close(mediaDone)
+		entries, downloaded = wptomdx.StreamMedia(entryCh, nCPU, func(i int, target wptomdx.MediaTarget) bool {
+			// Skip if not from our WordPress site
+			if wptomdx.LocalMediaPath(target.URL, cfg.BaseURL, cfg.MediaHosts) == "" {
+				log.Printf("Skipping external URL: %s", target.URL)
+				metrics.Update(func(run *wptomdx.RunMetrics) { run.MediaSkipped++ })
+				return false
 			}
-			if cats, err := FetchPostCategories(db, p.ID); err != nil {
-				log.Printf("Warning fetching categories for post %d: %v", p.ID, err)
-			} else {
-				p.Categories = cats
-			}
-			if img, err := FetchFeaturedImage(db, p.ID); err != nil {
-				log.Printf("Warning fetching featured image for post %d: %v", p.ID, err)
+			log.Printf("Downloading image %d: %s", i, target.URL)
+
+			// Colocated media goes next to its post, everything else to the media dir
+			var checksum string
+			var err error
+			if target.LocalPath != "" {
+				checksum, err = downloader.DownloadFile(wptomdx.AbsoluteMediaURL(target.URL, cfg.BaseURL), target.LocalPath)
 			} else {
-				p.FeaturedImage = img
+				checksum, err = downloader.DownloadImage(target.URL, cfg.BaseURL, cfg.MediaOutputDir)
 			}
-			// Merge categories into tags
-			p.Tags = append(p.Tags, p.Categories...)
-			if url, err := GetPostURL(wpAPIBase, p.ID); err != nil {
-				log.Printf("Warning getting URL for post %d: %v", p.ID, err)
-			} else {
-				p.URL = url
+			resultsMu.Lock()
+			defer resultsMu.Unlock()
+			if err != nil {
+				log.Printf("Failed to download image %d (%s): %v", i, target.URL, err)
+				failures = append(failures, wptomdx.MediaFailure{URL: target.URL, Err: err})
+				metrics.Update(func(run *wptomdx.RunMetrics) { run.MediaFailed++ })
+				return false
 			}
-
-			// Process content and collect images for this post
-			urls := ProcessContent([]Post{*p}, postsOutputDir, htmlOutputDir, wpAPIBase, false, db)
-			imageCh <- urls
-		}(p)
-	}
-
-	// Process each page end-to-end in parallel
-	for i := range pages {
-		p := &pages[i]
+			log.Printf("Downloaded image %d: %s", i, target.URL)
+			checksums[target] = checksum
+			metrics.Update(func(run *wptomdx.RunMetrics) { run.MediaDownloaded++ })
+			return true
+		})
+	}()
+
+	// Process each post and page end-to-end in parallel
+	convertStart := time.Now()
+	var streamedMu sync.Mutex
+	var streamed []*wptomdx.Post
+	process := func(p *wptomdx.Post, isPage bool) {
 		wg.Add(1)
 		sem <- struct{}{}
 
-		go func(p *Post) {
+		go func() {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			// Enrich metadata
-			if tags, err := FetchPostTags(db, p.ID); err != nil {
-				log.Printf("Warning fetching tags for page %d: %v", p.ID, err)
-			} else {
-				p.Tags = tags
-			}
-			if cats, err := FetchPostCategories(db, p.ID); err != nil {
-				log.Printf("Warning fetching categories for page %d: %v", p.ID, err)
-			} else {
-				p.Categories = cats
+			kind := "post"
+			if isPage {
+				kind = "page"
 			}
-			if img, err := FetchFeaturedImage(db, p.ID); err != nil {
-				log.Printf("Warning fetching featured image for page %d: %v", p.ID, err)
-			} else {
-				p.FeaturedImage = img
-			}
-			// Merge categories into tags
+
+			p.Author = authorSlugs[p.AuthorID]
+
+			// Rename terms for the new site, then merge categories into tags
+			p.Categories, p.Tags = cfg.TaxonomyRename.Apply(p.Categories), cfg.TaxonomyRename.Apply(p.Tags)
 			p.Tags = append(p.Tags, p.Categories...)
-			if url, err := GetPageURL(wpAPIBase, p.ID); err != nil {
-				log.Printf("Warning getting URL for page %d: %v", p.ID, err)
-			} else {
+			// The URL is already known when reading from an export, and is
+			// otherwise found through the configured strategies. Items without
+			// one are skipped.
+			if p.URL == "" {
+				url, err := converter.ResolveURL(*p, isPage)
+				if err != nil {
+					log.Printf("Warning getting URL for %s %d: %v", kind, p.ID, err)
+					return
+				}
 				p.URL = url
 			}
 
-			// Process content and collect images for this page
-			urls := ProcessContent([]Post{*p}, pagesOutputDir, htmlOutputDir, wpAPIBase, true, db)
-			imageCh <- urls
-		}(p)
+			// Process content and collect the manifest entry for this item
+			entryCh <- converter.ProcessContent([]wptomdx.Post{*p}, isPage)
+			metrics.Update(func(run *wptomdx.RunMetrics) {
+				if isPage {
+					run.Pages++
+				} else {
+					run.Posts++
+				}
+			})
+
+			// Streamed posts are kept for the category indexes, without their content
+			if stream != nil && !isPage {
+				p.Content = ""
+				streamedMu.Lock()
+				streamed = append(streamed, p)
+				streamedMu.Unlock()
+			}
+		}()
+	}
+
+	if stream != nil {
+		// Streamed series can only be numbered by their order meta key
+		if err := stream(func(p wptomdx.Post, isPage bool) {
+			cfg.Series.Read(&p)
+			process(&p, isPage)
+		}); err != nil {
+			log.Fatalf("Failed to load content from database: %v", err)
+		}
+	} else {
+		cfg.Series.Apply(posts)
+		for i := range posts {
+			process(&posts[i], false)
+		}
+		for i := range pages {
+			process(&pages[i], true)
+		}
 	}
 
 	// Wait for all to finish, then close channel
 	wg.Wait()
-	close(imageCh)
+	close(entryCh)
+	metrics.Phase("convert", convertStart)
+	for _, p := range streamed {
+		posts = append(posts, *p)
+	}
+
+	// Wait for the remaining downloads
+	downloadStart := time.Now()
+	<-mediaDone
+	metrics.Phase("download", downloadStart)
 
-	// Combine and print all image URLs
-	var mediaUrls []string
-	for urls := range imageCh {
-		mediaUrls = append(mediaUrls, urls...)
+	// Section indexes list the posts of every category
+	if cfg.CategoryIndexes {
+		if err := converter.WriteCategoryIndexes(posts); err != nil {
+			log.Fatalf("Failed to write category indexes: %v", err)
+		}
 	}
 
-	fmt.Println("Images to download:")
-	for i, src := range mediaUrls {
-		fmt.Println(i, src)
+	// The combined JSON output holds every post and page in one file
+	if cfg.JSONOutput == "combined" {
+		if err := wptomdx.WriteJSONPosts(cfg.JSONOutputPath, entries); err != nil {
+			log.Fatalf("Failed to write JSON output: %v", err)
+		}
+		log.Printf("Wrote JSON output: %s", cfg.JSONOutputPath)
 	}
-	
-	// Get the media output directory
-	mediaOutputDir := os.Getenv("MEDIA_OUTPUT_DIR")
-	if mediaOutputDir == "" {
-		mediaOutputDir = "./output-media"
+
+	// Write the manifest describing every processed post and page
+	wptomdx.MarkDownloaded(entries, downloaded)
+	if cfg.MediaChecksums {
+		wptomdx.RecordChecksums(entries, checksums)
 	}
-	wpBaseURL := os.Getenv("WP_BASE_URL")
-	if wpBaseURL == "" {
-		log.Println("WP_BASE_URL not set, using default")
-		wpBaseURL = "http://localhost:8082"
+	if err := wptomdx.WriteManifest(cfg.ManifestPath, entries); err != nil {
+		log.Fatalf("Failed to write manifest: %v", err)
 	}
-
-	// Create the output directory
-	if err := os.MkdirAll(mediaOutputDir, 0755); err != nil {
-		log.Fatalf("Failed to create media output directory %s: %v", mediaOutputDir, err)
+	log.Printf("Wrote manifest: %s", cfg.ManifestPath)
+
+	// Find files earlier runs left for items that are gone or were renamed
+	if *prune || *reportOrphans {
+		outputs := converter.Outputs()
+		for _, entry := range entries {
+			for _, m := range entry.Media {
+				if wptomdx.LocalMediaPath(m.URL, cfg.BaseURL, cfg.MediaHosts) != "" {
+					outputs = append(outputs, m.OutputPath(cfg.BaseURL, cfg.MediaOutputDir))
+				}
+			}
+		}
+		orphans, err := wptomdx.FindOrphans([]string{cfg.PostsOutputDir, cfg.PagesOutputDir, cfg.HTMLOutputDir, cfg.MediaOutputDir}, outputs)
+		if err != nil {
+			log.Fatalf("Failed to look for orphaned files: %v", err)
+		}
+		for _, orphan := range orphans {
+			if !*prune {
+				log.Printf("Orphaned file: %s", orphan)
+			} else if err := os.Remove(orphan); err != nil {
+				log.Printf("Warning: failed to remove orphaned file %s: %v", orphan, err)
+			} else {
+				log.Printf("Removed orphaned file: %s", orphan)
+			}
+		}
+		log.Printf("Found %d orphaned files", len(orphans))
 	}
 
-	// Set up concurrency limiting for downloads
-	dlSem := make(chan struct{}, nCPU)
-	var dlWg sync.WaitGroup
+	// Point out content the MDX compiler is likely to reject
+	invalidMDX := 0
+	if *validateMDX {
+		for _, entry := range entries {
+			if filepath.Ext(entry.MDXPath) != ".mdx" {
+				continue
+			}
+			content, err := os.ReadFile(entry.MDXPath)
+			if err != nil {
+				log.Printf("Warning: failed to validate %s: %v", entry.MDXPath, err)
+				continue
+			}
+			issues := wptomdx.ValidateMDX(string(content))
+			for _, issue := range issues {
+				fmt.Printf("%s:%s\n", entry.MDXPath, issue)
+			}
+			if len(issues) > 0 {
+				invalidMDX++
+			}
+		}
+		log.Printf("Found likely MDX errors in %d files", invalidMDX)
+	}
 
-	// Download images in parallel
-	for i, src := range mediaUrls {
-		// Skip if not from our WordPress site
-		if !strings.HasPrefix(src, wpBaseURL) {
-			log.Printf("Skipping external URL: %s", src)
-			continue
+	// Report how long the run took and what it did
+	metrics.Phase("total", runStart)
+	run := metrics.Snapshot()
+	fmt.Print("\n" + run.Summary())
+	if cfg.MetricsPath != "" {
+		if err := wptomdx.WriteMetrics(cfg.MetricsPath, run); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			log.Printf("Wrote metrics: %s", cfg.MetricsPath)
 		}
-		
-		// Download in parallel
-		dlWg.Add(1)
-		dlSem <- struct{}{}
-		
-		go func(src string, i int) {
-			defer dlWg.Done()
-			defer func() { <-dlSem }()
-			
-			err := DownloadImage(src, wpBaseURL, mediaOutputDir)
-			if err != nil {
-				log.Printf("Failed to download image %d (%s): %v", i, src, err)
+	}
+
+	// List the files that reference media missing from the output, so they
+	// can be fixed before deploying
+	if unresolved := wptomdx.FindUnresolvedMedia(entries, cfg.BaseURL, cfg.MediaHosts); len(unresolved) > 0 {
+		report := wptomdx.UnresolvedMediaReport(unresolved)
+		fmt.Print("\n" + report)
+		if cfg.UnresolvedMediaPath != "" {
+			if err := os.WriteFile(cfg.UnresolvedMediaPath, []byte(report), 0644); err != nil {
+				log.Printf("Warning: failed to write unresolved media: %v", err)
 			} else {
-				log.Printf("Downloaded image %d: %s", i, src)
+				log.Printf("Wrote unresolved media: %s", cfg.UnresolvedMediaPath)
 			}
-		}(src, i)
+		}
 	}
 
-	// Wait for all downloads to complete
-	dlWg.Wait()
+	// Summarize the media that is missing from the output
+	if len(failures) > 0 {
+		report := wptomdx.MediaFailureReport("Failed media", failures)
+		fmt.Print("\n" + report)
+		if cfg.MediaFailuresPath != "" {
+			if err := os.WriteFile(cfg.MediaFailuresPath, []byte(report), 0644); err != nil {
+				log.Printf("Warning: failed to write media failures: %v", err)
+			} else {
+				log.Printf("Wrote media failures: %s", cfg.MediaFailuresPath)
+			}
+		}
+		if *failOnMediaError {
+			os.Exit(1)
+		}
+	}
+	if invalidMDX > 0 {
+		os.Exit(1)
+	}
 }
@@ -17,6 +17,8 @@ import (
     "github.com/gocolly/colly/v2"
     "github.com/joho/godotenv"
     "golang.org/x/net/html"
+
+    "wptomd/wptomdx"
 )
 
 type BadLink struct {
@@ -121,10 +123,8 @@ func main() {
             log.Fatalf("WP_BASE_URL environment variable is required when using --fix-media")
         }
         
-        // Ensure wpBaseURL ends with /
-        if !strings.HasSuffix(wpBaseURL, "/") {
-            wpBaseURL += "/"
-        }
+        // wp-content paths have no leading slash, so join them with exactly one
+        wpBaseURL = wptomdx.NormalizeBaseURL(wpBaseURL) + "/"
     }
 
     parsed, err := url.Parse(startURL)
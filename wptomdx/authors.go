@@ -0,0 +1,83 @@
+package wptomdx
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Author is a user who published posts or pages, as written to authors.json.
+// Posts reference their author by Slug.
+type Author struct {
+	ID     int    `db:"ID" json:"-"`
+	Slug   string `db:"slug" json:"slug"`
+	Name   string `db:"name" json:"name"`
+	Bio    string `db:"bio" json:"bio,omitempty"`
+	Email  string `db:"email" json:"-"`
+	Avatar string `db:"-" json:"avatar,omitempty"`
+}
+
+// FetchAuthors retrieves the users who authored published posts or pages,
+// with their profile description as the bio and their Gravatar as the avatar
+func FetchAuthors(db *sqlx.DB, tables Tables) ([]Author, error) {
+	query := fmt.Sprintf(`
+		SELECT u.ID, u.user_nicename AS slug, u.display_name AS name,
+		       u.user_email AS email, COALESCE(m.meta_value, '') AS bio
+		FROM %s u
+		LEFT JOIN %s m ON m.user_id = u.ID AND m.meta_key = 'description'
+		WHERE u.ID IN (
+		  SELECT post_author FROM %s
+		  WHERE post_type IN ('post', 'page') AND post_status = 'publish'
+		)
+		ORDER BY u.display_name, u.ID;
+	`, tables.usersTable("users"), tables.usersTable("usermeta"), tables.table("posts"))
+
+	var authors []Author
+	if err := db.Select(&authors, query); err != nil {
+		return nil, fmt.Errorf("error fetching authors: %v", err)
+	}
+	for i := range authors {
+		authors[i].Avatar = gravatarURL(authors[i].Email)
+	}
+	return authors, nil
+}
+
+// gravatarURL returns the Gravatar image URL WordPress shows for an email
+// address, or "" for an empty one
+func gravatarURL(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(email))
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(sum[:])
+}
+
+// AuthorSlugs maps author IDs to the slug posts reference them by
+func AuthorSlugs(authors []Author) map[int]string {
+	slugs := make(map[int]string, len(authors))
+	for _, author := range authors {
+		slugs[author.ID] = author.Slug
+	}
+	return slugs
+}
+
+// WriteAuthors writes the authors to path as a JSON array
+func WriteAuthors(path string, authors []Author) error {
+	if authors == nil {
+		authors = []Author{}
+	}
+	data, err := json.MarshalIndent(authors, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode authors: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write authors %s: %v", path, err)
+	}
+	return nil
+}
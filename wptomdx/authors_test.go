@@ -0,0 +1,138 @@
+package wptomdx
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFetchAuthors(t *testing.T) {
+	columns := []string{"ID", "slug", "name", "email", "bio"}
+	tests := []struct {
+		name       string
+		tables     Tables
+		rows       [][]driver.Value
+		err        error
+		wantTables []string
+		want       []Author
+		wantErr    bool
+	}{
+		{
+			name: "authors",
+			rows: [][]driver.Value{
+				{int64(1), "ana", "Ana Lima", " Ana@Example.com ", "Writes about Go."},
+				{int64(2), "bo", "Bo", "", ""},
+			},
+			wantTables: []string{"wp_users", "wp_usermeta", "wp_posts"},
+			want: []Author{
+				{ID: 1, Slug: "ana", Name: "Ana Lima", Email: " Ana@Example.com ", Bio: "Writes about Go.", Avatar: "https://www.gravatar.com/avatar/cdb9d6a1dddc375a09cc83e3001598dc"},
+				{ID: 2, Slug: "bo", Name: "Bo"},
+			},
+		},
+		{
+			name:       "multisite blog",
+			tables:     Tables{Prefix: "wp_3_", UsersPrefix: "wp_"},
+			wantTables: []string{"wp_users", "wp_usermeta", "wp_3_posts"},
+		},
+		{name: "query error", err: errors.New("no such table"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(fakeResult{match: "user_nicename", columns: columns, rows: tt.rows, err: tt.err})
+			authors, err := FetchAuthors(db, tt.tables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchAuthors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(authors, tt.want) && len(authors)+len(tt.want) > 0 {
+				t.Errorf("FetchAuthors() = %+v, want %+v", authors, tt.want)
+			}
+			var words []string
+			for _, query := range fake.sent("user_nicename") {
+				words = append(words, strings.Fields(query)...)
+			}
+			for _, table := range tt.wantTables {
+				if !slices.Contains(words, table) {
+					t.Errorf("%s isn't queried", table)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteAuthors(t *testing.T) {
+	tests := []struct {
+		name    string
+		authors []Author
+		want    string
+	}{
+		{"none", nil, "[]"},
+		{
+			name: "authors",
+			authors: []Author{
+				{ID: 1, Slug: "ana", Name: "Ana Lima", Email: "ana@example.com", Bio: "Writes about Go.", Avatar: "https://www.gravatar.com/avatar/cdb9d6a1dddc375a09cc83e3001598dc"},
+				{ID: 2, Slug: "bo", Name: "Bo"},
+			},
+			want: `[
+  {
+    "slug": "ana",
+    "name": "Ana Lima",
+    "bio": "Writes about Go.",
+    "avatar": "https://www.gravatar.com/avatar/cdb9d6a1dddc375a09cc83e3001598dc"
+  },
+  {
+    "slug": "bo",
+    "name": "Bo"
+  }
+]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "authors.json")
+			if err := WriteAuthors(path, tt.authors); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("authors.json =\n%s\nwant\n%s", data, tt.want)
+			}
+			if strings.Contains(string(data), "@") {
+				t.Error("authors.json exposes an email address")
+			}
+		})
+	}
+}
+
+func TestProcessContentAuthor(t *testing.T) {
+	slugs := AuthorSlugs([]Author{{ID: 1, Slug: "ana"}, {ID: 2, Slug: "bo"}})
+	tests := []struct {
+		name     string
+		authorID int
+		want     string
+	}{
+		{"author", 2, "bo"},
+		{"unknown author", 7, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, nil)
+			post := testPost(1, "by-author", "<p>Text</p>")
+			post.AuthorID, post.Author = tt.authorID, slugs[tt.authorID]
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "author"); got != tt.want {
+				t.Errorf("author = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package wptomdx
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter caps the combined throughput of the readers it wraps,
+// which may be read from concurrently
+type BandwidthLimiter struct {
+	bytesPerSecond int64
+	mu             sync.Mutex
+	// next is when the bytes read so far have been paid for
+	next time.Time
+}
+
+// NewBandwidthLimiter returns a limiter for bytesPerSecond, or nil, which
+// doesn't throttle, when it isn't positive
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &BandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// Reader wraps r so that reading from it counts against the limit
+func (l *BandwidthLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{r: r, limiter: l}
+}
+
+// wait sleeps until n more bytes fit in the limit
+func (l *BandwidthLimiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	until := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// limitedReader is a reader throttled by a BandwidthLimiter
+type limitedReader struct {
+	r       io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// Read at most a second's worth at a time so the throughput stays even
+	if int64(len(p)) > lr.limiter.bytesPerSecond {
+		p = p[:lr.limiter.bytesPerSecond]
+	}
+	n, err := lr.r.Read(p)
+	lr.limiter.wait(n)
+	return n, err
+}
@@ -0,0 +1,119 @@
+package wptomdx
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewBandwidthLimiter(t *testing.T) {
+	for _, limit := range []int64{0, -1} {
+		if l := NewBandwidthLimiter(limit); l != nil {
+			t.Errorf("NewBandwidthLimiter(%d) = %+v, want nil", limit, l)
+		}
+	}
+	// A nil limiter hands out the reader itself
+	r := bytes.NewReader(nil)
+	if got := (*BandwidthLimiter)(nil).Reader(r); got != r {
+		t.Errorf("nil limiter wrapped the reader")
+	}
+}
+
+func TestBandwidthLimiterThroughput(t *testing.T) {
+	const limit = 100_000
+	tests := []struct {
+		name    string
+		readers int
+		size    int
+	}{
+		{"one reader", 1, 50_000},
+		{"shared by readers", 4, 12_500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewBandwidthLimiter(limit)
+			payload := bytes.Repeat([]byte("x"), tt.size)
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			total := 0
+			start := time.Now()
+			for i := 0; i < tt.readers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n, err := io.Copy(io.Discard, l.Reader(bytes.NewReader(payload)))
+					if err != nil {
+						t.Error(err)
+					}
+					mu.Lock()
+					total += int(n)
+					mu.Unlock()
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+
+			if total != tt.readers*tt.size {
+				t.Fatalf("read %d bytes, want %d", total, tt.readers*tt.size)
+			}
+			// The bytes read are paid for as they arrive, so reading them all
+			// takes at least total/limit seconds
+			if want := time.Duration(total) * time.Second / limit; elapsed < want*9/10 {
+				t.Errorf("read %d bytes in %v, faster than %d B/s allows (%v)", total, elapsed, limit, want)
+			}
+		})
+	}
+}
+
+// chunkRecorder records the size of every read it serves
+type chunkRecorder struct {
+	r      io.Reader
+	chunks []int
+}
+
+func (c *chunkRecorder) Read(p []byte) (int, error) {
+	c.chunks = append(c.chunks, len(p))
+	return c.r.Read(p)
+}
+
+func TestBandwidthLimiterChunks(t *testing.T) {
+	const limit = 1000
+	rec := &chunkRecorder{r: bytes.NewReader(make([]byte, limit+10))}
+	buf := make([]byte, 4096)
+	r := NewBandwidthLimiter(limit).Reader(rec)
+	for {
+		if _, err := r.Read(buf); err == io.EOF {
+			break
+		}
+	}
+	for _, chunk := range rec.chunks {
+		if chunk > limit {
+			t.Errorf("read %d bytes at once, want at most a second's worth (%d)", chunk, limit)
+		}
+	}
+}
+
+func TestDownloaderBandwidth(t *testing.T) {
+	const limit, size = 50_000, 25_000
+	payload := append(append([]byte{}, jpegBytes...), make([]byte, size-len(jpegBytes))...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(payload)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	d := Downloader{Bandwidth: NewBandwidthLimiter(limit)}
+	start := time.Now()
+	if _, err := d.DownloadFile(server.URL+"/a.jpg", filepath.Join(dir, "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed, want := time.Since(start), time.Duration(size)*time.Second/limit; elapsed < want*9/10 {
+		t.Errorf("downloaded %d bytes in %v, faster than %d B/s allows (%v)", size, elapsed, limit, want)
+	}
+}
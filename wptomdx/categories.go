@@ -0,0 +1,108 @@
+package wptomdx
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// termSlug builds the slug WordPress would give a category or tag of this name
+func termSlug(name string) string {
+	return strings.Trim(permalinkSlugRe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// TaxonomyRename maps lowercased category and tag names to the term they
+// become; an empty term drops them
+type TaxonomyRename map[string]string
+
+// ParseTaxonomyRename parses "News=updates,Uncategorized=" into a
+// TaxonomyRename, matching names case-insensitively
+func ParseTaxonomyRename(raw string) TaxonomyRename {
+	rename := make(TaxonomyRename)
+	for _, pair := range strings.Split(raw, ",") {
+		name, term, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			rename[name] = strings.TrimSpace(term)
+		}
+	}
+	return rename
+}
+
+// Apply renames and drops terms, removing the duplicates that merging two
+// terms into one leaves
+func (r TaxonomyRename) Apply(terms []string) []string {
+	if len(r) == 0 {
+		return terms
+	}
+	var renamed []string
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		if to, ok := r[strings.ToLower(term)]; ok {
+			term = to
+		}
+		if term != "" && !seen[term] {
+			seen[term] = true
+			renamed = append(renamed, term)
+		}
+	}
+	return renamed
+}
+
+// WriteCategoryIndexes writes a section index file for every category of
+// posts, at <posts dir>/category/<slug>/<CategoryIndexName><ext>, holding
+// the category's title and slug as frontmatter and a list of links to its
+// posts in the order they are given. Posts without a URL are left out.
+func (c *Converter) WriteCategoryIndexes(posts []Post) error {
+	var names []string
+	members := make(map[string][]Post)
+	for _, post := range posts {
+		if post.URL == "" {
+			continue
+		}
+		for _, category := range post.Categories {
+			if _, ok := members[category]; !ok {
+				names = append(names, category)
+			}
+			members[category] = append(members[category], post)
+		}
+	}
+
+	extension := OutputExtension(c.Config.OutputExtension)
+	for _, name := range names {
+		slug := SanitizePath(termSlug(name), c.Config.TransliterateSlugs)
+		if slug == "" {
+			log.Printf("Warning: skipping index of category %q, which has no usable slug", name)
+			continue
+		}
+
+		var fm Frontmatter
+		fm.Set("title", name)
+		fm.Set("slug", slug)
+		frontmatter, err := fm.Encode(c.Config.FrontmatterFormat)
+		if err != nil {
+			return fmt.Errorf("failed to generate frontmatter for category %q: %v", name, err)
+		}
+
+		var list strings.Builder
+		for _, post := range members[name] {
+			title := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(post.Title)
+			fmt.Fprintf(&list, "- [%s](%s)\n", title, relativeURL(post.URL, c.Config.BaseURL, c.Config.MediaHosts))
+		}
+
+		filePath := filepath.Join(c.Config.PostsOutputDir, "category", slug, c.Config.CategoryIndexName+extension)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", filePath, err)
+		}
+		if err := os.WriteFile(filePath, []byte(frontmatter+list.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", filePath, err)
+		}
+		log.Printf("Wrote category index: %s", filePath)
+		c.recordOutputs(filePath)
+	}
+	return nil
+}
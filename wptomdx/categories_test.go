@@ -0,0 +1,138 @@
+package wptomdx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestWriteCategoryIndexes(t *testing.T) {
+	posts := []Post{
+		{ID: 1, Title: "First [draft]", URL: "https://example.com/first/", Categories: []string{"News"}},
+		{ID: 2, Title: "Second", URL: "https://example.com/2024/second/", Categories: []string{"News", "Café & Tips"}},
+		{ID: 3, Title: "Unresolved", Categories: []string{"News", "Empty"}},
+	}
+	tests := []struct {
+		name      string
+		indexName string
+		extension string
+		want      map[string]string
+	}{
+		{
+			name:      "section indexes",
+			indexName: "_index",
+			want: map[string]string{
+				"category/news/_index.mdx":      "---\ntitle: \"News\"\nslug: \"news\"\n---\n\n- [First \\[draft\\]](/first/)\n- [Second](/2024/second/)\n",
+				"category/café-tips/_index.mdx": "---\ntitle: \"Café & Tips\"\nslug: \"café-tips\"\n---\n\n- [Second](/2024/second/)\n",
+			},
+		},
+		{
+			name:      "index files",
+			indexName: "index",
+			extension: ".md",
+			want: map[string]string{
+				"category/news/index.md":      "---\ntitle: \"News\"\nslug: \"news\"\n---\n\n- [First \\[draft\\]](/first/)\n- [Second](/2024/second/)\n",
+				"category/café-tips/index.md": "---\ntitle: \"Café & Tips\"\nslug: \"café-tips\"\n---\n\n- [Second](/2024/second/)\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.CategoryIndexes = true
+				cfg.CategoryIndexName = tt.indexName
+				cfg.OutputExtension = tt.extension
+			})
+			if err := c.WriteCategoryIndexes(posts); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string)
+			err := filepath.WalkDir(c.Config.PostsOutputDir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				rel, _ := filepath.Rel(c.Config.PostsOutputDir, path)
+				got[filepath.ToSlash(rel)] = string(data)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A category whose posts have no URL gets no index
+			if len(got) != len(tt.want) {
+				t.Errorf("wrote %d files, want %d: %q", len(got), len(tt.want), got)
+			}
+			for path, want := range tt.want {
+				if got[path] != want {
+					t.Errorf("%s =\n%q\nwant\n%q", path, got[path], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTaxonomyRename(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want TaxonomyRename
+	}{
+		{"", TaxonomyRename{}},
+		{"News=updates", TaxonomyRename{"news": "updates"}},
+		{" News = updates , Uncategorized= ", TaxonomyRename{"news": "updates", "uncategorized": ""}},
+		{"Go=golang,invalid,=empty", TaxonomyRename{"go": "golang"}},
+	}
+	for _, tt := range tests {
+		if got := ParseTaxonomyRename(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTaxonomyRename(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestTaxonomyRenameApply(t *testing.T) {
+	rename := TaxonomyRename{"news": "updates", "uncategorized": "", "golang": "Go"}
+	tests := []struct {
+		name   string
+		rename TaxonomyRename
+		terms  []string
+		want   []string
+	}{
+		{"rename", rename, []string{"News", "Tips"}, []string{"updates", "Tips"}},
+		{"drop", rename, []string{"Uncategorized", "Tips"}, []string{"Tips"}},
+		{"drop every term", rename, []string{"Uncategorized"}, nil},
+		{"case-insensitive", rename, []string{"NEWS", "uncategorized"}, []string{"updates"}},
+		{"merged terms", rename, []string{"Go", "Golang", "news", "updates"}, []string{"Go", "updates"}},
+		{"no renames", nil, []string{"News", "News"}, []string{"News", "News"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rename.Apply(tt.terms); !slices.Equal(got, tt.want) {
+				t.Errorf("Apply(%q) = %q, want %q", tt.terms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileTaxonomyRename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("taxonomy_rename:\n  News: updates\n  \" Uncategorized\": \"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TaxonomyRename{"news": "updates", "uncategorized": ""}
+	if !reflect.DeepEqual(cfg.TaxonomyRename, want) {
+		t.Errorf("TaxonomyRename = %q, want %q", cfg.TaxonomyRename, want)
+	}
+	if got := cfg.TaxonomyRename.Apply([]string{"Uncategorized", "News"}); !slices.Equal(got, []string{"updates"}) {
+		t.Errorf("Apply() = %q, want %q", got, []string{"updates"})
+	}
+}
@@ -0,0 +1,38 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Comment is an approved comment on a post. Parent is the ID of the comment
+// it replies to, or 0.
+type Comment struct {
+	ID        int    `db:"comment_ID" json:"id"`
+	Parent    int    `db:"comment_parent" json:"parent,omitempty"`
+	Author    string `db:"comment_author" json:"author"`
+	AuthorURL string `db:"comment_author_url" json:"authorUrl,omitempty"`
+	Date      string `db:"comment_date" json:"date"`
+	Content   string `db:"comment_content" json:"content"`
+}
+
+// writeComments writes comments as a JSON array to path, with their dates as
+// ISO 8601 timestamps in the site's time zone, like WordPress stores them
+func writeComments(path string, comments []Comment) error {
+	out := make([]Comment, len(comments))
+	for i, comment := range comments {
+		if date, err := ParseWordPressDate(comment.Date); err == nil && !date.IsZero() {
+			comment.Date = date.Format("2006-01-02T15:04:05")
+		}
+		out[i] = comment
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode comments: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
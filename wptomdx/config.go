@@ -0,0 +1,367 @@
+package wptomdx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of a conversion run. It is populated once at
+// startup and handed to the Converter, so the pipeline never reads the
+// environment itself.
+type Config struct {
+	// Database connection
+	DBHost     string `yaml:"db_host"`
+	DBPort     string `yaml:"db_port"`
+	DBUser     string `yaml:"db_user"`
+	DBPassword string `yaml:"db_password"`
+	DBName     string `yaml:"db_name"`
+	// TablePrefix is the base table prefix; BlogID selects a multisite blog
+	TablePrefix string `yaml:"table_prefix"`
+	BlogID      int    `yaml:"blog_id"`
+	// Window limits the posts and pages that are processed
+	Window QueryWindow `yaml:"window"`
+	// StreamPosts processes posts and pages while they're read from the
+	// database instead of loading them all first
+	StreamPosts bool `yaml:"stream_posts"`
+	// Taxonomy restricts the posts that are processed to some categories and tags
+	Taxonomy TaxonomyFilter `yaml:"taxonomy"`
+	// Series reads the series posts belong to from their meta
+	Series SeriesOptions `yaml:"series"`
+	// TaxonomyRename renames or drops categories and tags before they reach
+	// the frontmatter
+	TaxonomyRename TaxonomyRename `yaml:"taxonomy_rename"`
+
+	// BaseURL is the WordPress site URL, used to resolve internal links and media
+	BaseURL string `yaml:"wp_base_url"`
+	// APIBase is the WordPress REST API base, used to look up permalinks
+	APIBase string `yaml:"wp_api_base"`
+	// PermalinkStructure is the site's permalink structure setting; when set,
+	// URLs are built from it instead of being looked up through the API
+	PermalinkStructure string `yaml:"permalink_structure"`
+	// PathResolutionOrder lists the ways URLs are found, tried in order until
+	// one works: "api", "slug" and "guid"; see URLResolutionOrder
+	PathResolutionOrder []string `yaml:"path_resolution_order"`
+	// APIRetry is how failed REST API requests are retried
+	APIRetry RetryPolicy `yaml:"api_retry"`
+	// APIFailureThreshold is how many lookups may fail to connect before the
+	// API counts as unreachable; 0 disables the check
+	APIFailureThreshold int `yaml:"api_unreachable_threshold"`
+
+	PostsOutputDir string `yaml:"posts_output_dir"`
+	PagesOutputDir string `yaml:"pages_output_dir"`
+	HTMLOutputDir  string `yaml:"output_html_dir"`
+	MediaOutputDir string `yaml:"media_output_dir"`
+	ManifestPath   string `yaml:"manifest_output"`
+	// JSONOutput writes JSON instead of markdown files: "files" for one per
+	// item, or "combined" for a single array at JSONOutputPath
+	JSONOutput     string `yaml:"json_output"`
+	JSONOutputPath string `yaml:"json_output_file"`
+	// SkipEmpty leaves out items whose content converts to nothing
+	SkipEmpty bool `yaml:"skip_empty"`
+	// ApplyWpautop adds the paragraphs WordPress adds to classic editor
+	// content when rendering it before converting the content
+	ApplyWpautop bool `yaml:"apply_wpautop"`
+	// EmbedSourceHTML appends the source HTML of each item to its markdown
+	// file as a comment
+	EmbedSourceHTML bool `yaml:"embed_source_html"`
+	// MediaFailuresPath is where failed downloads are listed, if set
+	MediaFailuresPath string `yaml:"media_failures_output"`
+	// UnresolvedMediaPath is where the files referencing media that wasn't
+	// downloaded are listed, if set
+	UnresolvedMediaPath string `yaml:"unresolved_media_output"`
+	// ExportAuthors writes the authors of published content to AuthorsPath
+	// and references them by slug in the frontmatter of their posts
+	ExportAuthors bool   `yaml:"export_authors"`
+	AuthorsPath   string `yaml:"authors_output"`
+	// MetricsPath is where the run's timings and counts are written as JSON, if set
+	MetricsPath string `yaml:"metrics_output"`
+
+	// OutputExtension is ".mdx" or ".md" for plain markdown
+	OutputExtension string `yaml:"output_extension"`
+	// PasswordProtected is "include", "skip" or "placeholder"
+	PasswordProtected string `yaml:"password_protected"`
+	// IgnorePaths are glob patterns of site paths that are never exported
+	IgnorePaths []string `yaml:"ignore_paths"`
+	// Resume skips items whose file was written after their last modification
+	Resume bool `yaml:"resume"`
+	// TransliterateSlugs converts slugs to ASCII for file names
+	TransliterateSlugs bool `yaml:"transliterate_slugs"`
+	// NormalizeFilenames lowercases output paths and turns underscores and
+	// spaces into hyphens
+	NormalizeFilenames bool `yaml:"normalize_filenames"`
+	// ColocateMedia writes each item as <slug>/index.mdx with its media next to it
+	ColocateMedia bool `yaml:"colocate_media"`
+	// KeepAbsoluteMediaURLs keeps WordPress URLs for featured images
+	KeepAbsoluteMediaURLs bool `yaml:"keep_absolute_media_urls"`
+	// DedupeFeaturedInContent removes the first image of the content when it
+	// is the featured image
+	DedupeFeaturedInContent bool `yaml:"dedupe_featured_in_content"`
+	// MediaUserAgent and MediaHeaders are sent with media downloads, which go
+	// through MediaProxy when set
+	MediaUserAgent string      `yaml:"media_user_agent"`
+	MediaHeaders   http.Header `yaml:"media_headers"`
+	MediaProxy     string      `yaml:"media_proxy"`
+	// MediaHosts are the hosts, besides the base URL, that media is downloaded
+	// from, and those it never is
+	MediaHosts MediaHosts `yaml:"media_hosts"`
+	// MediaChecksums records the SHA-256 of downloaded media in the manifest
+	MediaChecksums bool `yaml:"media_checksums"`
+	// InlineSVGUnderBytes inlines the markup of SVG images smaller than this
+	// many bytes instead of downloading them; 0 disables it
+	InlineSVGUnderBytes int `yaml:"inline_svg_under_bytes"`
+	// FixMediaExtensions saves media whose extension is missing or wrong under
+	// the extension of its content type, updating the references to it
+	FixMediaExtensions bool `yaml:"fix_media_extensions"`
+	// FollowMediaRedirects looks up where media under the base URL redirects
+	// to, e.g. old attachment URLs, and references and downloads the final
+	// location instead
+	FollowMediaRedirects bool `yaml:"follow_media_redirects"`
+	// DownloadBandwidthLimit caps the combined media download throughput in
+	// bytes per second; 0 leaves it unlimited
+	DownloadBandwidthLimit int64 `yaml:"download_bandwidth_limit"`
+	// StrictMediaContentType rejects downloads that aren't the expected kind of media
+	StrictMediaContentType bool `yaml:"strict_media_content_type"`
+	// DateUseGMT picks the GMT date columns and emits UTC timestamps
+	DateUseGMT bool `yaml:"date_use_gmt"`
+	// DateIncludeTime emits full timestamps instead of dates only
+	DateIncludeTime bool `yaml:"date_include_time"`
+	// DateOutputFormat is the Go time layout of publishDate and updatedDate,
+	// e.g. "Jan 2, 2006"; it overrides DateIncludeTime
+	DateOutputFormat string `yaml:"date_output_format"`
+	// ImageSyntax is "html" (the default) for <img> tags or "markdown" for
+	// ![alt](src); markdown images can't carry captions, which become an
+	// emphasized line below them
+	ImageSyntax string `yaml:"image_syntax"`
+	// MoreTagMode is what becomes of the <!--more--> fold: "strip" (the
+	// default), "excerpt" to use the text before it as the excerpt, or
+	// "marker" for a {/* more */} comment
+	MoreTagMode string `yaml:"more_tag_mode"`
+	// FrontmatterFormat is "yaml", "toml" or "json"
+	FrontmatterFormat string `yaml:"frontmatter_format"`
+	// FieldMapping adds frontmatter fields per post type
+	FieldMapping FieldMapping `yaml:"field_mapping"`
+	// IncludeCanonical adds the WordPress permalink as canonicalURL
+	IncludeCanonical bool `yaml:"include_canonical"`
+	// IncludeSlug adds the WordPress slug as slug
+	IncludeSlug bool `yaml:"include_slug"`
+	// IncludeComments is "count" to add commentCount, or "export" to also
+	// write each item's approved comments to a .comments.json file next to it
+	IncludeComments string `yaml:"include_comments"`
+	// ReadingTime adds wordCount and readingTime at ReadingWPM words per minute
+	ReadingTime bool `yaml:"include_reading_time"`
+	ReadingWPM  int  `yaml:"reading_wpm"`
+	// CategoryIndexes writes a <CategoryIndexName> file listing the posts of
+	// each category, for generators that use section index files
+	CategoryIndexes   bool   `yaml:"generate_category_indexes"`
+	CategoryIndexName string `yaml:"category_index_name"`
+	// FormatCommand is run on every generated file before it is written
+	FormatCommand string `yaml:"format_command"`
+
+	Convert    ConvertOptions   `yaml:"convert"`
+	Shortcodes ShortcodeOptions `yaml:"shortcodes"`
+}
+
+// DefaultConfig returns the settings used for a local development site
+func DefaultConfig() Config {
+	return Config{
+		DBPort:              "3306",
+		TablePrefix:         "wp_",
+		BlogID:              1,
+		BaseURL:             "http://localhost:8082",
+		APIBase:             "http://localhost:8082/wp-json/wp/v2",
+		PostsOutputDir:      "./output-posts",
+		PagesOutputDir:      "./output-pages",
+		HTMLOutputDir:       "./output-html",
+		MediaOutputDir:      "./output-media",
+		ManifestPath:        "./manifest.json",
+		JSONOutputPath:      "./posts.json",
+		AuthorsPath:         "./authors.json",
+		CategoryIndexName:   "_index",
+		OutputExtension:     ".mdx",
+		ReadingWPM:          defaultReadingWPM,
+		APIFailureThreshold: 5,
+		APIRetry:            RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond},
+	}
+}
+
+// LoadConfigFile reads the settings from a YAML file over the defaults. Its
+// keys are the lowercased names of the environment variables, with the
+// related settings grouped, e.g. window.limit for LIMIT; see
+// config.example.yaml.
+func LoadConfigFile(path string) (Config, error) {
+	cfg := DefaultConfig()
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config file: %v", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	// Misspelled settings would otherwise be silently ignored
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && err != io.EOF {
+		return cfg, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return cfg, cfg.normalize()
+}
+
+// Set changes the setting named by its config file key, with the keys of the
+// groups it is in joined by dots (e.g. convert.list_indent), to value, read
+// as YAML (e.g. 4, true or [a, b])
+func (c *Config) Set(key string, value string) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+	if len(doc.Content) > 0 {
+		node = doc.Content[0]
+	}
+	parts := strings.Split(key, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		node = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: parts[i]}, node}}
+	}
+
+	raw, err := yaml.Marshal(node)
+	if err != nil {
+		return fmt.Errorf("invalid setting %s: %v", key, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("invalid setting %s=%s: %v", key, value, err)
+	}
+	return c.normalize()
+}
+
+// normalize checks and canonicalizes the settings read from YAML
+func (c *Config) normalize() error {
+	if err := c.FieldMapping.validate(); err != nil {
+		return err
+	}
+	c.BaseURL = NormalizeBaseURL(c.BaseURL)
+	// Match the environment's parsing: header names are canonical and
+	// renamed terms are matched case-insensitively
+	header := make(http.Header)
+	for name, values := range c.MediaHeaders {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	c.MediaHeaders = header
+	if c.TaxonomyRename != nil {
+		rename := make(TaxonomyRename)
+		for name, term := range c.TaxonomyRename {
+			rename[strings.ToLower(strings.TrimSpace(name))] = term
+		}
+		c.TaxonomyRename = rename
+	}
+	return nil
+}
+
+// Validate reports settings that can't be used
+func (c Config) Validate() error {
+	if c.BlogID < 1 {
+		return fmt.Errorf("invalid blog ID %d: must be a positive integer", c.BlogID)
+	}
+	switch c.PasswordProtected {
+	case "", "include", "skip", "placeholder":
+	default:
+		return fmt.Errorf("invalid password-protected mode %q: must be include, skip or placeholder", c.PasswordProtected)
+	}
+	if c.ReadingWPM < 1 {
+		return fmt.Errorf("invalid reading speed %d: must be a positive number of words per minute", c.ReadingWPM)
+	}
+	switch c.Convert.ListIndent {
+	case 0, 2, 4:
+	default:
+		return fmt.Errorf("invalid list indent %d: must be 2 or 4", c.Convert.ListIndent)
+	}
+	switch c.Convert.HeadingStyle {
+	case "", "atx", "setext":
+	default:
+		return fmt.Errorf("invalid heading style %q: must be atx or setext", c.Convert.HeadingStyle)
+	}
+	switch c.Convert.EmphasisDelimiter {
+	case "", "_", "*":
+	default:
+		return fmt.Errorf("invalid emphasis delimiter %q: must be _ or *", c.Convert.EmphasisDelimiter)
+	}
+	switch c.Convert.BulletChar {
+	case "", "-", "*", "+":
+	default:
+		return fmt.Errorf("invalid bullet character %q: must be -, * or +", c.Convert.BulletChar)
+	}
+	switch c.Convert.HighlightSyntax {
+	case "", "html", "markdown":
+	default:
+		return fmt.Errorf("invalid highlight syntax %q: must be html or markdown", c.Convert.HighlightSyntax)
+	}
+	for _, strategy := range c.PathResolutionOrder {
+		switch strategy {
+		case ResolveFromAPI, ResolveFromSlug, ResolveFromGUID:
+		default:
+			return fmt.Errorf("invalid path resolution strategy %q: must be api, slug or guid", strategy)
+		}
+	}
+	switch strings.TrimPrefix(c.OutputExtension, ".") {
+	case "", "md", "mdx":
+	default:
+		return fmt.Errorf("invalid output extension %q: must be .mdx or .md", c.OutputExtension)
+	}
+	switch c.FrontmatterFormat {
+	case "", "yaml", "toml", "json":
+	default:
+		return fmt.Errorf("invalid frontmatter format %q: must be yaml, toml or json", c.FrontmatterFormat)
+	}
+	switch c.ImageSyntax {
+	case "", "html", "markdown":
+	default:
+		return fmt.Errorf("invalid image syntax %q: must be html or markdown", c.ImageSyntax)
+	}
+	switch c.MoreTagMode {
+	case "", "strip", "excerpt", "marker":
+	default:
+		return fmt.Errorf("invalid more tag mode %q: must be strip, excerpt or marker", c.MoreTagMode)
+	}
+	// A layout without any date or time element prints as itself
+	if sample := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC); c.DateOutputFormat != "" && sample.Format(c.DateOutputFormat) == c.DateOutputFormat {
+		return fmt.Errorf("invalid date output format %q: must be a Go time layout such as 2006-01-02", c.DateOutputFormat)
+	}
+	switch c.IncludeComments {
+	case "", "count", "export":
+	default:
+		return fmt.Errorf("invalid comments mode %q: must be count or export", c.IncludeComments)
+	}
+	switch c.JSONOutput {
+	case "", "files", "combined":
+	default:
+		return fmt.Errorf("invalid JSON output %q: must be files or combined", c.JSONOutput)
+	}
+	if c.MediaProxy != "" {
+		if u, err := url.Parse(c.MediaProxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid media proxy %q: must be a URL such as http://proxy:8080", c.MediaProxy)
+		}
+	}
+	if c.CategoryIndexes && SanitizeFilename(c.CategoryIndexName) != c.CategoryIndexName {
+		return fmt.Errorf("invalid category index name %q: must be a file name such as _index", c.CategoryIndexName)
+	}
+	if c.APIRetry.Attempts < 1 || c.APIRetry.Backoff < 0 {
+		return fmt.Errorf("invalid API retry policy: attempts must be at least 1 and the backoff non-negative")
+	}
+	if c.APIFailureThreshold < 0 {
+		return fmt.Errorf("invalid API failure threshold %d: must be non-negative", c.APIFailureThreshold)
+	}
+	if c.Window.Limit < 0 || c.Window.Offset < 0 {
+		return fmt.Errorf("invalid limit/offset %d/%d: must be non-negative", c.Window.Limit, c.Window.Offset)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package wptomdx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *Config)
+		wantErr   bool
+	}{
+		{"defaults", func(cfg *Config) {}, false},
+		{"limit and offset", func(cfg *Config) { cfg.Window = QueryWindow{Limit: 10, Offset: 20} }, false},
+		{"negative limit", func(cfg *Config) { cfg.Window.Limit = -1 }, true},
+		{"negative offset", func(cfg *Config) { cfg.Window.Offset = -5 }, true},
+		{"md extension", func(cfg *Config) { cfg.OutputExtension = ".md" }, false},
+		{"unknown extension", func(cfg *Config) { cfg.OutputExtension = ".txt" }, true},
+		{"toml frontmatter", func(cfg *Config) { cfg.FrontmatterFormat = "toml" }, false},
+		{"unknown frontmatter", func(cfg *Config) { cfg.FrontmatterFormat = "ini" }, true},
+		{"unknown password mode", func(cfg *Config) { cfg.PasswordProtected = "hide" }, true},
+		{"unknown heading style", func(cfg *Config) { cfg.Convert.HeadingStyle = "underline" }, true},
+		{"setext headings", func(cfg *Config) { cfg.Convert.HeadingStyle = "setext" }, false},
+		{"asterisk emphasis", func(cfg *Config) { cfg.Convert.EmphasisDelimiter = "*" }, false},
+		{"unknown emphasis delimiter", func(cfg *Config) { cfg.Convert.EmphasisDelimiter = "~" }, true},
+		{"plus bullets", func(cfg *Config) { cfg.Convert.BulletChar = "+" }, false},
+		{"unknown bullet character", func(cfg *Config) { cfg.Convert.BulletChar = "•" }, true},
+		{"markdown highlight", func(cfg *Config) { cfg.Convert.HighlightSyntax = "markdown" }, false},
+		{"unknown highlight syntax", func(cfg *Config) { cfg.Convert.HighlightSyntax = "css" }, true},
+		{"unknown image syntax", func(cfg *Config) { cfg.ImageSyntax = "jsx" }, true},
+		{"unknown resolution strategy", func(cfg *Config) { cfg.PathResolutionOrder = []string{"api", "sitemap"} }, true},
+		{"blog ID zero", func(cfg *Config) { cfg.BlogID = 0 }, true},
+		{"date output format", func(cfg *Config) { cfg.DateOutputFormat = "Jan 2, 2006" }, false},
+		{"date output format without layout", func(cfg *Config) { cfg.DateOutputFormat = "dd/mm/yyyy" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.configure(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConverterHonorsConfig(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) {
+		cfg.OutputExtension = ".md"
+		cfg.FrontmatterFormat = "toml"
+		cfg.DateIncludeTime = true
+		cfg.ImageSyntax = "markdown"
+		cfg.IncludeSlug = true
+		cfg.Convert.HeadingStyle = "setext"
+	})
+	post := testPost(1, "configured", `<h1>Heading</h1><p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A"></p>`)
+	entries := c.ProcessContent([]Post{post}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+	if want := filepath.Join(c.Config.PostsOutputDir, "configured.md"); entries[0].MDXPath != want {
+		t.Errorf("written to %q, want %q", entries[0].MDXPath, want)
+	}
+	data, err := os.ReadFile(entries[0].MDXPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"+++\n",
+		`publishDate = "2024-03-01T10:00:00Z"`,
+		`slug = "configured"`,
+		"Heading\n=======",
+		"![A](/wp-content/uploads/a.jpg)",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("output does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		check   func(t *testing.T, cfg Config)
+		wantErr bool
+	}{
+		{
+			name: "empty file",
+			check: func(t *testing.T, cfg Config) {
+				if want := DefaultConfig(); cfg.PostsOutputDir != want.PostsOutputDir || cfg.ReadingWPM != want.ReadingWPM {
+					t.Errorf("got %+v, want the defaults", cfg)
+				}
+			},
+		},
+		{
+			name: "settings",
+			yaml: "wp_base_url: https://example.com\nposts_output_dir: out/posts\ninclude_slug: true\nwindow:\n  limit: 10\nconvert:\n  list_indent: 4\n  strip_query_params: [utm_source]\n",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.BaseURL != "https://example.com" || cfg.PostsOutputDir != "out/posts" || !cfg.IncludeSlug {
+					t.Errorf("got base %q, posts dir %q, include slug %v", cfg.BaseURL, cfg.PostsOutputDir, cfg.IncludeSlug)
+				}
+				if cfg.Window.Limit != 10 || cfg.Convert.ListIndent != 4 || len(cfg.Convert.StripQueryParams) != 1 {
+					t.Errorf("got limit %d, list indent %d, strip params %q", cfg.Window.Limit, cfg.Convert.ListIndent, cfg.Convert.StripQueryParams)
+				}
+				// Settings left out keep their defaults
+				if cfg.MediaOutputDir != DefaultConfig().MediaOutputDir {
+					t.Errorf("got media dir %q", cfg.MediaOutputDir)
+				}
+			},
+		},
+		{
+			name: "media headers",
+			yaml: "media_headers:\n  x-api-key: [secret]\n",
+			check: func(t *testing.T, cfg Config) {
+				if got := cfg.MediaHeaders.Get("X-Api-Key"); got != "secret" {
+					t.Errorf("got X-Api-Key %q", got)
+				}
+			},
+		},
+		{name: "unknown key", yaml: "post_output_dir: out\n", wantErr: true},
+		{name: "unknown nested key", yaml: "window:\n  limt: 10\n", wantErr: true},
+		{name: "wrong type", yaml: "window:\n  limit: ten\n", wantErr: true},
+		{name: "malformed", yaml: "window: [\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfigFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	if _, err := LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadConfigFile() error = nil, want one for a missing file")
+	}
+}
+
+func TestLoadConfigFileExample(t *testing.T) {
+	cfg, err := LoadConfigFile(filepath.Join("..", "config.example.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if cfg.Window.Limit != 0 || cfg.APIRetry.Attempts != 3 || cfg.Convert.InternalLinkPrefix != "/blog" {
+		t.Errorf("got limit %d, retry attempts %d, link prefix %q", cfg.Window.Limit, cfg.APIRetry.Attempts, cfg.Convert.InternalLinkPrefix)
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		check   func(t *testing.T, cfg Config)
+		wantErr bool
+	}{
+		{
+			name: "nested number", key: "convert.list_indent", value: "4",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Convert.ListIndent != 4 {
+					t.Errorf("got list indent %d", cfg.Convert.ListIndent)
+				}
+			},
+		},
+		{
+			name: "list", key: "media_hosts.allowed", value: "[cdn.example.com, img.example.com]",
+			check: func(t *testing.T, cfg Config) {
+				if len(cfg.MediaHosts.Allowed) != 2 {
+					t.Errorf("got allowed hosts %q", cfg.MediaHosts.Allowed)
+				}
+			},
+		},
+		{
+			name: "toggle", key: "include_slug", value: "true",
+			check: func(t *testing.T, cfg Config) {
+				if !cfg.IncludeSlug {
+					t.Error("slug not included")
+				}
+			},
+		},
+		{
+			name: "empty string", key: "posts_output_dir", value: "",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.PostsOutputDir != "" {
+					t.Errorf("got posts dir %q", cfg.PostsOutputDir)
+				}
+			},
+		},
+		{
+			name: "other settings kept", key: "window.offset", value: "5",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Window.Offset != 5 || cfg.Window.Limit != 10 {
+					t.Errorf("got window %+v", cfg.Window)
+				}
+			},
+		},
+		{name: "unknown key", key: "convert.list_indnt", value: "4", wantErr: true},
+		{name: "wrong type", key: "window.limit", value: "many", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Window.Limit = 10
+			err := cfg.Set(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set(%q, %q) error = %v, wantErr %v", tt.key, tt.value, err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
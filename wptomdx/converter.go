@@ -0,0 +1,603 @@
+package wptomdx
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// passwordProtectedNotice replaces the content of password-protected items in placeholder mode
+const passwordProtectedNotice = "This content is password protected."
+
+// Converter turns WordPress posts and pages into HTML and MDX files
+type Converter struct {
+	Config Config
+
+	// Attachments resolves gallery attachment IDs to their URLs
+	Attachments AttachmentResolver
+	// Paths is shared by all workers so that items resolving to the same path get
+	// distinct files
+	Paths *PathRegistry
+	// PostSlugs are the slugs of the posts links are prefixed with the
+	// internal link prefix for; see ConvertOptions.PostSlugs
+	PostSlugs map[string]bool
+	// LookupURL finds the URL of a post or page through the REST API for the
+	// ResolveFromAPI strategy; nil asks Config.APIBase directly
+	LookupURL func(id int, isPage bool) (string, error)
+	// Downloader sends the media requests made while converting, e.g. to
+	// follow media redirects
+	Downloader Downloader
+
+	// mediaRedirects caches the final location of every media URL looked up
+	mediaRedirectsMu sync.Mutex
+	mediaRedirects   map[string]*redirectEntry
+
+	// linkRedirects is shared by every conversion so each link is resolved once
+	linkRedirectsMu sync.Mutex
+	linkRedirects   *RedirectResolver
+
+	// outputs lists the files written (or kept up to date) so far
+	outputsMu sync.Mutex
+	outputs   []string
+}
+
+// NewConverter returns a Converter for cfg with an empty path registry
+func NewConverter(cfg Config) *Converter {
+	cfg.BaseURL = NormalizeBaseURL(cfg.BaseURL)
+	return &Converter{
+		Config: cfg,
+		Paths:  NewPathRegistry(),
+	}
+}
+
+// recordOutputs notes files that belong to this run's output
+func (c *Converter) recordOutputs(paths ...string) {
+	c.outputsMu.Lock()
+	defer c.outputsMu.Unlock()
+	c.outputs = append(c.outputs, paths...)
+}
+
+// ResolveURL finds the URL of item with the strategies of the configured
+// resolution order
+func (c *Converter) ResolveURL(item Post, isPage bool) (string, error) {
+	lookup := c.LookupURL
+	if lookup == nil {
+		api := APIClient{Base: c.Config.APIBase, Retry: c.Config.APIRetry}
+		lookup = func(id int, isPage bool) (string, error) {
+			if isPage {
+				return api.PageURL(id)
+			}
+			return api.PostURL(id)
+		}
+	}
+	return ResolveURL(c.Config.URLResolutionOrder(), c.Config.BaseURL, c.Config.PermalinkStructure, item, func(id int) (string, error) {
+		return lookup(id, isPage)
+	})
+}
+
+// mediaRedirectsFor returns the final location of each of urls that redirects
+// elsewhere, when FollowMediaRedirects is set. Every URL is only looked up once
+// across items.
+func (c *Converter) mediaRedirectsFor(urls []string) map[string]string {
+	if !c.Config.FollowMediaRedirects {
+		return nil
+	}
+	return resolveMediaRedirects(urls, c.Config.BaseURL, c.Config.MediaHosts, func(src string) string {
+		c.mediaRedirectsMu.Lock()
+		if c.mediaRedirects == nil {
+			c.mediaRedirects = make(map[string]*redirectEntry)
+		}
+		entry, ok := c.mediaRedirects[src]
+		if !ok {
+			entry = &redirectEntry{}
+			c.mediaRedirects[src] = entry
+		}
+		c.mediaRedirectsMu.Unlock()
+
+		entry.once.Do(func() {
+			// Relative URLs that don't move stay as they are
+			absolute := AbsoluteMediaURL(src, c.Config.BaseURL)
+			entry.finalURL = src
+			if final := c.Downloader.ResolveMediaURL(absolute); final != absolute {
+				entry.finalURL = final
+			}
+		})
+		return entry.finalURL
+	})
+}
+
+// linkRedirectResolver returns the resolver following link redirects through
+// the downloader's client
+func (c *Converter) linkRedirectResolver() *RedirectResolver {
+	c.linkRedirectsMu.Lock()
+	defer c.linkRedirectsMu.Unlock()
+	if c.linkRedirects == nil {
+		c.linkRedirects = NewRedirectResolver(c.Downloader.Client, maxRedirectRequests)
+	}
+	return c.linkRedirects
+}
+
+// Outputs returns the files written so far, including those kept when
+// resuming. A colocated item that was kept is listed as its directory.
+func (c *Converter) Outputs() []string {
+	c.outputsMu.Lock()
+	defer c.outputsMu.Unlock()
+	return append([]string(nil), c.outputs...)
+}
+
+// outputDir returns the directory markdown files for posts or pages are written to
+func (c *Converter) outputDir(isPage bool) string {
+	if isPage {
+		return c.Config.PagesOutputDir
+	}
+	return c.Config.PostsOutputDir
+}
+
+// convertOptions returns the HTML conversion options. Layout components are
+// left out when writing plain markdown.
+func (c *Converter) convertOptions() ConvertOptions {
+	opts := c.Config.Convert
+	opts.MoreMarker = c.Config.MoreTagMode == "marker"
+	opts.MarkdownImages = c.Config.ImageSyntax == "markdown"
+	opts.PostSlugs = c.PostSlugs
+	opts.MediaHosts = c.Config.MediaHosts
+	if opts.FollowLinkRedirects {
+		opts.LinkRedirects = c.linkRedirectResolver()
+	}
+	if OutputExtension(c.Config.OutputExtension) == ".md" {
+		opts.ColumnsComponent, opts.ColumnComponent, opts.GroupComponent = "", "", ""
+		opts.QuoteComponent, opts.PullquoteComponent, opts.ButtonComponent = "", "", ""
+	}
+	return opts
+}
+
+// shortcodeOptions returns the shortcode options. Plain markdown output can't
+// render components.
+func (c *Converter) shortcodeOptions() ShortcodeOptions {
+	opts := c.Config.Shortcodes
+	opts.MarkdownImages = c.Config.ImageSyntax == "markdown"
+	if OutputExtension(c.Config.OutputExtension) == ".md" {
+		opts.Components = nil
+		opts.UltimateComponents = nil
+		opts.PDFComponent = ""
+	}
+	return opts
+}
+
+// ConvertContent converts the HTML content of an item to markdown, running
+// the conversion rules and then the line post-processing, and returns the
+// markdown with the media URLs it references
+func (c *Converter) ConvertContent(inputHtml string) (string, []string, error) {
+	if c.Config.ApplyWpautop {
+		inputHtml = wpautop(inputHtml)
+	}
+	markdown, mediaUrls, err := ConvertHTMLToMarkdown(inputHtml, c.Config.BaseURL, c.convertOptions())
+	if err != nil {
+		return "", nil, err
+	}
+	markdown, ppMediaUrls := PostProcessMarkdownLines(markdown, c.Config.BaseURL, c.Config.MediaHosts, c.Attachments, c.shortcodeOptions())
+	return markdown, append(mediaUrls, ppMediaUrls...), nil
+}
+
+// ProcessContent converts each item to HTML and MDX files and returns a manifest
+// entry describing the generated files and the media each item references
+func (c *Converter) ProcessContent(content []Post, isPage bool) []ManifestEntry {
+	var entries []ManifestEntry
+
+	for _, item := range content {
+		var mediaUrls []string
+
+		// Password-protected items are exported as-is, skipped, or replaced by a notice
+		if item.Password != "" {
+			switch c.Config.PasswordProtected {
+			case "skip":
+				log.Printf("Skipping password-protected item %d", item.ID)
+				continue
+			case "placeholder":
+				item.Content = "<p>" + passwordProtectedNotice + "</p>"
+			}
+		}
+
+		// Resolve the full URL just before creating the file, unless it is
+		// already known (e.g. from a WXR export)
+		fullURL := item.URL
+		var urlErr error
+		if fullURL == "" {
+			fullURL, urlErr = c.ResolveURL(item, isPage)
+		}
+		if urlErr != nil {
+			log.Printf("Warning: Could not get URL for %d: %v", item.ID, urlErr)
+			continue
+		}
+
+		// Extract the path from the URL
+		u, parseErr := url.Parse(fullURL)
+		if parseErr != nil {
+			log.Printf("Warning: Could not parse URL %s: %v", fullURL, parseErr)
+			continue
+		}
+		path := strings.TrimPrefix(u.Path, "/")
+		if path == "" {
+			path = "index"
+		}
+		// Remove any trailing slash from the path
+		path = strings.TrimSuffix(path, "/")
+
+		// Skip items the user never wants exported
+		if IsIgnoredPath(path, c.Config.IgnorePaths) {
+			log.Printf("Skipping ignored path %s (item %d)", path, item.ID)
+			continue
+		}
+
+		// Make every segment safe to use as a file or directory name
+		path = SanitizePath(path, c.Config.TransliterateSlugs)
+		if c.Config.NormalizeFilenames {
+			// The manifest maps the item's URL to the file it ends up in
+			if normalized := NormalizePath(path); normalized != path {
+				log.Printf("Normalized path %s to %s (item %d)", path, normalized, item.ID)
+				path = normalized
+			}
+		}
+		if path == "" {
+			path = strconv.Itoa(item.ID)
+		}
+
+		// Posts and pages can resolve to the same path; disambiguate instead of overwriting
+		path = c.Paths.Claim(path, item.ID)
+
+		// When colocating, the post becomes a folder holding its index file and media
+		extension := OutputExtension(c.Config.OutputExtension)
+		fileExtension := extension
+		if c.Config.JSONOutput == "files" {
+			fileExtension = ".json"
+		}
+		filePath := fmt.Sprintf("%s/%s%s", c.outputDir(isPage), path, fileExtension)
+		if c.Config.ColocateMedia {
+			filePath = fmt.Sprintf("%s/%s/index%s", c.outputDir(isPage), path, fileExtension)
+		}
+
+		// When resuming, files written after the item's last change are kept.
+		// The combined JSON output is rewritten with every item each run.
+		if c.Config.Resume && c.Config.JSONOutput != "combined" && isUpToDate(filePath, item) {
+			log.Printf("Skipping up-to-date file %s (item %d)", filePath, item.ID)
+			kept := filePath
+			if c.Config.ColocateMedia {
+				kept = filepath.Dir(filePath)
+			}
+			c.recordOutputs(kept, fmt.Sprintf("%s/%s.html", c.Config.HTMLOutputDir, path), commentsFilePath(filePath, fileExtension, c.Config.ColocateMedia))
+			continue
+		}
+
+		// The text before the <!--more--> fold is the excerpt unless one was written
+		if c.Config.MoreTagMode == "excerpt" && item.Excerpt == "" {
+			item.Excerpt = moreTagExcerpt(item.Content)
+		}
+
+		inputHtml := item.Content
+
+		// Convert HTML to Markdown
+		markdown, contentMediaUrls, err := c.ConvertContent(inputHtml)
+		if err != nil {
+			log.Printf("Warning: Failed to convert %d to markdown: %v", item.ID, err)
+			continue
+		}
+		mediaUrls = append(mediaUrls, contentMediaUrls...)
+
+		// Themes usually show the featured image above the content already
+		if c.Config.DedupeFeaturedInContent {
+			var removed string
+			markdown, removed = removeFeaturedFromContent(markdown, item.FeaturedImage, c.Config.BaseURL)
+			if removed != "" && !strings.Contains(markdown, `"`+removed+`"`) && !strings.Contains(markdown, "("+removed) {
+				mediaUrls = dropMediaURL(mediaUrls, removed, c.Config.BaseURL)
+			}
+		}
+
+		// Posts whose content converts to nothing, e.g. only a page builder's
+		// empty markup, would be written as a bare frontmatter block
+		if strings.TrimSpace(markdown) == "" {
+			if c.Config.SkipEmpty {
+				log.Printf("Skipping %d (%s): no content", item.ID, item.Title)
+				continue
+			}
+			log.Printf("Warning: %d (%s) has no content", item.ID, item.Title)
+		}
+
+		// Create HTML file path
+		htmlFilePath := fmt.Sprintf("%s/%s.html", c.Config.HTMLOutputDir, path)
+
+		// Create the directory path if it doesn't exist
+		dirPath := filepath.Dir(htmlFilePath)
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			log.Printf("Failed to create directory %s: %v", dirPath, err)
+			continue
+		}
+
+		// Write HTML file
+		if err := os.WriteFile(htmlFilePath, []byte(inputHtml), 0644); err != nil {
+			log.Printf("WriteFile error for HTML %s: %v", htmlFilePath, err)
+			continue
+		}
+
+		// Plain markdown targets can't use MDX imports or components, while MDX
+		// would evaluate the braces of the text
+		if extension == ".md" {
+			markdown = DegradeToMarkdown(markdown)
+		} else {
+			markdown = EscapeMDXBraces(markdown)
+		}
+
+		// Small SVGs are inlined rather than downloaded
+		if c.Config.InlineSVGUnderBytes > 0 {
+			markdown, mediaUrls = c.Downloader.inlineSmallSVGs(markdown, mediaUrls, c.Config.BaseURL, c.Config.MediaHosts, c.Config.InlineSVGUnderBytes, extension == ".mdx")
+		}
+
+		item.Content = markdown
+
+		// Add featured image to imageURLs if it exists, once when the
+		// content shows it too
+		if item.FeaturedImage != "" && !slices.Contains(mediaUrls, AbsoluteMediaURL(item.FeaturedImage, c.Config.BaseURL)) {
+			mediaUrls = append(mediaUrls, item.FeaturedImage)
+		}
+
+		// Old attachment URLs may redirect; reference and download the final location
+		if moved := c.mediaRedirectsFor(mediaUrls); len(moved) > 0 {
+			for i, u := range mediaUrls {
+				if final, ok := moved[u]; ok {
+					mediaUrls[i] = final
+				}
+			}
+			if final, ok := moved[item.FeaturedImage]; ok {
+				item.FeaturedImage = final
+			}
+			item.Content = rewriteRedirectedMedia(item.Content, moved, c.Config.BaseURL, c.Config.MediaHosts)
+		}
+
+		// Colocated media is stored next to the post's index file
+		media := NewMediaEntries(mediaUrls)
+		var colocatedNames map[string]string
+		if c.Config.ColocateMedia {
+			colocatedNames = colocatedMediaNames(mediaUrls, c.Config.BaseURL, c.Config.MediaHosts)
+			for i := range media {
+				if name, ok := colocatedNames[media[i].URL]; ok {
+					media[i].LocalPath = filepath.Join(filepath.Dir(filePath), name)
+				}
+			}
+			item.Content = rewriteMediaReferences(item.Content, colocatedNames, c.Config.BaseURL, c.Config.MediaHosts)
+		}
+
+		// Save media under the extension of the type the server sends
+		var fixedExtensions map[string]string
+		if c.Config.FixMediaExtensions {
+			fixedExtensions = c.Downloader.fixMediaExtensions(media, c.Config.BaseURL, c.Config.MediaHosts, c.Config.MediaOutputDir)
+			item.Content = rewriteFixedExtensions(item.Content, fixedExtensions, func(u string) string {
+				if name, ok := colocatedNames[u]; ok {
+					return "./" + name
+				}
+				return LocalMediaPath(u, c.Config.BaseURL, c.Config.MediaHosts)
+			})
+		}
+
+		// Parse dates, using the GMT columns (emitted as UTC timestamps) when requested.
+		// Dates are emitted without their time unless asked for.
+		useGMT := c.Config.DateUseGMT
+		dateLayout := "2006-01-02"
+		if c.Config.DateOutputFormat != "" {
+			dateLayout = c.Config.DateOutputFormat
+		} else if useGMT || c.Config.DateIncludeTime {
+			dateLayout = time.RFC3339
+		}
+
+		publishDate, dateErr := PickWordPressDate(item.PublishedDate, item.PublishedGMT, useGMT)
+		if dateErr != nil {
+			log.Printf("Warning: Could not parse publish date '%s': %v", item.PublishedDate, dateErr)
+			publishDate = time.Now() // fallback to current time
+		} else if publishDate.IsZero() {
+			publishDate = time.Now() // WordPress never set a publish date
+		}
+
+		updatedDate, updateErr := PickWordPressDate(item.UpdatedDate, item.UpdatedGMT, useGMT)
+		if updateErr != nil {
+			log.Printf("Warning: Could not parse update date '%s': %v", item.UpdatedDate, updateErr)
+			// If we can't parse the updated date, we'll omit it from the frontmatter
+		}
+
+		// Point the featured image at the downloaded copy unless absolute URLs were requested
+		frontmatterItem := item
+		frontmatterItem.URL = fullURL
+		if item.FeaturedImage != "" && !c.Config.KeepAbsoluteMediaURLs {
+			if ref, ok := fixedExtensions[item.FeaturedImage]; ok {
+				frontmatterItem.FeaturedImage = ref
+			} else if name, ok := colocatedNames[item.FeaturedImage]; ok {
+				frontmatterItem.FeaturedImage = "./" + name
+			} else if localPath := LocalMediaPath(item.FeaturedImage, c.Config.BaseURL, c.Config.MediaHosts); localPath != "" {
+				frontmatterItem.FeaturedImage = localPath
+			}
+		}
+
+		// Generate frontmatter
+		fm := BuildFrontmatter(frontmatterItem, publishDate, updatedDate, FrontmatterOptions{
+			DateLayout:   dateLayout,
+			ReadingTime:  c.Config.ReadingTime,
+			ReadingWPM:   c.Config.ReadingWPM,
+			CanonicalURL: c.Config.IncludeCanonical,
+			Slug:         c.Config.IncludeSlug,
+			CommentCount: c.Config.IncludeComments != "",
+			Fields:       c.Config.FieldMapping,
+		})
+
+		// The JSON output modes keep the fields and markdown body apart
+		jsonPost := JSONPost{
+			ID:          item.ID,
+			Type:        item.PostType,
+			Path:        path,
+			URL:         fullURL,
+			Frontmatter: fm,
+			Content:     item.Content,
+		}
+
+		var markdownWithFrontmatter string
+		switch c.Config.JSONOutput {
+		case "combined":
+			// Written by WriteJSONPosts once every item is converted
+			c.recordOutputs(htmlFilePath)
+			entries = append(entries, ManifestEntry{
+				ID:        item.ID,
+				Title:     item.Title,
+				SourceURL: fullURL,
+				HTMLPath:  htmlFilePath,
+				MDXPath:   c.Config.JSONOutputPath,
+				Media:     media,
+				Post:      &jsonPost,
+			})
+			continue
+		case "files":
+			encoded, err := encodeJSONPost(jsonPost)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			markdownWithFrontmatter = encoded
+		default:
+			frontmatter, fmErr := fm.Encode(c.Config.FrontmatterFormat)
+			if fmErr != nil {
+				log.Printf("Warning: Could not generate frontmatter for %d: %v", item.ID, fmErr)
+				continue
+			}
+
+			// Create markdown content with frontmatter
+			markdownWithFrontmatter = frontmatter + item.Content
+
+			// Optionally run the result through an external formatter, keeping the
+			// unformatted content if it fails
+			if formatCommand := c.Config.FormatCommand; formatCommand != "" {
+				if formatted, err := FormatWithCommand(formatCommand, markdownWithFrontmatter); err != nil {
+					log.Printf("Warning: Could not format %s: %v", filePath, err)
+				} else {
+					markdownWithFrontmatter = formatted
+				}
+			}
+
+			// Keep the source for reviewing the conversion by hand
+			if c.Config.EmbedSourceHTML {
+				markdownWithFrontmatter = strings.TrimRight(markdownWithFrontmatter, "\n") + "\n\n" + sourceHTMLComment(inputHtml, extension == ".mdx") + "\n"
+			}
+		}
+
+		dir := filepath.Dir(filePath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("MkdirAll error for %s: %v", dir, err)
+			continue
+		}
+
+		// Write the markdown file
+		if err := os.WriteFile(filePath, []byte(markdownWithFrontmatter), 0644); err != nil {
+			log.Printf("WriteFile error for %s: %v", filePath, err)
+			continue
+		} else {
+			log.Printf("Wrote file: %s", filePath)
+		}
+		c.recordOutputs(htmlFilePath, filePath)
+
+		// Export the approved comments next to the item
+		if c.Config.IncludeComments == "export" && len(item.Comments) > 0 {
+			commentsPath := commentsFilePath(filePath, fileExtension, c.Config.ColocateMedia)
+			if err := writeComments(commentsPath, item.Comments); err != nil {
+				log.Printf("Warning: %v", err)
+			} else {
+				c.recordOutputs(commentsPath)
+			}
+		}
+
+		entries = append(entries, ManifestEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			SourceURL: fullURL,
+			HTMLPath:  htmlFilePath,
+			MDXPath:   filePath,
+			Media:     media,
+		})
+
+		// Print item information
+		fmt.Printf(
+			"Title: %s\nDate: %s\nTags: %s\nURL: %s\nHTML File: %s\nMarkdown File: %s\nFeatured Image: %s\nContent snippet: %s\n\n",
+			item.Title,
+			item.PublishedDate,
+			strings.Join(item.Tags, ", "),
+			fullURL,
+			htmlFilePath,
+			filePath,
+			item.FeaturedImage,
+			contentSnippet(item.Content, 60),
+		)
+	}
+
+	return entries
+}
+
+// sourceHTMLComment wraps the source HTML of an item in a comment: an MDX
+// expression comment, or an HTML comment for plain markdown. Sequences that
+// would end the comment early are broken up.
+func sourceHTMLComment(source string, mdx bool) string {
+	source = strings.TrimSpace(source)
+	if mdx {
+		return "{/* Source HTML:\n" + strings.ReplaceAll(source, "*/", "*\\/") + "\n*/}"
+	}
+	return "<!-- Source HTML:\n" + strings.ReplaceAll(source, "--", "- -") + "\n-->"
+}
+
+// contentSnippet returns the first n characters of content, for logging
+func contentSnippet(content string, n int) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "(empty)"
+	}
+	runes := []rune(content)
+	if len(runes) <= n {
+		return content
+	}
+	return string(runes[:n]) + "..."
+}
+
+// commentsFilePath returns where the comments of the item written to filePath
+// are exported: next to it, or inside its folder when colocating
+func commentsFilePath(filePath string, extension string, colocated bool) string {
+	if colocated {
+		return filepath.Join(filepath.Dir(filePath), "comments.json")
+	}
+	return strings.TrimSuffix(filePath, extension) + ".comments.json"
+}
+
+// maxLocalTimeLag is how far UTC can be ahead of a site-local time: the time
+// zones furthest west are UTC-12
+const maxLocalTimeLag = 12 * time.Hour
+
+// isUpToDate reports whether the file at filePath was written after item was
+// last modified. Items without a usable modification date count as up to date
+// once their file exists. Without a GMT date the site's time zone is unknown,
+// so the file has to be newer than the latest time the local date can mean.
+func isUpToDate(filePath string, item Post) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	modified, err := PickWordPressDate(item.UpdatedDate, item.UpdatedGMT, true)
+	gmt := item.UpdatedGMT
+	if err != nil || modified.IsZero() {
+		modified, err = PickWordPressDate(item.PublishedDate, item.PublishedGMT, true)
+		gmt = item.PublishedGMT
+	}
+	if err != nil {
+		return true
+	}
+	if isZeroWordPressDate(gmt) && !modified.IsZero() {
+		modified = modified.Add(maxLocalTimeLag)
+	}
+	return info.ModTime().After(modified)
+}
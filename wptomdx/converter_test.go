@@ -0,0 +1,723 @@
+package wptomdx
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConverter returns a converter for https://example.com writing into a
+// temporary directory, with cfg changed by configure when given
+func testConverter(t *testing.T, configure func(cfg *Config)) *Converter {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.BaseURL = "https://example.com"
+	cfg.APIBase = "https://example.com/wp-json/wp/v2"
+	cfg.PostsOutputDir = filepath.Join(dir, "posts")
+	cfg.PagesOutputDir = filepath.Join(dir, "pages")
+	cfg.HTMLOutputDir = filepath.Join(dir, "html")
+	cfg.MediaOutputDir = filepath.Join(dir, "media")
+	if configure != nil {
+		configure(&cfg)
+	}
+	return NewConverter(cfg)
+}
+
+// testPost returns a published post with content at https://example.com/slug/
+func testPost(id int, slug string, content string) Post {
+	return Post{
+		ID:            id,
+		Title:         "Post " + slug,
+		Slug:          slug,
+		PublishedDate: "2024-03-01 10:00:00",
+		UpdatedDate:   "2024-03-02 10:00:00",
+		Content:       content,
+		PostType:      "post",
+		Status:        "publish",
+		URL:           "https://example.com/" + slug + "/",
+	}
+}
+
+func TestProcessContentManifest(t *testing.T) {
+	c := testConverter(t, nil)
+	posts := []Post{
+		testPost(2, "second", `<p>Text</p>`),
+		testPost(1, "first", `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A"></p>`),
+	}
+	entries := c.ProcessContent(posts, false)
+
+	want := []ManifestEntry{
+		{
+			ID:        2,
+			Title:     "Post second",
+			SourceURL: "https://example.com/second/",
+			HTMLPath:  filepath.Join(c.Config.HTMLOutputDir, "second.html"),
+			MDXPath:   filepath.Join(c.Config.PostsOutputDir, "second.mdx"),
+			Media:     []MediaEntry{},
+		},
+		{
+			ID:        1,
+			Title:     "Post first",
+			SourceURL: "https://example.com/first/",
+			HTMLPath:  filepath.Join(c.Config.HTMLOutputDir, "first.html"),
+			MDXPath:   filepath.Join(c.Config.PostsOutputDir, "first.mdx"),
+			Media:     []MediaEntry{{URL: "https://example.com/wp-content/uploads/a.jpg"}},
+		},
+	}
+	for i := range entries {
+		entries[i].Post = nil
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("ProcessContent() entries =\n%+v\nwant\n%+v", entries, want)
+	}
+
+	MarkDownloaded(entries, map[MediaTarget]bool{{URL: "https://example.com/wp-content/uploads/a.jpg"}: true})
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := WriteManifest(path, entries); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0].ID != 1 || read[1].ID != 2 {
+		t.Fatalf("ReadManifest() = %+v, want entries 1 and 2 in ID order", read)
+	}
+	if !read[0].Media[0].Downloaded {
+		t.Errorf("media of entry 1 not marked as downloaded: %+v", read[0].Media)
+	}
+}
+
+// frontmatterValue returns the value of a key of the YAML frontmatter of an
+// output file, unquoted
+func frontmatterValue(t *testing.T, path string, key string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, key+": "); ok {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+func TestFeaturedImageFrontmatter(t *testing.T) {
+	const featured = "https://example.com/wp-content/uploads/2024/03/hero.jpg"
+	tests := []struct {
+		name      string
+		configure func(cfg *Config)
+		want      string
+		wantFile  func(c *Converter) string
+	}{
+		{
+			name: "local path",
+			want: "/wp-content/uploads/2024/03/hero.jpg",
+			wantFile: func(c *Converter) string {
+				return filepath.Join(c.Config.MediaOutputDir, "wp-content/uploads/2024/03/hero.jpg")
+			},
+		},
+		{
+			name:      "colocated",
+			configure: func(cfg *Config) { cfg.ColocateMedia = true },
+			want:      "./hero.jpg",
+			wantFile: func(c *Converter) string {
+				return filepath.Join(c.Config.PostsOutputDir, "hero-post", "hero.jpg")
+			},
+		},
+		{
+			name:      "kept absolute",
+			configure: func(cfg *Config) { cfg.KeepAbsoluteMediaURLs = true },
+			want:      featured,
+			wantFile: func(c *Converter) string {
+				return filepath.Join(c.Config.MediaOutputDir, "wp-content/uploads/2024/03/hero.jpg")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, tt.configure)
+			post := testPost(1, "hero-post", "<p>Text</p>")
+			post.FeaturedImage = featured
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+
+			if got := frontmatterValue(t, entries[0].MDXPath, "featuredImage"); got != tt.want {
+				t.Errorf("featuredImage = %q, want %q", got, tt.want)
+			}
+			var media *MediaEntry
+			for i := range entries[0].Media {
+				if entries[0].Media[i].URL == featured {
+					media = &entries[0].Media[i]
+				}
+			}
+			if media == nil {
+				t.Fatalf("featured image missing from the media %+v", entries[0].Media)
+			}
+			if got := media.OutputPath(c.Config.BaseURL, c.Config.MediaOutputDir); got != tt.wantFile(c) {
+				t.Errorf("featured image saved at %q, want %q", got, tt.wantFile(c))
+			}
+		})
+	}
+}
+
+func TestColocatedMedia(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.ColocateMedia = true })
+	post := testPost(1, "my-post", `<p><img src="https://example.com/wp-content/uploads/2024/03/img1.jpg" alt="One"></p>`+
+		`<p><img src="/wp-content/uploads/2024/04/img1.jpg" alt="Two"></p>`+
+		`<p><img src="https://cdn.example.org/img2.jpg" alt="Elsewhere"></p>`)
+	entries := c.ProcessContent([]Post{post}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+
+	dir := filepath.Join(c.Config.PostsOutputDir, "my-post")
+	if want := filepath.Join(dir, "index.mdx"); entries[0].MDXPath != want {
+		t.Errorf("MDXPath = %q, want %q", entries[0].MDXPath, want)
+	}
+	wantPaths := map[string]string{
+		"https://example.com/wp-content/uploads/2024/03/img1.jpg": filepath.Join(dir, "img1.jpg"),
+		"https://example.com/wp-content/uploads/2024/04/img1.jpg": filepath.Join(dir, "2-img1.jpg"),
+		"https://cdn.example.org/img2.jpg":                        "",
+	}
+	for _, m := range entries[0].Media {
+		want, ok := wantPaths[m.URL]
+		if !ok {
+			t.Errorf("unexpected media %q", m.URL)
+			continue
+		}
+		if m.LocalPath != want {
+			t.Errorf("LocalPath of %q = %q, want %q", m.URL, m.LocalPath, want)
+		}
+	}
+
+	data, err := os.ReadFile(entries[0].MDXPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{`"./img1.jpg"`, `"./2-img1.jpg"`, `"https://cdn.example.org/img2.jpg"`} {
+		if !strings.Contains(string(data), ref) {
+			t.Errorf("output does not reference %s:\n%s", ref, data)
+		}
+	}
+}
+
+func TestProcessContentDateLayouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		configure   func(cfg *Config)
+		wantPublish string
+		wantUpdated string
+	}{
+		{"date only", nil, "2024-03-01", "2024-03-02"},
+		{"with time", func(cfg *Config) { cfg.DateIncludeTime = true }, "2024-03-01T10:00:00Z", "2024-03-02T10:00:00Z"},
+		{"custom layout", func(cfg *Config) { cfg.DateOutputFormat = "Jan 2, 2006" }, "Mar 1, 2024", "Mar 2, 2024"},
+		{"custom layout with time", func(cfg *Config) { cfg.DateOutputFormat = "02/01/2006 15:04" }, "01/03/2024 10:00", "02/03/2024 10:00"},
+		{"custom layout over the time flag", func(cfg *Config) {
+			cfg.DateOutputFormat, cfg.DateIncludeTime = "January 2006", true
+		}, "March 2024", "March 2024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, tt.configure)
+			entries := c.ProcessContent([]Post{testPost(1, "dated", "<p>Text</p>")}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "publishDate"); got != tt.wantPublish {
+				t.Errorf("publishDate = %q, want %q", got, tt.wantPublish)
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "updatedDate"); got != tt.wantUpdated {
+				t.Errorf("updatedDate = %q, want %q", got, tt.wantUpdated)
+			}
+		})
+	}
+}
+
+func TestPasswordProtected(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		wantWritten bool
+		want        string
+	}{
+		{"default", "", true, "Secret recipe"},
+		{"include", "include", true, "Secret recipe"},
+		{"skip", "skip", false, ""},
+		{"placeholder", "placeholder", true, passwordProtectedNotice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.PasswordProtected = tt.mode })
+			protected := testPost(1, "protected", "<p>Secret recipe</p>")
+			protected.Password = "hunter2"
+			entries := c.ProcessContent([]Post{protected, testPost(2, "public", "<p>Public</p>")}, false)
+
+			var written *ManifestEntry
+			for i := range entries {
+				if entries[i].ID == 1 {
+					written = &entries[i]
+				}
+			}
+			if (written != nil) != tt.wantWritten {
+				t.Fatalf("protected post written = %v, want %v", written != nil, tt.wantWritten)
+			}
+			if len(entries) == 0 || entries[len(entries)-1].ID != 2 {
+				t.Errorf("public post missing from %+v", entries)
+			}
+			if written == nil {
+				return
+			}
+			data, err := os.ReadFile(written.MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("output does not contain %q:\n%s", tt.want, data)
+			}
+			if tt.mode == "placeholder" && strings.Contains(string(data), "Secret recipe") {
+				t.Errorf("placeholder output leaks the content:\n%s", data)
+			}
+			if got := frontmatterValue(t, written.MDXPath, "title"); got != "Post protected" {
+				t.Errorf("title = %q, want the frontmatter kept", got)
+			}
+		})
+	}
+}
+
+func TestProcessContentResume(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.Resume = true })
+	// testPost items were last modified on 2024-03-02
+	files := map[string]time.Time{
+		"fresh": time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+		"stale": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for slug, mtime := range files {
+		path := filepath.Join(c.Config.PostsOutputDir, slug+".mdx")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("previous run"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := c.ProcessContent([]Post{
+		testPost(1, "fresh", "<p>New content</p>"),
+		testPost(2, "stale", "<p>New content</p>"),
+		testPost(3, "new", "<p>New content</p>"),
+	}, false)
+
+	var written []int
+	for _, entry := range entries {
+		written = append(written, entry.ID)
+	}
+	if want := []int{2, 3}; !reflect.DeepEqual(written, want) {
+		t.Errorf("regenerated items %v, want %v", written, want)
+	}
+	for slug, want := range map[string]string{"fresh": "previous run", "stale": "New content", "new": "New content"} {
+		data, err := os.ReadFile(filepath.Join(c.Config.PostsOutputDir, slug+".mdx"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s.mdx = %q, want it to contain %q", slug, data, want)
+		}
+	}
+	if outputs := c.Outputs(); !slices.Contains(outputs, filepath.Join(c.Config.PostsOutputDir, "fresh.mdx")) {
+		t.Errorf("kept file missing from the outputs %q", outputs)
+	}
+}
+
+func TestIsUpToDate(t *testing.T) {
+	// The file was written at 2024-03-02 12:00 UTC
+	path := filepath.Join(t.TempDir(), "post.mdx")
+	if err := os.WriteFile(path, []byte("previous run"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	written := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, written, written); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                    string
+		updated, updatedGMT     string
+		published, publishedGMT string
+		want                    bool
+	}{
+		{"modified before", "2024-03-02 13:00:00", "2024-03-02 11:00:00", "", "", true},
+		{"modified after", "2024-03-02 11:00:00", "2024-03-02 13:00:00", "", "", false},
+		// 11:00 local is after 12:00 UTC on sites west of UTC-1
+		{"zero GMT date", "2024-03-02 11:00:00", zeroWordPressDate, "", "", false},
+		{"zero GMT date long before", "2024-03-01 20:00:00", zeroWordPressDate, "", "", true},
+		{"published only", zeroWordPressDate, zeroWordPressDate, "2024-03-02 11:00:00", "2024-03-02 11:00:00", true},
+		{"published only without GMT date", zeroWordPressDate, zeroWordPressDate, "2024-03-02 11:00:00", zeroWordPressDate, false},
+		{"no dates", zeroWordPressDate, zeroWordPressDate, zeroWordPressDate, zeroWordPressDate, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := Post{UpdatedDate: tt.updated, UpdatedGMT: tt.updatedGMT, PublishedDate: tt.published, PublishedGMT: tt.publishedGMT}
+			if got := isUpToDate(path, item); got != tt.want {
+				t.Errorf("isUpToDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if isUpToDate(filepath.Join(t.TempDir(), "missing.mdx"), Post{}) {
+		t.Error("isUpToDate() = true for a missing file")
+	}
+}
+
+func TestProcessContentMoreTag(t *testing.T) {
+	const folded = "<p>Intro <em>text</em> &amp; more.</p>\n<!--more-->\n<p>Rest</p>"
+	tests := []struct {
+		name        string
+		mode        string
+		excerpt     string
+		content     string
+		wantExcerpt string
+		wantBody    string
+	}{
+		{"default", "", "", folded, "", "Intro _text_ & more.\n\nRest"},
+		{"strip", "strip", "", folded, "", "Intro _text_ & more.\n\nRest"},
+		{"excerpt", "excerpt", "", folded, "Intro text & more.", "Intro _text_ & more.\n\nRest"},
+		{"excerpt kept", "excerpt", "Written", folded, "Written", "Intro _text_ & more.\n\nRest"},
+		{"excerpt without fold", "excerpt", "", "<p>No fold</p>", "", "No fold"},
+		{"marker", "marker", "", folded, "", "Intro _text_ & more.\n\n{/* more */}\n\nRest"},
+		{"marker with link text", "marker", "", "<p>Intro</p><!--more Read on--><p>Rest</p>", "", "Intro\n\n{/* more */}\n\nRest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.MoreTagMode = tt.mode })
+			post := testPost(3, "folded", tt.content)
+			post.Excerpt = tt.excerpt
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "excerpt"); got != tt.wantExcerpt {
+				t.Errorf("excerpt = %q, want %q", got, tt.wantExcerpt)
+			}
+			data, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, body, _ := strings.Cut(string(data), "---\n\n"); body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestProcessContentCanonicalURL(t *testing.T) {
+	const permalink = "https://example.com/2024/03/hello-world/"
+	tests := []struct {
+		name    string
+		include bool
+		isPage  bool
+		lookup  bool
+		want    string
+	}{
+		{"post", true, false, false, permalink},
+		{"page", true, true, false, permalink},
+		{"looked up", true, false, true, permalink},
+		{"disabled", false, false, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.IncludeCanonical = tt.include })
+			post := testPost(5, "hello-world", "<p>Hello</p>")
+			post.URL = permalink
+			if tt.lookup {
+				// The URL comes from the REST API instead
+				post.URL = ""
+				c.LookupURL = func(id int, isPage bool) (string, error) { return permalink, nil }
+			}
+			if tt.isPage {
+				post.PostType = "page"
+			}
+			entries := c.ProcessContent([]Post{post}, tt.isPage)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "canonicalURL"); got != tt.want {
+				t.Errorf("canonicalURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentSlug(t *testing.T) {
+	tests := []struct {
+		name    string
+		include bool
+		want    map[int]string
+	}{
+		{"included", true, map[int]string{1: "hello-world", 2: "deja-vu"}},
+		{"disabled", false, map[int]string{1: "", 2: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The slug is post_name, whatever the title
+			db, _ := newFakeDB(
+				fakeResult{match: "post_type   = 'post'", columns: []string{"ID", "title", "slug", "post_type", "status", "published_date"}, rows: [][]driver.Value{
+					{int64(1), "Hello, World!", "hello-world", "post", "publish", "2024-03-01 10:00:00"},
+					{int64(2), "Déjà vu", "deja-vu", "post", "publish", "2024-03-01 10:00:00"},
+				}},
+				fakeResult{match: "post_type   = 'page'", columns: []string{"ID"}},
+			)
+			posts, _, err := LoadFromDatabase(db, LoadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := testConverter(t, func(cfg *Config) { cfg.IncludeSlug = tt.include })
+			c.LookupURL = func(id int, isPage bool) (string, error) {
+				return fmt.Sprintf("https://example.com/?p=%d", id), nil
+			}
+			entries := c.ProcessContent(posts, false)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("ProcessContent() returned %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, entry := range entries {
+				id := posts[i].ID
+				if got := frontmatterValue(t, entry.MDXPath, "slug"); got != tt.want[id] {
+					t.Errorf("post %d: slug = %q, want %q", id, got, tt.want[id])
+				}
+			}
+		})
+	}
+}
+
+func TestProcessContentEmpty(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		skipEmpty bool
+		// wantWritten is set when the post is written
+		wantWritten bool
+	}{
+		{"no content", "", false, true},
+		{"whitespace", " \n\t", false, true},
+		{"empty markup", "<div><p>&nbsp;</p></div>", false, true},
+		{"skipped", "", true, false},
+		{"empty markup skipped", "<div><p></p></div>\n<!-- wp:paragraph -->", true, false},
+		{"content kept", "<p>Text</p>", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.SkipEmpty = tt.skipEmpty })
+			entries := c.ProcessContent([]Post{testPost(1, "empty", tt.content)}, false)
+			if got := len(entries) == 1; got != tt.wantWritten {
+				t.Fatalf("written = %v, want %v", got, tt.wantWritten)
+			}
+			mdxPath := filepath.Join(c.Config.PostsOutputDir, "empty.mdx")
+			if _, err := os.Stat(mdxPath); (err == nil) != tt.wantWritten {
+				t.Errorf("stat %s: %v, want written %v", mdxPath, err, tt.wantWritten)
+			}
+			if tt.wantWritten {
+				if got := frontmatterValue(t, mdxPath, "title"); got != "Post empty" {
+					t.Errorf("title = %q, want %q", got, "Post empty")
+				}
+			}
+		})
+	}
+}
+
+func TestSourceHTMLComment(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		mdx    bool
+		want   string
+	}{
+		{"mdx", "\n<p>Hi {name}</p>\n", true, "{/* Source HTML:\n<p>Hi {name}</p>\n*/}"},
+		{"mdx comment end", "<p>a */ b</p>", true, "{/* Source HTML:\n<p>a *\\/ b</p>\n*/}"},
+		{"markdown", "<p>Hi</p>", false, "<!-- Source HTML:\n<p>Hi</p>\n-->"},
+		{"markdown comment end", "<!-- wp:paragraph --><p>Hi</p>", false, "<!-- Source HTML:\n<!- - wp:paragraph - -><p>Hi</p>\n-->"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceHTMLComment(tt.source, tt.mdx); got != tt.want {
+				t.Errorf("sourceHTMLComment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentEmbedSourceHTML(t *testing.T) {
+	const source = "<!-- wp:paragraph -->\n<p>Hello {name} */ world</p>\n<!-- /wp:paragraph -->"
+	tests := []struct {
+		name      string
+		embed     bool
+		extension string
+		want      string
+	}{
+		{"mdx", true, ".mdx", "{/* Source HTML:\n<!-- wp:paragraph -->\n<p>Hello {name} *\\/ world</p>\n<!-- /wp:paragraph -->\n*/}\n"},
+		{"markdown", true, ".md", "<!-- Source HTML:\n<!- - wp:paragraph - ->\n<p>Hello {name} */ world</p>\n<!- - /wp:paragraph - ->\n-->\n"},
+		{"disabled", false, ".mdx", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.EmbedSourceHTML = tt.embed
+				cfg.OutputExtension = tt.extension
+			})
+			entries := c.ProcessContent([]Post{testPost(1, "hello", source)}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if filepath.Ext(entries[0].MDXPath) != tt.extension {
+				t.Errorf("wrote %s, want a %s file", entries[0].MDXPath, tt.extension)
+			}
+			data, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(data)
+			if tt.want == "" {
+				if strings.Contains(got, "Source HTML") {
+					t.Errorf("source HTML embedded:\n%s", got)
+				}
+				return
+			}
+			if !strings.HasSuffix(got, "\n\n"+tt.want) {
+				t.Errorf("output doesn't end with the source HTML comment %q:\n%s", tt.want, got)
+			}
+			if tt.extension == ".mdx" {
+				if issues := ValidateMDX(got); len(issues) > 0 {
+					t.Errorf("ValidateMDX() = %+v, want no issues", issues)
+				}
+			}
+		})
+	}
+}
+
+func TestContentSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    string
+	}{
+		{"empty", "", 60, "(empty)"},
+		{"whitespace", " \n ", 60, "(empty)"},
+		{"short", " Hello ", 60, "Hello"},
+		{"exact", "Hello", 5, "Hello"},
+		{"truncated", "Hello, world", 5, "Hello..."},
+		{"multibyte", "日本語のテキスト", 3, "日本語..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentSnippet(tt.content, tt.n); got != tt.want {
+				t.Errorf("contentSnippet(%q, %d) = %q, want %q", tt.content, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentComments(t *testing.T) {
+	comments := []Comment{
+		{ID: 5, Author: "Ana", AuthorURL: "https://ana.example", Date: "2024-03-02 08:00:00", Content: "First!"},
+		{ID: 6, Parent: 5, Author: "Bo", Date: "2024-03-02 09:00:00", Content: "Reply"},
+	}
+	const wantExport = `[
+  {
+    "id": 5,
+    "author": "Ana",
+    "authorUrl": "https://ana.example",
+    "date": "2024-03-02T08:00:00",
+    "content": "First!"
+  },
+  {
+    "id": 6,
+    "parent": 5,
+    "author": "Bo",
+    "date": "2024-03-02T09:00:00",
+    "content": "Reply"
+  }
+]
+`
+	tests := []struct {
+		name       string
+		mode       string
+		colocate   bool
+		wantCount  string
+		wantExport string
+	}{
+		{"off", "", false, "", ""},
+		{"count", "count", false, "2", ""},
+		{"export", "export", false, "2", wantExport},
+		{"export colocated", "export", true, "2", wantExport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.IncludeComments = tt.mode
+				cfg.ColocateMedia = tt.colocate
+			})
+			post := testPost(1, "discussed", "<p>Text</p>")
+			post.CommentCount, post.Comments = 2, comments
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "commentCount"); got != tt.wantCount {
+				t.Errorf("commentCount = %q, want %q", got, tt.wantCount)
+			}
+
+			path := commentsFilePath(entries[0].MDXPath, ".mdx", tt.colocate)
+			data, err := os.ReadFile(path)
+			if tt.wantExport == "" {
+				if err == nil {
+					t.Errorf("comments exported to %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantExport {
+				t.Errorf("%s =\n%s\nwant\n%s", path, data, tt.wantExport)
+			}
+		})
+	}
+}
+
+func TestProcessContentSticky(t *testing.T) {
+	tests := []struct {
+		name     string
+		featured bool
+		want     string
+	}{
+		{"sticky", true, "true"},
+		{"not sticky", false, "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, nil)
+			post := testPost(1, "pinned", "<p>Text</p>")
+			post.IsFeatured = tt.featured
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "isFeatured"); got != tt.want {
+				t.Errorf("isFeatured = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
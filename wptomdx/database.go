@@ -0,0 +1,881 @@
+package wptomdx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Post represents a WordPress post with title, publish date, update date, HTML content, and related taxonomies.
+type Post struct {
+	ID            int       `db:"ID"`
+	Title         string    `db:"title"`
+	PublishedDate string    `db:"published_date"`
+	UpdatedDate   string    `db:"updated_date"`
+	PublishedGMT  string    `db:"published_date_gmt"`
+	UpdatedGMT    string    `db:"updated_date_gmt"`
+	Content       string    `db:"content"`
+	Excerpt       string    `db:"excerpt"`
+	PostType      string    `db:"post_type"`
+	Status        string    `db:"status"`
+	Password      string    `db:"password"`
+	Slug          string    `db:"slug"`
+	GUID          string    `db:"guid"`
+	ParentPath    string    // Slugs of a page's ancestors, e.g. "about/team"
+	CommentCount  int       `db:"comment_count"`
+	AuthorID      int       `db:"author_id"`
+	Author        string    // Slug of the author when authors are exported
+	Series        string    // Name of the series the post belongs to, if any
+	SeriesOrder   int       // Position of the post in its series, from 1
+	Comments      []Comment // Approved comments, when requested through LoadOptions.Comments
+	URL           string    // Will be populated from WordPress API
+	Tags          []string  // Will be populated separately
+	Categories    []string  // Will be populated separately
+	IsFeatured    bool      // Set for sticky posts
+	FeaturedImage string    // Will be populated from WordPress API
+	// Meta holds the post meta values requested through LoadOptions.MetaKeys
+	Meta map[string]string
+}
+
+// TablePrefix builds the table prefix for a blog. On multisite installs every
+// blog except the main site (blog_id 1) has its blog ID appended to the prefix,
+// e.g. "wp_2_".
+func TablePrefix(basePrefix string, blogID int) string {
+	if basePrefix == "" {
+		basePrefix = "wp_"
+	}
+	if blogID > 1 {
+		return fmt.Sprintf("%s%d_", basePrefix, blogID)
+	}
+	return basePrefix
+}
+
+// Tables names the WordPress tables a blog's content is read from
+type Tables struct {
+	// Prefix is prepended to the blog's tables, "wp_" when empty. See
+	// TablePrefix for the tables of multisite blogs.
+	Prefix string
+	// UsersPrefix is prepended to wp_users and wp_usermeta, which multisite
+	// blogs share with the main site instead of having their own. It is "wp_"
+	// when empty.
+	UsersPrefix string
+}
+
+// table returns the prefixed name of a blog table, e.g. "posts" -> "wp_posts"
+func (t Tables) table(name string) string {
+	if t.Prefix == "" {
+		return "wp_" + name
+	}
+	return t.Prefix + name
+}
+
+// usersTable returns the prefixed name of a users table, e.g. "users" -> "wp_users"
+func (t Tables) usersTable(name string) string {
+	if t.UsersPrefix == "" {
+		return "wp_" + name
+	}
+	return t.UsersPrefix + name
+}
+
+// ConnectDB establishes a connection to the MySQL database. Its errors are
+// DatabaseErrors.
+func ConnectDB(host, port, user, password, dbName string) (*sqlx.DB, error) {
+	dsn := fmt.Sprintf(
+		"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=true&loc=Local",
+		user, password, host, port, dbName,
+	)
+	db, err := sqlx.Connect("mysql", dsn)
+	if err != nil {
+		return nil, &DatabaseError{Err: err}
+	}
+	return db, nil
+}
+
+// QueryWindow restricts a query to a subset of its rows. A zero Limit means
+// no limit.
+type QueryWindow struct {
+	Limit  int `yaml:"limit"`
+	Offset int `yaml:"offset"`
+}
+
+// clause returns the LIMIT/OFFSET SQL for the window and its arguments
+func (w QueryWindow) clause() (string, []interface{}) {
+	switch {
+	case w.Limit > 0:
+		return "LIMIT ? OFFSET ?", []interface{}{w.Limit, w.Offset}
+	case w.Offset > 0:
+		// MySQL needs a LIMIT to use OFFSET; this is the documented "all rows" value
+		return "LIMIT 18446744073709551615 OFFSET ?", []interface{}{w.Offset}
+	default:
+		return "", nil
+	}
+}
+
+// Apply returns the part of posts that falls within the window, mirroring
+// what the LIMIT/OFFSET clause does for database queries
+func (w QueryWindow) Apply(posts []Post) []Post {
+	if w.Offset >= len(posts) {
+		return nil
+	}
+	posts = posts[w.Offset:]
+	if w.Limit > 0 && w.Limit < len(posts) {
+		posts = posts[:w.Limit]
+	}
+	return posts
+}
+
+// TaxonomyFilter restricts posts to the ones in (or not in) the given
+// categories and tags, named by name or slug
+type TaxonomyFilter struct {
+	IncludeCategories []string `yaml:"include_categories"`
+	IncludeTags       []string `yaml:"include_tags"`
+	ExcludeCategories []string `yaml:"exclude_categories"`
+	ExcludeTags       []string `yaml:"exclude_tags"`
+	// MatchAll requires a post to have every included term instead of any of them
+	MatchAll bool `yaml:"match_all"`
+}
+
+// clause returns the SQL conditions restricting posts to the filter and their
+// arguments, resolving every term to its term_taxonomy_ids first
+func (f TaxonomyFilter) clause(db *sqlx.DB, tables Tables) (string, []interface{}, error) {
+	include, err := resolveTerms(db, tables, f.IncludeCategories, f.IncludeTags)
+	if err != nil {
+		return "", nil, err
+	}
+	exclude, err := resolveTerms(db, tables, f.ExcludeCategories, f.ExcludeTags)
+	if err != nil {
+		return "", nil, err
+	}
+
+	membership := fmt.Sprintf("ID %%s (SELECT object_id FROM %s WHERE term_taxonomy_id IN (?))", tables.table("term_relationships"))
+	var conditions []string
+	var args []interface{}
+	if f.MatchAll {
+		// One condition per term, so a post needs all of them
+		for _, ids := range include {
+			conditions = append(conditions, fmt.Sprintf(membership, "IN"))
+			args = append(args, ids)
+		}
+	} else if len(include) > 0 {
+		var ids []int
+		for _, termIDs := range include {
+			ids = append(ids, termIDs...)
+		}
+		conditions = append(conditions, fmt.Sprintf(membership, "IN"))
+		args = append(args, ids)
+	}
+	if len(exclude) > 0 {
+		var ids []int
+		for _, termIDs := range exclude {
+			ids = append(ids, termIDs...)
+		}
+		conditions = append(conditions, fmt.Sprintf(membership, "NOT IN"))
+		args = append(args, ids)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return "AND " + strings.Join(conditions, " AND "), args, nil
+}
+
+// resolveTerms looks up the term_taxonomy_ids of every category and tag, one
+// list per term. Terms that don't exist are reported as an error.
+func resolveTerms(db *sqlx.DB, tables Tables, categories []string, tags []string) ([][]int, error) {
+	var resolved [][]int
+	for _, group := range []struct {
+		taxonomy string
+		label    string
+		names    []string
+	}{{"category", "category", categories}, {"post_tag", "tag", tags}} {
+		for _, name := range group.names {
+			var ids []int
+			query := fmt.Sprintf(`
+				SELECT tt.term_taxonomy_id
+				FROM %s t
+				INNER JOIN %s tt ON t.term_id = tt.term_id
+				WHERE tt.taxonomy = ?
+				AND (t.name = ? OR t.slug = ?);
+			`, tables.table("terms"), tables.table("term_taxonomy"))
+			if err := db.Select(&ids, query, group.taxonomy, name, name); err != nil {
+				return nil, fmt.Errorf("error resolving %s %q: %v", group.label, name, err)
+			}
+			if len(ids) == 0 {
+				return nil, fmt.Errorf("unknown %s %q", group.label, name)
+			}
+			resolved = append(resolved, ids)
+		}
+	}
+	return resolved, nil
+}
+
+// Apply returns the posts matching the filter by term name, mirroring what
+// the SQL conditions do for database queries
+func (f TaxonomyFilter) Apply(posts []Post) []Post {
+	if len(f.IncludeCategories)+len(f.IncludeTags)+len(f.ExcludeCategories)+len(f.ExcludeTags) == 0 {
+		return posts
+	}
+	var filtered []Post
+	for _, post := range posts {
+		if f.matches(post) {
+			filtered = append(filtered, post)
+		}
+	}
+	return filtered
+}
+
+// matches reports whether post has the included terms and none of the excluded ones
+func (f TaxonomyFilter) matches(post Post) bool {
+	wanted := len(f.IncludeCategories) + len(f.IncludeTags)
+	found := 0
+	for _, name := range f.IncludeCategories {
+		if containsFold(post.Categories, name) {
+			found++
+		}
+	}
+	for _, name := range f.IncludeTags {
+		if containsFold(post.Tags, name) {
+			found++
+		}
+	}
+	if wanted > 0 && (found == 0 || f.MatchAll && found < wanted) {
+		return false
+	}
+
+	for _, name := range f.ExcludeCategories {
+		if containsFold(post.Categories, name) {
+			return false
+		}
+	}
+	for _, name := range f.ExcludeTags {
+		if containsFold(post.Tags, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchPosts retrieves the published posts matching filter within window from the database
+func FetchPosts(db *sqlx.DB, tables Tables, window QueryWindow, filter TaxonomyFilter) ([]Post, error) {
+	query, args, err := postsQuery(db, tables, window, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []Post
+	if err := db.Select(&posts, query, args...); err != nil {
+		return nil, fmt.Errorf("query execution error: %v", err)
+	}
+
+	return posts, nil
+}
+
+// FetchPostSlugs retrieves the slugs of the published posts matching filter
+// within window, without reading the posts themselves
+func FetchPostSlugs(db *sqlx.DB, tables Tables, window QueryWindow, filter TaxonomyFilter) (map[string]bool, error) {
+	query, args, err := postsQueryColumns(db, tables, window, filter, "post_name")
+	if err != nil {
+		return nil, err
+	}
+
+	var slugs []string
+	if err := db.Select(&slugs, query, args...); err != nil {
+		return nil, fmt.Errorf("error fetching post slugs: %v", err)
+	}
+	set := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		if slug != "" {
+			set[slug] = true
+		}
+	}
+	return set, nil
+}
+
+// postsQuery builds the query selecting the published posts matching filter within window
+func postsQuery(db *sqlx.DB, tables Tables, window QueryWindow, filter TaxonomyFilter) (string, []interface{}, error) {
+	return postsQueryColumns(db, tables, window, filter, postColumns)
+}
+
+// postColumns are the columns of the posts table read into a Post
+const postColumns = `
+          ID,
+          post_title   AS title,
+          post_date    AS published_date,
+          post_modified AS updated_date,
+          post_date_gmt AS published_date_gmt,
+          post_modified_gmt AS updated_date_gmt,
+          post_content AS content,
+          post_excerpt AS excerpt,
+          post_type,
+          post_status  AS status,
+          post_password AS password,
+          post_name     AS slug,
+          guid,
+          post_author   AS author_id,
+          comment_count`
+
+// postsQueryColumns builds the query selecting columns of the published posts
+// matching filter within window
+func postsQueryColumns(db *sqlx.DB, tables Tables, window QueryWindow, filter TaxonomyFilter, columns string) (string, []interface{}, error) {
+	filterClause, args, err := filter.clause(db, tables)
+	if err != nil {
+		return "", nil, err
+	}
+	limitClause, limitArgs := window.clause()
+	args = append(args, limitArgs...)
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE
+          post_type   = 'post'
+          AND post_status = 'publish'
+          %s
+        ORDER BY post_date DESC
+        %s;
+    `, columns, tables.table("posts"), filterClause, limitClause)
+
+	// Expand the term ID lists of the filter
+	if len(filterClause) > 0 {
+		query, args, err = sqlx.In(query, args...)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to build query: %v", err)
+		}
+		query = db.Rebind(query)
+	}
+	return query, args, nil
+}
+
+// FetchPostTags retrieves all tags for a post
+func FetchPostTags(db *sqlx.DB, tables Tables, postID int) ([]string, error) {
+	var tags []string
+	query := fmt.Sprintf(`
+		SELECT t.name
+		FROM %s t
+		INNER JOIN %s tt ON t.term_id = tt.term_id
+		INNER JOIN %s tr ON tt.term_taxonomy_id = tr.term_taxonomy_id
+		WHERE tr.object_id = ?
+		AND tt.taxonomy = 'post_tag';
+	`, tables.table("terms"), tables.table("term_taxonomy"), tables.table("term_relationships"))
+	if err := db.Select(&tags, query, postID); err != nil {
+		return nil, fmt.Errorf("error fetching tags for post %d: %v", postID, err)
+	}
+	return tags, nil
+}
+
+// FetchPostCategories retrieves all categories for a post
+func FetchPostCategories(db *sqlx.DB, tables Tables, postID int) ([]string, error) {
+	var categories []string
+	query := fmt.Sprintf(`
+		SELECT t.name
+		FROM %s t
+		INNER JOIN %s tt ON t.term_id = tt.term_id
+		INNER JOIN %s tr ON tt.term_taxonomy_id = tr.term_taxonomy_id
+		WHERE tr.object_id = ?
+		AND tt.taxonomy = 'category';
+	`, tables.table("terms"), tables.table("term_taxonomy"), tables.table("term_relationships"))
+	if err := db.Select(&categories, query, postID); err != nil {
+		return nil, fmt.Errorf("error fetching categories for post %d: %v", postID, err)
+	}
+	return categories, nil
+}
+
+// batchSize caps the number of IDs sent in a single IN (...) clause
+const batchSize = 1000
+
+// FetchTagsForPosts retrieves the tags of all given posts in one query per batch, keyed by post ID
+func FetchTagsForPosts(db *sqlx.DB, tables Tables, postIDs []int) (map[int][]string, error) {
+	tags, err := fetchTermsForPosts(db, tables, postIDs, "post_tag")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tags: %v", err)
+	}
+	return tags, nil
+}
+
+// FetchCategoriesForPosts retrieves the categories of all given posts in one query per batch, keyed by post ID
+func FetchCategoriesForPosts(db *sqlx.DB, tables Tables, postIDs []int) (map[int][]string, error) {
+	categories, err := fetchTermsForPosts(db, tables, postIDs, "category")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching categories: %v", err)
+	}
+	return categories, nil
+}
+
+// fetchTermsForPosts retrieves the term names of a taxonomy for many posts at once
+func fetchTermsForPosts(db *sqlx.DB, tables Tables, postIDs []int, taxonomy string) (map[int][]string, error) {
+	terms := make(map[int][]string)
+	for start := 0; start < len(postIDs); start += batchSize {
+		end := min(start+batchSize, len(postIDs))
+
+		query, args, err := sqlx.In(fmt.Sprintf(`
+			SELECT tr.object_id AS post_id, t.name
+			FROM %s t
+			INNER JOIN %s tt ON t.term_id = tt.term_id
+			INNER JOIN %s tr ON tt.term_taxonomy_id = tr.term_taxonomy_id
+			WHERE tr.object_id IN (?)
+			AND tt.taxonomy = ?;
+		`, tables.table("terms"), tables.table("term_taxonomy"), tables.table("term_relationships")), postIDs[start:end], taxonomy)
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []struct {
+			PostID int    `db:"post_id"`
+			Name   string `db:"name"`
+		}
+		if err := db.Select(&rows, db.Rebind(query), args...); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			terms[row.PostID] = append(terms[row.PostID], row.Name)
+		}
+	}
+	return terms, nil
+}
+
+// FetchFeaturedImagesForPosts retrieves the featured image URLs of all given posts
+// in one query per batch, keyed by post ID. Posts without a featured image are absent.
+func FetchFeaturedImagesForPosts(db *sqlx.DB, tables Tables, postIDs []int) (map[int]string, error) {
+	images := make(map[int]string)
+	for start := 0; start < len(postIDs); start += batchSize {
+		end := min(start+batchSize, len(postIDs))
+
+		query, args, err := sqlx.In(fmt.Sprintf(`
+			SELECT pm.post_id, a.guid
+			FROM %s pm
+			INNER JOIN %s a ON a.ID = CAST(pm.meta_value AS UNSIGNED)
+			WHERE pm.post_id IN (?)
+			AND pm.meta_key = '_thumbnail_id';
+		`, tables.table("postmeta"), tables.table("posts")), postIDs[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("error building featured image query: %v", err)
+		}
+
+		var rows []struct {
+			PostID int    `db:"post_id"`
+			GUID   string `db:"guid"`
+		}
+		if err := db.Select(&rows, db.Rebind(query), args...); err != nil {
+			return nil, fmt.Errorf("error fetching featured images: %v", err)
+		}
+		for _, row := range rows {
+			images[row.PostID] = row.GUID
+		}
+	}
+	return images, nil
+}
+
+// FetchMetaForPosts retrieves the given meta keys of all given posts in one
+// query per batch, keyed by post ID and then meta key
+func FetchMetaForPosts(db *sqlx.DB, tables Tables, postIDs []int, keys []string) (map[int]map[string]string, error) {
+	meta := make(map[int]map[string]string)
+	if len(keys) == 0 {
+		return meta, nil
+	}
+	for start := 0; start < len(postIDs); start += batchSize {
+		end := min(start+batchSize, len(postIDs))
+
+		query, args, err := sqlx.In(fmt.Sprintf(`
+			SELECT post_id, meta_key, meta_value
+			FROM %s
+			WHERE post_id IN (?)
+			AND meta_key IN (?);
+		`, tables.table("postmeta")), postIDs[start:end], keys)
+		if err != nil {
+			return nil, fmt.Errorf("error building post meta query: %v", err)
+		}
+
+		var rows []struct {
+			PostID int    `db:"post_id"`
+			Key    string `db:"meta_key"`
+			Value  string `db:"meta_value"`
+		}
+		if err := db.Select(&rows, db.Rebind(query), args...); err != nil {
+			return nil, fmt.Errorf("error fetching post meta: %v", err)
+		}
+		for _, row := range rows {
+			if meta[row.PostID] == nil {
+				meta[row.PostID] = make(map[string]string)
+			}
+			meta[row.PostID][row.Key] = row.Value
+		}
+	}
+	return meta, nil
+}
+
+// FetchCommentCount counts the approved comments on a post. Like the
+// comment_count column, the count includes pingbacks and trackbacks.
+func FetchCommentCount(db *sqlx.DB, tables Tables, postID int) (int, error) {
+	var count int
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s
+		WHERE comment_post_ID = ?
+		AND comment_approved = '1';
+	`, tables.table("comments"))
+	if err := db.Get(&count, query, postID); err != nil {
+		return 0, fmt.Errorf("error fetching comment count: %v", err)
+	}
+	return count, nil
+}
+
+// FetchCommentsForPosts retrieves the approved comments, oldest first, of
+// multiple posts. Pingbacks and trackbacks are left out.
+func FetchCommentsForPosts(db *sqlx.DB, tables Tables, postIDs []int) (map[int][]Comment, error) {
+	comments := make(map[int][]Comment)
+	for start := 0; start < len(postIDs); start += batchSize {
+		end := min(start+batchSize, len(postIDs))
+
+		query, args, err := sqlx.In(fmt.Sprintf(`
+			SELECT comment_post_ID, comment_ID, comment_parent, comment_author,
+			       comment_author_url, comment_date, comment_content
+			FROM %s
+			WHERE comment_post_ID IN (?)
+			AND comment_approved = '1'
+			AND comment_type IN ('', 'comment')
+			ORDER BY comment_date ASC, comment_ID ASC;
+		`, tables.table("comments")), postIDs[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("error building comments query: %v", err)
+		}
+
+		var rows []struct {
+			PostID int `db:"comment_post_ID"`
+			Comment
+		}
+		if err := db.Select(&rows, db.Rebind(query), args...); err != nil {
+			return nil, fmt.Errorf("error fetching comments: %v", err)
+		}
+		for _, row := range rows {
+			comments[row.PostID] = append(comments[row.PostID], row.Comment)
+		}
+	}
+	return comments, nil
+}
+
+// FetchStickyPostIDs retrieves the IDs of the posts stuck to the front page,
+// which WordPress keeps as a PHP-serialized array in the sticky_posts option
+func FetchStickyPostIDs(db *sqlx.DB, tables Tables) (map[int]bool, error) {
+	var raw string
+	query := fmt.Sprintf(`
+		SELECT option_value
+		FROM %s
+		WHERE option_name = 'sticky_posts';
+	`, tables.table("options"))
+	if err := db.Get(&raw, query); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return map[int]bool{}, nil
+		}
+		return nil, fmt.Errorf("error fetching sticky posts: %v", err)
+	}
+	ids, err := parsePHPIntArray(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sticky posts: %v", err)
+	}
+	sticky := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		sticky[id] = true
+	}
+	return sticky, nil
+}
+
+// FetchFeaturedImage retrieves the featured image URL for a post
+func FetchFeaturedImage(db *sqlx.DB, tables Tables, postID int) (string, error) {
+	var featuredImageID int
+	query := fmt.Sprintf(`
+		SELECT meta_value
+		FROM %s
+		WHERE post_id = ?
+		AND meta_key = '_thumbnail_id';
+	`, tables.table("postmeta"))
+	if err := db.Get(&featuredImageID, query, postID); err != nil {
+		// Posts without a _thumbnail_id simply have no featured image
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error fetching featured image ID for post %d: %v", postID, err)
+	}
+
+	if featuredImageID > 0 {
+		var imageURL string
+		query := fmt.Sprintf(`
+			SELECT guid
+			FROM %s
+			WHERE ID = ?;
+		`, tables.table("posts"))
+		if err := db.Get(&imageURL, query, featuredImageID); err != nil {
+			return "", fmt.Errorf("error fetching featured image URL for post %d: %v", postID, err)
+		}
+		return imageURL, nil
+	}
+
+	return "", nil
+}
+
+// FetchPages retrieves the published pages within window from the WordPress database
+func FetchPages(db *sqlx.DB, tables Tables, window QueryWindow) ([]Post, error) {
+	query, args := pagesQuery(tables, window)
+
+	var pages []Post
+	if err := db.Select(&pages, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch pages: %v", err)
+	}
+
+	return pages, nil
+}
+
+// pagesQuery builds the query selecting the published pages within window
+func pagesQuery(tables Tables, window QueryWindow) (string, []interface{}) {
+	limitClause, args := window.clause()
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE
+          post_type   = 'page'
+          AND post_status = 'publish'
+        ORDER BY post_date DESC
+        %s;
+    `, postColumns, tables.table("posts"), limitClause)
+	return query, args
+}
+
+// FetchPageTree retrieves the slug and parent of every page regardless of its
+// status or the window, since WordPress nests pages under unpublished parents too
+func FetchPageTree(db *sqlx.DB, tables Tables) (map[int]PageNode, error) {
+	query := fmt.Sprintf(`
+        SELECT ID, post_name AS slug, post_parent AS parent
+        FROM %s
+        WHERE post_type = 'page';
+    `, tables.table("posts"))
+
+	var nodes []PageNode
+	if err := db.Select(&nodes, query); err != nil {
+		return nil, fmt.Errorf("failed to fetch page hierarchy: %v", err)
+	}
+	tree := make(map[int]PageNode, len(nodes))
+	for _, node := range nodes {
+		tree[node.ID] = node
+	}
+	return tree, nil
+}
+
+// AttachmentResolver looks up the URLs of attachments (e.g. gallery images) by ID
+type AttachmentResolver interface {
+	AttachmentURLs(ids []int) ([]string, error)
+}
+
+// DBAttachments resolves attachments from the WordPress database
+type DBAttachments struct {
+	DB     *sqlx.DB
+	Tables Tables
+}
+
+// AttachmentURLs looks up the attachment URLs with GetImageURLsFromDB
+func (a DBAttachments) AttachmentURLs(ids []int) ([]string, error) {
+	return GetImageURLsFromDB(a.DB, a.Tables, ids)
+}
+
+// GetImageURLsFromDB simply SELECTs the GUID column
+func GetImageURLsFromDB(db *sqlx.DB, tables Tables, ids []int) ([]string, error) {
+	stmt, err := db.Prepare(fmt.Sprintf(`
+        SELECT guid
+          FROM %s
+         WHERE ID = ?
+           AND post_type = 'attachment'
+    `, tables.table("posts")))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var urls []string
+	for _, id := range ids {
+		var url string
+		if err := stmt.QueryRow(id).Scan(&url); err != nil {
+			return nil, fmt.Errorf("id %d: %w", id, err)
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// LoadOptions selects what LoadFromDatabase reads
+type LoadOptions struct {
+	// Tables are the tables the blog is read from
+	Tables Tables
+	// Window limits the posts and pages that are read
+	Window QueryWindow
+	// Taxonomy restricts the posts to some categories and tags
+	Taxonomy TaxonomyFilter
+	// MetaKeys are the post meta values loaded into Post.Meta
+	MetaKeys []string
+	// Comments loads the approved comments into Post.Comments
+	Comments bool
+}
+
+// LoadFromDatabase fetches the posts and pages selected by opts along with
+// their tags, categories, featured images, sticky flags, requested meta values
+// and comments. Its errors are DatabaseErrors.
+func LoadFromDatabase(db *sqlx.DB, opts LoadOptions) ([]Post, []Post, error) {
+	posts, err := FetchPosts(db, opts.Tables, opts.Window, opts.Taxonomy)
+	if err != nil {
+		return nil, nil, &DatabaseError{Err: fmt.Errorf("failed to fetch posts: %v", err)}
+	}
+	pages, err := FetchPages(db, opts.Tables, opts.Window)
+	if err != nil {
+		return nil, nil, &DatabaseError{Err: fmt.Errorf("failed to fetch pages: %v", err)}
+	}
+
+	tree, err := FetchPageTree(db, opts.Tables)
+	if err != nil {
+		return nil, nil, &DatabaseError{Err: err}
+	}
+	ResolvePageParents(pages, tree)
+
+	// Fetch taxonomies and featured images for all posts and pages up front
+	items := append(append(make([]Post, 0, len(posts)+len(pages)), posts...), pages...)
+	sticky, err := FetchStickyPostIDs(db, opts.Tables)
+	if err != nil {
+		return nil, nil, &DatabaseError{Err: err}
+	}
+	if err := loadDetails(db, items, opts, sticky); err != nil {
+		return nil, nil, &DatabaseError{Err: err}
+	}
+	return items[:len(posts):len(posts)], items[len(posts):], nil
+}
+
+// loadDetails fills in the tags, categories, featured images, meta values and
+// comments of items in place, marking the posts among sticky as featured
+func loadDetails(db *sqlx.DB, items []Post, opts LoadOptions, sticky map[int]bool) error {
+	ids := make([]int, 0, len(items))
+	for _, p := range items {
+		ids = append(ids, p.ID)
+	}
+	tags, err := FetchTagsForPosts(db, opts.Tables, ids)
+	if err != nil {
+		return err
+	}
+	categories, err := FetchCategoriesForPosts(db, opts.Tables, ids)
+	if err != nil {
+		return err
+	}
+	featuredImages, err := FetchFeaturedImagesForPosts(db, opts.Tables, ids)
+	if err != nil {
+		return err
+	}
+	meta, err := FetchMetaForPosts(db, opts.Tables, ids, opts.MetaKeys)
+	if err != nil {
+		return err
+	}
+	var comments map[int][]Comment
+	if opts.Comments {
+		if comments, err = FetchCommentsForPosts(db, opts.Tables, ids); err != nil {
+			return err
+		}
+	}
+
+	for i := range items {
+		items[i].Tags = tags[items[i].ID]
+		items[i].Categories = categories[items[i].ID]
+		items[i].FeaturedImage = featuredImages[items[i].ID]
+		items[i].Meta = meta[items[i].ID]
+		items[i].Comments = comments[items[i].ID]
+		items[i].IsFeatured = items[i].PostType == "post" && sticky[items[i].ID]
+		unescapeEntities(&items[i])
+	}
+	return nil
+}
+
+// streamBatchSize is how many streamed rows are read before their details are
+// fetched and they are handed on
+const streamBatchSize = 100
+
+// StreamFromDatabase reads the posts and then the pages selected by opts like
+// LoadFromDatabase, but hands each one to fn as soon as its batch is read
+// instead of loading the whole site into memory first. Its errors are
+// DatabaseErrors.
+func StreamFromDatabase(db *sqlx.DB, opts LoadOptions, fn func(post Post, isPage bool)) error {
+	tree, err := FetchPageTree(db, opts.Tables)
+	if err != nil {
+		return &DatabaseError{Err: err}
+	}
+	// The sticky posts are one option, read once rather than for every batch
+	sticky, err := FetchStickyPostIDs(db, opts.Tables)
+	if err != nil {
+		return &DatabaseError{Err: err}
+	}
+
+	query, args, err := postsQuery(db, opts.Tables, opts.Window, opts.Taxonomy)
+	if err != nil {
+		return &DatabaseError{Err: err}
+	}
+	if err := streamQuery(db, query, args, opts, sticky, func(batch []Post) {
+		for _, post := range batch {
+			fn(post, false)
+		}
+	}); err != nil {
+		return &DatabaseError{Err: fmt.Errorf("failed to stream posts: %v", err)}
+	}
+
+	query, args = pagesQuery(opts.Tables, opts.Window)
+	if err := streamQuery(db, query, args, opts, sticky, func(batch []Post) {
+		ResolvePageParents(batch, tree)
+		for _, page := range batch {
+			fn(page, true)
+		}
+	}); err != nil {
+		return &DatabaseError{Err: fmt.Errorf("failed to stream pages: %v", err)}
+	}
+	return nil
+}
+
+// streamQuery scans the rows of query one by one, passing them on to fn in
+// batches with their details loaded
+func streamQuery(db *sqlx.DB, query string, args []interface{}, opts LoadOptions, sticky map[int]bool, fn func(batch []Post)) error {
+	rows, err := db.Queryx(query, args...)
+	if err != nil {
+		return fmt.Errorf("query execution error: %v", err)
+	}
+	defer rows.Close()
+
+	batch := make([]Post, 0, streamBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := loadDetails(db, batch, opts, sticky); err != nil {
+			return err
+		}
+		fn(batch)
+		batch = make([]Post, 0, streamBatchSize)
+		return nil
+	}
+	for rows.Next() {
+		var post Post
+		if err := rows.StructScan(&post); err != nil {
+			return fmt.Errorf("failed to scan row: %v", err)
+		}
+		if batch = append(batch, post); len(batch) == streamBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read rows: %v", err)
+	}
+	return flush()
+}
@@ -0,0 +1,721 @@
+package wptomdx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeResult is the answer of a fakeDB to the queries containing match: rows,
+// or the rows rowsFor gives for the query and its arguments
+type fakeResult struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+	rowsFor func(query string, args []driver.Value) [][]driver.Value
+	err     error
+}
+
+// fakeDB answers queries with the first result whose match they contain, or
+// with no rows, and records every query it is sent
+type fakeDB struct {
+	results []fakeResult
+
+	mu      sync.Mutex
+	queries []string
+	args    [][]driver.Value
+}
+
+// newFakeDB returns a database answering with results
+func newFakeDB(results ...fakeResult) (*sqlx.DB, *fakeDB) {
+	f := &fakeDB{results: results}
+	return sqlx.NewDb(sql.OpenDB(fakeConnector{f}), "mysql"), f
+}
+
+// sent returns the queries containing match that were sent
+func (f *fakeDB) sent(match string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var queries []string
+	for _, q := range f.queries {
+		if strings.Contains(q, match) {
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("statements are not supported")
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	s.db.queries = append(s.db.queries, s.query)
+	s.db.args = append(s.db.args, args)
+	s.db.mu.Unlock()
+
+	for _, result := range s.db.results {
+		if strings.Contains(s.query, result.match) {
+			if result.err != nil {
+				return nil, result.err
+			}
+			rows := result.rows
+			if result.rowsFor != nil {
+				rows = result.rowsFor(s.query, args)
+			}
+			return &fakeRows{columns: result.columns, rows: rows}, nil
+		}
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+func TestFetchFeaturedImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []fakeResult
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "no thumbnail",
+			results: []fakeResult{{match: "_thumbnail_id", columns: []string{"meta_value"}}},
+		},
+		{
+			name: "thumbnail",
+			results: []fakeResult{
+				{match: "_thumbnail_id", columns: []string{"meta_value"}, rows: [][]driver.Value{{"7"}}},
+				{match: "SELECT guid", columns: []string{"guid"}, rows: [][]driver.Value{{"https://example.com/wp-content/uploads/a.jpg"}}},
+			},
+			want: "https://example.com/wp-content/uploads/a.jpg",
+		},
+		{
+			name:    "query error",
+			results: []fakeResult{{match: "_thumbnail_id", err: errors.New("connection lost")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newFakeDB(tt.results...)
+			got, err := FetchFeaturedImage(db, Tables{}, 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchFeaturedImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FetchFeaturedImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTablePrefix(t *testing.T) {
+	tests := []struct {
+		base   string
+		blogID int
+		want   string
+	}{
+		{"", 1, "wp_"},
+		{"wp_", 1, "wp_"},
+		{"wp_", 2, "wp_2_"},
+		{"site_", 12, "site_12_"},
+		{"", 3, "wp_3_"},
+	}
+	for _, tt := range tests {
+		if got := TablePrefix(tt.base, tt.blogID); got != tt.want {
+			t.Errorf("TablePrefix(%q, %d) = %q, want %q", tt.base, tt.blogID, got, tt.want)
+		}
+	}
+}
+
+func TestTablesNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		tables     Tables
+		wantPosts  string
+		wantAuthor string
+	}{
+		{"default", Tables{}, "FROM wp_posts", "FROM wp_users"},
+		{"main site", Tables{Prefix: TablePrefix("wp_", 1), UsersPrefix: "wp_"}, "FROM wp_posts", "FROM wp_users"},
+		{"second blog", Tables{Prefix: TablePrefix("wp_", 2), UsersPrefix: "wp_"}, "FROM wp_2_posts", "FROM wp_users"},
+		{"custom prefix", Tables{Prefix: TablePrefix("site_", 2), UsersPrefix: "site_"}, "FROM site_2_posts", "FROM site_users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB()
+			if _, err := FetchPosts(db, tt.tables, QueryWindow{}, TaxonomyFilter{}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := FetchAuthors(db, tt.tables); err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.sent(tt.wantPosts)) == 0 {
+				t.Errorf("no query read %q; sent %q", tt.wantPosts, fake.queries)
+			}
+			if len(fake.sent(tt.wantAuthor)) == 0 {
+				t.Errorf("no query read %q; sent %q", tt.wantAuthor, fake.queries)
+			}
+		})
+	}
+}
+
+// termRows answers term queries from terms by post ID: the batched ones,
+// whose arguments are the post IDs and the taxonomy, with post_id and name
+// rows, the per-post ones with name rows
+func termRows(terms map[int64][]string) func(query string, args []driver.Value) [][]driver.Value {
+	return func(_ string, args []driver.Value) [][]driver.Value {
+		var rows [][]driver.Value
+		if len(args) == 1 {
+			for _, name := range terms[args[0].(int64)] {
+				rows = append(rows, []driver.Value{name})
+			}
+			return rows
+		}
+		for _, id := range args[:len(args)-1] {
+			for _, name := range terms[id.(int64)] {
+				rows = append(rows, []driver.Value{id, name})
+			}
+		}
+		return rows
+	}
+}
+
+func TestFetchPostSlugs(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  fakeResult
+		want    map[string]bool
+		wantErr bool
+	}{
+		{"none", fakeResult{match: "SELECT post_name", columns: []string{"post_name"}}, map[string]bool{}, false},
+		{"slugs", fakeResult{match: "SELECT post_name", columns: []string{"post_name"}, rows: [][]driver.Value{{"my-post"}, {""}, {"café"}}}, map[string]bool{"my-post": true, "café": true}, false},
+		{"query error", fakeResult{match: "SELECT post_name", err: errors.New("connection lost")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(tt.result)
+			got, err := FetchPostSlugs(db, Tables{}, QueryWindow{}, TaxonomyFilter{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchPostSlugs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FetchPostSlugs() = %v, want %v", got, tt.want)
+			}
+			// Only published posts link as posts
+			queries := fake.sent("SELECT post_name")
+			if len(queries) != 1 || !strings.Contains(queries[0], "post_type   = 'post'") || !strings.Contains(queries[0], "post_status = 'publish'") {
+				t.Errorf("queries = %q, want one for published posts", queries)
+			}
+		})
+	}
+}
+
+func TestFetchTagsForPosts(t *testing.T) {
+	tags := map[int64][]string{1: {"go", "sql"}, 2: {"go"}, 4: {"html"}}
+	tests := []struct {
+		name string
+		ids  []int
+	}{
+		{"some posts", []int{1, 2, 3, 4}},
+		{"no posts", nil},
+		{"more than a batch", func() []int {
+			ids := make([]int, batchSize+5)
+			for i := range ids {
+				ids[i] = i + 1
+			}
+			return ids
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batched, fake := newFakeDB(fakeResult{match: "tr.object_id IN", columns: []string{"post_id", "name"}, rowsFor: termRows(tags)})
+			got, err := FetchTagsForPosts(batched, Tables{}, tt.ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (len(tt.ids) + batchSize - 1) / batchSize; len(fake.queries) != want {
+				t.Errorf("sent %d queries, want %d", len(fake.queries), want)
+			}
+
+			perPost, _ := newFakeDB(fakeResult{match: "tr.object_id = ?", columns: []string{"name"}, rowsFor: termRows(tags)})
+			for _, id := range tt.ids {
+				want, err := FetchPostTags(perPost, Tables{}, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got[id], want) {
+					t.Errorf("tags of post %d = %q, FetchPostTags gives %q", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+// windowRows answers queries from n seeded rows of ID and slug, newest first,
+// applying the LIMIT/OFFSET arguments of a QueryWindow the way MySQL would
+func windowRows(n int) func(query string, args []driver.Value) [][]driver.Value {
+	return func(_ string, args []driver.Value) [][]driver.Value {
+		var rows [][]driver.Value
+		for id := n; id >= 1; id-- {
+			rows = append(rows, []driver.Value{int64(id), fmt.Sprintf("post-%d", id)})
+		}
+		limit, offset := int64(len(rows)), int64(0)
+		switch len(args) {
+		case 1:
+			offset = args[0].(int64)
+		case 2:
+			limit, offset = args[0].(int64), args[1].(int64)
+		}
+		rows = rows[min(offset, int64(len(rows))):]
+		return rows[:min(limit, int64(len(rows)))]
+	}
+}
+
+func TestQueryWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		window QueryWindow
+		want   []int
+	}{
+		{"everything", QueryWindow{}, []int{6, 5, 4, 3, 2, 1}},
+		{"limit", QueryWindow{Limit: 2}, []int{6, 5}},
+		{"limit and offset", QueryWindow{Limit: 2, Offset: 3}, []int{3, 2}},
+		{"offset", QueryWindow{Offset: 4}, []int{2, 1}},
+		{"past the end", QueryWindow{Limit: 3, Offset: 10}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newFakeDB(fakeResult{match: "SELECT", columns: []string{"ID", "slug"}, rowsFor: windowRows(6)})
+			posts, err := FetchPosts(db, Tables{}, tt.window, TaxonomyFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages, err := FetchPages(db, Tables{}, tt.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, err := FetchPosts(db, Tables{}, QueryWindow{}, TaxonomyFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, got := range map[string][]Post{"FetchPosts": posts, "FetchPages": pages, "Apply": tt.window.Apply(all)} {
+				var ids []int
+				for _, p := range got {
+					ids = append(ids, p.ID)
+				}
+				if !reflect.DeepEqual(ids, tt.want) {
+					t.Errorf("%s() IDs = %v, want %v", name, ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchPostsPassword(t *testing.T) {
+	db, fake := newFakeDB(fakeResult{
+		match:   "post_password",
+		columns: []string{"ID", "password"},
+		rows:    [][]driver.Value{{int64(1), "hunter2"}, {int64(2), ""}},
+	})
+	posts, err := FetchPosts(db, Tables{}, QueryWindow{}, TaxonomyFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].Password != "hunter2" || posts[1].Password != "" {
+		t.Errorf("FetchPosts() = %+v, want the password of post 1 only", posts)
+	}
+	if _, err := FetchPages(db, Tables{}, QueryWindow{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(fake.sent("post_password")); got != 2 {
+		t.Errorf("%d queries selected post_password, want the posts and pages ones", got)
+	}
+}
+
+// taxonomyDB seeds the terms and term relationships of the posts with IDs 1
+// to 4 and answers the posts query by evaluating its taxonomy conditions
+func taxonomyDB() *sqlx.DB {
+	// term_taxonomy_ids by taxonomy and name
+	termIDs := map[string]map[string]int64{
+		"category": {"Blog": 10, "News": 11},
+		"post_tag": {"go": 20},
+	}
+	postTerms := map[int64][]int64{1: {10, 20}, 2: {10}, 3: {11, 20}, 4: {}}
+
+	condition := regexp.MustCompile(`ID (NOT IN|IN) \(SELECT object_id FROM \w+ WHERE term_taxonomy_id IN \(([?, ]+)\)\)`)
+	db, _ := newFakeDB(
+		fakeResult{match: "tt.taxonomy = ?", columns: []string{"term_taxonomy_id"}, rowsFor: func(_ string, args []driver.Value) [][]driver.Value {
+			// Names and slugs match alike here
+			for name, id := range termIDs[args[0].(string)] {
+				if strings.EqualFold(name, args[1].(string)) {
+					return [][]driver.Value{{id}}
+				}
+			}
+			return nil
+		}},
+		fakeResult{match: "post_type   = 'post'", columns: []string{"ID"}, rowsFor: func(query string, args []driver.Value) [][]driver.Value {
+			var rows [][]driver.Value
+			for id := int64(4); id >= 1; id-- {
+				matches, next := true, 0
+				for _, c := range condition.FindAllStringSubmatch(query, -1) {
+					n := strings.Count(c[2], "?")
+					found := false
+					for _, arg := range args[next : next+n] {
+						found = found || slices.Contains(postTerms[id], arg.(int64))
+					}
+					next += n
+					matches = matches && found == (c[1] == "IN")
+				}
+				if matches {
+					rows = append(rows, []driver.Value{id})
+				}
+			}
+			return rows
+		}},
+	)
+	return db
+}
+
+func TestTaxonomyFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  TaxonomyFilter
+		want    []int
+		wantErr bool
+	}{
+		{"no filter", TaxonomyFilter{}, []int{4, 3, 2, 1}, false},
+		{"include category", TaxonomyFilter{IncludeCategories: []string{"blog"}}, []int{2, 1}, false},
+		{"exclude category", TaxonomyFilter{ExcludeCategories: []string{"Blog"}}, []int{4, 3}, false},
+		{"include and exclude", TaxonomyFilter{IncludeCategories: []string{"Blog"}, ExcludeTags: []string{"go"}}, []int{2}, false},
+		{"any of", TaxonomyFilter{IncludeCategories: []string{"News"}, IncludeTags: []string{"go"}}, []int{3, 1}, false},
+		{"all of", TaxonomyFilter{IncludeCategories: []string{"Blog"}, IncludeTags: []string{"go"}, MatchAll: true}, []int{1}, false},
+		{"unknown category", TaxonomyFilter{IncludeCategories: []string{"Recipes"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := FetchPosts(taxonomyDB(), Tables{}, QueryWindow{}, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchPosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var ids []int
+			for _, p := range posts {
+				ids = append(ids, p.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("FetchPosts() IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaxonomyFilterApply(t *testing.T) {
+	posts := []Post{
+		{ID: 1, Categories: []string{"Blog"}, Tags: []string{"go"}},
+		{ID: 2, Categories: []string{"Blog"}},
+		{ID: 3, Categories: []string{"News"}, Tags: []string{"go"}},
+		{ID: 4},
+	}
+	tests := []struct {
+		name   string
+		filter TaxonomyFilter
+		want   []int
+	}{
+		{"no filter", TaxonomyFilter{}, []int{1, 2, 3, 4}},
+		{"include category", TaxonomyFilter{IncludeCategories: []string{"blog"}}, []int{1, 2}},
+		{"exclude category", TaxonomyFilter{ExcludeCategories: []string{"Blog"}}, []int{3, 4}},
+		{"any of", TaxonomyFilter{IncludeCategories: []string{"News"}, IncludeTags: []string{"go"}}, []int{1, 3}},
+		{"all of", TaxonomyFilter{IncludeCategories: []string{"Blog"}, IncludeTags: []string{"go"}, MatchAll: true}, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			for _, p := range tt.filter.Apply(posts) {
+				ids = append(ids, p.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Apply() IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFromDatabaseEntities(t *testing.T) {
+	tests := []struct {
+		stored string
+		want   string
+	}{
+		{"Don&#8217;t Panic", "Don’t Panic"},
+		{"Salt &amp; Pepper", "Salt & Pepper"},
+		{"It&#039;s here", "It's here"},
+		{"&lt;div&gt; tags", "<div> tags"},
+		{"Plain", "Plain"},
+	}
+	var rows [][]driver.Value
+	tags := make(map[int64][]string)
+	for i, tt := range tests {
+		id := int64(i + 1)
+		rows = append(rows, []driver.Value{id, tt.stored, "Excerpt: " + tt.stored})
+		tags[id] = []string{tt.stored}
+	}
+	db, _ := newFakeDB(
+		fakeResult{match: "post_type   = 'post'", columns: []string{"ID", "title", "excerpt"}, rows: rows},
+		fakeResult{match: "tr.object_id IN", columns: []string{"post_id", "name"}, rowsFor: termRows(tags)},
+	)
+	posts, _, err := LoadFromDatabase(db, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != len(tests) {
+		t.Fatalf("LoadFromDatabase() returned %d posts, want %d", len(posts), len(tests))
+	}
+	for i, tt := range tests {
+		post := posts[i]
+		if post.Title != tt.want || post.Excerpt != "Excerpt: "+tt.want {
+			t.Errorf("%q loaded as title %q, excerpt %q, want %q", tt.stored, post.Title, post.Excerpt, tt.want)
+		}
+		if want := []string{tt.want}; !slices.Equal(post.Tags, want) || !slices.Equal(post.Categories, want) {
+			t.Errorf("%q loaded as tags %q, categories %q, want %q", tt.stored, post.Tags, post.Categories, want)
+		}
+	}
+}
+
+func TestFetchCommentCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  fakeResult
+		want    int
+		wantErr bool
+	}{
+		{"comments", fakeResult{match: "COUNT(*)", columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(3)}}}, 3, false},
+		{"none", fakeResult{match: "COUNT(*)", columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(0)}}}, 0, false},
+		{"query error", fakeResult{match: "COUNT(*)", err: errors.New("connection lost")}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(tt.result)
+			got, err := FetchCommentCount(db, Tables{Prefix: "blog_"}, 7)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchCommentCount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FetchCommentCount() = %d, want %d", got, tt.want)
+			}
+			queries := fake.sent("COUNT(*)")
+			if len(queries) != 1 || !strings.Contains(queries[0], "FROM blog_comments") || !strings.Contains(queries[0], "comment_approved = '1'") {
+				t.Errorf("queries = %q, want one counting approved comments", queries)
+			}
+		})
+	}
+}
+
+func TestLoadFromDatabaseComments(t *testing.T) {
+	commentColumns := []string{"comment_post_ID", "comment_ID", "comment_parent", "comment_author", "comment_author_url", "comment_date", "comment_content"}
+	seeded := [][]driver.Value{
+		{int64(1), int64(5), int64(0), "Ana", "https://ana.example", "2024-03-02 08:00:00", "First!"},
+		{int64(1), int64(6), int64(5), "Bo", "", "2024-03-02 09:00:00", "Reply"},
+		{int64(2), int64(7), int64(0), "Cy", "", "2024-03-03 10:00:00", "Nice"},
+	}
+	tests := []struct {
+		name     string
+		comments bool
+		want     map[int][]Comment
+	}{
+		{"not loaded", false, map[int][]Comment{}},
+		{
+			name:     "loaded",
+			comments: true,
+			want: map[int][]Comment{
+				1: {
+					{ID: 5, Author: "Ana", AuthorURL: "https://ana.example", Date: "2024-03-02 08:00:00", Content: "First!"},
+					{ID: 6, Parent: 5, Author: "Bo", Date: "2024-03-02 09:00:00", Content: "Reply"},
+				},
+				2: {{ID: 7, Author: "Cy", Date: "2024-03-03 10:00:00", Content: "Nice"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(
+				fakeResult{match: "post_type   = 'post'", columns: []string{"ID", "comment_count"}, rows: [][]driver.Value{{int64(1), int64(2)}, {int64(2), int64(1)}, {int64(3), int64(0)}}},
+				fakeResult{match: "comment_approved = '1'", columns: commentColumns, rows: seeded},
+			)
+			posts, _, err := LoadFromDatabase(db, LoadOptions{Comments: tt.comments})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[int][]Comment)
+			for _, post := range posts {
+				if post.Comments != nil {
+					got[post.ID] = post.Comments
+				}
+				if want := map[int]int{1: 2, 2: 1, 3: 0}[post.ID]; post.CommentCount != want {
+					t.Errorf("post %d has comment count %d, want %d", post.ID, post.CommentCount, want)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("comments = %+v, want %+v", got, tt.want)
+			}
+			if sent := len(fake.sent("comment_approved")) > 0; sent != tt.comments {
+				t.Errorf("comments queried = %v, want %v", sent, tt.comments)
+			}
+		})
+	}
+}
+
+func TestStreamFromDatabase(t *testing.T) {
+	tests := []struct {
+		name  string
+		posts int
+	}{
+		{"none", 0},
+		{"one batch", 3},
+		{"several batches", 2*streamBatchSize + 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts [][]driver.Value
+			tags := make(map[int64][]string)
+			for i := 1; i <= tt.posts; i++ {
+				posts = append(posts, []driver.Value{int64(i), fmt.Sprintf("Post &amp; %d", i), fmt.Sprintf("post-%d", i)})
+				tags[int64(i)] = []string{fmt.Sprintf("tag-%d", i%7)}
+			}
+			db, fake := newFakeDB(
+				fakeResult{match: "post_parent AS parent", columns: []string{"ID", "slug", "parent"}, rows: [][]driver.Value{{int64(900), "about", int64(0)}, {int64(901), "team", int64(900)}}},
+				fakeResult{match: "post_type   = 'post'", columns: []string{"ID", "title", "slug"}, rows: posts},
+				fakeResult{match: "post_type   = 'page'", columns: []string{"ID", "title", "slug", "post_type"}, rows: [][]driver.Value{{int64(900), "About", "about", "page"}, {int64(901), "Team", "team", "page"}}},
+				fakeResult{match: "tr.object_id IN", columns: []string{"post_id", "name"}, rowsFor: termRows(tags)},
+			)
+
+			wantPosts, wantPages, err := LoadFromDatabase(db, LoadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			loadQueries := len(fake.sent("sticky_posts"))
+			var gotPosts, gotPages []Post
+			err = StreamFromDatabase(db, LoadOptions{}, func(post Post, isPage bool) {
+				if isPage {
+					gotPages = append(gotPages, post)
+				} else {
+					gotPosts = append(gotPosts, post)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(gotPosts) != tt.posts || (tt.posts > 0 && !reflect.DeepEqual(gotPosts, wantPosts)) {
+				t.Errorf("streamed %d posts that differ from the %d loaded", len(gotPosts), len(wantPosts))
+			}
+			if !reflect.DeepEqual(gotPages, wantPages) {
+				t.Errorf("streamed pages %+v, want %+v", gotPages, wantPages)
+			}
+			if len(gotPages) == 2 && gotPages[1].ParentPath != "about" {
+				t.Errorf("streamed page has parent path %q, want %q", gotPages[1].ParentPath, "about")
+			}
+			if got := len(fake.sent("sticky_posts")) - loadQueries; got != 1 {
+				t.Errorf("queried the sticky posts %d times while streaming, want once", got)
+			}
+		})
+	}
+}
+
+func TestStreamFromDatabaseError(t *testing.T) {
+	db, _ := newFakeDB(fakeResult{match: "post_type   = 'post'", err: errors.New("connection lost")})
+	called := false
+	err := StreamFromDatabase(db, LoadOptions{}, func(Post, bool) { called = true })
+	if !errors.Is(err, ErrDatabase) || !strings.Contains(err.Error(), "connection lost") {
+		t.Errorf("StreamFromDatabase() error = %v, want a database error", err)
+	}
+	if called {
+		t.Error("posts were handed on after the query failed")
+	}
+}
+
+func TestLoadFromDatabaseSticky(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  [][]driver.Value
+		want    map[int]bool
+		wantErr bool
+	}{
+		{"no option", nil, map[int]bool{1: false, 2: false, 3: false}, false},
+		{"sticky posts", [][]driver.Value{{"a:2:{i:0;i:3;i:1;i:1;}"}}, map[int]bool{1: true, 2: false, 3: true}, false},
+		{"sticky page ID", [][]driver.Value{{"a:1:{i:0;i:900;}"}}, map[int]bool{1: false, 2: false, 3: false}, false},
+		{"corrupt option", [][]driver.Value{{"a:2:{i:0;i:3;}"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newFakeDB(
+				fakeResult{match: "sticky_posts", columns: []string{"option_value"}, rows: tt.option},
+				fakeResult{match: "post_type   = 'post'", columns: []string{"ID", "post_type"}, rows: [][]driver.Value{{int64(1), "post"}, {int64(2), "post"}, {int64(3), "post"}}},
+				fakeResult{match: "post_type   = 'page'", columns: []string{"ID", "post_type"}, rows: [][]driver.Value{{int64(900), "page"}}},
+			)
+			posts, pages, err := LoadFromDatabase(db, LoadOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadFromDatabase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := make(map[int]bool)
+			for _, post := range posts {
+				got[post.ID] = post.IsFeatured
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("featured = %v, want %v", got, tt.want)
+			}
+			if len(pages) != 1 || pages[0].IsFeatured {
+				t.Errorf("pages = %+v, want one page that isn't featured", pages)
+			}
+		})
+	}
+}
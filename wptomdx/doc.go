@@ -0,0 +1,35 @@
+// Package wptomdx converts WordPress content into MDX files for AstroJS
+// (or any other markdown based static site generator).
+//
+// Content can be read from a WordPress database or a WXR export, then handed
+// to a Converter built from a Config, which writes the HTML and MDX file for
+// each item and returns a manifest entry listing the media it references:
+//
+//	db, err := wptomdx.ConnectDB("localhost", "3306", "wp", "secret", "wordpress")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer db.Close()
+//
+//	posts, pages, err := wptomdx.LoadFromDatabase(db, wptomdx.LoadOptions{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	cfg := wptomdx.DefaultConfig()
+//	cfg.BaseURL = "https://example.com"
+//	cfg.APIBase = "https://example.com/wp-json/wp/v2"
+//	cfg.FrontmatterFormat = "toml"
+//
+//	converter := wptomdx.NewConverter(cfg)
+//	converter.Attachments = wptomdx.DBAttachments{DB: db}
+//
+//	entries := append(converter.ProcessContent(posts, false), converter.ProcessContent(pages, true)...)
+//	if err := wptomdx.WriteManifest("manifest.json", entries); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// The individual steps are available on their own as well: ConvertHTMLToMarkdown
+// turns post HTML into markdown, PostProcessMarkdownLines rewrites shortcodes
+// into components and GenerateFrontmatter renders the frontmatter block.
+package wptomdx
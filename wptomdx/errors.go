@@ -0,0 +1,98 @@
+package wptomdx
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// The stages of the pipeline an error can come from. Errors returned by the
+// pipeline match the sentinel of their stage with errors.Is, e.g.
+// errors.Is(err, ErrMediaDownload), and errors.As gives the typed error with
+// its details. Their messages are those of the errors they wrap.
+var (
+	ErrDatabase      = errors.New("database error")
+	ErrAPILookup     = errors.New("API lookup error")
+	ErrConversion    = errors.New("conversion error")
+	ErrMediaDownload = errors.New("media download error")
+)
+
+// DatabaseError is a failure to connect to or read from the database
+type DatabaseError struct {
+	Err error
+}
+
+func (e *DatabaseError) Error() string        { return e.Err.Error() }
+func (e *DatabaseError) Unwrap() error        { return e.Err }
+func (e *DatabaseError) Is(target error) bool { return target == ErrDatabase }
+
+// APILookupError is a failed REST API lookup of an item's URL
+type APILookupError struct {
+	URL string
+	// StatusCode is the status of the response, or 0 when there was none
+	StatusCode int
+	Err        error
+}
+
+func (e *APILookupError) Error() string        { return e.Err.Error() }
+func (e *APILookupError) Unwrap() error        { return e.Err }
+func (e *APILookupError) Is(target error) bool { return target == ErrAPILookup }
+
+// Retryable reports whether the lookup may succeed when tried again
+func (e *APILookupError) Retryable() bool {
+	return retryable(e.StatusCode, e.Err)
+}
+
+// ConversionError is a failure to convert HTML content to markdown
+type ConversionError struct {
+	Err error
+}
+
+func (e *ConversionError) Error() string        { return e.Err.Error() }
+func (e *ConversionError) Unwrap() error        { return e.Err }
+func (e *ConversionError) Is(target error) bool { return target == ErrConversion }
+
+// MediaDownloadError is a failure to download a media file or to save it
+type MediaDownloadError struct {
+	URL string
+	// StatusCode is the status of an unexpected response, or 0 for other
+	// failures
+	StatusCode int
+	Err        error
+}
+
+func (e *MediaDownloadError) Error() string        { return e.Err.Error() }
+func (e *MediaDownloadError) Unwrap() error        { return e.Err }
+func (e *MediaDownloadError) Is(target error) bool { return target == ErrMediaDownload }
+
+// Retryable reports whether the download may succeed when tried again
+func (e *MediaDownloadError) Retryable() bool {
+	return retryable(e.StatusCode, e.Err)
+}
+
+// retryable reports whether a request that failed with err is worth trying
+// again: network errors, without a response, and responses with a
+// retryableStatus are
+func retryable(status int, err error) bool {
+	if status != 0 {
+		return retryableStatus(status)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryableStatus reports whether a response with status may succeed when
+// the request is repeated
+func retryableStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// mediaDownloadError wraps err, from downloading src, in a MediaDownloadError
+// unless it already is one
+func mediaDownloadError(src string, err error) error {
+	var downloadErr *MediaDownloadError
+	if errors.As(err, &downloadErr) {
+		return err
+	}
+	return &MediaDownloadError{URL: src, Err: err}
+}
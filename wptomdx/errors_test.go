@@ -0,0 +1,173 @@
+package wptomdx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPipelineErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wp-json/wp/v2/posts/1", "/media/busy.jpg":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/wp-json/wp/v2/posts/2":
+			w.Write([]byte("not json"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api := APIClient{Base: server.URL + "/wp-json/wp/v2"}
+	unreachable := APIClient{Base: "http://127.0.0.1:1/wp-json/wp/v2"}
+	download := func(path string) error {
+		_, err := Downloader{}.DownloadFile(server.URL+path, filepath.Join(t.TempDir(), "a.jpg"))
+		return err
+	}
+
+	// status is the StatusCode of the typed error, and retryable what its
+	// Retryable method reports, for the errors that have them
+	tests := []struct {
+		name      string
+		err       func() error
+		sentinel  error
+		status    int
+		retryable bool
+	}{
+		{
+			name: "database query",
+			err: func() error {
+				db, _ := newFakeDB(fakeResult{match: "post_type   = 'post'", err: errors.New("connection lost")})
+				_, _, err := LoadFromDatabase(db, LoadOptions{})
+				return err
+			},
+			sentinel: ErrDatabase,
+		},
+		{
+			name: "database stream",
+			err: func() error {
+				db, _ := newFakeDB(fakeResult{match: "post_type   = 'post'", err: errors.New("connection lost")})
+				return StreamFromDatabase(db, LoadOptions{}, func(Post, bool) {})
+			},
+			sentinel: ErrDatabase,
+		},
+		{
+			name:     "API status",
+			err:      func() error { _, err := api.PostURL(1); return err },
+			sentinel: ErrAPILookup, status: http.StatusServiceUnavailable, retryable: true,
+		},
+		{
+			name:     "API not found",
+			err:      func() error { _, err := api.PageURL(1); return err },
+			sentinel: ErrAPILookup, status: http.StatusNotFound,
+		},
+		{
+			name:     "API response",
+			err:      func() error { _, err := api.PostURL(2); return err },
+			sentinel: ErrAPILookup,
+		},
+		{
+			name:     "API unreachable",
+			err:      func() error { _, err := unreachable.PostURL(1); return err },
+			sentinel: ErrAPILookup, retryable: true,
+		},
+		{
+			name:     "media status",
+			err:      func() error { return download("/media/missing.jpg") },
+			sentinel: ErrMediaDownload, status: http.StatusNotFound,
+		},
+		{
+			name:     "media busy",
+			err:      func() error { return download("/media/busy.jpg") },
+			sentinel: ErrMediaDownload, status: http.StatusServiceUnavailable, retryable: true,
+		},
+		{
+			name: "media path",
+			err: func() error {
+				_, err := Downloader{}.DownloadImage("https://example.com/", "https://example.com", t.TempDir())
+				return err
+			},
+			sentinel: ErrMediaDownload,
+		},
+		{
+			name:     "conversion",
+			err:      func() error { return &ConversionError{Err: errors.New("conversion error: bad markup")} },
+			sentinel: ErrConversion,
+		},
+		{
+			name: "wrapped",
+			err: func() error {
+				_, err := api.PostURL(1)
+				return fmt.Errorf("item 1: %w", err)
+			},
+			sentinel: ErrAPILookup, status: http.StatusServiceUnavailable, retryable: true,
+		},
+	}
+	sentinels := []error{ErrDatabase, ErrAPILookup, ErrConversion, ErrMediaDownload}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err()
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			for _, sentinel := range sentinels {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.sentinel) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, sentinel, got)
+				}
+			}
+
+			var (
+				dbErr         *DatabaseError
+				lookupErr     *APILookupError
+				conversionErr *ConversionError
+				downloadErr   *MediaDownloadError
+			)
+			switch tt.sentinel {
+			case ErrDatabase:
+				if !errors.As(err, &dbErr) {
+					t.Errorf("errors.As(%v) found no DatabaseError", err)
+				}
+			case ErrConversion:
+				if !errors.As(err, &conversionErr) {
+					t.Errorf("errors.As(%v) found no ConversionError", err)
+				}
+			case ErrAPILookup:
+				if !errors.As(err, &lookupErr) {
+					t.Fatalf("errors.As(%v) found no APILookupError", err)
+				}
+				if lookupErr.URL == "" || lookupErr.StatusCode != tt.status || lookupErr.Retryable() != tt.retryable {
+					t.Errorf("got URL %q, status %d, retryable %v, want status %d, retryable %v", lookupErr.URL, lookupErr.StatusCode, lookupErr.Retryable(), tt.status, tt.retryable)
+				}
+			case ErrMediaDownload:
+				if !errors.As(err, &downloadErr) {
+					t.Fatalf("errors.As(%v) found no MediaDownloadError", err)
+				}
+				if downloadErr.URL == "" || downloadErr.StatusCode != tt.status || downloadErr.Retryable() != tt.retryable {
+					t.Errorf("got URL %q, status %d, retryable %v, want status %d, retryable %v", downloadErr.URL, downloadErr.StatusCode, downloadErr.Retryable(), tt.status, tt.retryable)
+				}
+			}
+			// The typed errors read as the errors they wrap
+			if errors.Unwrap(err) == nil {
+				t.Errorf("%v wraps no error", err)
+			}
+		})
+	}
+}
+
+func TestMediaDownloadErrorWrapsOnce(t *testing.T) {
+	inner := &MediaDownloadError{URL: "https://example.com/a.jpg", StatusCode: http.StatusNotFound, Err: errors.New("bad status: 404 Not Found")}
+	if got := mediaDownloadError("https://example.com/b.jpg", inner); got != error(inner) {
+		t.Errorf("mediaDownloadError() = %#v, want the MediaDownloadError unchanged", got)
+	}
+	plain := errors.New("disk full")
+	var downloadErr *MediaDownloadError
+	if got := mediaDownloadError("https://example.com/b.jpg", plain); !errors.As(got, &downloadErr) || downloadErr.URL != "https://example.com/b.jpg" || !errors.Is(got, plain) {
+		t.Errorf("mediaDownloadError() = %#v, want a MediaDownloadError for b.jpg wrapping %v", got, plain)
+	}
+	if got := inner.Error(); got != "bad status: 404 Not Found" {
+		t.Errorf("Error() = %q, want the wrapped message", got)
+	}
+}
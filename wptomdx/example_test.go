@@ -0,0 +1,70 @@
+package wptomdx_test
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"wptomd/wptomdx"
+)
+
+func ExampleConvertHTMLToMarkdown() {
+	markdown, media, err := wptomdx.ConvertHTMLToMarkdown(
+		`<h2>Hello</h2><p>Read <a href="https://example.com/about/">about us</a>.</p>`+
+			`<p><img src="https://example.com/wp-content/uploads/2024/03/team.jpg" alt="Team"></p>`,
+		"https://example.com",
+		wptomdx.ConvertOptions{},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(markdown)
+	fmt.Println(media)
+	// Output:
+	// ## Hello
+	//
+	// Read [about us](/about/).
+	//
+	// <img src="/wp-content/uploads/2024/03/team.jpg" alt="Team" />
+	// [https://example.com/wp-content/uploads/2024/03/team.jpg]
+}
+
+func ExampleGenerateFrontmatter() {
+	post := wptomdx.Post{Title: "Hello: world", Tags: []string{"go"}}
+	published := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	frontmatter, err := wptomdx.GenerateFrontmatter(post, published, time.Time{}, wptomdx.FrontmatterOptions{Format: "toml"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(frontmatter)
+	// Output:
+	// +++
+	// excerpt = ""
+	// isFeatured = false
+	// publishDate = "2024-03-01"
+	// tags = ["go"]
+	// title = "Hello: world"
+	//
+	// [seo]
+	// +++
+}
+
+func ExampleConverter_ConvertContent() {
+	cfg := wptomdx.DefaultConfig()
+	cfg.BaseURL = "https://example.com"
+	converter := wptomdx.NewConverter(cfg)
+
+	markdown, media, err := converter.ConvertContent(`<p>Our <em>new</em> office:</p>` +
+		`<p><img src="https://example.com/wp-content/uploads/2024/03/office.jpg" alt="Office"></p>`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(markdown)
+	fmt.Println(media)
+	// Output:
+	// Our _new_ office:
+	//
+	// <img src="/wp-content/uploads/2024/03/office.jpg" alt="Office" />
+	// [https://example.com/wp-content/uploads/2024/03/office.jpg]
+}
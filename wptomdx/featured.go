@@ -0,0 +1,73 @@
+package wptomdx
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// contentImageRe matches an image in converted markdown with what belongs to
+// it: a <figure> holding an <img> and its caption, an <img> optionally wrapped
+// in a link, or a markdown image optionally wrapped in a link and followed by
+// its emphasized caption line. The first non-empty group is the image URL.
+var contentImageRe = regexp.MustCompile(`(?s)<figure[^>]*>\s*(?:<a [^>]*>)?<img [^>]*?src="([^"]*)"[^>]*/>(?:</a>)?\s*(?:<figcaption>.*?</figcaption>\s*)?</figure>` +
+	`|(?:<a [^>]*>)?<img [^>]*?src="([^"]*)"[^>]*/>(?:</a>)?` +
+	`|\[?!\[[^\]]*\]\(<?([^)\s>]*)>?(?: "[^"]*")?\)(?:\]\([^)]*\))?(?:\n\*[^\n]*\*|\n_[^\n]*_)?`)
+
+// removeFeaturedFromContent drops the first image of the markdown when it is
+// the featured image, which themes usually show above the content already. It
+// returns the markdown and the image URL that was removed, or "".
+func removeFeaturedFromContent(markdown string, featuredImage string, baseURL string) (string, string) {
+	if featuredImage == "" {
+		return markdown, ""
+	}
+	match := contentImageRe.FindStringSubmatchIndex(markdown)
+	if match == nil {
+		return markdown, ""
+	}
+	var src string
+	for group := 1; group < len(match)/2; group++ {
+		if match[2*group] >= 0 {
+			src = markdown[match[2*group]:match[2*group+1]]
+			break
+		}
+	}
+	if normalizedImageURL(src, baseURL) != normalizedImageURL(featuredImage, baseURL) {
+		return markdown, ""
+	}
+
+	before := strings.TrimRight(markdown[:match[0]], "\n")
+	after := strings.TrimLeft(markdown[match[1]:], "\n")
+	switch {
+	case before == "":
+		return after, src
+	case after == "":
+		return before, src
+	}
+	return before + "\n\n" + after, src
+}
+
+// normalizedImageURL returns the URL of the original upload behind an image
+// reference, absolute and without its query string or fragment, so that
+// resized copies and the original compare equal
+func normalizedImageURL(src string, baseURL string) string {
+	src = fullSizeImageURL(AbsoluteMediaURL(src, baseURL), "")
+	u, err := url.Parse(src)
+	if err != nil {
+		return src
+	}
+	u.RawQuery, u.Fragment = "", ""
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+// dropMediaURL returns urls without the ones src refers to
+func dropMediaURL(urls []string, src string, baseURL string) []string {
+	var kept []string
+	for _, u := range urls {
+		if AbsoluteMediaURL(u, baseURL) != AbsoluteMediaURL(src, baseURL) {
+			kept = append(kept, u)
+		}
+	}
+	return kept
+}
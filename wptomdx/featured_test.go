@@ -0,0 +1,110 @@
+package wptomdx
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRemoveFeaturedFromContent(t *testing.T) {
+	const featured = "https://example.com/wp-content/uploads/2024/03/hero.jpg"
+	tests := []struct {
+		name        string
+		markdown    string
+		featured    string
+		want        string
+		wantRemoved string
+	}{
+		{
+			name:        "first image",
+			markdown:    "<img src=\"/wp-content/uploads/2024/03/hero.jpg\" alt=\"Hero\" />\n\nIntro",
+			featured:    featured,
+			want:        "Intro",
+			wantRemoved: "/wp-content/uploads/2024/03/hero.jpg",
+		},
+		{
+			name:        "resized copy",
+			markdown:    "Intro\n\n<img src=\"/wp-content/uploads/2024/03/hero-1024x768.jpg?ver=2\" alt=\"Hero\" />\n\nMore",
+			featured:    featured,
+			want:        "Intro\n\nMore",
+			wantRemoved: "/wp-content/uploads/2024/03/hero-1024x768.jpg?ver=2",
+		},
+		{
+			name:        "figure with caption",
+			markdown:    "<figure>\n  <img src=\"/wp-content/uploads/2024/03/hero.jpg\" alt=\"Hero\" />\n  <figcaption>Caption</figcaption>\n</figure>\n\nIntro",
+			featured:    featured,
+			want:        "Intro",
+			wantRemoved: "/wp-content/uploads/2024/03/hero.jpg",
+		},
+		{
+			name:        "markdown image with caption",
+			markdown:    "Intro\n\n![Hero](/wp-content/uploads/2024/03/hero.jpg)\n*Caption*",
+			featured:    featured,
+			want:        "Intro",
+			wantRemoved: "/wp-content/uploads/2024/03/hero.jpg",
+		},
+		{
+			name:     "first image is another one",
+			markdown: "![Other](/wp-content/uploads/other.jpg)\n\n![Hero](/wp-content/uploads/2024/03/hero.jpg)",
+			featured: featured,
+			want:     "![Other](/wp-content/uploads/other.jpg)\n\n![Hero](/wp-content/uploads/2024/03/hero.jpg)",
+		},
+		{
+			name:     "no featured image",
+			markdown: "![Hero](/wp-content/uploads/2024/03/hero.jpg)",
+			want:     "![Hero](/wp-content/uploads/2024/03/hero.jpg)",
+		},
+		{
+			name:     "no images",
+			markdown: "Just text",
+			featured: featured,
+			want:     "Just text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed := removeFeaturedFromContent(tt.markdown, tt.featured, "https://example.com")
+			if got != tt.want || removed != tt.wantRemoved {
+				t.Errorf("removeFeaturedFromContent() = %q, %q, want %q, %q", got, removed, tt.want, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestProcessContentDedupeFeatured(t *testing.T) {
+	const content = `<p><img src="https://example.com/wp-content/uploads/2024/03/hero-300x200.jpg" alt="Hero"></p><p>Intro</p>`
+	tests := []struct {
+		name      string
+		dedupe    bool
+		wantImage bool
+	}{
+		{"kept", false, true},
+		{"deduped", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.DedupeFeaturedInContent = tt.dedupe })
+			post := testPost(1, "hero", content)
+			post.FeaturedImage = "https://example.com/wp-content/uploads/2024/03/hero.jpg"
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			data, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := string(data)[strings.Index(string(data)[3:], "---")+6:]
+			if got := strings.Contains(body, "<img"); got != tt.wantImage {
+				t.Errorf("content has the image = %v, want %v:\n%s", got, tt.wantImage, body)
+			}
+			if !strings.Contains(body, "Intro") {
+				t.Errorf("content lost its text:\n%s", body)
+			}
+			// The featured image is still downloaded for the frontmatter
+			if len(entries[0].Media) != 1 || entries[0].Media[0].URL != post.FeaturedImage {
+				t.Errorf("media = %+v, want only the featured image", entries[0].Media)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package wptomdx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FrontmatterOptions controls how GenerateFrontmatter serializes a post
+type FrontmatterOptions struct {
+	// Format is "yaml" (the default), "toml" or "json"
+	Format string
+	// DateLayout is the Go time layout used for publishDate and updatedDate
+	DateLayout string
+	// ReadingTime adds wordCount and readingTime (in minutes at ReadingWPM
+	// words per minute) computed from the post's converted content
+	ReadingTime bool
+	ReadingWPM  int
+	// CanonicalURL adds the WordPress permalink as canonicalURL
+	CanonicalURL bool
+	// Slug adds the WordPress slug (post_name) as slug
+	Slug bool
+	// CommentCount adds the number of approved comments as commentCount
+	CommentCount bool
+	// Fields adds frontmatter fields per post type
+	Fields FieldMapping
+}
+
+// FieldMapping maps, per post type, frontmatter fields to the post field or
+// "meta:<key>" post meta value they are read from. Mapped fields replace the
+// default field of the same name, and a field mapped to "-" is left out.
+//
+//	recipe:
+//	  cookTime: meta:cook_time
+//	  tags: "-"
+type FieldMapping map[string]map[string]string
+
+// fieldSources are the post fields a FieldMapping can read from
+var fieldSources = map[string]func(Post) interface{}{
+	"id":         func(p Post) interface{} { return p.ID },
+	"title":      func(p Post) interface{} { return p.Title },
+	"slug":       func(p Post) interface{} { return p.Slug },
+	"excerpt":    func(p Post) interface{} { return p.Excerpt },
+	"status":     func(p Post) interface{} { return p.Status },
+	"type":       func(p Post) interface{} { return p.PostType },
+	"url":        func(p Post) interface{} { return p.URL },
+	"author":     func(p Post) interface{} { return p.Author },
+	"series":     func(p Post) interface{} { return p.Series },
+	"tags":       func(p Post) interface{} { return nonNilStrings(p.Tags) },
+	"categories": func(p Post) interface{} { return nonNilStrings(p.Categories) },
+}
+
+// LoadFieldMapping reads a field mapping from a YAML or JSON file
+func LoadFieldMapping(path string) (FieldMapping, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field mapping: %v", err)
+	}
+	// JSON is valid YAML, so one decoder handles both
+	var mapping FieldMapping
+	if err := yaml.Unmarshal(raw, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse field mapping %s: %v", path, err)
+	}
+	if err := mapping.validate(); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// validate reports fields read from a source that doesn't exist
+func (m FieldMapping) validate() error {
+	for postType, fields := range m {
+		for field, source := range fields {
+			if _, ok := fieldSources[source]; !ok && source != "-" && !strings.HasPrefix(source, "meta:") {
+				return fmt.Errorf("unknown source %q for field %s of %s", source, field, postType)
+			}
+		}
+	}
+	return nil
+}
+
+// MetaKeys returns the post meta keys the mapping reads, sorted
+func (m FieldMapping) MetaKeys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, fields := range m {
+		for _, source := range fields {
+			if key, ok := strings.CutPrefix(source, "meta:"); ok && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// apply sets the mapped fields of post on fm, in field name order
+func (m FieldMapping) apply(fm *Frontmatter, post Post) {
+	fields := m[post.PostType]
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		source := fields[name]
+		switch {
+		case source == "-":
+			fm.Remove(name)
+		case strings.HasPrefix(source, "meta:"):
+			if value, ok := post.Meta[strings.TrimPrefix(source, "meta:")]; ok {
+				fm.Set(name, value)
+			}
+		case fieldSources[source] != nil:
+			fm.Set(name, fieldSources[source](post))
+		}
+	}
+}
+
+// nonNilStrings returns values, or an empty list so it isn't encoded as null
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// frontmatterField is a single frontmatter key and its value
+type frontmatterField struct {
+	Key   string
+	Value interface{}
+}
+
+// Frontmatter is an ordered list of frontmatter fields
+type Frontmatter []frontmatterField
+
+// Set appends a field to the frontmatter, or replaces its value if it is
+// already present
+func (f *Frontmatter) Set(key string, value interface{}) {
+	for i := range *f {
+		if (*f)[i].Key == key {
+			(*f)[i].Value = value
+			return
+		}
+	}
+	*f = append(*f, frontmatterField{Key: key, Value: value})
+}
+
+// Remove deletes a field from the frontmatter
+func (f *Frontmatter) Remove(key string) {
+	for i := range *f {
+		if (*f)[i].Key == key {
+			*f = append((*f)[:i], (*f)[i+1:]...)
+			return
+		}
+	}
+}
+
+// GenerateFrontmatter creates the frontmatter for a markdown file, including
+// its delimiters
+func GenerateFrontmatter(post Post, publishDate, updatedDate time.Time, opts FrontmatterOptions) (string, error) {
+	return BuildFrontmatter(post, publishDate, updatedDate, opts).Encode(opts.Format)
+}
+
+// BuildFrontmatter returns the frontmatter fields of a post in order
+func BuildFrontmatter(post Post, publishDate, updatedDate time.Time, opts FrontmatterOptions) Frontmatter {
+	layout := opts.DateLayout
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+
+	tags := post.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var fm Frontmatter
+	fm.Set("title", post.Title)
+	if opts.Slug && post.Slug != "" {
+		fm.Set("slug", post.Slug)
+	}
+	fm.Set("excerpt", post.Excerpt)
+	fm.Set("publishDate", publishDate.Format(layout))
+	// Add updated date to frontmatter if available
+	if !updatedDate.IsZero() {
+		fm.Set("updatedDate", updatedDate.Format(layout))
+	}
+	fm.Set("isFeatured", post.IsFeatured)
+	fm.Set("tags", tags)
+	if post.Author != "" {
+		fm.Set("author", post.Author)
+	}
+	if post.Series != "" {
+		fm.Set("series", post.Series)
+		if post.SeriesOrder > 0 {
+			fm.Set("seriesOrder", post.SeriesOrder)
+		}
+	}
+	// Add featured image to frontmatter if available
+	if post.FeaturedImage != "" {
+		fm.Set("featuredImage", post.FeaturedImage)
+	}
+	if opts.ReadingTime {
+		words := CountWords(post.Content)
+		fm.Set("wordCount", words)
+		fm.Set("readingTime", ReadingTime(words, opts.ReadingWPM))
+	}
+	if opts.CanonicalURL && post.URL != "" {
+		fm.Set("canonicalURL", post.URL)
+	}
+	if opts.CommentCount {
+		fm.Set("commentCount", post.CommentCount)
+	}
+	opts.Fields.apply(&fm, post)
+	fm.Set("seo", map[string]interface{}{})
+
+	return fm
+}
+
+// MarshalJSON encodes the fields in order as a JSON object
+func (f Frontmatter) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, field := range f {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, err := marshalJSON(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalJSON(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode frontmatter field %s: %v", field.Key, err)
+		}
+		buf.WriteString(key + ":" + value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// Encode serializes the frontmatter as yaml (the default), toml or json
+func (f Frontmatter) Encode(format string) (string, error) {
+	switch format {
+	case "", "yaml":
+		return f.encodeYAML()
+	case "toml":
+		return f.encodeTOML()
+	case "json":
+		return f.encodeJSON()
+	default:
+		return "", fmt.Errorf("unknown frontmatter format %q (expected yaml, toml or json)", format)
+	}
+}
+
+// encodeYAML emits the fields in order between --- delimiters
+func (f Frontmatter) encodeYAML() (string, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range f {
+		var value yaml.Node
+		if err := value.Encode(field.Value); err != nil {
+			return "", fmt.Errorf("failed to encode frontmatter field %s: %v", field.Key, err)
+		}
+		// Keep lists on a single line, like tags: ["a", "b"]
+		if value.Kind == yaml.SequenceNode {
+			value.Style = yaml.FlowStyle
+		}
+		quoteStrings(&value)
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.Key}, &value)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", fmt.Errorf("failed to encode frontmatter: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode frontmatter: %v", err)
+	}
+
+	return "---\n" + buf.String() + "---\n\n", nil
+}
+
+// quoteStrings double-quotes every string scalar in node. The encoder already
+// quotes values that need it (titles with ": ", a leading "@" or "-", ...);
+// quoting all of them keeps the output uniform and leaves no value whose type
+// a consumer's YAML parser could guess differently.
+func quoteStrings(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		quoteStrings(child)
+	}
+}
+
+// encodeTOML emits the fields between +++ delimiters. TOML requires tables to
+// come after plain keys, which the encoder takes care of.
+func (f Frontmatter) encodeTOML() (string, error) {
+	fields := make(map[string]interface{}, len(f))
+	for _, field := range f {
+		fields[field.Key] = field.Value
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(fields); err != nil {
+		return "", fmt.Errorf("failed to encode frontmatter: %v", err)
+	}
+
+	return "+++\n" + buf.String() + "+++\n\n", nil
+}
+
+// encodeJSON emits the fields in order as a JSON object, which needs no delimiters
+func (f Frontmatter) encodeJSON() (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, field := range f {
+		key, err := marshalJSON(field.Key)
+		if err != nil {
+			return "", err
+		}
+		value, err := marshalJSON(field.Value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode frontmatter field %s: %v", field.Key, err)
+		}
+		fmt.Fprintf(&buf, "  %s: %s", key, value)
+		if i < len(f)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n\n")
+
+	return buf.String(), nil
+}
+
+// marshalJSON encodes v on a single line without escaping HTML characters
+func marshalJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(buf.Bytes(), "\n")), nil
+}
@@ -0,0 +1,249 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// parseFrontmatter strips the delimiters of frontmatter generated in format
+// and decodes its fields
+func parseFrontmatter(t *testing.T, format string, out string) map[string]interface{} {
+	t.Helper()
+	fields := make(map[string]interface{})
+	var err error
+	switch format {
+	case "yaml":
+		body, ok := strings.CutPrefix(out, "---\n")
+		if !ok || !strings.HasSuffix(body, "---\n\n") {
+			t.Fatalf("YAML frontmatter not between --- delimiters:\n%s", out)
+		}
+		err = yaml.Unmarshal([]byte(strings.TrimSuffix(body, "---\n\n")), &fields)
+	case "toml":
+		body, ok := strings.CutPrefix(out, "+++\n")
+		if !ok || !strings.HasSuffix(body, "+++\n\n") {
+			t.Fatalf("TOML frontmatter not between +++ delimiters:\n%s", out)
+		}
+		_, err = toml.Decode(strings.TrimSuffix(body, "+++\n\n"), &fields)
+	case "json":
+		err = json.Unmarshal([]byte(out), &fields)
+	}
+	if err != nil {
+		t.Fatalf("failed to parse %s frontmatter: %v\n%s", format, err, out)
+	}
+	return fields
+}
+
+func TestGenerateFrontmatterFormats(t *testing.T) {
+	post := Post{Title: "Hello", Excerpt: "Short", Tags: []string{"go", "wordpress"}, Author: "Ana"}
+	published := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	for _, format := range []string{"yaml", "toml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			out, err := GenerateFrontmatter(post, published, updated, FrontmatterOptions{Format: format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := parseFrontmatter(t, format, out)
+
+			want := map[string]interface{}{
+				"title":       "Hello",
+				"excerpt":     "Short",
+				"publishDate": "2024-03-01",
+				"updatedDate": "2024-03-02",
+				"author":      "Ana",
+			}
+			for key, value := range want {
+				if fields[key] != value {
+					t.Errorf("%s = %#v, want %#v", key, fields[key], value)
+				}
+			}
+			if fields["isFeatured"] != false {
+				t.Errorf("isFeatured = %#v, want false", fields["isFeatured"])
+			}
+			if got := decodedStrings(fields["tags"]); !reflect.DeepEqual(got, post.Tags) {
+				t.Errorf("tags = %#v, want %q", fields["tags"], post.Tags)
+			}
+			if _, ok := fields["seo"]; !ok {
+				t.Errorf("seo missing from %v", fields)
+			}
+		})
+	}
+
+	if _, err := GenerateFrontmatter(post, published, updated, FrontmatterOptions{Format: "xml"}); err == nil {
+		t.Error("GenerateFrontmatter() with format xml succeeded, want an error")
+	}
+}
+
+// decodedStrings converts a decoded list into strings
+func decodedStrings(value interface{}) []string {
+	list, _ := value.([]interface{})
+	strs := make([]string, 0, len(list))
+	for _, v := range list {
+		s, _ := v.(string)
+		strs = append(strs, s)
+	}
+	return strs
+}
+
+func TestFrontmatterYAMLEscaping(t *testing.T) {
+	titles := []string{
+		`He said: "hi"`,
+		`It's a 'quote'`,
+		"@mention first",
+		"- looks like a list",
+		"# not a comment",
+		"Café, naïve & 日本語 🎉",
+		"yes",
+		"123",
+		`back\slash`,
+		"",
+	}
+	for _, title := range titles {
+		t.Run(title, func(t *testing.T) {
+			post := Post{Title: title, Excerpt: title, Tags: []string{title}}
+			out, err := GenerateFrontmatter(post, time.Now(), time.Time{}, FrontmatterOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := parseFrontmatter(t, "yaml", out)
+			if fields["title"] != title {
+				t.Errorf("title = %#v, want %q\n%s", fields["title"], title, out)
+			}
+			if fields["excerpt"] != title {
+				t.Errorf("excerpt = %#v, want %q", fields["excerpt"], title)
+			}
+			if got := decodedStrings(fields["tags"]); !reflect.DeepEqual(got, []string{title}) {
+				t.Errorf("tags = %#v, want [%q]", fields["tags"], title)
+			}
+			if strings.Contains(out, `\u`) {
+				t.Errorf("output escapes unicode:\n%s", out)
+			}
+		})
+	}
+}
+
+// frontmatterKeys returns the keys of fm in order
+func frontmatterKeys(fm Frontmatter) []string {
+	keys := make([]string, 0, len(fm))
+	for _, field := range fm {
+		keys = append(keys, field.Key)
+	}
+	return keys
+}
+
+func TestFieldMapping(t *testing.T) {
+	mapping := FieldMapping{
+		"recipe": {"cookTime": "meta:cook_time", "tags": "-", "isFeatured": "-", "kind": "type"},
+		"post":   {"subtitle": "meta:subtitle", "postID": "id"},
+	}
+	published := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		post     Post
+		wantKeys []string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "recipe",
+			post:     Post{ID: 7, Title: "Soup", PostType: "recipe", Tags: []string{"food"}, Meta: map[string]string{"cook_time": "45m"}},
+			wantKeys: []string{"title", "excerpt", "publishDate", "cookTime", "kind", "seo"},
+			want:     map[string]interface{}{"cookTime": "45m", "kind": "recipe"},
+		},
+		{
+			name:     "post",
+			post:     Post{ID: 8, Title: "News", PostType: "post", Tags: []string{"go"}, Meta: map[string]string{"subtitle": "Today"}},
+			wantKeys: []string{"title", "excerpt", "publishDate", "isFeatured", "tags", "postID", "subtitle", "seo"},
+			want:     map[string]interface{}{"postID": 8, "subtitle": "Today"},
+		},
+		{
+			name:     "missing meta",
+			post:     Post{ID: 9, Title: "Plain", PostType: "post"},
+			wantKeys: []string{"title", "excerpt", "publishDate", "isFeatured", "tags", "postID", "seo"},
+			want:     map[string]interface{}{"postID": 9},
+		},
+		{
+			name:     "unmapped type",
+			post:     Post{ID: 10, Title: "About", PostType: "page"},
+			wantKeys: []string{"title", "excerpt", "publishDate", "isFeatured", "tags", "seo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm := BuildFrontmatter(tt.post, published, time.Time{}, FrontmatterOptions{Fields: mapping})
+			if got := frontmatterKeys(fm); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("keys = %q, want %q", got, tt.wantKeys)
+			}
+			for _, field := range fm {
+				if want, ok := tt.want[field.Key]; ok && field.Value != want {
+					t.Errorf("%s = %#v, want %#v", field.Key, field.Value, want)
+				}
+			}
+		})
+	}
+
+	if got, want := mapping.MetaKeys(), []string{"cook_time", "subtitle"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MetaKeys() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadFieldMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    FieldMapping
+		wantErr bool
+	}{
+		{"yaml", "fields.yaml", "recipe:\n  cookTime: meta:cook_time\n  tags: \"-\"\n", FieldMapping{"recipe": {"cookTime": "meta:cook_time", "tags": "-"}}, false},
+		{"json", "fields.json", `{"recipe": {"cookTime": "meta:cook_time"}}`, FieldMapping{"recipe": {"cookTime": "meta:cook_time"}}, false},
+		{"unknown source", "fields.yaml", "recipe:\n  cookTime: cook_time\n", nil, true},
+		{"invalid", "fields.yaml", "recipe: [", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadFieldMapping(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadFieldMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadFieldMapping() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrontmatterUnescapedTitle(t *testing.T) {
+	post := Post{Title: "Don&#8217;t &amp; Won&#039;t", Tags: []string{"R&amp;D"}}
+	unescapeEntities(&post)
+	for _, format := range []string{"yaml", "toml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			out, err := GenerateFrontmatter(post, time.Time{}, time.Time{}, FrontmatterOptions{Format: format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(out, "&#") || strings.Contains(out, "&amp;") {
+				t.Errorf("frontmatter kept entities:\n%s", out)
+			}
+			fm := parseFrontmatter(t, format, out)
+			if got, want := fm["title"], "Don’t & Won't"; got != want {
+				t.Errorf("title = %q, want %q", got, want)
+			}
+			if got, want := decodedStrings(fm["tags"]), []string{"R&D"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("tags = %q, want %q", got, want)
+			}
+		})
+	}
+}
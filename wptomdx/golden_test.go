@@ -0,0 +1,119 @@
+package wptomdx
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files from the current output:
+//
+//	go test ./wptomdx -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files from the current output")
+
+// goldenBaseURL is the site the inputs link to, so their media is made relative
+const goldenBaseURL = "https://example.com"
+
+// TestGolden converts every testdata/golden/<name>.html the way post content
+// is converted and compares it with testdata/golden/<name>.mdx. Add a pair for
+// each conversion rule.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no .html inputs in testdata/golden")
+	}
+
+	converter := NewConverter(Config{
+		BaseURL: goldenBaseURL,
+		Shortcodes: ShortcodeOptions{
+			Components: map[string]string{"note": "Note"},
+		},
+	})
+	// Galleries in the inputs reference these attachment IDs
+	converter.Attachments = &WXRExport{Attachments: map[int]string{
+		1: goldenBaseURL + "/wp-content/uploads/2023/05/one.jpg",
+		2: goldenBaseURL + "/wp-content/uploads/2023/05/two.jpg",
+		3: goldenBaseURL + "/wp-content/uploads/2023/05/three.jpg",
+	}}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".html")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			markdown, _, err := converter.ConvertContent(string(raw))
+			if err != nil {
+				t.Fatalf("ConvertContent: %v", err)
+			}
+			got := strings.TrimSpace(EscapeMDXBraces(markdown)) + "\n"
+
+			golden := strings.TrimSuffix(input, ".html") + ".mdx"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if diff := firstDifference(string(want), got); diff != "" {
+				t.Errorf("output differs from %s:\n%s", golden, diff)
+			}
+		})
+	}
+}
+
+// firstDifference describes the first line where got differs from want, or
+// returns "" when they are equal
+func firstDifference(want string, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		if w, g := goldenLine(wantLines, i), goldenLine(gotLines, i); w != g {
+			return fmt.Sprintf("  line %d\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return "  files differ"
+}
+
+// goldenLine quotes line i of lines, or says the file ended before it
+func goldenLine(lines []string, i int) string {
+	if i >= len(lines) {
+		return "end of file"
+	}
+	return fmt.Sprintf("%q", lines[i])
+}
+
+func TestFirstDifference(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		got  string
+		diff string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"changed line", "a\nb\nc", "a\nx\nc", "  line 2\n  want: \"b\"\n  got:  \"x\""},
+		{"missing line", "a\nb", "a", "  line 2\n  want: \"b\"\n  got:  end of file"},
+		{"extra line", "a", "a\nb", "  line 2\n  want: end of file\n  got:  \"b\""},
+		{"missing trailing newline", "a\n", "a", "  line 2\n  want: \"\"\n  got:  end of file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstDifference(tt.want, tt.got); got != tt.diff {
+				t.Errorf("firstDifference() = %q, want %q", got, tt.diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// JSONPost is a converted post or page in the JSON output modes: its
+// frontmatter fields and markdown body, for headless CMSs and build steps
+type JSONPost struct {
+	ID          int         `json:"id"`
+	Type        string      `json:"type"`
+	Path        string      `json:"path"`
+	URL         string      `json:"url"`
+	Frontmatter Frontmatter `json:"frontmatter"`
+	Content     string      `json:"content"`
+}
+
+// encodeJSONPost serializes a single post for the per-file JSON output
+func encodeJSONPost(post JSONPost) (string, error) {
+	data, err := json.MarshalIndent(post, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %d as JSON: %v", post.ID, err)
+	}
+	return string(data) + "\n", nil
+}
+
+// WriteJSONPosts writes the posts of the combined JSON output to path as a
+// single array ordered by ID
+func WriteJSONPosts(path string, entries []ManifestEntry) error {
+	posts := []JSONPost{}
+	for _, entry := range entries {
+		if entry.Post != nil {
+			posts = append(posts, *entry.Post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID < posts[j].ID })
+
+	data, err := json.MarshalIndent(posts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode posts: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
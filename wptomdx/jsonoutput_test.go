@@ -0,0 +1,101 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// wantJSONPost is the JSON output of testPost(3, "hello", ...) tagged "go"
+const wantJSONPost = `{
+	"id": 3,
+	"type": "post",
+	"path": "hello",
+	"url": "https://example.com/hello/",
+	"frontmatter": {
+		"title": "Post hello",
+		"excerpt": "",
+		"publishDate": "2024-03-01",
+		"updatedDate": "2024-03-02",
+		"isFeatured": false,
+		"tags": ["go"],
+		"seo": {}
+	},
+	"content": "Hi **there**"
+}`
+
+// decodeJSON decodes data into generic values, for comparing JSON documents
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", data, err)
+	}
+	return v
+}
+
+func TestJSONOutput(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"files", wantJSONPost},
+		{"combined", "[" + wantJSONPost + "]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.JSONOutput = tt.mode
+				cfg.JSONOutputPath = t.TempDir() + "/out/posts.json"
+			})
+			post := testPost(3, "hello", "<p>Hi <strong>there</strong></p>")
+			post.Tags = []string{"go"}
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if tt.mode == "combined" {
+				if err := WriteJSONPosts(c.Config.JSONOutputPath, entries); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := decodeJSON(t, string(data)), decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("JSON output =\n%s\nwant\n%s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONPostsOrder(t *testing.T) {
+	path := t.TempDir() + "/nested/posts.json"
+	entries := []ManifestEntry{
+		{ID: 9, Post: &JSONPost{ID: 9, Type: "page"}},
+		{ID: 5},
+		{ID: 2, Post: &JSONPost{ID: 2, Type: "post"}},
+	}
+	if err := WriteJSONPosts(path, entries); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var posts []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(data, &posts); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	if want := []int{2, 9}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("wrote IDs %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,177 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestEntry describes the files generated for a single post or page
+type ManifestEntry struct {
+	ID        int          `json:"id"`
+	Title     string       `json:"title"`
+	SourceURL string       `json:"sourceUrl"`
+	HTMLPath  string       `json:"htmlPath"`
+	MDXPath   string       `json:"mdxPath"`
+	Media     []MediaEntry `json:"media"`
+	// Post is the converted post kept for the combined JSON output
+	Post *JSONPost `json:"-"`
+}
+
+// MediaEntry is a media URL referenced by a post and whether it was downloaded.
+// LocalPath is only set when the file goes somewhere other than the shared
+// media directory, e.g. next to the post when media is colocated.
+type MediaEntry struct {
+	URL        string `json:"url"`
+	LocalPath  string `json:"localPath,omitempty"`
+	Downloaded bool   `json:"downloaded"`
+	// SHA256 is the checksum of the downloaded file, when recorded
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// MediaTarget identifies a single download: a URL and where it's saved
+type MediaTarget struct {
+	URL       string
+	LocalPath string
+}
+
+// Target returns the download this media entry refers to
+func (m MediaEntry) Target() MediaTarget {
+	return MediaTarget{URL: m.URL, LocalPath: m.LocalPath}
+}
+
+// OutputPath returns where the media file is saved: its LocalPath, or its
+// URL path inside mediaDir
+func (m MediaEntry) OutputPath(baseURL string, mediaDir string) string {
+	if m.LocalPath != "" {
+		return m.LocalPath
+	}
+	p, _ := MediaFilePath(m.URL, baseURL)
+	return filepath.Join(mediaDir, p)
+}
+
+// NewMediaEntries wraps a list of media URLs into not-yet-downloaded entries
+func NewMediaEntries(urls []string) []MediaEntry {
+	entries := make([]MediaEntry, 0, len(urls))
+	for _, u := range urls {
+		entries = append(entries, MediaEntry{URL: u})
+	}
+	return entries
+}
+
+// MarkDownloaded sets the Downloaded flag of every media entry whose target was
+// successfully downloaded
+func MarkDownloaded(entries []ManifestEntry, downloaded map[MediaTarget]bool) {
+	for i := range entries {
+		for j := range entries[i].Media {
+			entries[i].Media[j].Downloaded = downloaded[entries[i].Media[j].Target()]
+		}
+	}
+}
+
+// RecordChecksums sets the SHA256 of every media entry whose target has a
+// checksum
+func RecordChecksums(entries []ManifestEntry, checksums map[MediaTarget]string) {
+	for i := range entries {
+		for j := range entries[i].Media {
+			entries[i].Media[j].SHA256 = checksums[entries[i].Media[j].Target()]
+		}
+	}
+}
+
+// UnresolvedMedia is a media reference of an output file that won't resolve
+// on the new site because the media wasn't downloaded
+type UnresolvedMedia struct {
+	MDXPath string
+	URL     string
+	// External is set for media that isn't downloaded because of its host;
+	// otherwise its download failed
+	External bool
+}
+
+// FindUnresolvedMedia lists, per output file, the media entries that weren't
+// downloaded. The entries must have been marked with MarkDownloaded.
+func FindUnresolvedMedia(entries []ManifestEntry, baseURL string, hosts MediaHosts) []UnresolvedMedia {
+	var unresolved []UnresolvedMedia
+	seen := make(map[UnresolvedMedia]bool)
+	for _, entry := range entries {
+		for _, media := range entry.Media {
+			if media.Downloaded {
+				continue
+			}
+			ref := UnresolvedMedia{
+				MDXPath:  entry.MDXPath,
+				URL:      media.URL,
+				External: LocalMediaPath(media.URL, baseURL, hosts) == "",
+			}
+			if !seen[ref] {
+				seen[ref] = true
+				unresolved = append(unresolved, ref)
+			}
+		}
+	}
+	sort.Slice(unresolved, func(i, j int) bool {
+		if unresolved[i].MDXPath != unresolved[j].MDXPath {
+			return unresolved[i].MDXPath < unresolved[j].MDXPath
+		}
+		return unresolved[i].URL < unresolved[j].URL
+	})
+	return unresolved
+}
+
+// UnresolvedMediaReport lists unresolved media grouped by output file
+func UnresolvedMediaReport(unresolved []UnresolvedMedia) string {
+	var b strings.Builder
+	files := 0
+	for i, ref := range unresolved {
+		if i == 0 || unresolved[i-1].MDXPath != ref.MDXPath {
+			files++
+		}
+	}
+	fmt.Fprintf(&b, "Media that won't resolve locally (%d references in %d files)\n", len(unresolved), files)
+	for i, ref := range unresolved {
+		if i == 0 || unresolved[i-1].MDXPath != ref.MDXPath {
+			fmt.Fprintf(&b, "%s\n", ref.MDXPath)
+		}
+		reason := "download failed"
+		if ref.External {
+			reason = "external host"
+		}
+		fmt.Fprintf(&b, "  - %s (%s)\n", ref.URL, reason)
+	}
+	return b.String()
+}
+
+// ReadManifest reads a manifest written by WriteManifest
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", path, err)
+	}
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// WriteManifest writes all entries, ordered by ID, as indented JSON to path
+func WriteManifest(path string, entries []ManifestEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for manifest %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package wptomdx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindUnresolvedMedia(t *testing.T) {
+	const (
+		local    = "https://example.com/wp-content/uploads/a.jpg"
+		external = "https://other.org/b.jpg"
+	)
+	tests := []struct {
+		name       string
+		downloaded map[MediaTarget]bool
+		want       []UnresolvedMedia
+	}{
+		{
+			name:       "external image",
+			downloaded: map[MediaTarget]bool{{URL: local}: true},
+			want:       []UnresolvedMedia{{URL: external, External: true}},
+		},
+		{
+			name:       "failed download",
+			downloaded: map[MediaTarget]bool{},
+			want:       []UnresolvedMedia{{URL: local}, {URL: external, External: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, nil)
+			post := testPost(1, "hello", `<p><img src="`+local+`" alt="a"></p><p><img src="`+external+`" alt="b"></p>`)
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			MarkDownloaded(entries, tt.downloaded)
+			for i := range tt.want {
+				tt.want[i].MDXPath = entries[0].MDXPath
+			}
+			if got := FindUnresolvedMedia(entries, c.Config.BaseURL, c.Config.MediaHosts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindUnresolvedMedia() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindUnresolvedMediaOrder(t *testing.T) {
+	entries := []ManifestEntry{
+		{MDXPath: "posts/b.mdx", Media: []MediaEntry{{URL: "https://example.com/z.jpg"}, {URL: "https://example.com/y.jpg", Downloaded: true}}},
+		{MDXPath: "posts/a.mdx", Media: []MediaEntry{{URL: "https://example.com/x.jpg"}, {URL: "https://example.com/w.jpg"}, {URL: "https://example.com/x.jpg"}}},
+		{MDXPath: "posts/c.mdx", Media: []MediaEntry{{URL: "https://example.com/v.jpg", Downloaded: true}}},
+	}
+	want := []UnresolvedMedia{
+		{MDXPath: "posts/a.mdx", URL: "https://example.com/w.jpg"},
+		{MDXPath: "posts/a.mdx", URL: "https://example.com/x.jpg"},
+		{MDXPath: "posts/b.mdx", URL: "https://example.com/z.jpg"},
+	}
+	if got := FindUnresolvedMedia(entries, "https://example.com", MediaHosts{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindUnresolvedMedia() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUnresolvedMediaReport(t *testing.T) {
+	unresolved := []UnresolvedMedia{
+		{MDXPath: "posts/a.mdx", URL: "https://example.com/w.jpg"},
+		{MDXPath: "posts/a.mdx", URL: "https://other.org/x.jpg", External: true},
+		{MDXPath: "posts/b.mdx", URL: "https://example.com/z.jpg"},
+	}
+	const want = `Media that won't resolve locally (3 references in 2 files)
+posts/a.mdx
+  - https://example.com/w.jpg (download failed)
+  - https://other.org/x.jpg (external host)
+posts/b.mdx
+  - https://example.com/z.jpg (download failed)
+`
+	if got := UnresolvedMediaReport(unresolved); got != want {
+		t.Errorf("UnresolvedMediaReport() =\n%s\nwant:\n%s", got, want)
+	}
+}
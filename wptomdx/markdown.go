@@ -0,0 +1,1114 @@
+package wptomdx
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	html2md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ConvertOptions controls the optional parts of ConvertHTMLToMarkdown's output
+type ConvertOptions struct {
+	// ColumnsComponent, ColumnComponent and GroupComponent are the MDX layout
+	// components wrapping Gutenberg columns, column and group blocks. Blocks
+	// whose component is empty are stacked as plain content.
+	ColumnsComponent string `yaml:"columns_component"`
+	ColumnComponent  string `yaml:"column_component"`
+	GroupComponent   string `yaml:"group_component"`
+
+	// QuoteComponent and PullquoteComponent wrap quotes and pullquotes as
+	// <Quote cite="Author">. When empty, the citation is appended to the
+	// markdown quote instead.
+	QuoteComponent     string `yaml:"quote_component"`
+	PullquoteComponent string `yaml:"pullquote_component"`
+
+	// ButtonComponent renders Gutenberg buttons as <Button href="...">Label</Button>;
+	// when empty they stay plain links
+	ButtonComponent string `yaml:"button_component"`
+
+	// MarkdownImages emits images as ![alt](src "title") instead of <img>.
+	// Captions become an emphasized line below the image.
+	MarkdownImages bool `yaml:"-"`
+
+	// DeriveAltFromFilename fills in missing alt text from the image's file
+	// name, e.g. "team-photo_2024.jpg" -> "team photo 2024"
+	DeriveAltFromFilename bool `yaml:"derive_alt_from_filename"`
+
+	// MoreMarker keeps the <!--more--> fold as a {/* more */} comment
+	MoreMarker bool `yaml:"-"`
+
+	// CaptionShortcodes are the names of the [caption] shortcode and its
+	// aliases, which become figures; empty means caption and wp_caption
+	CaptionShortcodes []string `yaml:"caption_shortcodes"`
+
+	// HeadingStyle is "atx" (# Heading, the default) or "setext" (underlined
+	// level 1 and 2 headings)
+	HeadingStyle string `yaml:"heading_style"`
+	// EmphasisDelimiter is the emphasis delimiter, "_" (the default) or "*"
+	EmphasisDelimiter string `yaml:"emphasis_delimiter"`
+	// BulletChar is the bullet list marker, "-" (the default), "*" or "+"
+	BulletChar string `yaml:"bullet_char"`
+	// HighlightSyntax is "html" (the default) to keep <mark> elements or
+	// "markdown" for ==text==, which needs a highlight plugin to render
+	HighlightSyntax string `yaml:"highlight_syntax"`
+
+	// ListIndent is the minimum indentation of nested lists (2 or 4); lists
+	// nested under wider markers such as "10. " are indented further
+	ListIndent int `yaml:"list_indent"`
+
+	// FollowLinkRedirects resolves links under the base URL to the permalink
+	// they redirect to, through LinkRedirects. Without LinkRedirects each
+	// conversion looks the links up on its own.
+	FollowLinkRedirects bool              `yaml:"follow_link_redirects"`
+	LinkRedirects       *RedirectResolver `yaml:"-"`
+
+	// StripQueryParams lists query parameters removed from links. A trailing
+	// "*" matches a prefix, and "tracking" stands for trackingQueryParams.
+	StripQueryParams []string `yaml:"strip_query_params"`
+
+	// InternalLinkPrefix is prepended to the site-relative links to posts,
+	// e.g. "/blog" turns /my-post/ into /blog/my-post/ for a content
+	// collection. Links to posts are those whose last path segment is one of
+	// PostSlugs; without PostSlugs no link is prefixed.
+	InternalLinkPrefix string          `yaml:"internal_link_prefix"`
+	PostSlugs          map[string]bool `yaml:"-"`
+
+	// MediaHosts are the hosts, besides the base URL, whose media is linked
+	// to as local files; the converter sets it from Config.MediaHosts
+	MediaHosts MediaHosts `yaml:"-"`
+}
+
+// trackingQueryParams are the analytics and ad click parameters removed by
+// the "tracking" entry of StripQueryParams
+var trackingQueryParams = []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid"}
+
+// ConvertHTMLToMarkdown converts HTML content to Markdown format. Links and
+// media under baseURL are made site-relative; the full media URLs are returned
+// for downloading. Its errors are ConversionErrors.
+func ConvertHTMLToMarkdown(inputHtml string, baseURL string, opts ConvertOptions) (string, []string, error) {
+	baseURL = NormalizeBaseURL(baseURL)
+	if opts.FollowLinkRedirects && opts.LinkRedirects == nil {
+		opts.LinkRedirects = NewRedirectResolver(nil, maxRedirectRequests)
+	}
+
+	// turn &lt; into &amp;lt;  so the parser produces a text node containing "&lt;"
+	inputHtml = strings.ReplaceAll(inputHtml, "&lt;", "&amp;lt;")
+	inputHtml = strings.ReplaceAll(inputHtml, "&gt;", "&amp;gt;")
+
+	inputHtml = expandCaptionShortcodes(inputHtml, opts.CaptionShortcodes)
+
+	converter := html2md.NewConverter("", true, &html2md.Options{
+		HeadingStyle:     opts.HeadingStyle,
+		EmDelimiter:      opts.EmphasisDelimiter,
+		BulletListMarker: opts.BulletChar,
+	})
+	// Rules record media through media rather than appending to a slice; see
+	// mediaCollector
+	media := newMediaCollector(baseURL)
+
+	// The parser drops comments, so the fold becomes an element of its own
+	if opts.MoreMarker {
+		inputHtml = moreTagRe.ReplaceAllString(inputHtml, "<wp-more></wp-more>")
+		converter.AddRules(
+			html2md.Rule{
+				Filter: []string{"wp-more"},
+				Replacement: func(_ string, _ *goquery.Selection, _ *html2md.Options) *string {
+					md := "\n\n{/* more */}\n\n"
+					return &md
+				},
+			},
+		)
+	}
+
+	// Table of contents plugins link to ids on the headings, which the new
+	// site replaces with anchors of its own
+	var anchors map[string]string
+	converter.Before(func(selec *goquery.Selection) {
+		anchors = headingAnchors(selec)
+	})
+
+	// Rule to strip baseURL from all <a> hrefs
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"a"},
+			Replacement: func(content string, selec *goquery.Selection, _ *html2md.Options) *string {
+				href, ok := selec.Attr("href")
+				if !ok {
+					return nil
+				}
+				// Formatting in the link text, e.g. a footnote's <sup>, is kept
+				text := selec.Text()
+				if selec.Children().Length() > 0 && selec.Find("img").Length() == 0 {
+					text = strings.TrimSpace(content)
+				}
+
+				// Links within the page only need their anchor updated
+				if fragment, ok := strings.CutPrefix(href, "#"); ok {
+					if anchor, ok := anchors[unescapeFragment(fragment)]; ok {
+						href = "#" + anchor
+					}
+					md := fmt.Sprintf("[%s](%s)", text, href)
+					return &md
+				}
+
+				// The fragment isn't sent to the server, so it is set aside
+				// and added back to wherever the link ends up
+				finalURL, fragment, _ := strings.Cut(href, "#")
+				// only follow redirects for links under our own site, when asked to
+				if opts.FollowLinkRedirects && LocalMediaPath(finalURL, baseURL, opts.MediaHosts) != "" {
+					finalURL = opts.LinkRedirects.Resolve(AbsoluteMediaURL(finalURL, baseURL))
+				}
+
+				finalURL = stripQueryParams(finalURL, opts.StripQueryParams)
+
+				// PDFs in the uploads are downloaded like other media
+				if isPDF(finalURL) && LocalMediaPath(finalURL, baseURL, opts.MediaHosts) != "" {
+					media.add(finalURL)
+				}
+
+				// convert to a site-relative path
+				newHref := relativeURL(finalURL, baseURL, opts.MediaHosts)
+				newHref = prefixPostLink(newHref, opts.InternalLinkPrefix, opts.PostSlugs)
+				if fragment != "" {
+					newHref += "#" + fragment
+				}
+				md := fmt.Sprintf("[%s](%s)", text, newHref)
+				return &md
+			},
+		},
+	)
+	// Add custom rule for images inside paragraph tags
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"p", "span", "h1", "h2", "h3", "h4", "h5", "h6"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				if selec.Children().Length() == 1 && selec.Children().Is("img") {
+					img := selec.Children().First()
+					src, _ := img.Attr("src")
+					alt, _ := img.Attr("alt")
+
+					// Reference the original upload rather than a resized copy
+					src = fullSizeImageURL(src, img.AttrOr("srcset", ""))
+
+					// Keep full URL for downloads
+					media.add(src)
+
+					// Strip base URL for display
+					relativePath := relativeURL(src, baseURL, opts.MediaHosts)
+					markdown := fmt.Sprintf("\n\n%s\n\n", imageTag(relativePath, alt, img.AttrOr("title", ""), "", opts))
+					return &markdown
+				}
+				return nil
+			},
+		},
+	)
+
+	// Add custom rule for figure tags with single <a> child
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"figure"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				// Check for audio element in figure
+				if selec.Children().Length() == 1 && selec.Children().Is("audio") {
+					audio := selec.Children().First()
+					src, ok := audio.Attr("src")
+					if ok {
+						// Keep full URL for downloads
+						media.add(src)
+
+						// Strip base URL for display
+						relativePath := relativeURL(src, baseURL, opts.MediaHosts)
+						markdown := fmt.Sprintf("\n\n<audio controls src=\"%s\"></audio>\n\n", relativePath)
+						return &markdown
+					}
+				}
+
+				// Check for YouTube video in figure with div and figcaption
+				if selec.Children().Length() == 2 {
+					div := selec.Children().First()
+					figcaption := selec.Children().Last()
+
+					if div.Is("div") && figcaption.Is("figcaption") {
+						divText := strings.TrimSpace(div.Text())
+						captionText := strings.TrimSpace(figcaption.Text())
+
+						// Check if div contains YouTube URL
+						if video := parseYouTubeURL(divText); video.ID != "" {
+							markdown := fmt.Sprintf("\n\n%s\n\n%s\n\n", youTubeComponent(video.ID, video), captionText)
+							return &markdown
+						}
+					}
+				}
+
+				// Check for an image block, optionally captioned or wrapped in a link
+				if markdown, src, ok := imageFigure(selec, baseURL, opts); ok {
+					media.add(src)
+					return &markdown
+				}
+
+				// Pullquotes are converted by the blockquote rule
+				if selec.HasClass("wp-block-pullquote") {
+					md := fmt.Sprintf("\n\n%s\n\n", strings.TrimSpace(content))
+					return &md
+				}
+
+				if selec.Children().Length() == 1 && selec.Children().Is("a") {
+					a := selec.Children().First()
+					href, _ := a.Attr("href")
+
+					// Keep full URL for downloads
+					media.add(href)
+
+					// Strip base URL for display
+					relativePath := relativeURL(href, baseURL, opts.MediaHosts)
+
+					// Use link text as alt text if available
+					altText := a.Text()
+					if altText == "" && !opts.DeriveAltFromFilename {
+						altText = "Image"
+					}
+
+					markdown := fmt.Sprintf("\n\n%s\n\n", imageTag(relativePath, altText, a.AttrOr("title", ""), "", opts))
+					return &markdown
+				}
+
+				// Other figures, e.g. gallery and table blocks, keep their
+				// converted content; a nil result would drop it
+				md := fmt.Sprintf("\n\n%s\n\n", strings.TrimSpace(content))
+				return &md
+			},
+		},
+	)
+
+	// Add rule for iframes
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"iframe"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				src, ok := selec.Attr("src")
+				if !ok {
+					return nil
+				}
+				if video := parseYouTubeURL(src); video.ID != "" {
+					md := fmt.Sprintf("\n\n%s\n\n", youTubeComponent("https://youtu.be/"+video.ID, video))
+					return &md
+				}
+				if strings.Contains(src, "youtube.com") || strings.Contains(src, "youtu.be") {
+					src = strings.ReplaceAll(src, "https://www.youtube.com/embed/", "https://youtu.be/")
+					md := fmt.Sprintf("\n\n<YouTube id=\"%s\" />\n\n", src)
+					return &md
+				}
+				md := fmt.Sprintf("\n\n[View embedded content](%s)\n\n", src)
+				return &md
+			},
+		},
+	)
+
+	// Add rule for Gutenberg columns and group blocks. Each block is wrapped in
+	// its configured layout component, or stacked as plain content when unset.
+	// Buttons become the button component, one per paragraph, and classic
+	// editor captions a figure.
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"div"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				var component string
+				switch {
+				case selec.HasClass("wp-caption"):
+					// Classic editor captions render like image blocks
+					markdown, src, ok := imageFigure(selec, baseURL, opts)
+					if !ok {
+						return nil
+					}
+					media.add(src)
+					return &markdown
+				case selec.HasClass("wp-block-button"):
+					link := selec.Find("a").First()
+					if link.Length() == 0 || opts.ButtonComponent == "" {
+						md := fmt.Sprintf("\n\n%s\n\n", strings.TrimSpace(content))
+						return &md
+					}
+					md := fmt.Sprintf("\n\n<%s href=\"%s\">%s</%s>\n\n", opts.ButtonComponent,
+						relativeURL(stripQueryParams(link.AttrOr("href", ""), opts.StripQueryParams), baseURL, opts.MediaHosts), html.EscapeString(strings.TrimSpace(link.Text())), opts.ButtonComponent)
+					return &md
+				case selec.HasClass("wp-block-buttons"):
+					// Buttons are stacked without a wrapper
+				case selec.HasClass("wp-block-columns"):
+					component = opts.ColumnsComponent
+				case selec.HasClass("wp-block-column"):
+					component = opts.ColumnComponent
+				case selec.HasClass("wp-block-group"):
+					component = opts.GroupComponent
+				default:
+					return nil
+				}
+
+				content = strings.TrimSpace(content)
+				if component == "" {
+					md := fmt.Sprintf("\n\n%s\n\n", content)
+					return &md
+				}
+				md := fmt.Sprintf("\n\n<%s>\n\n%s\n\n</%s>\n\n", component, content, component)
+				return &md
+			},
+		},
+	)
+
+	// Quote blocks end with a <cite>. Keep it aside so it isn't converted
+	// as part of the quote text.
+	converter.Before(func(selec *goquery.Selection) {
+		selec.Find("blockquote").Each(func(_ int, quote *goquery.Selection) {
+			cite := quote.ChildrenFiltered("cite").Last()
+			if cite.Length() == 0 {
+				return
+			}
+			author := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(cite.Text()), "—–-"))
+			quote.SetAttr("data-cite", author)
+			cite.Remove()
+		})
+	})
+
+	// Add rule for quotes and pullquotes, keeping their citation
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"blockquote"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				cite := selec.AttrOr("data-cite", "")
+				component := opts.QuoteComponent
+				if selec.HasClass("wp-block-pullquote") || selec.ParentFiltered("figure").HasClass("wp-block-pullquote") {
+					component = opts.PullquoteComponent
+				}
+				if cite == "" && component == "" {
+					return nil
+				}
+
+				content = strings.TrimSpace(content)
+				if component != "" {
+					attrs := ""
+					if cite != "" {
+						attrs = fmt.Sprintf(" cite=\"%s\"", html.EscapeString(cite))
+					}
+					md := fmt.Sprintf("\n\n<%s%s>\n\n%s\n\n</%s>\n\n", component, attrs, content, component)
+					return &md
+				}
+
+				var lines []string
+				for _, line := range strings.Split(content, "\n") {
+					line = strings.TrimRight("> "+line, " ")
+					// Keep a single blank line between paragraphs
+					if line == ">" && len(lines) > 0 && lines[len(lines)-1] == ">" {
+						continue
+					}
+					lines = append(lines, line)
+				}
+				md := fmt.Sprintf("\n\n%s\n>\n> — %s\n\n", strings.Join(lines, "\n"), cite)
+				return &md
+			},
+		},
+	)
+
+	// WordPress often nests lists directly inside lists instead of inside an
+	// item. Move them into the preceding item so they stay sublists.
+	converter.Before(func(selec *goquery.Selection) {
+		selec.Find("ul > ul, ul > ol, ol > ul, ol > ol").Each(func(_ int, list *goquery.Selection) {
+			if prev := list.Prev(); prev.Is("li") {
+				prev.AppendSelection(list)
+			} else {
+				list.WrapHtml("<li></li>")
+			}
+		})
+		// Items holding nothing but a list belong to the item before them
+		selec.Find("li").Each(func(_ int, li *goquery.Selection) {
+			if prev := li.Prev(); isWrapperListItem(li) && prev.Is("li") {
+				prev.AppendSelection(li.Children())
+				li.Remove()
+			}
+		})
+	})
+
+	// Add rule for list items, numbering them from the list's start attribute and
+	// indenting their continuation lines and sublists relative to their marker
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"li"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				content = strings.TrimRight(strings.TrimLeft(content, "\n "), "\n")
+				if strings.TrimSpace(content) == "" {
+					return nil
+				}
+
+				// A leading item that only wraps a list has no marker of its own
+				if isWrapperListItem(selec) {
+					md := content + "\n"
+					return &md
+				}
+
+				marker := listItemMarker(selec, opt.BulletListMarker)
+				indent := strings.Repeat(" ", max(len(marker), opts.ListIndent))
+				lines := strings.Split(content, "\n")
+				for i := 1; i < len(lines); i++ {
+					if strings.TrimSpace(lines[i]) != "" {
+						lines[i] = indent + lines[i]
+					}
+				}
+				md := marker + strings.Join(lines, "\n") + "\n"
+				return &md
+			},
+		},
+	)
+
+	// Add rules for definition lists, which markdown has no syntax for. Each
+	// term becomes a bold line followed by its definitions, separated by hard
+	// line breaks, e.g.
+	//
+	//	**Term**\
+	//	Definition
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"dl"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				md := fmt.Sprintf("\n\n%s\n\n", strings.TrimSpace(content))
+				return &md
+			},
+		},
+		html2md.Rule{
+			Filter: []string{"dt"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				term := strings.TrimSpace(content)
+				if term == "" {
+					return &term
+				}
+				// Terms that are partly bold are made bold as a whole
+				children := selec.Children()
+				bold := children.Length() == 1 && children.Is("strong, b") &&
+					strings.TrimSpace(children.Text()) == strings.TrimSpace(selec.Text())
+				if !bold {
+					term = "**" + strings.ReplaceAll(term, "**", "") + "**"
+				}
+				// Terms sharing definitions are stacked on separate lines
+				md := term + "\\\n"
+				if !selec.Prev().Is("dt") {
+					md = "\n\n" + md
+				}
+				return &md
+			},
+		},
+		html2md.Rule{
+			Filter: []string{"dd"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				md := strings.TrimSpace(content)
+				if selec.Next().Is("dd") {
+					md += "\\\n"
+				} else {
+					md += "\n\n"
+				}
+				return &md
+			},
+		},
+	)
+
+	// Strikethrough becomes ~~text~~. Markdown has no highlight, insertion,
+	// superscript or subscript, so those stay inline HTML, which MDX allows.
+	converter.AddRules(
+		html2md.Rule{
+			Filter: []string{"del", "s", "strike"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				md := wrapDelimiter(content, selec, "~~")
+				return &md
+			},
+		},
+		html2md.Rule{
+			Filter: []string{"mark", "ins", "sup", "sub"},
+			Replacement: func(content string, selec *goquery.Selection, opt *html2md.Options) *string {
+				if goquery.NodeName(selec) == "mark" && opts.HighlightSyntax == "markdown" {
+					md := wrapDelimiter(content, selec, "==")
+					return &md
+				}
+				md := inlineHTML(content, selec)
+				return &md
+			},
+		},
+	)
+
+	markdown, err := converter.ConvertString(inputHtml)
+	if err != nil {
+		return "", nil, &ConversionError{Err: fmt.Errorf("conversion error: %v", err)}
+	}
+
+	// Handle [youtube]URL[/youtube] shortcode format
+	markdown = processYouTubeShortcodes(markdown)
+
+	return markdown, media.urls(), nil
+}
+
+// inlineHTML keeps an inline element as HTML around its converted content.
+// The converter drops the whitespace between elements, so the spaces around
+// it in the source are put back, except next to the converter's own inline
+// elements, which space themselves from it.
+func inlineHTML(content string, selec *goquery.Selection) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return ""
+	}
+	tag := goquery.NodeName(selec)
+	md := "<" + tag + ">" + trimmed + "</" + tag + ">"
+
+	siblings := selec.Parent().Contents()
+	i := siblings.IndexOfSelection(selec)
+	if blankText(siblings.Eq(i-1)) && i >= 2 {
+		if before := goquery.NodeName(siblings.Eq(i - 2)); before == "#text" || isInlineHTMLTag(before) {
+			md = " " + md
+		}
+	}
+	if blankText(siblings.Eq(i+1)) && goquery.NodeName(siblings.Eq(i+2)) == "#text" {
+		md += " "
+	}
+	return md
+}
+
+// isInlineHTMLTag reports whether inlineHTML keeps elements named name
+func isInlineHTMLTag(name string) bool {
+	switch name {
+	case "mark", "ins", "sup", "sub":
+		return true
+	}
+	return false
+}
+
+// blankText reports whether selec is a text node of whitespace only
+func blankText(selec *goquery.Selection) bool {
+	return selec.Length() == 1 && goquery.NodeName(selec) == "#text" && strings.TrimSpace(selec.Text()) == ""
+}
+
+// wrapDelimiter wraps the converted content of an inline element in a
+// markdown delimiter such as ~~, spaced from its neighbors like the
+// converter's own emphasis so that the delimiter is recognized
+func wrapDelimiter(content string, selec *goquery.Selection, delimiter string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return ""
+	}
+	return html2md.AddSpaceIfNessesary(selec, delimiter+trimmed+delimiter)
+}
+
+// processYouTubeShortcodes converts [youtube]URL[/youtube] shortcodes to YouTube components
+func processYouTubeShortcodes(content string) string {
+	result := content
+
+	for {
+		// Find the start of a YouTube shortcode
+		startTag := "\\[youtube\\]"
+		endTag := "\\[/youtube\\]"
+
+		startIndex := strings.Index(result, startTag)
+		if startIndex == -1 {
+			break // No more shortcodes found
+		}
+
+		// Find the corresponding end tag
+		endIndex := strings.Index(result[startIndex:], endTag)
+		if endIndex == -1 {
+			break // No matching end tag found
+		}
+
+		// Adjust endIndex to be relative to the full string
+		endIndex += startIndex
+
+		// Extract the URL between the tags
+		url := result[startIndex+len(startTag) : endIndex]
+
+		// Extract video ID from YouTube URL
+		video := parseYouTubeURL(url)
+
+		replacement := ""
+		if video.ID != "" {
+			replacement = fmt.Sprintf("\n\n%s\n\n", youTubeComponent("https://youtu.be/"+video.ID, video))
+		} else {
+			// If unable to extract video ID, keep original shortcode
+			replacement = result[startIndex : endIndex+len(endTag)]
+		}
+
+		// Replace the shortcode with the YouTube component
+		result = result[:startIndex] + replacement + result[endIndex+len(endTag):]
+	}
+
+	return result
+}
+
+// extractYouTubeVideoID extracts the video ID from various YouTube URL formats
+func extractYouTubeVideoID(url string) string {
+	return parseYouTubeURL(url).ID
+}
+
+// youTubeIDRe matches a YouTube video ID
+var youTubeIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// youTubeVideo is a video a YouTube URL points at, with the second it starts
+// at and the playlist it is played from, if any
+type youTubeVideo struct {
+	ID       string
+	Start    int
+	Playlist string
+}
+
+// params returns the player parameters of the video for the params prop of
+// the astro-embed YouTube component, e.g. "start=30&list=PL..."
+func (v youTubeVideo) params() string {
+	var params []string
+	if v.Start > 0 {
+		params = append(params, fmt.Sprintf("start=%d", v.Start))
+	}
+	if v.Playlist != "" {
+		params = append(params, "list="+url.QueryEscape(v.Playlist))
+	}
+	return strings.Join(params, "&")
+}
+
+// parseYouTubeURL returns the video a youtu.be, watch, embed (including the
+// privacy-enhanced youtube-nocookie.com), shorts or live URL points at, with
+// its start or t and list parameters. The ID is "" for other URLs.
+func parseYouTubeURL(raw string) youTubeVideo {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + strings.TrimPrefix(raw, "//")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return youTubeVideo{}
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	query := u.Query()
+
+	var id string
+	switch host {
+	case "youtu.be":
+		id = segments[0]
+	case "youtube.com", "youtube-nocookie.com":
+		switch segments[0] {
+		case "watch":
+			id = query.Get("v")
+		case "embed", "shorts", "live", "v":
+			if len(segments) > 1 {
+				id = segments[1]
+			}
+		}
+	}
+	if !youTubeIDRe.MatchString(id) || id == "videoseries" {
+		return youTubeVideo{}
+	}
+
+	video := youTubeVideo{ID: id, Start: youTubeSeconds(query.Get("start")), Playlist: query.Get("list")}
+	if video.Start == 0 {
+		video.Start = youTubeSeconds(query.Get("t"))
+	}
+	return video
+}
+
+// youTubeTimeRe matches a YouTube time such as 90, 90s or 1h2m30s
+var youTubeTimeRe = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+
+// youTubeSeconds converts a YouTube start time to seconds, or 0 when it isn't one
+func youTubeSeconds(value string) int {
+	match := youTubeTimeRe.FindStringSubmatch(value)
+	if match == nil {
+		return 0
+	}
+	seconds := 0
+	for i, unit := range []int{3600, 60, 1} {
+		n, _ := strconv.Atoi(match[i+1])
+		seconds += n * unit
+	}
+	return seconds
+}
+
+// youTubeComponent renders the astro-embed YouTube component for a video,
+// passing its start time and playlist on through the params prop
+func youTubeComponent(id string, video youTubeVideo) string {
+	if params := video.params(); params != "" {
+		return fmt.Sprintf("<YouTube id=\"%s\" params=\"%s\" />", id, params)
+	}
+	return fmt.Sprintf("<YouTube id=\"%s\" />", id)
+}
+
+// prefixPostLink prepends prefix to href, a link made site-relative, when it
+// leads to a post: a page of the site, rather than a file or part of
+// WordPress itself, whose last path segment is one of slugs. Without slugs no
+// link is known to be a post.
+func prefixPostLink(href string, prefix string, slugs map[string]bool) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || len(slugs) == 0 || !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return href
+	}
+	linkPath, query, _ := strings.Cut(href, "?")
+	trimmed := strings.Trim(linkPath, "/")
+	if trimmed == "" || strings.HasPrefix(trimmed, "wp-") || path.Ext(trimmed) != "" {
+		return href
+	}
+	if slug := path.Base(trimmed); !slugs[slug] && !slugs[unescapeFragment(slug)] {
+		return href
+	}
+	if query != "" {
+		linkPath += "?" + query
+	}
+	return "/" + prefix + linkPath
+}
+
+// headingAnchors maps the ids of the headings in doc, and of the elements
+// inside them where table of contents plugins put theirs, to the anchor the
+// new site generates from the heading's text
+func headingAnchors(doc *goquery.Selection) map[string]string {
+	anchors := make(map[string]string)
+	seen := make(map[string]int)
+	doc.Find("h1, h2, h3, h4, h5, h6").Each(func(_ int, heading *goquery.Selection) {
+		ids := heading.Find("[id]").AddSelection(heading.Filter("[id]"))
+		if ids.Length() == 0 {
+			// The slug is still counted so that later duplicates are numbered right
+			headingSlug(heading.Text(), seen)
+			return
+		}
+		anchor := headingSlug(heading.Text(), seen)
+		ids.Each(func(_ int, el *goquery.Selection) {
+			if id := el.AttrOr("id", ""); id != "" {
+				anchors[id] = anchor
+			}
+		})
+	})
+	return anchors
+}
+
+// headingSlug returns the anchor of a heading the way GitHub and most static
+// site generators make it: lowercased, punctuation removed and spaces turned
+// into hyphens, with "-1", "-2"... added to repeated headings, which seen
+// counts
+func headingSlug(text string, seen map[string]int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	slug := b.String()
+	if n := seen[slug]; n > 0 {
+		seen[slug] = n + 1
+		slug = fmt.Sprintf("%s-%d", slug, n)
+	} else {
+		seen[slug] = 1
+	}
+	return slug
+}
+
+// unescapeFragment decodes the percent escapes of a link's fragment, which
+// the ids it points at don't have
+func unescapeFragment(fragment string) string {
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		return unescaped
+	}
+	return fragment
+}
+
+// stripQueryParams removes the named query parameters from href, keeping the
+// others in their original order. In-page anchors are left alone.
+func stripQueryParams(href string, params []string) string {
+	if len(params) == 0 || strings.HasPrefix(href, "#") {
+		return href
+	}
+	u, err := url.Parse(href)
+	if err != nil || u.RawQuery == "" {
+		return href
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && matchesQueryParam(name, params) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	return u.String()
+}
+
+// matchesQueryParam reports whether name is one of params
+func matchesQueryParam(name string, params []string) bool {
+	for _, param := range params {
+		if param == "tracking" {
+			if matchesQueryParam(name, trackingQueryParams) {
+				return true
+			}
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(param, "*"); ok && strings.HasPrefix(name, prefix) {
+			return true
+		}
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// listItemMarker returns the "- " or "N. " marker of a list item, counting
+// ordered items from the list's start attribute
+func listItemMarker(li *goquery.Selection, bullet string) string {
+	list := li.Parent()
+	if !list.Is("ol") {
+		return bullet + " "
+	}
+	start, err := strconv.Atoi(list.AttrOr("start", "1"))
+	if err != nil {
+		start = 1
+	}
+	return fmt.Sprintf("%d. ", start+li.PrevAllFiltered("li").Length())
+}
+
+// isWrapperListItem reports whether li holds nothing but nested lists
+func isWrapperListItem(li *goquery.Selection) bool {
+	children := li.Children()
+	return children.Length() > 0 && children.Not("ul, ol").Length() == 0 &&
+		strings.TrimSpace(li.Text()) == strings.TrimSpace(children.Text())
+}
+
+// imageFigure renders a Gutenberg image block, <figure> holding an <img> (or
+// an <a> wrapping it) and optionally a <figcaption>, as a site-relative image,
+// as well as the classic editor's <div class="wp-caption"> whose caption is a
+// <p class="wp-caption-text">. The image is wrapped in a figure with the
+// caption text when there is one. Links to something other than an image
+// file are kept around the image, and the block's alignment and size classes
+// become data-align and data-size attributes. It returns the image URL to download.
+func imageFigure(selec *goquery.Selection, baseURL string, opts ConvertOptions) (string, string, bool) {
+	children := selec.Children()
+	figcaption := children.Last()
+	switch {
+	case children.Length() == 2 && figcaption.Is("figcaption, p.wp-caption-text"):
+	case children.Length() == 1:
+		figcaption = nil
+	default:
+		return "", "", false
+	}
+
+	img, link := children.First(), ""
+	if img.Is("a") && img.Children().Length() == 1 && img.Children().Is("img") {
+		href := img.AttrOr("href", "")
+		if !isImageFile(href) {
+			link = relativeURL(href, baseURL, opts.MediaHosts)
+		}
+		img = img.Children().First()
+	}
+	if !img.Is("img") {
+		return "", "", false
+	}
+
+	src := fullSizeImageURL(img.AttrOr("src", ""), img.AttrOr("srcset", ""))
+	if src == "" {
+		return "", "", false
+	}
+	attrs := imageBlockAttrs(selec)
+	imgAttrs := ""
+	if figcaption == nil {
+		imgAttrs = attrs
+	}
+	imgTag := imageTag(relativeURL(src, baseURL, opts.MediaHosts), img.AttrOr("alt", ""), img.AttrOr("title", ""), imgAttrs, opts)
+	if opts.MarkdownImages {
+		if link != "" {
+			imgTag = fmt.Sprintf("[%s](%s)", imgTag, link)
+		}
+		// Markdown has no captions; keep it as a line of its own
+		var caption string
+		if figcaption != nil {
+			caption = strings.NewReplacer("*", `\*`, "_", `\_`).Replace(strings.TrimSpace(figcaption.Text()))
+		}
+		if caption == "" {
+			return fmt.Sprintf("\n\n%s\n\n", imgTag), src, true
+		}
+		delimiter := "*"
+		if opts.EmphasisDelimiter != "" {
+			delimiter = opts.EmphasisDelimiter
+		}
+		return fmt.Sprintf("\n\n%s\n%s%s%s\n\n", imgTag, delimiter, caption, delimiter), src, true
+	}
+	if link != "" {
+		imgTag = fmt.Sprintf("<a href=\"%s\">%s</a>", link, imgTag)
+	}
+	if figcaption == nil {
+		return fmt.Sprintf("\n\n%s\n\n", imgTag), src, true
+	}
+	caption := html.EscapeString(strings.TrimSpace(figcaption.Text()))
+
+	markdown := fmt.Sprintf("\n\n<figure%s>\n  %s\n  <figcaption>%s</figcaption>\n</figure>\n\n", attrs, imgTag, caption)
+	return markdown, src, true
+}
+
+// imageBlockAttrs returns the data-align and data-size attributes for the
+// alignment (alignwide, aligncenter, ...) and size (size-large, ...) classes
+// of an image block
+func imageBlockAttrs(selec *goquery.Selection) string {
+	var attrs string
+	for _, class := range strings.Fields(selec.AttrOr("class", "")) {
+		if align, ok := strings.CutPrefix(class, "align"); ok && align != "" {
+			attrs += fmt.Sprintf(" data-align=\"%s\"", html.EscapeString(align))
+		} else if size, ok := strings.CutPrefix(class, "size-"); ok && size != "" {
+			attrs += fmt.Sprintf(" data-size=\"%s\"", html.EscapeString(size))
+		}
+	}
+	return attrs
+}
+
+// isPDF reports whether u points at a PDF document
+func isPDF(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(path.Ext(parsed.Path), ".pdf")
+}
+
+// isImageFile reports whether u points at an image file rather than a page
+func isImageFile(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mime.TypeByExtension(path.Ext(parsed.Path)), "image/")
+}
+
+// sizeSuffixRe matches the -WIDTHxHEIGHT suffix WordPress adds to resized images
+var sizeSuffixRe = regexp.MustCompile(`-\d+x\d+(\.[A-Za-z0-9]+)$`)
+
+// imageTag renders an <img>, keeping its title when there is one and adding
+// attrs, e.g. ` data-align="wide"`. Without alt text, the alt is derived from
+// the file name if opts ask for it.
+func imageTag(src string, alt string, title string, attrs string, opts ConvertOptions) string {
+	if alt == "" && opts.DeriveAltFromFilename {
+		alt = altFromFilename(src)
+	}
+	if opts.MarkdownImages {
+		return markdownImage(src, alt, title)
+	}
+	tag := fmt.Sprintf("<img src=\"%s\" alt=\"%s\"", src, html.EscapeString(alt))
+	if title != "" {
+		tag += fmt.Sprintf(" title=\"%s\"", html.EscapeString(title))
+	}
+	return tag + attrs + " />"
+}
+
+// markdownImage renders an image in markdown syntax, escaping the characters
+// that would end its alt text, URL or title early
+func markdownImage(src string, alt string, title string) string {
+	alt = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(alt)
+	if strings.ContainsAny(src, " ()") {
+		src = "<" + src + ">"
+	}
+	if title == "" {
+		return fmt.Sprintf("![%s](%s)", alt, src)
+	}
+	title = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(title)
+	return fmt.Sprintf("![%s](%s \"%s\")", alt, src, title)
+}
+
+// altSeparatorRe matches the dashes and underscores separating words in file names
+var altSeparatorRe = regexp.MustCompile(`[-_\s]+`)
+
+// altFromFilename turns an image URL's file name into readable alt text
+func altFromFilename(src string) string {
+	name := src
+	if u, err := url.Parse(src); err == nil {
+		name = u.Path
+	}
+	name = sizeSuffixRe.ReplaceAllString(path.Base(name), "$1")
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return strings.TrimSpace(altSeparatorRe.ReplaceAllString(name, " "))
+}
+
+// fullSizeImageURL returns the URL of the original upload behind an image: the
+// widest srcset candidate (falling back to src), without WordPress' -WxH resize
+// suffix, e.g. image-300x200.jpg -> image.jpg
+func fullSizeImageURL(src string, srcset string) string {
+	best, bestWidth := src, 0
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) < 2 || !strings.HasSuffix(fields[1], "w") {
+			continue
+		}
+		if width, err := strconv.Atoi(strings.TrimSuffix(fields[1], "w")); err == nil && width > bestWidth {
+			best, bestWidth = fields[0], width
+		}
+	}
+
+	// Only strip the suffix from the path, leaving any query string alone
+	path, query, hasQuery := strings.Cut(best, "?")
+	path = sizeSuffixRe.ReplaceAllString(path, "$1")
+	if hasQuery {
+		return path + "?" + query
+	}
+	return path
+}
+
+// mediaCollector accumulates the media URLs found by the conversion rules.
+// The converter may run a rule's children through several rules when an
+// earlier one declines, and nothing promises it converts sequentially, so
+// adding is idempotent and safe for concurrent use. URLs keep the order in
+// which they were first found, and relative ones are resolved against
+// baseURL so they can be downloaded.
+type mediaCollector struct {
+	mu      sync.Mutex
+	baseURL string
+	seen    map[string]bool
+	list    []string
+}
+
+// newMediaCollector returns an empty mediaCollector
+func newMediaCollector(baseURL string) *mediaCollector {
+	return &mediaCollector{baseURL: baseURL, seen: make(map[string]bool)}
+}
+
+// add records a media URL unless it was already found
+func (m *mediaCollector) add(u string) {
+	u = AbsoluteMediaURL(u, m.baseURL)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.seen[u] {
+		m.seen[u] = true
+		m.list = append(m.list, u)
+	}
+}
+
+// urls returns the recorded media URLs
+func (m *mediaCollector) urls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.list...)
+}
+
+// moreTagRe matches the <!--more--> fold, optionally with custom link text
+var moreTagRe = regexp.MustCompile(`<!--\s*more\b.*?-->`)
+
+// moreTagExcerpt returns the text before the <!--more--> fold of some HTML,
+// or "" when there is none
+func moreTagExcerpt(inputHtml string) string {
+	loc := moreTagRe.FindStringIndex(inputHtml)
+	if loc == nil {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(inputHtml[:loc[0]]))
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
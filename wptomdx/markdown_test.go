@@ -0,0 +1,905 @@
+package wptomdx
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testBaseURL is the site of the converted test content
+const testBaseURL = "https://example.com"
+
+// convertTest is a conversion case: HTML in, the markdown and media URLs out
+type convertTest struct {
+	name      string
+	in        string
+	opts      ConvertOptions
+	want      string
+	wantMedia []string
+}
+
+// runConvertTests converts every case with ConvertHTMLToMarkdown. The media
+// URLs are only compared when the case lists some.
+func runConvertTests(t *testing.T, tests []convertTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, media, err := ConvertHTMLToMarkdown(tt.in, testBaseURL, tt.opts)
+			if err != nil {
+				t.Fatalf("ConvertHTMLToMarkdown() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ConvertHTMLToMarkdown(%q) =\n%q\nwant\n%q", tt.in, got, tt.want)
+			}
+			if tt.wantMedia != nil && !reflect.DeepEqual(media, tt.wantMedia) {
+				t.Errorf("media = %q, want %q", media, tt.wantMedia)
+			}
+		})
+	}
+}
+
+func TestConvertLayoutBlocks(t *testing.T) {
+	const columns = `<div class="wp-block-columns">` +
+		`<div class="wp-block-column"><p>Left text</p></div>` +
+		`<div class="wp-block-column"><p>Right</p><figure class="wp-block-image"><img src="https://example.com/wp-content/uploads/r.jpg" alt="R"/></figure></div>` +
+		`</div><div class="wp-block-group"><p>Grouped</p></div>`
+	runConvertTests(t, []convertTest{
+		{
+			name: "components",
+			in:   columns,
+			opts: ConvertOptions{ColumnsComponent: "Columns", ColumnComponent: "Column", GroupComponent: "Group"},
+			want: "<Columns>\n\n<Column>\n\nLeft text\n\n</Column>\n\n<Column>\n\nRight\n\n" +
+				`<img src="/wp-content/uploads/r.jpg" alt="R" />` +
+				"\n\n</Column>\n\n</Columns>\n\n<Group>\n\nGrouped\n\n</Group>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/r.jpg"},
+		},
+		{
+			name:      "stacked",
+			in:        columns,
+			want:      "Left text\n\nRight\n\n" + `<img src="/wp-content/uploads/r.jpg" alt="R" />` + "\n\nGrouped",
+			wantMedia: []string{"https://example.com/wp-content/uploads/r.jpg"},
+		},
+	})
+}
+
+func TestFullSizeImageURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		srcset string
+		want   string
+	}{
+		{"original", "https://example.com/a/photo.jpg", "", "https://example.com/a/photo.jpg"},
+		{"size suffix", "https://example.com/a/photo-300x200.jpg", "", "https://example.com/a/photo.jpg"},
+		{"query kept", "https://example.com/a/photo-300x200.jpg?v=2", "", "https://example.com/a/photo.jpg?v=2"},
+		{"widest candidate", "https://example.com/a/photo-300x200.jpg",
+			"https://example.com/a/photo-300x200.jpg 300w, https://example.com/a/photo-2048x1365.jpg 2048w, https://example.com/a/photo-1024x683.jpg 1024w",
+			"https://example.com/a/photo.jpg"},
+		{"density descriptors ignored", "https://example.com/a/small.jpg", "https://example.com/a/large.jpg 2x", "https://example.com/a/small.jpg"},
+		{"dimensions in the name", "https://example.com/a/1920x1080.jpg", "", "https://example.com/a/1920x1080.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fullSizeImageURL(tt.src, tt.srcset); got != tt.want {
+				t.Errorf("fullSizeImageURL(%q, %q) = %q, want %q", tt.src, tt.srcset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertResponsiveImages(t *testing.T) {
+	const full = "https://example.com/wp-content/uploads/2024/03/photo.jpg"
+	const want = `<img src="/wp-content/uploads/2024/03/photo.jpg" alt="Photo" />`
+	runConvertTests(t, []convertTest{
+		{
+			name: "srcset",
+			in: `<p><img src="https://example.com/wp-content/uploads/2024/03/photo-300x200.jpg" ` +
+				`srcset="https://example.com/wp-content/uploads/2024/03/photo-300x200.jpg 300w, https://example.com/wp-content/uploads/2024/03/photo.jpg 1600w" alt="Photo"></p>`,
+			want:      want,
+			wantMedia: []string{full},
+		},
+		{
+			name:      "suffixed src",
+			in:        `<p><img src="https://example.com/wp-content/uploads/2024/03/photo-300x200.jpg" alt="Photo"></p>`,
+			want:      want,
+			wantMedia: []string{full},
+		},
+	})
+}
+
+func TestConvertHTMLToMarkdownBaseURL(t *testing.T) {
+	const in = `<p><a href="https://blog.example.org/about/">About</a></p>` +
+		`<p><img src="https://blog.example.org/wp-content/uploads/a.jpg" alt="A"></p>` +
+		`<p><img src="https://example.com/wp-content/uploads/b.jpg" alt="B"></p>`
+	media := []string{"https://blog.example.org/wp-content/uploads/a.jpg", "https://example.com/wp-content/uploads/b.jpg"}
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"https://example.com",
+			"[About](https://blog.example.org/about/)\n\n" +
+				`<img src="https://blog.example.org/wp-content/uploads/a.jpg" alt="A" />` + "\n\n" +
+				`<img src="/wp-content/uploads/b.jpg" alt="B" />`},
+		{"https://blog.example.org",
+			"[About](/about/)\n\n" +
+				`<img src="/wp-content/uploads/a.jpg" alt="A" />` + "\n\n" +
+				`<img src="https://example.com/wp-content/uploads/b.jpg" alt="B" />`},
+		{"https://blog.example.org/",
+			"[About](/about/)\n\n" +
+				`<img src="/wp-content/uploads/a.jpg" alt="A" />` + "\n\n" +
+				`<img src="https://example.com/wp-content/uploads/b.jpg" alt="B" />`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			// Nothing is read from the environment, so conversions can run side by side
+			t.Parallel()
+			got, gotMedia, err := ConvertHTMLToMarkdown(in, tt.baseURL, ConvertOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ConvertHTMLToMarkdown(%q) =\n%q\nwant\n%q", tt.baseURL, got, tt.want)
+			}
+			if !reflect.DeepEqual(gotMedia, media) {
+				t.Errorf("media = %q, want %q", gotMedia, media)
+			}
+		})
+	}
+}
+
+func TestConvertFigureCaptions(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{
+			name:      "image and caption",
+			in:        `<figure class="wp-block-image"><img src="https://example.com/wp-content/uploads/a.jpg" alt="A"/><figcaption>The <em>caption</em></figcaption></figure>`,
+			want:      "<figure>\n  <img src=\"/wp-content/uploads/a.jpg\" alt=\"A\" />\n  <figcaption>The caption</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+		{
+			name: "linked to the full size image",
+			in: `<figure class="wp-block-image"><a href="https://example.com/wp-content/uploads/a.jpg"><img src="https://example.com/wp-content/uploads/a-300x200.jpg" alt="A"/></a>` +
+				`<figcaption>Linked caption</figcaption></figure>`,
+			want:      "<figure>\n  <img src=\"/wp-content/uploads/a.jpg\" alt=\"A\" />\n  <figcaption>Linked caption</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+		{
+			name: "linked elsewhere",
+			in: `<figure class="wp-block-image"><a href="https://example.org/elsewhere"><img src="https://example.com/wp-content/uploads/b.jpg" alt="B"/></a>` +
+				`<figcaption>Elsewhere</figcaption></figure>`,
+			want:      "<figure>\n  <a href=\"https://example.org/elsewhere\"><img src=\"/wp-content/uploads/b.jpg\" alt=\"B\" /></a>\n  <figcaption>Elsewhere</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/b.jpg"},
+		},
+		{
+			name:      "no caption",
+			in:        `<figure class="wp-block-image"><img src="https://example.com/wp-content/uploads/a.jpg" alt="A"/></figure>`,
+			want:      `<img src="/wp-content/uploads/a.jpg" alt="A" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+	})
+}
+
+func TestConvertNestedLists(t *testing.T) {
+	const nested = `<ul><li>One<ol><li>Sub one<ul><li>Deep</li></ul></li><li>Sub two</li></ol></li><li>Two</li></ul>`
+	runConvertTests(t, []convertTest{
+		{
+			name: "three levels",
+			in:   nested,
+			want: "- One\n  1. Sub one\n     - Deep\n  2. Sub two\n- Two",
+		},
+		{
+			name: "four space indent",
+			in:   nested,
+			opts: ConvertOptions{ListIndent: 4},
+			want: "- One\n    1. Sub one\n        - Deep\n    2. Sub two\n- Two",
+		},
+		{
+			name: "start attribute",
+			in:   `<ol start="5"><li>Five</li><li>Six</li></ol>`,
+			want: "5. Five\n6. Six",
+		},
+		{
+			name: "nested start attribute",
+			in:   `<ol start="5"><li>Five<ol start="3"><li>Three</li></ol></li><li>Six</li></ol>`,
+			want: "5. Five\n   3. Three\n6. Six",
+		},
+	})
+}
+
+func TestConvertDefinitionLists(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{
+			name: "single term",
+			in:   `<dl><dt>Term</dt><dd>Definition</dd></dl>`,
+			want: "**Term**\\\nDefinition",
+		},
+		{
+			name: "multiple terms",
+			in:   `<dl><dt>A</dt><dd>One</dd><dt>B</dt><dd>Two</dd><dd>Three</dd></dl>`,
+			want: "**A**\\\nOne\n\n**B**\\\nTwo\\\nThree",
+		},
+		{
+			name: "shared definition",
+			in:   `<dl><dt>A</dt><dt>B</dt><dd>Shared</dd></dl>`,
+			want: "**A**\\\n**B**\\\nShared",
+		},
+		{
+			name: "bold term",
+			in:   `<dl><dt><strong>Bold</strong></dt><dd>Already bold</dd></dl>`,
+			want: "**Bold**\\\nAlready bold",
+		},
+		{
+			name: "partly bold term",
+			in:   `<dl><dt><strong>A</strong> and <b>B</b></dt><dd>Partly bold</dd></dl>`,
+			want: "**A and B**\\\nPartly bold",
+		},
+		{
+			name: "inline markup",
+			in:   `<dl><dt><em>Em</em> term</dt><dd><a href="https://example.com/x/">link</a> and <code>code</code></dd></dl>`,
+			want: "**_Em_ term**\\\n[link](/x/) and `code`",
+		},
+		{
+			name: "between paragraphs",
+			in:   `<p>Before</p><dl><dt>T</dt><dd>D</dd></dl><p>After</p>`,
+			want: "Before\n\n**T**\\\nD\n\nAfter",
+		},
+	})
+}
+
+func TestConvertMarkdownStyle(t *testing.T) {
+	const (
+		in      = `<h1>Title</h1><h2>Sub</h2><h3>Third</h3><p><em>em</em> and <strong>strong</strong></p><ul><li>One<ul><li>Nested</li></ul></li></ul>`
+		figure  = `<figure><img src="https://example.com/a.jpg" alt="A"><figcaption>Caption</figcaption></figure>`
+		body    = "\n\n### Third\n\n_em_ and **strong**\n\n- One\n  - Nested"
+		atxHead = "# Title\n\n## Sub"
+	)
+	runConvertTests(t, []convertTest{
+		{
+			name: "defaults",
+			in:   in,
+			want: atxHead + body,
+		},
+		{
+			name: "setext headings",
+			in:   in,
+			opts: ConvertOptions{HeadingStyle: "setext"},
+			want: "Title\n=====\n\nSub\n---" + body,
+		},
+		{
+			name: "asterisk emphasis",
+			in:   in,
+			opts: ConvertOptions{EmphasisDelimiter: "*"},
+			want: atxHead + "\n\n### Third\n\n*em* and **strong**\n\n- One\n  - Nested",
+		},
+		{
+			name: "asterisk bullets",
+			in:   in,
+			opts: ConvertOptions{BulletChar: "*"},
+			want: atxHead + "\n\n### Third\n\n_em_ and **strong**\n\n* One\n  * Nested",
+		},
+		{
+			name: "plus bullets",
+			in:   in,
+			opts: ConvertOptions{BulletChar: "+"},
+			want: atxHead + "\n\n### Third\n\n_em_ and **strong**\n\n+ One\n  + Nested",
+		},
+		{
+			name: "caption emphasis",
+			in:   figure,
+			opts: ConvertOptions{MarkdownImages: true},
+			want: "![A](/a.jpg)\n*Caption*",
+		},
+		{
+			name: "underscore caption emphasis",
+			in:   figure,
+			opts: ConvertOptions{MarkdownImages: true, EmphasisDelimiter: "_"},
+			want: "![A](/a.jpg)\n_Caption_",
+		},
+	})
+}
+
+func TestConvertInlineElements(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{name: "del", in: `<p>Old <del>price</del> here</p>`, want: "Old ~~price~~ here"},
+		{name: "s and strike", in: `<p>Old <s>price</s>, <strike>gone</strike></p>`, want: "Old ~~price~~, ~~gone~~"},
+		{name: "spaced del", in: `<p>A <del> spaced </del> word</p>`, want: "A ~~spaced~~ word"},
+		{name: "empty del", in: `<p>Empty <del></del> tag</p>`, want: "Empty  tag"},
+		{name: "ins", in: `<p>New <ins>text</ins> here</p>`, want: "New <ins>text</ins> here"},
+		{name: "mark", in: `<p>A <mark>note</mark> here</p>`, want: "A <mark>note</mark> here"},
+		{
+			name: "mark as markdown",
+			in:   `<p>A <mark>note</mark> here</p>`,
+			opts: ConvertOptions{HighlightSyntax: "markdown"},
+			want: "A ==note== here",
+		},
+		{name: "blank mark", in: `<p><mark> </mark>only space</p>`, want: "only space"},
+		{name: "sup and sub", in: `<p>x<sup>2</sup> and H<sub>2</sub>O</p>`, want: "x<sup>2</sup> and H<sub>2</sub>O"},
+		{name: "within strong", in: `<p><strong>Bold <del>struck</del></strong></p>`, want: "**Bold ~~struck~~**"},
+		{name: "within list item", in: `<ul><li>Item <del>gone</del></li></ul>`, want: "- Item ~~gone~~"},
+		{name: "mark in link", in: `<p><a href="https://example.com/x/">a <mark>b</mark></a></p>`, want: "[a <mark>b</mark>](/x/)"},
+		{name: "footnote link", in: `<p>See<a href="#fn1"><sup>1</sup></a> here</p>`, want: "See[<sup>1</sup>](#fn1) here"},
+		{name: "del in link", in: `<p><a href="https://example.com/x/"><del>del</del> link</a></p>`, want: "[~~del~~ link](/x/)"},
+	})
+}
+
+func TestConvertAnchorLinks(t *testing.T) {
+	// Table of contents plugins put their ids on the headings or on elements
+	// inside them
+	const headings = `<h2 id="Getting_Started">Getting Started</h2><h2><span class="ez-toc-section" id="Café_Time"></span>Café Time</h2><h2 id="intro">Intro</h2><h2 id="intro-again">Intro</h2>`
+	const anchors = "## Getting Started\n\n## Café Time\n\n## Intro\n\n## Intro\n\n"
+	postLinks := ConvertOptions{InternalLinkPrefix: "/blog", PostSlugs: map[string]bool{"post": true}}
+	runConvertTests(t, []convertTest{
+		{name: "section", in: headings + `<p><a href="#Getting_Started">a</a></p>`, want: anchors + "[a](#getting-started)"},
+		{name: "id inside heading", in: headings + `<p><a href="#Café_Time">a</a></p>`, want: anchors + "[a](#café-time)"},
+		{name: "escaped section", in: headings + `<p><a href="#Caf%C3%A9_Time">a</a></p>`, want: anchors + "[a](#café-time)"},
+		{name: "repeated heading", in: headings + `<p><a href="#intro-again">a</a></p>`, want: anchors + "[a](#intro-1)"},
+		{name: "unknown section", in: headings + `<p><a href="#unknown">a</a></p>`, want: anchors + "[a](#unknown)"},
+		{name: "top of page", in: `<p><a href="#">top</a></p>`, want: "[top](#)"},
+		{name: "relative post section", in: `<p><a href="/post#section">a</a></p>`, want: "[a](/post#section)"},
+		{name: "post section", in: `<p><a href="https://example.com/post/#section">a</a></p>`, want: "[a](/post/#section)"},
+		{name: "prefixed post section", in: `<p><a href="/post#section">a</a></p>`, opts: postLinks, want: "[a](/blog/post#section)"},
+		{name: "prefixed post URL section", in: `<p><a href="https://example.com/post/#section">a</a></p>`, opts: postLinks, want: "[a](/blog/post/#section)"},
+		{
+			name: "stripped query before section",
+			in:   `<p><a href="https://example.com/post/?utm_source=x&amp;page=2#section">a</a></p>`,
+			opts: ConvertOptions{StripQueryParams: []string{"utm_source"}},
+			want: "[a](/post/?page=2#section)",
+		},
+		{name: "empty section", in: `<p><a href="/post#">a</a></p>`, want: "[a](/post)"},
+		{name: "external section", in: `<p><a href="https://other.org/post/#section">a</a></p>`, want: "[a](https://other.org/post/#section)"},
+	})
+}
+
+func TestPrefixPostLink(t *testing.T) {
+	slugs := map[string]bool{"my-post": true, "café": true}
+	tests := []struct {
+		name   string
+		href   string
+		prefix string
+		slugs  map[string]bool
+		want   string
+	}{
+		{"post", "/my-post/", "/blog", slugs, "/blog/my-post/"},
+		{"no trailing slash", "/my-post", "/blog", slugs, "/blog/my-post"},
+		{"dated permalink", "/2024/03/my-post/", "/blog", slugs, "/blog/2024/03/my-post/"},
+		{"query", "/my-post/?page=2", "/blog", slugs, "/blog/my-post/?page=2"},
+		{"bare prefix", "/my-post/", "blog", slugs, "/blog/my-post/"},
+		{"prefix with slashes", "/my-post/", "/content/blog/", slugs, "/content/blog/my-post/"},
+		{"escaped slug", "/caf%C3%A9/", "/blog", slugs, "/blog/caf%C3%A9/"},
+		{"page", "/about/", "/blog", slugs, "/about/"},
+		{"upload", "/wp-content/uploads/my-post", "/blog", slugs, "/wp-content/uploads/my-post"},
+		{"file", "/files/my-post.pdf", "/blog", slugs, "/files/my-post.pdf"},
+		{"home", "/", "/blog", slugs, "/"},
+		{"external", "https://other.org/my-post/", "/blog", slugs, "https://other.org/my-post/"},
+		{"protocol-relative", "//other.org/my-post/", "/blog", slugs, "//other.org/my-post/"},
+		{"no prefix", "/my-post/", "", slugs, "/my-post/"},
+		{"no slugs", "/my-post/", "/blog", nil, "/my-post/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixPostLink(tt.href, tt.prefix, tt.slugs); got != tt.want {
+				t.Errorf("prefixPostLink(%q, %q) = %q, want %q", tt.href, tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertInternalLinkPrefix(t *testing.T) {
+	opts := ConvertOptions{InternalLinkPrefix: "/blog", PostSlugs: map[string]bool{"my-post": true}}
+	runConvertTests(t, []convertTest{
+		{name: "post", in: `<p><a href="https://example.com/my-post/">Read</a></p>`, opts: opts, want: "[Read](/blog/my-post/)"},
+		{name: "relative post", in: `<p><a href="/my-post/">Read</a></p>`, opts: opts, want: "[Read](/blog/my-post/)"},
+		{name: "post section", in: `<p><a href="https://example.com/my-post/#part">Read</a></p>`, opts: opts, want: "[Read](/blog/my-post/#part)"},
+		{name: "page", in: `<p><a href="https://example.com/about/">About</a></p>`, opts: opts, want: "[About](/about/)"},
+		{name: "other site", in: `<p><a href="https://other.org/my-post/">Elsewhere</a></p>`, opts: opts, want: "[Elsewhere](https://other.org/my-post/)"},
+		{name: "no prefix", in: `<p><a href="https://example.com/my-post/">Read</a></p>`, want: "[Read](/my-post/)"},
+	})
+}
+
+func TestStripQueryParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		href   string
+		params []string
+		want   string
+	}{
+		{"no params configured", "https://example.org/?utm_source=x", nil, "https://example.org/?utm_source=x"},
+		{"tracking set", "https://example.org/page?id=3&utm_source=news&fbclid=abc&lang=en&gclid=1", []string{"tracking"}, "https://example.org/page?id=3&lang=en"},
+		{"named param", "https://example.org/?ref=home&id=3", []string{"ref"}, "https://example.org/?id=3"},
+		{"prefix", "https://example.org/?pk_campaign=a&pk_kwd=b&page=2", []string{"pk_*"}, "https://example.org/?page=2"},
+		{"fragment kept", "https://example.org/post?utm_medium=x#comments", []string{"tracking"}, "https://example.org/post#comments"},
+		{"everything stripped", "https://example.org/?utm_source=x", []string{"tracking"}, "https://example.org/"},
+		{"anchor", "#utm_source=x", []string{"tracking"}, "#utm_source=x"},
+		{"no query", "https://example.org/page", []string{"tracking"}, "https://example.org/page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripQueryParams(tt.href, tt.params); got != tt.want {
+				t.Errorf("stripQueryParams(%q, %q) = %q, want %q", tt.href, tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertStripsLinkParams(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{
+			name: "outbound link",
+			in:   `<p><a href="https://example.org/shop?item=7&utm_source=blog&utm_medium=post&fbclid=x">Shop</a></p>`,
+			opts: ConvertOptions{StripQueryParams: []string{"tracking"}},
+			want: "[Shop](https://example.org/shop?item=7)",
+		},
+		{
+			name: "internal link",
+			in:   `<p><a href="https://example.com/about/?utm_source=nav#team">About</a></p>`,
+			opts: ConvertOptions{StripQueryParams: []string{"tracking"}},
+			want: "[About](/about/#team)",
+		},
+		{
+			name: "off",
+			in:   `<p><a href="https://example.org/shop?utm_source=blog">Shop</a></p>`,
+			want: "[Shop](https://example.org/shop?utm_source=blog)",
+		},
+	})
+}
+
+func TestConvertQuotes(t *testing.T) {
+	const (
+		quote     = `<blockquote class="wp-block-quote"><p>First line</p><p>Second</p><cite>— Ada Lovelace</cite></blockquote>`
+		uncited   = `<blockquote class="wp-block-quote"><p>No author</p></blockquote>`
+		pullquote = `<figure class="wp-block-pullquote"><blockquote><p>Big words</p><cite>Grace</cite></blockquote></figure>`
+		escaped   = `<blockquote><p>Said</p><cite>O'Brien &amp; "Co"</cite></blockquote>`
+	)
+	components := ConvertOptions{QuoteComponent: "Quote", PullquoteComponent: "Pullquote"}
+	runConvertTests(t, []convertTest{
+		{name: "cite", in: quote, want: "> First line\n>\n> Second\n>\n> — Ada Lovelace"},
+		{name: "cite component", in: quote, opts: components, want: "<Quote cite=\"Ada Lovelace\">\n\nFirst line\n\nSecond\n\n</Quote>"},
+		{name: "no cite", in: uncited, want: "> No author"},
+		{name: "no cite component", in: uncited, opts: components, want: "<Quote>\n\nNo author\n\n</Quote>"},
+		{name: "pullquote", in: pullquote, want: "> Big words\n>\n> — Grace"},
+		{name: "pullquote component", in: pullquote, opts: components, want: "<Pullquote cite=\"Grace\">\n\nBig words\n\n</Pullquote>"},
+		{name: "pullquote without its component", in: pullquote, opts: ConvertOptions{QuoteComponent: "Quote"}, want: "> Big words\n>\n> — Grace"},
+		{name: "escaped cite", in: escaped, opts: components, want: "<Quote cite=\"O&#39;Brien &amp; &#34;Co&#34;\">\n\nSaid\n\n</Quote>"},
+	})
+}
+
+func TestConvertEntities(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{name: "curly apostrophe", in: "<p>Don&#8217;t</p>", want: "Don’t"},
+		{name: "ampersand", in: "<p>Salt &amp; Pepper</p>", want: "Salt & Pepper"},
+		{name: "apostrophe", in: "<p>It&#039;s</p>", want: "It's"},
+		// Literal angle brackets stay escaped so MDX doesn't read them as tags
+		{name: "angle brackets", in: "<p>Use &lt;div&gt;</p>", want: "Use &lt;div&gt;"},
+	})
+}
+
+func TestConvertButtons(t *testing.T) {
+	const (
+		single   = `<div class="wp-block-button"><a class="wp-block-button__link" href="https://example.com/signup/">Sign up</a></div>`
+		multiple = `<div class="wp-block-buttons">` +
+			`<div class="wp-block-button"><a class="wp-block-button__link" href="/docs">Docs</a></div>` +
+			`<div class="wp-block-button is-style-outline"><a class="wp-block-button__link" href="https://other.com/x?a=1&amp;b=2">Say "hi"</a></div>` +
+			`</div>`
+	)
+	component := ConvertOptions{ButtonComponent: "Button"}
+	runConvertTests(t, []convertTest{
+		{name: "single link", in: single, want: "[Sign up](/signup/)"},
+		{name: "single component", in: single, opts: component, want: `<Button href="/signup/">Sign up</Button>`},
+		{name: "multiple links", in: multiple, want: "[Docs](/docs)\n\n[Say \"hi\"](https://other.com/x?a=1&b=2)"},
+		{
+			name: "multiple components",
+			in:   multiple,
+			opts: component,
+			want: "<Button href=\"/docs\">Docs</Button>\n\n<Button href=\"https://other.com/x?a=1&b=2\">Say &#34;hi&#34;</Button>",
+		},
+	})
+}
+
+func TestMediaCollectorConcurrentAdds(t *testing.T) {
+	media := newMediaCollector(testBaseURL)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				// Relative and absolute forms of a URL are the same media
+				path := fmt.Sprintf("/wp-content/uploads/%d.jpg", i%10)
+				if i%2 == 0 {
+					media.add(path)
+				} else {
+					media.add(testBaseURL + path)
+				}
+				media.urls()
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := media.urls()
+	slices.Sort(got)
+	var want []string
+	for i := 0; i < 10; i++ {
+		want = append(want, fmt.Sprintf("%s/wp-content/uploads/%d.jpg", testBaseURL, i))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("urls() = %q, want %q", got, want)
+	}
+}
+
+// TestConvertHTMLToMarkdownConcurrent converts documents from many goroutines
+// at once, so that `go test -race` catches state shared between conversions
+func TestConvertHTMLToMarkdownConcurrent(t *testing.T) {
+	const conversions = 32
+	var wg sync.WaitGroup
+	for i := 0; i < conversions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			image := fmt.Sprintf("%s/wp-content/uploads/%d.jpg", testBaseURL, i)
+			file := fmt.Sprintf("%s/wp-content/uploads/%d.pdf", testBaseURL, i)
+			in := fmt.Sprintf(`<p><img src="%s" alt="%d"></p>`+
+				`<figure class="wp-block-image"><img src="%s"><figcaption>Again</figcaption></figure>`+
+				`<p><a href="%s">File</a></p>`, image, i, image, file)
+			_, media, err := ConvertHTMLToMarkdown(in, testBaseURL, ConvertOptions{})
+			if err != nil {
+				t.Errorf("ConvertHTMLToMarkdown() error = %v", err)
+				return
+			}
+			slices.Sort(media)
+			if want := []string{image, file}; !slices.Equal(media, want) {
+				t.Errorf("conversion %d found media %q, want %q", i, media, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConvertImageAttributes(t *testing.T) {
+	const (
+		titled  = `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A cat" title="Sleeping cat"></p>`
+		noAlt   = `<p><img src="https://example.com/wp-content/uploads/team-photo_2024.jpg" alt=""></p>`
+		figure  = `<figure class="wp-block-image"><img src="https://example.com/wp-content/uploads/my_pic.png" title="Say &quot;hi&quot;"><figcaption>Cap</figcaption></figure>`
+		withAlt = `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="Kept"></p>`
+	)
+	derive := ConvertOptions{DeriveAltFromFilename: true}
+	runConvertTests(t, []convertTest{
+		{name: "title", in: titled, want: `<img src="/wp-content/uploads/a.jpg" alt="A cat" title="Sleeping cat" />`},
+		{name: "empty alt", in: noAlt, want: `<img src="/wp-content/uploads/team-photo_2024.jpg" alt="" />`},
+		{name: "derived alt", in: noAlt, opts: derive, want: `<img src="/wp-content/uploads/team-photo_2024.jpg" alt="team photo 2024" />`},
+		{name: "alt kept", in: withAlt, opts: derive, want: `<img src="/wp-content/uploads/a.jpg" alt="Kept" />`},
+		{
+			name: "figure title and derived alt",
+			in:   figure,
+			opts: derive,
+			want: "<figure>\n  <img src=\"/wp-content/uploads/my_pic.png\" alt=\"my pic\" title=\"Say &#34;hi&#34;\" />\n  <figcaption>Cap</figcaption>\n</figure>",
+		},
+	})
+}
+
+func TestAltFromFilename(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"/wp-content/uploads/team-photo_2024.jpg", "team photo 2024"},
+		{"https://example.com/uploads/My%20Cat.PNG?ver=2", "My Cat"},
+		{"/wp-content/uploads/a--b__c.webp", "a b c"},
+		{"/wp-content/uploads/sunset-1024x768.jpg", "sunset"},
+		{"/wp-content/uploads/IMG_0042.jpg", "IMG 0042"},
+	}
+	for _, tt := range tests {
+		if got := altFromFilename(tt.src); got != tt.want {
+			t.Errorf("altFromFilename(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestConvertGalleryBlocks(t *testing.T) {
+	const (
+		one    = "https://example.com/wp-content/uploads/one.jpg"
+		two    = "https://example.com/wp-content/uploads/two.jpg"
+		nested = `<figure class="wp-block-gallery has-nested-images">` +
+			`<figure class="wp-block-image"><img src="` + one + `" alt="One"></figure>` +
+			`<figure class="wp-block-image"><img src="` + two + `" alt="Two"><figcaption>Second</figcaption></figure>` +
+			`</figure>`
+	)
+	runConvertTests(t, []convertTest{
+		{
+			name:      "html",
+			in:        nested,
+			want:      "<img src=\"/wp-content/uploads/one.jpg\" alt=\"One\" />\n\n<figure>\n  <img src=\"/wp-content/uploads/two.jpg\" alt=\"Two\" />\n  <figcaption>Second</figcaption>\n</figure>",
+			wantMedia: []string{one, two},
+		},
+		{
+			name:      "markdown",
+			in:        nested,
+			opts:      ConvertOptions{MarkdownImages: true},
+			want:      "![One](/wp-content/uploads/one.jpg)\n\n![Two](/wp-content/uploads/two.jpg)\n*Second*",
+			wantMedia: []string{one, two},
+		},
+		{
+			name: "other figure",
+			in:   `<figure class="wp-block-embed is-provider-vimeo"><div class="wp-block-embed__wrapper">https://vimeo.com/123</div></figure>`,
+			want: "https://vimeo.com/123",
+		},
+	})
+}
+
+func TestConvertMarkdownImages(t *testing.T) {
+	markdownImages := ConvertOptions{MarkdownImages: true}
+	runConvertTests(t, []convertTest{
+		{name: "simple", in: `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A cat"></p>`, opts: markdownImages, want: "![A cat](/wp-content/uploads/a.jpg)"},
+		{name: "no alt", in: `<p><img src="https://example.com/wp-content/uploads/a.jpg"></p>`, opts: markdownImages, want: "![](/wp-content/uploads/a.jpg)"},
+		{name: "title", in: `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A cat" title="Sleeping cat"></p>`, opts: markdownImages, want: `![A cat](/wp-content/uploads/a.jpg "Sleeping cat")`},
+		{
+			name: "escaped",
+			in:   `<p><img src="https://example.com/wp-content/uploads/a b.jpg" alt="x [y]"></p>`,
+			opts: markdownImages,
+			want: `![x \[y\]](</wp-content/uploads/a b.jpg>)`,
+		},
+		{
+			name: "captioned figure",
+			in:   `<figure class="wp-block-image"><img src="https://example.com/wp-content/uploads/b.jpg" alt="B"><figcaption>Cap <em>tion</em></figcaption></figure>`,
+			opts: markdownImages,
+			want: "![B](/wp-content/uploads/b.jpg)\n*Cap tion*",
+		},
+		{
+			name: "linked figure",
+			in:   `<figure class="wp-block-image"><a href="https://example.com/x/"><img src="https://example.com/wp-content/uploads/b.jpg" alt="B"></a></figure>`,
+			opts: markdownImages,
+			want: "[![B](/wp-content/uploads/b.jpg)](/x/)",
+		},
+		{name: "html", in: `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A cat"></p>`, want: `<img src="/wp-content/uploads/a.jpg" alt="A cat" />`},
+	})
+}
+
+func TestConvertContentMarkdownGallery(t *testing.T) {
+	c := NewConverter(Config{BaseURL: testBaseURL, ImageSyntax: "markdown"})
+	c.Attachments = &WXRExport{Attachments: map[int]string{
+		1: testBaseURL + "/wp-content/uploads/one.jpg",
+		2: testBaseURL + "/wp-content/uploads/two.jpg",
+	}}
+	got, media, err := c.ConvertContent(`<p>[gallery ids="1,2"]</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "![](/wp-content/uploads/one.jpg)\n\n![](/wp-content/uploads/two.jpg)"; strings.TrimSpace(got) != want {
+		t.Errorf("ConvertContent() = %q, want %q", got, want)
+	}
+	if want := []string{testBaseURL + "/wp-content/uploads/one.jpg", testBaseURL + "/wp-content/uploads/two.jpg"}; !reflect.DeepEqual(media, want) {
+		t.Errorf("media = %q, want %q", media, want)
+	}
+}
+
+func TestConvertImageBlockAlignment(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{
+			name:      "alignwide",
+			in:        `<figure class="wp-block-image size-large alignwide"><img src="https://example.com/wp-content/uploads/w-1024x683.jpg" alt="Wide"></figure>`,
+			want:      `<img src="/wp-content/uploads/w.jpg" alt="Wide" data-size="large" data-align="wide" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/w.jpg"},
+		},
+		{
+			name:      "aligncenter with caption",
+			in:        `<figure class="wp-block-image aligncenter size-medium"><img src="https://example.com/wp-content/uploads/c.jpg" alt="C"><figcaption>Centered</figcaption></figure>`,
+			want:      "<figure data-align=\"center\" data-size=\"medium\">\n  <img src=\"/wp-content/uploads/c.jpg\" alt=\"C\" />\n  <figcaption>Centered</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/c.jpg"},
+		},
+		{
+			// Older themes wrap aligned figures in a div
+			name:      "aligncenter in a div",
+			in:        `<div class="wp-block-image"><figure class="aligncenter size-large"><img src="https://example.com/wp-content/uploads/c.jpg" alt="C"></figure></div>`,
+			want:      `<img src="/wp-content/uploads/c.jpg" alt="C" data-align="center" data-size="large" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/c.jpg"},
+		},
+		{
+			name:      "linked alignfull",
+			in:        `<figure class="wp-block-image alignfull size-full"><a href="https://example.com/x/"><img src="https://example.com/wp-content/uploads/f.jpg" alt="F"></a></figure>`,
+			want:      `<a href="/x/"><img src="/wp-content/uploads/f.jpg" alt="F" data-align="full" data-size="full" /></a>`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/f.jpg"},
+		},
+		{
+			name:      "no classes",
+			in:        `<figure class="wp-block-image"><img src="https://example.com/wp-content/uploads/p.jpg" alt="P"></figure>`,
+			want:      `<img src="/wp-content/uploads/p.jpg" alt="P" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/p.jpg"},
+		},
+		{
+			// Markdown images have nowhere to put the attributes
+			name:      "markdown",
+			in:        `<figure class="wp-block-image size-large alignwide"><img src="https://example.com/wp-content/uploads/w.jpg" alt="Wide"></figure>`,
+			opts:      ConvertOptions{MarkdownImages: true},
+			want:      "![Wide](/wp-content/uploads/w.jpg)",
+			wantMedia: []string{"https://example.com/wp-content/uploads/w.jpg"},
+		},
+	})
+}
+
+func TestConvertClassicCaptions(t *testing.T) {
+	const centered = `<div id="attachment_12" class="wp-caption aligncenter" style="width: 310px">` +
+		`<img class="size-medium wp-image-12" src="https://example.com/wp-content/uploads/2019/04/cat-300x200.jpg" alt="Cat" width="300" height="200">` +
+		`<p class="wp-caption-text">A sleepy cat</p></div>`
+	runConvertTests(t, []convertTest{
+		{
+			name:      "aligncenter",
+			in:        centered,
+			want:      "<figure data-align=\"center\">\n  <img src=\"/wp-content/uploads/2019/04/cat.jpg\" alt=\"Cat\" />\n  <figcaption>A sleepy cat</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/2019/04/cat.jpg"},
+		},
+		{
+			name:      "markdown",
+			in:        centered,
+			opts:      ConvertOptions{MarkdownImages: true},
+			want:      "![Cat](/wp-content/uploads/2019/04/cat.jpg)\n*A sleepy cat*",
+			wantMedia: []string{"https://example.com/wp-content/uploads/2019/04/cat.jpg"},
+		},
+		{
+			name:      "alignright linked to the file",
+			in:        `<div class="wp-caption alignright"><a href="https://example.com/wp-content/uploads/dog.jpg"><img src="https://example.com/wp-content/uploads/dog-150x150.jpg" alt="Dog"></a><p class="wp-caption-text">Dog</p></div>`,
+			want:      "<figure data-align=\"right\">\n  <img src=\"/wp-content/uploads/dog.jpg\" alt=\"Dog\" />\n  <figcaption>Dog</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/dog.jpg"},
+		},
+		{
+			name:      "no caption text",
+			in:        `<div class="wp-caption alignnone"><img src="https://example.com/wp-content/uploads/x.jpg" alt=""></div>`,
+			want:      `<img src="/wp-content/uploads/x.jpg" alt="" data-align="none" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/x.jpg"},
+		},
+		{
+			name: "no image",
+			in:   `<div class="wp-caption"><p class="wp-caption-text">No image</p></div>`,
+			want: "No image",
+		},
+	})
+}
+
+func TestConvertImageSources(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{
+			name:      "absolute",
+			in:        `<p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A"></p>`,
+			want:      `<img src="/wp-content/uploads/a.jpg" alt="A" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+		{
+			name:      "root-relative",
+			in:        `<p><img src="/wp-content/uploads/a.jpg" alt="A"></p>`,
+			want:      `<img src="/wp-content/uploads/a.jpg" alt="A" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+		{
+			name:      "protocol-relative",
+			in:        `<p><img src="//example.com/wp-content/uploads/a.jpg" alt="A"></p>`,
+			want:      `<img src="/wp-content/uploads/a.jpg" alt="A" />`,
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+		{
+			name:      "figure with root-relative source",
+			in:        `<figure class="wp-block-image"><img src="/wp-content/uploads/b.png" alt="B"><figcaption>Bee</figcaption></figure>`,
+			want:      "<figure>\n  <img src=\"/wp-content/uploads/b.png\" alt=\"B\" />\n  <figcaption>Bee</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/b.png"},
+		},
+		{
+			name:      "same file referenced both ways",
+			in:        `<p><img src="/wp-content/uploads/a.jpg" alt="A"></p><p><img src="https://example.com/wp-content/uploads/a.jpg" alt="A"></p>`,
+			want:      "<img src=\"/wp-content/uploads/a.jpg\" alt=\"A\" />\n\n<img src=\"/wp-content/uploads/a.jpg\" alt=\"A\" />",
+			wantMedia: []string{"https://example.com/wp-content/uploads/a.jpg"},
+		},
+	})
+}
+
+func TestParseYouTubeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want youTubeVideo
+	}{
+		{"short link", "https://youtu.be/abc123", youTubeVideo{ID: "abc123"}},
+		{"watch", "https://www.youtube.com/watch?v=abc123&t=1m30s", youTubeVideo{ID: "abc123", Start: 90}},
+		{"mobile watch", "https://m.youtube.com/watch?v=abc123", youTubeVideo{ID: "abc123"}},
+		{"embed with start", "https://www.youtube.com/embed/abc123?start=30&rel=0", youTubeVideo{ID: "abc123", Start: 30}},
+		{"nocookie embed", "https://www.youtube-nocookie.com/embed/abc123", youTubeVideo{ID: "abc123"}},
+		{"shorts", "https://youtube.com/shorts/a_B-9?feature=share", youTubeVideo{ID: "a_B-9"}},
+		{"live", "https://www.youtube.com/live/abc123?t=2h", youTubeVideo{ID: "abc123", Start: 7200}},
+		{"playlist", "https://www.youtube.com/watch?v=abc123&list=PL1", youTubeVideo{ID: "abc123", Playlist: "PL1"}},
+		{"protocol-relative", "//www.youtube.com/embed/abc123", youTubeVideo{ID: "abc123"}},
+		{"no scheme", "youtu.be/abc123?t=45s", youTubeVideo{ID: "abc123", Start: 45}},
+		{"playlist embed", "https://www.youtube.com/embed/videoseries?list=PL1", youTubeVideo{}},
+		{"channel", "https://www.youtube.com/@someone", youTubeVideo{}},
+		{"other site", "https://vimeo.com/123", youTubeVideo{}},
+		{"invalid id", "https://youtu.be/abc%20123", youTubeVideo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseYouTubeURL(tt.url); got != tt.want {
+				t.Errorf("parseYouTubeURL(%q) = %+v, want %+v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertYouTubeIframes(t *testing.T) {
+	runConvertTests(t, []convertTest{
+		{
+			name: "embed",
+			in:   `<iframe src="https://www.youtube.com/embed/abc123"></iframe>`,
+			want: `<YouTube id="https://youtu.be/abc123" />`,
+		},
+		{
+			name: "nocookie",
+			in:   `<iframe src="https://www.youtube-nocookie.com/embed/abc123?rel=0"></iframe>`,
+			want: `<YouTube id="https://youtu.be/abc123" />`,
+		},
+		{
+			name: "shorts",
+			in:   `<iframe src="https://www.youtube.com/shorts/abc123"></iframe>`,
+			want: `<YouTube id="https://youtu.be/abc123" />`,
+		},
+		{
+			name: "start time and playlist",
+			in:   `<iframe src="https://www.youtube.com/embed/abc123?start=30&list=PL%201"></iframe>`,
+			want: `<YouTube id="https://youtu.be/abc123" params="start=30&list=PL+1" />`,
+		},
+		{
+			name: "other iframe",
+			in:   `<iframe src="https://maps.example.com/embed?q=x"></iframe>`,
+			want: `[View embedded content](https://maps.example.com/embed?q=x)`,
+		},
+	})
+}
+
+func TestConvertContentYouTubeParams(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "shortcode with time",
+			in:   `<p>[youtube]https://www.youtube.com/watch?v=abc123&t=90[/youtube]</p>`,
+			want: `<YouTube id="https://youtu.be/abc123" params="start=90" />`,
+		},
+		{
+			name: "timestamped link",
+			in:   `<p>https://youtu.be/abc123?t=1m5s</p>`,
+			want: `<YouTube id="https://youtu.be/abc123" params="start=65" />`,
+		},
+		{
+			name: "playlist link",
+			in:   `<p>https://www.youtube.com/watch?v=abc123&list=PLxyz Watch this</p>`,
+			want: `<YouTube id="https://youtu.be/abc123" params="list=PLxyz" /> Watch this`,
+		},
+		{
+			name: "embed block with caption",
+			in:   "<figure class=\"wp-block-embed is-provider-youtube\"><div class=\"wp-block-embed__wrapper\">\nhttps://www.youtube.com/watch?v=abc123&amp;start=30&amp;list=PLxyz\n</div><figcaption>Cap</figcaption></figure>",
+			want: "<YouTube id=\"abc123\" params=\"start=30&list=PLxyz\" />\n\nCap",
+		},
+		{
+			name: "embed block",
+			in:   "<figure class=\"wp-block-embed is-provider-youtube\"><div class=\"wp-block-embed__wrapper\">\nhttps://www.youtube.com/watch?v=abc123&amp;t=15\n</div></figure>",
+			want: `<YouTube id="https://youtu.be/abc123" params="start=15" />`,
+		},
+		{
+			name: "without params",
+			in:   `<p>https://youtu.be/abc123</p>`,
+			want: `<YouTube id="https://youtu.be/abc123" />`,
+		},
+	}
+	c := NewConverter(Config{BaseURL: testBaseURL})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := c.ConvertContent(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("ConvertContent() = %q, want it to contain %q", got, tt.want)
+			}
+			if !strings.HasPrefix(got, "import { YouTube } from 'astro-embed';") {
+				t.Errorf("ConvertContent() = %q doesn't import the component", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,595 @@
+package wptomdx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// colocatedMediaNames assigns each downloadable media URL a file name inside
+// its post's folder. URLs that aren't hosted under baseURL are left out.
+// Two different URLs sharing a base name get a numeric prefix to stay unique.
+func colocatedMediaNames(urls []string, baseURL string, hosts MediaHosts) map[string]string {
+	names := make(map[string]string)
+	taken := make(map[string]bool)
+
+	for _, u := range urls {
+		if _, ok := names[u]; ok || LocalMediaPath(u, baseURL, hosts) == "" {
+			continue
+		}
+
+		name := path.Base(LocalMediaPath(u, baseURL, hosts))
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%d-%s", n, path.Base(LocalMediaPath(u, baseURL, hosts)))
+		}
+		taken[name] = true
+		names[u] = name
+	}
+	return names
+}
+
+// rewriteMediaReferences points every quoted reference to a colocated media URL
+// (absolute, or relative to baseURL with or without a leading slash) at "./name"
+func rewriteMediaReferences(markdown string, names map[string]string, baseURL string, hosts MediaHosts) string {
+	for u, name := range names {
+		relative := strings.TrimPrefix(LocalMediaPath(u, baseURL, hosts), "/")
+		replacer := strings.NewReplacer(
+			`"`+u+`"`, `"./`+name+`"`,
+			`"/`+relative+`"`, `"./`+name+`"`,
+			`"`+relative+`"`, `"./`+name+`"`,
+		)
+		markdown = replacer.Replace(markdown)
+	}
+	return markdown
+}
+
+// resolveMediaRedirects follows redirects for every media URL hosted under
+// baseURL with resolve and returns the final location of each one that moved
+func resolveMediaRedirects(urls []string, baseURL string, hosts MediaHosts, resolve func(src string) string) map[string]string {
+	moved := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		if seen[u] || LocalMediaPath(u, baseURL, hosts) == "" {
+			continue
+		}
+		seen[u] = true
+		if final := resolve(u); final != u {
+			moved[u] = final
+		}
+	}
+	return moved
+}
+
+// ResolveMediaURL returns the URL src ends up at after following redirects, or
+// src itself when it can't be fetched
+func (d Downloader) ResolveMediaURL(src string) string {
+	req, err := http.NewRequest(http.MethodHead, src, nil)
+	if err != nil {
+		return src
+	}
+	resp, err := d.send(req)
+	if err != nil {
+		return src
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return src
+	}
+	return resp.Request.URL.String()
+}
+
+// rewriteRedirectedMedia points every quoted reference to a moved media URL
+// (absolute, or relative to baseURL with or without a leading slash) at its
+// final location
+func rewriteRedirectedMedia(markdown string, moved map[string]string, baseURL string, hosts MediaHosts) string {
+	for old, final := range moved {
+		relative := strings.TrimPrefix(LocalMediaPath(old, baseURL, hosts), "/")
+		target := final
+		if localPath := LocalMediaPath(final, baseURL, hosts); localPath != "" {
+			target = localPath
+		}
+		replacer := strings.NewReplacer(
+			`"`+old+`"`, `"`+final+`"`,
+			`"/`+relative+`"`, `"`+target+`"`,
+			`"`+relative+`"`, `"`+strings.TrimPrefix(target, "/")+`"`,
+		)
+		markdown = replacer.Replace(markdown)
+	}
+	return markdown
+}
+
+// Downloader fetches media files to disk
+type Downloader struct {
+	// StrictContentType rejects HTML pages and responses whose Content-Type
+	// doesn't match the media type expected from the file extension
+	StrictContentType bool
+	// Client sends the requests; nil uses http.DefaultClient
+	Client *http.Client
+	// Header is sent with every request, e.g. a User-Agent the site accepts
+	Header http.Header
+	// Metrics, when set, counts the bytes downloaded
+	Metrics *Metrics
+	// Bandwidth, when set, throttles the downloads sharing it
+	Bandwidth *BandwidthLimiter
+}
+
+// send sends req, with the downloader's headers added, through its client
+func (d Downloader) send(req *http.Request) (*http.Response, error) {
+	for name, values := range d.Header {
+		req.Header[name] = values
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// NewDownloader returns a Downloader for the media settings of cfg. Requests
+// go through cfg.MediaProxy when set, or the HTTP_PROXY/HTTPS_PROXY proxy.
+func NewDownloader(cfg Config) (Downloader, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.MediaProxy != "" {
+		proxyURL, err := url.Parse(cfg.MediaProxy)
+		if err != nil {
+			return Downloader{}, fmt.Errorf("invalid media proxy %q: %v", cfg.MediaProxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	header := cfg.MediaHeaders.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if cfg.MediaUserAgent != "" {
+		header.Set("User-Agent", cfg.MediaUserAgent)
+	}
+	return Downloader{
+		StrictContentType: cfg.StrictMediaContentType,
+		Client:            &http.Client{Transport: transport},
+		Header:            header,
+		Bandwidth:         NewBandwidthLimiter(cfg.DownloadBandwidthLimit),
+	}, nil
+}
+
+// ParseHeaders parses "Name: value|Other: value" into request headers
+func ParseHeaders(raw string) http.Header {
+	header := make(http.Header)
+	for _, line := range strings.Split(raw, "|") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if name != "" {
+			header.Add(name, value)
+		}
+	}
+	return header
+}
+
+// StreamMedia collects the manifest entries sent on entryCh and downloads
+// their media with workers concurrent calls to download while more entries
+// are still arriving. Each target is downloaded once, numbered in the order it
+// was first seen; download reports whether it succeeded. It returns once
+// entryCh is closed and every download has finished.
+func StreamMedia(entryCh <-chan []ManifestEntry, workers int, download func(i int, target MediaTarget) bool) ([]ManifestEntry, map[MediaTarget]bool) {
+	type job struct {
+		i      int
+		target MediaTarget
+	}
+	jobs := make(chan job)
+
+	var mu sync.Mutex
+	downloaded := make(map[MediaTarget]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if download(j.i, j.target) {
+					mu.Lock()
+					downloaded[j.target] = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var entries []ManifestEntry
+	seen := make(map[MediaTarget]bool)
+	for items := range entryCh {
+		entries = append(entries, items...)
+		for _, item := range items {
+			for _, media := range item.Media {
+				target := media.Target()
+				if seen[target] {
+					continue
+				}
+				seen[target] = true
+				jobs <- job{i: len(seen) - 1, target: target}
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return entries, downloaded
+}
+
+// MediaFailure is a media file that couldn't be downloaded
+type MediaFailure struct {
+	URL string
+	Err error
+}
+
+// MediaFailureReport lists failed media by URL under a heading such as
+// "Failed media (N)"
+func MediaFailureReport(heading string, failures []MediaFailure) string {
+	sorted := append([]MediaFailure(nil), failures...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].URL < sorted[j].URL })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%d)\n", heading, len(sorted))
+	for _, f := range sorted {
+		fmt.Fprintf(&b, "- %s: %v\n", f.URL, f.Err)
+	}
+	return b.String()
+}
+
+// VerifyMedia re-hashes the downloaded media of entries that has a recorded
+// checksum and returns the files that are missing or no longer match
+func VerifyMedia(entries []ManifestEntry, baseURL string, mediaDir string) []MediaFailure {
+	var failures []MediaFailure
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		for _, media := range entry.Media {
+			if media.SHA256 == "" {
+				continue
+			}
+			path := media.OutputPath(baseURL, mediaDir)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			sum, err := fileSHA256(path)
+			if err != nil {
+				failures = append(failures, MediaFailure{URL: media.URL, Err: err})
+			} else if sum != media.SHA256 {
+				failures = append(failures, MediaFailure{URL: media.URL, Err: fmt.Errorf("%s has checksum %s, expected %s", path, sum, media.SHA256)})
+			}
+		}
+	}
+	return failures
+}
+
+// fileSHA256 returns the hex SHA-256 of a file's content
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// DownloadImage downloads src into outputDir, mirroring its URL path, and
+// returns the SHA-256 of the saved file
+func (d Downloader) DownloadImage(src string, baseURL string, outputDir string) (string, error) {
+	// Derive the path from the URL so that other hosts and protocol-relative
+	// URLs land in the same tree
+	path, err := MediaFilePath(src, baseURL)
+	if err != nil {
+		return "", mediaDownloadError(src, err)
+	}
+
+	// Create the full output path
+	outputPath := filepath.Join(outputDir, path)
+
+	return d.DownloadFile(AbsoluteMediaURL(src, baseURL), outputPath)
+}
+
+// DownloadFile downloads src, saves it at outputPath and returns the hex
+// SHA-256 of its content. The download is written to outputPath.part first;
+// when an earlier attempt left one behind, only the rest of the file is
+// requested, provided the server supports range requests. Its errors are
+// MediaDownloadErrors.
+func (d Downloader) DownloadFile(src string, outputPath string) (string, error) {
+	checksum, err := d.download(src, outputPath)
+	if err != nil {
+		return "", mediaDownloadError(src, err)
+	}
+	return checksum, nil
+}
+
+// download is DownloadFile without its error type
+func (d Downloader) download(src string, outputPath string) (string, error) {
+	// Create directories
+	dir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	var offset int64
+	if info, err := os.Stat(outputPath + ".part"); err == nil && info.Mode().IsRegular() {
+		offset = info.Size()
+	}
+
+	checksum, err := d.downloadFrom(src, outputPath, offset)
+	if errors.Is(err, errStalePartial) {
+		// Start over once, without asking for a range
+		checksum, err = d.downloadFrom(src, outputPath, 0)
+	}
+	return checksum, err
+}
+
+// errStalePartial reports that the partial file of a download doesn't fit the
+// file on the server anymore
+var errStalePartial = errors.New("stale partial file")
+
+// downloadFrom downloads src into outputPath, keeping the first offset bytes
+// of its partial file
+func (d Downloader) downloadFrom(src string, outputPath string, offset int64) (string, error) {
+	partPath := outputPath + ".part"
+
+	// Download the file
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", src, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.send(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", src, err)
+	}
+	defer resp.Body.Close()
+
+	// Check status code. A server without range support answers with the
+	// whole file, which replaces the partial one; some answer with the whole
+	// file as a part starting at 0.
+	resumed := false
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp.Header.Get("Content-Range")) == offset:
+		resumed = offset > 0
+	case offset > 0 && (resp.StatusCode == http.StatusRequestedRangeNotSatisfiable || resp.StatusCode == http.StatusPartialContent):
+		// The partial file doesn't fit the file on the server anymore, or
+		// the server sent another part than the one asked for
+		resp.Body.Close()
+		if err := os.Remove(partPath); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %v", partPath, err)
+		}
+		return "", errStalePartial
+	case resp.StatusCode != http.StatusOK:
+		return "", &MediaDownloadError{URL: src, StatusCode: resp.StatusCode, Err: fmt.Errorf("bad status: %s", resp.Status)}
+	}
+
+	// Some sites answer missing media with a 200 error page
+	if d.StrictContentType {
+		if err := checkMediaContentType(src, resp.Header.Get("Content-Type")); err != nil {
+			return "", err
+		}
+	}
+
+	// Open the partial file, hashing what it already holds when resuming
+	hash := sha256.New()
+	var out *os.File
+	if resumed {
+		out, err = os.OpenFile(partPath, os.O_RDWR, 0644)
+		if err == nil {
+			_, err = io.Copy(hash, io.LimitReader(out, offset))
+		}
+	} else {
+		out, err = os.Create(partPath)
+	}
+	if err != nil {
+		if out != nil {
+			out.Close()
+		}
+		return "", fmt.Errorf("failed to create file %s: %v", partPath, err)
+	}
+	defer out.Close()
+
+	// Write the file, hashing it on the way
+	written, err := io.Copy(io.MultiWriter(out, hash), d.Bandwidth.Reader(resp.Body))
+	if d.Metrics != nil {
+		d.Metrics.Update(func(run *RunMetrics) { run.BytesDownloaded += written })
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write file %s: %v", partPath, err)
+	}
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("failed to write file %s: %v", partPath, err)
+	}
+	if err := os.Rename(partPath, outputPath); err != nil {
+		return "", fmt.Errorf("failed to move %s into place: %v", partPath, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// contentRangeStart returns the first byte position of a "bytes N-M/size"
+// Content-Range header, or -1 when there is none
+func contentRangeStart(header string) int64 {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !ok {
+		return -1
+	}
+	first, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// checkMediaContentType rejects HTML pages, and image, audio or video URLs
+// served with a content type of a different kind
+func checkMediaContentType(src string, contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("unexpected content type %q for %s", contentType, src)
+	}
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return fmt.Errorf("got an HTML page instead of media for %s", src)
+	}
+
+	ext := path.Ext(src)
+	if u, err := url.Parse(src); err == nil {
+		ext = path.Ext(u.Path)
+	}
+	expected, _, _ := strings.Cut(mime.TypeByExtension(ext), "/")
+	switch expected {
+	case "image", "audio", "video":
+		if !strings.HasPrefix(mediaType, expected+"/") {
+			return fmt.Errorf("content type %s doesn't match the %s file %s", mediaType, expected, src)
+		}
+	}
+	return nil
+}
+
+// mediaExtensions are the preferred file extensions of common media types,
+// where mime.ExtensionsByType would list several
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/avif":      ".avif",
+	"image/svg+xml":   ".svg",
+	"image/x-icon":    ".ico",
+	"audio/mpeg":      ".mp3",
+	"video/mp4":       ".mp4",
+	"application/pdf": ".pdf",
+}
+
+// fixMediaExtensions gives every media entry under baseURL whose extension is
+// missing or doesn't match the type the server sends a file name with the
+// right one, saving it through LocalPath. It returns the new reference (site
+// path, or "./name" when colocated) of each fixed URL by URL.
+func (d Downloader) fixMediaExtensions(media []MediaEntry, baseURL string, hosts MediaHosts, mediaDir string) map[string]string {
+	fixed := make(map[string]string)
+	for i := range media {
+		u := media[i].URL
+		if LocalMediaPath(u, baseURL, hosts) == "" {
+			continue
+		}
+		ext, ok := mediaExtension(d.probeMediaType(AbsoluteMediaURL(u, baseURL)))
+		if !ok {
+			continue
+		}
+
+		if media[i].LocalPath != "" {
+			name := filepath.Base(media[i].LocalPath)
+			if hasMediaExtension(name, ext) {
+				continue
+			}
+			newName := strings.TrimSuffix(name, path.Ext(name)) + ext
+			media[i].LocalPath = filepath.Join(filepath.Dir(media[i].LocalPath), newName)
+			fixed[u] = "./" + newName
+			continue
+		}
+
+		p, err := MediaFilePath(u, baseURL)
+		if err != nil || hasMediaExtension(p, ext) {
+			continue
+		}
+		media[i].LocalPath = filepath.Join(mediaDir, strings.TrimSuffix(p, path.Ext(p))+ext)
+		ref := LocalMediaPath(u, baseURL, hosts)
+		fixed[u] = strings.TrimSuffix(ref, path.Ext(ref)) + ext
+	}
+	return fixed
+}
+
+// rewriteFixedExtensions points the quoted and parenthesized references to
+// media whose extension was fixed at the renamed file. old gives the current
+// reference of every fixed URL.
+func rewriteFixedExtensions(markdown string, fixed map[string]string, old func(u string) string) string {
+	for u, ref := range fixed {
+		before := old(u)
+		markdown = strings.NewReplacer(
+			`"`+before+`"`, `"`+ref+`"`,
+			"("+before+")", "("+ref+")",
+			"("+before+" ", "("+ref+" ",
+		).Replace(markdown)
+	}
+	return markdown
+}
+
+// hasMediaExtension reports whether name's extension already stands for the
+// same media type as ext, so e.g. ".jpeg" is kept for image/jpeg
+func hasMediaExtension(name string, ext string) bool {
+	current := path.Ext(name)
+	return current != "" && mime.TypeByExtension(current) == mime.TypeByExtension(ext)
+}
+
+// mediaExtension returns the file extension for a media type, and false for
+// types that say nothing about the file such as HTML error pages
+func mediaExtension(mediaType string) (string, bool) {
+	if ext, ok := mediaExtensions[mediaType]; ok {
+		return ext, true
+	}
+	switch mediaType {
+	case "", "application/octet-stream", "text/html", "text/plain":
+		return "", false
+	}
+	exts, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(exts) == 0 {
+		return "", false
+	}
+	return exts[0], true
+}
+
+// probeMediaType asks the server for the media type of src, sniffing the
+// first bytes when the response doesn't declare a useful one
+func (d Downloader) probeMediaType(src string) string {
+	headReq, err := http.NewRequest(http.MethodHead, src, nil)
+	if err != nil {
+		return ""
+	}
+	if resp, err := d.send(headReq); err == nil {
+		resp.Body.Close()
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if resp.StatusCode < 400 && mediaType != "" && mediaType != "application/octet-stream" {
+			return mediaType
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Range", "bytes=0-511")
+	resp, err := d.send(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return ""
+	}
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return mediaType
+}
@@ -0,0 +1,874 @@
+package wptomdx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jpegBytes is the start of a JPEG file, enough for content sniffing
+var jpegBytes = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+// mediaServer serves jpegBytes for every path in files and redirects with a
+// 301 every path in redirects, counting the requests per method and path
+type mediaServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newMediaServer(t *testing.T, files []string, redirects map[string]string) *mediaServer {
+	t.Helper()
+	s := &mediaServer{requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.Method+" "+r.URL.Path]++
+		s.mu.Unlock()
+
+		if target, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		for _, file := range files {
+			if r.URL.Path == file {
+				w.Header().Set("Content-Type", "image/jpeg")
+				w.Write(jpegBytes)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// count returns how many requests were made with method for path
+func (s *mediaServer) count(method string, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" "+path]
+}
+
+func TestMediaRedirects(t *testing.T) {
+	const oldPath = "/wp-content/uploads/old.jpg"
+	const newPath = "/wp-content/uploads/2024/05/new.jpg"
+	server := newMediaServer(t, []string{newPath}, map[string]string{oldPath: newPath})
+
+	tests := []struct {
+		name     string
+		follow   bool
+		wantPath string
+	}{
+		{"followed", true, newPath},
+		{"not followed", false, oldPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.BaseURL = server.URL
+				cfg.FollowMediaRedirects = tt.follow
+			})
+			posts := []Post{
+				testPost(1, "absolute", `<p><img src="`+server.URL+oldPath+`" alt="Old"></p>`),
+				testPost(2, "relative", `<p><img src="`+oldPath+`" alt="Old"></p>`),
+			}
+			heads := server.count(http.MethodHead, oldPath)
+			entries := c.ProcessContent(posts, false)
+			if len(entries) != 2 {
+				t.Fatalf("ProcessContent() returned %d entries, want 2", len(entries))
+			}
+			wantLookups := 0
+			if tt.follow {
+				wantLookups = 1
+			}
+			if got := server.count(http.MethodHead, oldPath) - heads; got != wantLookups {
+				t.Errorf("looked up %s %d times, want %d", oldPath, got, wantLookups)
+			}
+
+			for _, entry := range entries {
+				data, err := os.ReadFile(entry.MDXPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := `src="` + tt.wantPath + `"`; !strings.Contains(string(data), want) {
+					t.Errorf("%s does not reference %s:\n%s", entry.MDXPath, want, data)
+				}
+				if len(entry.Media) != 1 || !strings.HasSuffix(entry.Media[0].URL, tt.wantPath) {
+					t.Fatalf("media of %d = %+v, want %s", entry.ID, entry.Media, tt.wantPath)
+				}
+			}
+
+			if !tt.follow {
+				return
+			}
+			media := entries[0].Media[0]
+			if _, err := c.Downloader.DownloadImage(media.URL, c.Config.BaseURL, c.Config.MediaOutputDir); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(media.OutputPath(c.Config.BaseURL, c.Config.MediaOutputDir)); err != nil {
+				t.Errorf("redirected media not saved at its final path: %v", err)
+			}
+		})
+	}
+}
+
+func TestResolveMediaURL(t *testing.T) {
+	server := newMediaServer(t, []string{"/new.jpg"}, map[string]string{"/old.jpg": "/new.jpg", "/gone.jpg": "/missing.jpg"})
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/new.jpg", server.URL + "/new.jpg"},
+		{"/old.jpg", server.URL + "/new.jpg"},
+		{"/gone.jpg", server.URL + "/gone.jpg"},
+		{"/missing.jpg", server.URL + "/missing.jpg"},
+	}
+	for _, tt := range tests {
+		if got := (Downloader{}).ResolveMediaURL(server.URL + tt.path); got != tt.want {
+			t.Errorf("ResolveMediaURL(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMediaContentType(t *testing.T) {
+	tests := []struct {
+		src         string
+		contentType string
+		wantErr     bool
+	}{
+		{"https://example.com/a.jpg", "image/jpeg", false},
+		{"https://example.com/a.jpg", "image/png", false},
+		{"https://example.com/a.jpg?ver=2", "image/webp; charset=binary", false},
+		{"https://example.com/a.jpg", "text/html; charset=UTF-8", true},
+		{"https://example.com/a.pdf", "application/xhtml+xml", true},
+		{"https://example.com/a.mp3", "video/mp4", true},
+		{"https://example.com/a.mp4", "video/mp4", false},
+		{"https://example.com/a.pdf", "application/pdf", false},
+		{"https://example.com/download", "application/octet-stream", false},
+		{"https://example.com/a.jpg", "", true},
+	}
+	for _, tt := range tests {
+		if err := checkMediaContentType(tt.src, tt.contentType); (err != nil) != tt.wantErr {
+			t.Errorf("checkMediaContentType(%q, %q) error = %v, wantErr %v", tt.src, tt.contentType, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDownloadFileContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.Write([]byte("<html><body>Not found</body></html>"))
+	}))
+	defer server.Close()
+
+	for _, strict := range []bool{false, true} {
+		output := filepath.Join(t.TempDir(), "image.jpg")
+		_, err := Downloader{StrictContentType: strict}.DownloadFile(server.URL+"/image.jpg", output)
+		if (err != nil) != strict {
+			t.Fatalf("DownloadFile() with strict %v error = %v", strict, err)
+		}
+		_, statErr := os.Stat(output)
+		if saved := statErr == nil; saved == strict {
+			t.Errorf("with strict %v, HTML page saved = %v", strict, saved)
+		}
+		if strict {
+			if !errors.Is(err, ErrMediaDownload) || !strings.Contains(err.Error(), "HTML page") {
+				t.Errorf("error = %v, want a media download error about the HTML page", err)
+			}
+			if _, err := os.Stat(output + ".part"); err == nil {
+				t.Error("rejected download left a partial file")
+			}
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want http.Header
+	}{
+		{"", http.Header{}},
+		{"Referer: https://example.com/", http.Header{"Referer": {"https://example.com/"}}},
+		{"X-Token: a:b | cookie: cf=1", http.Header{"X-Token": {"a:b"}, "Cookie": {"cf=1"}}},
+		{"X-A: 1|X-A: 2", http.Header{"X-A": {"1", "2"}}},
+		{"no colon|: empty name|X-Empty:", http.Header{"X-Empty": {""}}},
+	}
+	for _, tt := range tests {
+		if got := ParseHeaders(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseHeaders(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestDownloaderHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpegBytes)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want map[string]string
+	}{
+		{"default", Config{}, map[string]string{"User-Agent": "Go-http-client/1.1"}},
+		{"user agent", Config{MediaUserAgent: "Mozilla/5.0 (wptomd)"}, map[string]string{"User-Agent": "Mozilla/5.0 (wptomd)"}},
+		{
+			name: "headers",
+			cfg:  Config{MediaUserAgent: "Mozilla/5.0 (wptomd)", MediaHeaders: ParseHeaders("Referer: https://example.com/|User-Agent: ignored")},
+			want: map[string]string{"User-Agent": "Mozilla/5.0 (wptomd)", "Referer": "https://example.com/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDownloader(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.DownloadImage(server.URL+"/wp-content/uploads/a.jpg", server.URL, t.TempDir()); err != nil {
+				t.Fatalf("DownloadImage() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for name, want := range tt.want {
+				if value := got.Get(name); value != want {
+					t.Errorf("%s = %q, want %q", name, value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloaderProxy(t *testing.T) {
+	// The proxy answers every request itself, recording the URLs asked for
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpegBytes)
+	}))
+	defer proxy.Close()
+
+	d, err := NewDownloader(Config{MediaProxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const src = "http://media.invalid/wp-content/uploads/a.jpg"
+	if _, err := d.DownloadFile(src, filepath.Join(t.TempDir(), "a.jpg")); err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(proxied, []string{src}) {
+		t.Errorf("proxied %q, want %q", proxied, []string{src})
+	}
+
+	if _, err := NewDownloader(Config{MediaProxy: "://proxy"}); err == nil {
+		t.Error("NewDownloader() with an invalid proxy succeeded")
+	}
+}
+
+func TestStreamMediaStartsBeforeProcessingEnds(t *testing.T) {
+	entryCh := make(chan []ManifestEntry)
+	started := make(chan MediaTarget, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StreamMedia(entryCh, 2, func(i int, target MediaTarget) bool {
+			started <- target
+			return true
+		})
+	}()
+
+	// A post is processed while later ones are still being converted, so its
+	// media must download before entryCh is closed
+	first := MediaEntry{URL: "https://example.com/a.jpg"}
+	entryCh <- []ManifestEntry{{ID: 1, Media: []MediaEntry{first}}}
+	select {
+	case target := <-started:
+		if target != first.Target() {
+			t.Errorf("started %v, want %v", target, first.Target())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no download started while processing was still running")
+	}
+	close(entryCh)
+	<-done
+}
+
+func TestStreamMedia(t *testing.T) {
+	a := MediaEntry{URL: "https://example.com/a.jpg"}
+	b := MediaEntry{URL: "https://example.com/b.jpg"}
+	colocated := MediaEntry{URL: a.URL, LocalPath: "posts/one/a.jpg"}
+	tests := []struct {
+		name           string
+		batches        [][]ManifestEntry
+		fail           map[string]bool
+		wantEntries    int
+		wantDownloads  int
+		wantDownloaded map[MediaTarget]bool
+	}{
+		{
+			name:           "shared across posts",
+			batches:        [][]ManifestEntry{{{ID: 1, Media: []MediaEntry{a, b}}}, {{ID: 2, Media: []MediaEntry{b, a}}}},
+			wantEntries:    2,
+			wantDownloads:  2,
+			wantDownloaded: map[MediaTarget]bool{a.Target(): true, b.Target(): true},
+		},
+		{
+			name:           "repeated in a post",
+			batches:        [][]ManifestEntry{{{ID: 1, Media: []MediaEntry{a, a}}, {ID: 2}}},
+			wantEntries:    2,
+			wantDownloads:  1,
+			wantDownloaded: map[MediaTarget]bool{a.Target(): true},
+		},
+		{
+			name:           "colocated copy",
+			batches:        [][]ManifestEntry{{{ID: 1, Media: []MediaEntry{a}}}, {{ID: 2, Media: []MediaEntry{colocated}}}},
+			wantEntries:    2,
+			wantDownloads:  2,
+			wantDownloaded: map[MediaTarget]bool{a.Target(): true, colocated.Target(): true},
+		},
+		{
+			name:           "failed",
+			batches:        [][]ManifestEntry{{{ID: 1, Media: []MediaEntry{a, b}}}, {{ID: 2, Media: []MediaEntry{b}}}},
+			fail:           map[string]bool{b.URL: true},
+			wantEntries:    2,
+			wantDownloads:  2,
+			wantDownloaded: map[MediaTarget]bool{a.Target(): true},
+		},
+		{
+			name:           "no media",
+			wantDownloaded: map[MediaTarget]bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entryCh := make(chan []ManifestEntry, len(tt.batches))
+			for _, batch := range tt.batches {
+				entryCh <- batch
+			}
+			close(entryCh)
+
+			var mu sync.Mutex
+			var indexes []int
+			entries, downloaded := StreamMedia(entryCh, 3, func(i int, target MediaTarget) bool {
+				mu.Lock()
+				indexes = append(indexes, i)
+				mu.Unlock()
+				return !tt.fail[target.URL]
+			})
+			if len(entries) != tt.wantEntries {
+				t.Errorf("got %d entries, want %d", len(entries), tt.wantEntries)
+			}
+			slices.Sort(indexes)
+			wantIndexes := make([]int, tt.wantDownloads)
+			for i := range wantIndexes {
+				wantIndexes[i] = i
+			}
+			if !slices.Equal(indexes, wantIndexes) {
+				t.Errorf("downloads numbered %v, want %v", indexes, wantIndexes)
+			}
+			if !reflect.DeepEqual(downloaded, tt.wantDownloaded) {
+				t.Errorf("downloaded = %v, want %v", downloaded, tt.wantDownloaded)
+			}
+		})
+	}
+}
+
+func TestMediaFailureReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []MediaFailure
+		want     string
+	}{
+		{"none", nil, "Failed media (0)\n"},
+		{
+			name: "sorted by URL",
+			failures: []MediaFailure{
+				{URL: "https://example.com/b.jpg", Err: errors.New("bad status: 403 Forbidden")},
+				{URL: "https://example.com/a.jpg", Err: errors.New("timeout")},
+			},
+			want: "Failed media (2)\n- https://example.com/a.jpg: timeout\n- https://example.com/b.jpg: bad status: 403 Forbidden\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MediaFailureReport("Failed media", tt.failures); got != tt.want {
+				t.Errorf("MediaFailureReport() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaFailureReportDownloads(t *testing.T) {
+	server := newMediaServer(t, []string{"/ok.jpg"}, nil)
+	dir := t.TempDir()
+	var failures []MediaFailure
+	for _, path := range []string{"/ok.jpg", "/missing.jpg"} {
+		if _, err := (Downloader{}).DownloadFile(server.URL+path, filepath.Join(dir, path)); err != nil {
+			failures = append(failures, MediaFailure{URL: server.URL + path, Err: err})
+		}
+	}
+	want := "Failed media (1)\n- " + server.URL + "/missing.jpg: bad status: 404 Not Found\n"
+	if got := MediaFailureReport("Failed media", failures); got != want {
+		t.Errorf("MediaFailureReport() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestVerifyMedia(t *testing.T) {
+	const path = "/wp-content/uploads/2024/03/a.jpg"
+	server := newMediaServer(t, []string{path}, nil)
+	tests := []struct {
+		name    string
+		tamper  func(file string) error
+		want    string
+		skipSum bool
+	}{
+		{name: "intact"},
+		{name: "modified", tamper: func(file string) error { return os.WriteFile(file, []byte("corrupt"), 0644) }, want: "has checksum"},
+		{name: "truncated", tamper: func(file string) error { return os.Truncate(file, 3) }, want: "has checksum"},
+		{name: "missing", tamper: os.Remove, want: "failed to open"},
+		{name: "no checksum", tamper: os.Remove, skipSum: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaDir := t.TempDir()
+			src := server.URL + path
+			sum, err := (Downloader{}).DownloadImage(src, server.URL, mediaDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := sha256.Sum256(jpegBytes)
+			if want := hex.EncodeToString(hash[:]); sum != want {
+				t.Fatalf("DownloadImage() checksum = %s, want %s", sum, want)
+			}
+			if tt.skipSum {
+				sum = ""
+			}
+			media := MediaEntry{URL: src, Downloaded: true, SHA256: sum}
+			entries := []ManifestEntry{{ID: 1, Media: []MediaEntry{media}}, {ID: 2, Media: []MediaEntry{media}}}
+
+			if tt.tamper != nil {
+				if err := tt.tamper(media.OutputPath(server.URL, mediaDir)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			failures := VerifyMedia(entries, server.URL, mediaDir)
+			if tt.want == "" {
+				if len(failures) != 0 {
+					t.Errorf("VerifyMedia() = %v, want no failures", failures)
+				}
+				return
+			}
+			// Media shared by posts is reported once
+			if len(failures) != 1 || failures[0].URL != src || !strings.Contains(failures[0].Err.Error(), tt.want) {
+				t.Errorf("VerifyMedia() = %v, want one failure for %s containing %q", failures, src, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadImageOtherHosts(t *testing.T) {
+	const path = "/wp-content/uploads/2024/03/a.jpg"
+	server := newMediaServer(t, []string{path}, nil)
+	host := strings.TrimPrefix(server.URL, "http://")
+	tests := []struct {
+		name    string
+		src     string
+		baseURL string
+	}{
+		{"same host", server.URL + path, server.URL},
+		{"relative", path, server.URL + "/"},
+		{"protocol-relative", "//" + host + path, "http://example.com"},
+		{"cross-host", server.URL + path + "?ver=2", "https://example.com/blog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaDir := t.TempDir()
+			if _, err := (Downloader{}).DownloadImage(tt.src, tt.baseURL, mediaDir); err != nil {
+				t.Fatalf("DownloadImage() error = %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(mediaDir, path))
+			if err != nil || string(data) != string(jpegBytes) {
+				t.Errorf("%s not saved at %s: %v", tt.src, path, err)
+			}
+		})
+	}
+}
+
+func TestProcessContentFixMediaExtensions(t *testing.T) {
+	pngBytes := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wp-content/uploads/chart":
+			// No Content-Type, so the type is sniffed from the bytes
+			w.Write(pngBytes)
+		case "/wp-content/uploads/photo.gif":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(pngBytes)
+		case "/wp-content/uploads/pic.jpeg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(jpegBytes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name     string
+		fix      bool
+		colocate bool
+		// want maps each upload to the name it is saved under and referenced by
+		want map[string]string
+	}{
+		{
+			name: "off",
+			want: map[string]string{"chart": "/wp-content/uploads/chart", "photo.gif": "/wp-content/uploads/photo.gif", "pic.jpeg": "/wp-content/uploads/pic.jpeg"},
+		},
+		{
+			name: "fixed",
+			fix:  true,
+			want: map[string]string{"chart": "/wp-content/uploads/chart.png", "photo.gif": "/wp-content/uploads/photo.png", "pic.jpeg": "/wp-content/uploads/pic.jpeg"},
+		},
+		{
+			name:     "fixed colocated",
+			fix:      true,
+			colocate: true,
+			want:     map[string]string{"chart": "./chart.png", "photo.gif": "./photo.png", "pic.jpeg": "./pic.jpeg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.BaseURL = server.URL
+				cfg.FixMediaExtensions = tt.fix
+				cfg.ColocateMedia = tt.colocate
+			})
+			var content strings.Builder
+			for _, name := range []string{"chart", "photo.gif", "pic.jpeg"} {
+				fmt.Fprintf(&content, `<p><img src="%s/wp-content/uploads/%s" alt="%s"></p>`, server.URL, name, name)
+			}
+			entries := c.ProcessContent([]Post{testPost(1, "fixed", content.String())}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			markdown, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, media := range entries[0].Media {
+				ref := tt.want[path.Base(media.URL)]
+				if !strings.Contains(string(markdown), `"`+ref+`"`) {
+					t.Errorf("markdown doesn't reference %s:\n%s", ref, markdown)
+				}
+				// Media that keeps its name is given its path when downloaded
+				if media.LocalPath == "" {
+					if tt.fix && path.Base(ref) != path.Base(media.URL) {
+						t.Errorf("%s has no local path, want %s", media.URL, path.Base(ref))
+					}
+					continue
+				}
+				if filepath.Base(media.LocalPath) != path.Base(ref) {
+					t.Errorf("%s is saved to %s, want %s", media.URL, media.LocalPath, path.Base(ref))
+				}
+				if _, err := c.Downloader.DownloadFile(media.URL, media.LocalPath); err != nil {
+					t.Fatalf("DownloadFile(%s): %v", media.URL, err)
+				}
+				if _, err := os.Stat(media.LocalPath); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMediaExtension(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		want      string
+		wantOK    bool
+	}{
+		{"image/png", ".png", true},
+		{"image/jpeg", ".jpg", true},
+		{"application/pdf", ".pdf", true},
+		{"text/html", "", false},
+		{"application/octet-stream", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := mediaExtension(tt.mediaType); got != tt.want || ok != tt.wantOK {
+			t.Errorf("mediaExtension(%q) = %q, %v, want %q, %v", tt.mediaType, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// rangeServer serves payload at every path, answering Range requests when
+// ranges is set and ignoring them otherwise. It records the Range header of
+// every request.
+func rangeServer(t *testing.T, payload []byte, ranges bool) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get("Range"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "video/mp4")
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(payload))
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	payload := make([]byte, 64<<10)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	sum := sha256.Sum256(payload)
+	wantChecksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name string
+		// part is what an earlier attempt left in the .part file
+		part       []byte
+		ranges     bool
+		wantRanges []string
+		wantBytes  int64
+	}{
+		{"no partial file", nil, true, []string{""}, int64(len(payload))},
+		{"resumed", payload[:40<<10], true, []string{"bytes=40960-"}, 24 << 10},
+		{"server without ranges", payload[:40<<10], false, []string{"bytes=40960-"}, int64(len(payload))},
+		{"partial longer than the file", append(append([]byte{}, payload...), 1, 2, 3), true, []string{"bytes=65539-", ""}, int64(len(payload))},
+		{"empty partial file", []byte{}, true, []string{""}, int64(len(payload))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, ranges := rangeServer(t, payload, tt.ranges)
+			output := filepath.Join(t.TempDir(), "media", "video.mp4")
+			if tt.part != nil {
+				if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(output+".part", tt.part, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			metrics := &Metrics{}
+			checksum, err := Downloader{Metrics: metrics}.DownloadFile(server.URL+"/video.mp4", output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, payload) {
+				t.Errorf("saved %d bytes that differ from the %d served", len(data), len(payload))
+			}
+			if checksum != wantChecksum {
+				t.Errorf("checksum = %s, want %s", checksum, wantChecksum)
+			}
+			if _, err := os.Stat(output + ".part"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("the partial file is left behind: %v", err)
+			}
+			if !slices.Equal(*ranges, tt.wantRanges) {
+				t.Errorf("Range headers = %q, want %q", *ranges, tt.wantRanges)
+			}
+			if got := metrics.Snapshot().BytesDownloaded; got != tt.wantBytes {
+				t.Errorf("downloaded %d bytes, want %d", got, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestDownloadFileResumeWrongRange(t *testing.T) {
+	payload := []byte("0123456789abcdefghij")
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			// A part other than the one asked for
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-4/%d", len(payload)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(payload[:5])
+			return
+		}
+		w.Write(payload)
+	}))
+	t.Cleanup(server.Close)
+
+	output := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(output+".part", payload[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Downloader{}).DownloadFile(server.URL+"/file.bin", output); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(output); !bytes.Equal(data, payload) {
+		t.Errorf("saved %q, want %q", data, payload)
+	}
+	if want := []string{"bytes=10-", ""}; !slices.Equal(ranges, want) {
+		t.Errorf("Range headers = %q, want %q", ranges, want)
+	}
+}
+
+func TestDownloadFileRangeAnswers(t *testing.T) {
+	payload := []byte("0123456789abcdefghij")
+	wholePart := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(payload)-1, len(payload)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(payload)
+	}
+	tests := []struct {
+		name       string
+		part       []byte
+		handler    http.HandlerFunc
+		wantRanges []string
+		wantStatus int
+	}{
+		{"whole file as a part", nil, wholePart, []string{""}, 0},
+		{"whole file as a part after a stale partial file", payload[:10], wholePart, []string{"bytes=10-", ""}, 0},
+		{
+			// The restart isn't retried again
+			name: "range never satisfiable",
+			part: payload[:10],
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			},
+			wantRanges: []string{"bytes=10-", ""},
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				tt.handler(w, r)
+			}))
+			t.Cleanup(server.Close)
+
+			output := filepath.Join(t.TempDir(), "file.bin")
+			if tt.part != nil {
+				if err := os.WriteFile(output+".part", tt.part, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			metrics := &Metrics{}
+			_, err := Downloader{Metrics: metrics}.DownloadFile(server.URL+"/file.bin", output)
+			var downloadErr *MediaDownloadError
+			if tt.wantStatus != 0 {
+				if !errors.As(err, &downloadErr) || downloadErr.StatusCode != tt.wantStatus {
+					t.Errorf("DownloadFile() error = %v, want status %d", err, tt.wantStatus)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if data, _ := os.ReadFile(output); !bytes.Equal(data, payload) {
+				t.Errorf("saved %q, want %q", data, payload)
+			}
+			if !slices.Equal(ranges, tt.wantRanges) {
+				t.Errorf("Range headers = %q, want %q", ranges, tt.wantRanges)
+			}
+			wantBytes := int64(len(payload))
+			if tt.wantStatus != 0 {
+				wantBytes = 0
+			}
+			if got := metrics.Snapshot().BytesDownloaded; got != wantBytes {
+				t.Errorf("downloaded %d bytes, want %d", got, wantBytes)
+			}
+		})
+	}
+}
+
+func TestDownloadFileInterrupted(t *testing.T) {
+	payload := bytes.Repeat([]byte("abcdefgh"), 4<<10)
+	var interrupted atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if interrupted.CompareAndSwap(false, true) {
+			// Promise the whole file but drop the connection halfway
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write(payload[:len(payload)/2])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(payload))
+	}))
+	t.Cleanup(server.Close)
+
+	output := filepath.Join(t.TempDir(), "file.bin")
+	if _, err := (Downloader{}).DownloadFile(server.URL+"/file.bin", output); err == nil {
+		t.Fatal("the interrupted download succeeded")
+	}
+	if _, err := os.Stat(output); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the interrupted download was moved into place: %v", err)
+	}
+	part, err := os.ReadFile(output + ".part")
+	if err != nil || len(part) == 0 {
+		t.Fatalf("no partial file to resume from: %v", err)
+	}
+
+	metrics := &Metrics{}
+	if _, err := (Downloader{Metrics: metrics}).DownloadFile(server.URL+"/file.bin", output); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(output); !bytes.Equal(data, payload) {
+		t.Errorf("resumed download saved %d bytes that differ from the %d served", len(data), len(payload))
+	}
+	if got, want := metrics.Snapshot().BytesDownloaded, int64(len(payload)-len(part)); got != want {
+		t.Errorf("resumed download fetched %d bytes, want the missing %d", got, want)
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+	}{
+		{"bytes 100-199/200", 100},
+		{"bytes 0-4/*", 0},
+		{" bytes 7-8/9 ", 7},
+		{"", -1},
+		{"bytes */200", -1},
+		{"items 1-2/3", -1},
+	}
+	for _, tt := range tests {
+		if got := contentRangeStart(tt.header); got != tt.want {
+			t.Errorf("contentRangeStart(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
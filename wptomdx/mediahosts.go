@@ -0,0 +1,68 @@
+package wptomdx
+
+import (
+	"net/url"
+	"strings"
+)
+
+// MediaHosts widens or narrows which hosts media is downloaded from. Media
+// under the base URL is always downloaded unless its host is denied. A host
+// is either a hostname ("cdn.example.com") or a "*." pattern matching its
+// subdomains ("*.example.com").
+type MediaHosts struct {
+	// Allowed hosts are downloaded from besides the base URL, e.g. a CDN
+	Allowed []string `yaml:"allowed"`
+	// Denied hosts are never downloaded from, even when allowed
+	Denied []string `yaml:"denied"`
+}
+
+// allows reports whether host is one of the allowed hosts
+func (h MediaHosts) allows(host string) bool {
+	return matchesAnyHost(h.Allowed, host)
+}
+
+// denies reports whether host is one of the denied hosts
+func (h MediaHosts) denies(host string) bool {
+	return matchesAnyHost(h.Denied, host)
+}
+
+// matchesAnyHost reports whether host, ignoring its port and case, matches
+// one of patterns
+func matchesAnyHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	if host == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		// Accept a URL such as https://cdn.example.com/ as its host
+		if u, err := url.Parse(pattern); err == nil && u.Host != "" {
+			pattern = u.Hostname()
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if pattern != "" && host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHostPath returns the path of src, with its query and fragment, when
+// it is an absolute URL on one of the allowed hosts, or ""
+func allowedHostPath(src string, hosts MediaHosts) string {
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || !hosts.allows(u.Host) {
+		return ""
+	}
+	rest, ok := strings.CutPrefix(src, u.Scheme+"://"+u.Host)
+	if !ok {
+		return ""
+	}
+	return "/" + strings.TrimPrefix(rest, "/")
+}
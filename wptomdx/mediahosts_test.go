@@ -0,0 +1,99 @@
+package wptomdx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchesAnyHost(t *testing.T) {
+	patterns := []string{"cdn.example.com", "*.media.example.org", "https://img.example.net/", " Static.Example.com "}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"cdn.example.com", true},
+		{"CDN.example.com:8443", true},
+		{"www.example.com", false},
+		{"a.media.example.org", true},
+		{"a.b.media.example.org", true},
+		{"media.example.org", false},
+		{"evilmedia.example.org", false},
+		{"img.example.net", true},
+		{"static.example.com", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matchesAnyHost(patterns, tt.host); got != tt.want {
+			t.Errorf("matchesAnyHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestLocalMediaPathHosts(t *testing.T) {
+	const base = "https://www.example.com"
+	hosts := MediaHosts{
+		Allowed: []string{"cdn.example.com", "*.wp.com"},
+		Denied:  []string{"ads.example.com", "i0.wp.com"},
+	}
+	tests := []struct {
+		name  string
+		src   string
+		hosts MediaHosts
+		want  string
+	}{
+		{"base URL", base + "/wp-content/uploads/a.jpg", hosts, "/wp-content/uploads/a.jpg"},
+		{"CDN host", "https://cdn.example.com/wp-content/uploads/a.jpg?ver=2", hosts, "/wp-content/uploads/a.jpg?ver=2"},
+		{"CDN host not allowed", "https://cdn.example.com/wp-content/uploads/a.jpg", MediaHosts{}, ""},
+		{"wildcard host", "https://i1.wp.com/www.example.com/a.jpg", hosts, "/www.example.com/a.jpg"},
+		{"denied over wildcard", "https://i0.wp.com/www.example.com/a.jpg", hosts, ""},
+		{"external host", "https://other.org/b.jpg", hosts, ""},
+		{"denied host", "https://ads.example.com/banner.jpg", hosts, ""},
+		{"base host denied", base + "/wp-content/uploads/a.jpg", MediaHosts{Denied: []string{"www.example.com"}}, ""},
+		{"protocol-relative CDN", "//cdn.example.com/a.jpg", hosts, "/a.jpg"},
+		{"not http", "ftp://cdn.example.com/a.jpg", hosts, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LocalMediaPath(tt.src, base, tt.hosts); got != tt.want {
+				t.Errorf("LocalMediaPath(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertContentMediaHosts(t *testing.T) {
+	c := NewConverter(Config{
+		BaseURL:    "https://www.example.com",
+		MediaHosts: MediaHosts{Allowed: []string{"cdn.example.com"}, Denied: []string{"ads.example.com"}},
+	})
+	tests := []struct {
+		name string
+		src  string
+		// want is the reference in the output
+		want string
+		// wantDownload is set when the image is downloaded
+		wantDownload bool
+	}{
+		{"CDN host", "https://cdn.example.com/wp-content/uploads/a.jpg", "/wp-content/uploads/a.jpg", true},
+		{"base URL", "https://www.example.com/wp-content/uploads/d.jpg", "/wp-content/uploads/d.jpg", true},
+		{"external host", "https://other.org/b.jpg", "https://other.org/b.jpg", false},
+		{"denied host", "https://ads.example.com/c.jpg", "https://ads.example.com/c.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, media, err := c.ConvertContent(`<p><img src="` + tt.src + `" alt="x"></p>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `<img src="` + tt.want + `" alt="x" />`; got != want {
+				t.Errorf("ConvertContent() = %q, want %q", got, want)
+			}
+			if !slices.Equal(media, []string{tt.src}) {
+				t.Errorf("media = %q, want %q", media, []string{tt.src})
+			}
+			if downloaded := LocalMediaPath(tt.src, c.Config.BaseURL, c.Config.MediaHosts) != ""; downloaded != tt.wantDownload {
+				t.Errorf("downloaded = %v, want %v", downloaded, tt.wantDownload)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseTiming is how long one phase of a run took
+type PhaseTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+}
+
+// RunMetrics summarizes a run: the time spent in each phase, what was
+// processed and how much media was downloaded
+type RunMetrics struct {
+	Phases          []PhaseTiming `json:"phases"`
+	Posts           int           `json:"posts"`
+	Pages           int           `json:"pages"`
+	MediaDownloaded int           `json:"mediaDownloaded"`
+	MediaSkipped    int           `json:"mediaSkipped"`
+	MediaFailed     int           `json:"mediaFailed"`
+	BytesDownloaded int64         `json:"bytesDownloaded"`
+}
+
+// Metrics collects the RunMetrics of a run from concurrent workers
+type Metrics struct {
+	mu  sync.Mutex
+	run RunMetrics
+}
+
+// Phase records that the phase name started at start and has just ended
+func (m *Metrics) Phase(name string, start time.Time) {
+	elapsed := time.Since(start)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.run.Phases = append(m.run.Phases, PhaseTiming{Name: name, Duration: elapsed, Seconds: elapsed.Seconds()})
+}
+
+// Update changes the counts while holding the lock
+func (m *Metrics) Update(fn func(run *RunMetrics)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(&m.run)
+}
+
+// Snapshot returns a copy of the metrics collected so far
+func (m *Metrics) Snapshot() RunMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run := m.run
+	run.Phases = append([]PhaseTiming(nil), m.run.Phases...)
+	return run
+}
+
+// Phase returns the duration of the phase name, or 0 when it wasn't recorded
+func (r RunMetrics) Phase(name string) time.Duration {
+	for _, phase := range r.Phases {
+		if phase.Name == name {
+			return phase.Duration
+		}
+	}
+	return 0
+}
+
+// Summary renders the metrics as a table, with the throughput of each phase
+func (r RunMetrics) Summary() string {
+	var b strings.Builder
+	b.WriteString("Run summary\n")
+	for _, phase := range r.Phases {
+		fmt.Fprintf(&b, "  %-18s %10s\n", phase.Name, phase.Duration.Round(time.Millisecond))
+	}
+	rows := []struct {
+		name  string
+		value int
+	}{
+		{"posts", r.Posts},
+		{"pages", r.Pages},
+		{"media downloaded", r.MediaDownloaded},
+		{"media skipped", r.MediaSkipped},
+		{"media failed", r.MediaFailed},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(&b, "  %-18s %10d\n", row.name, row.value)
+	}
+	fmt.Fprintf(&b, "  %-18s %10s\n", "bytes downloaded", formatBytes(r.BytesDownloaded))
+
+	if convert := r.Phase("convert"); convert > 0 {
+		fmt.Fprintf(&b, "  %-18s %10.1f\n", "items/second", float64(r.Posts+r.Pages)/convert.Seconds())
+	}
+	// Downloads start during the conversion and finish in the download phase
+	if download := r.Phase("convert") + r.Phase("download"); download > 0 && r.BytesDownloaded > 0 {
+		fmt.Fprintf(&b, "  %-18s %10s\n", "media/second", formatBytes(int64(float64(r.BytesDownloaded)/download.Seconds())))
+	}
+	return b.String()
+}
+
+// WriteMetrics writes the metrics as JSON to path
+func WriteMetrics(path string, r RunMetrics) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metrics %s: %v", path, err)
+	}
+	return nil
+}
+
+// formatBytes renders n with a binary unit, such as 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
@@ -0,0 +1,177 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	var m Metrics
+	start := time.Now().Add(-2 * time.Second)
+	m.Phase("fetch", start)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Update(func(run *RunMetrics) {
+				run.Posts++
+				run.MediaDownloaded++
+				run.BytesDownloaded += 2048
+			})
+		}()
+	}
+	wg.Wait()
+	m.Update(func(run *RunMetrics) { run.Pages, run.MediaSkipped, run.MediaFailed = 4, 3, 1 })
+
+	run := m.Snapshot()
+	if run.Posts != 50 || run.Pages != 4 || run.MediaDownloaded != 50 || run.MediaSkipped != 3 || run.MediaFailed != 1 || run.BytesDownloaded != 50*2048 {
+		t.Errorf("Snapshot() = %+v", run)
+	}
+	if got := run.Phase("fetch"); got < 2*time.Second {
+		t.Errorf("fetch took %v, want at least 2s", got)
+	}
+	if got := run.Phase("download"); got != 0 {
+		t.Errorf("unrecorded phase took %v, want 0", got)
+	}
+
+	// The snapshot doesn't change with later phases
+	m.Phase("convert", time.Now())
+	if len(run.Phases) != 1 || len(m.Snapshot().Phases) != 2 {
+		t.Errorf("snapshot has %d phases, collector %d, want 1 and 2", len(run.Phases), len(m.Snapshot().Phases))
+	}
+}
+
+func TestRunMetricsSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     RunMetrics
+		want    []string
+		wantNot []string
+	}{
+		{
+			name: "full run",
+			run: RunMetrics{
+				Phases: []PhaseTiming{
+					{Name: "fetch", Duration: 1500 * time.Millisecond},
+					{Name: "convert", Duration: 2 * time.Second},
+					{Name: "download", Duration: 2 * time.Second},
+				},
+				Posts: 30, Pages: 10, MediaDownloaded: 12, MediaSkipped: 2, MediaFailed: 1,
+				BytesDownloaded: 8 << 20,
+			},
+			want: []string{
+				"  fetch                    1.5s\n",
+				"  posts                      30\n",
+				"  pages                      10\n",
+				"  media downloaded           12\n",
+				"  media skipped               2\n",
+				"  media failed                1\n",
+				"  bytes downloaded      8.0 MiB\n",
+				"  items/second             20.0\n",
+				"  media/second          2.0 MiB\n",
+			},
+		},
+		{
+			name:    "nothing timed",
+			run:     RunMetrics{Posts: 3},
+			want:    []string{"  posts                       3\n", "  bytes downloaded          0 B\n"},
+			wantNot: []string{"items/second", "media/second"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := tt.run.Summary()
+			if !strings.HasPrefix(summary, "Run summary\n") {
+				t.Errorf("summary doesn't start with its title:\n%s", summary)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(summary, want) {
+					t.Errorf("summary is missing %q:\n%s", want, summary)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(summary, unwanted) {
+					t.Errorf("summary has %q:\n%s", unwanted, summary)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	run := RunMetrics{
+		Phases: []PhaseTiming{{Name: "fetch", Duration: 1500 * time.Millisecond, Seconds: 1.5}},
+		Posts:  2, MediaFailed: 1, BytesDownloaded: 10,
+	}
+	if err := WriteMetrics(path, run); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"phases":          []interface{}{map[string]interface{}{"name": "fetch", "seconds": 1.5}},
+		"posts":           2.0,
+		"pages":           0.0,
+		"mediaDownloaded": 0.0,
+		"mediaSkipped":    0.0,
+		"mediaFailed":     1.0,
+		"bytesDownloaded": 10.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics JSON = %v, want %v", got, want)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+		{2 << 40, "2.0 TiB"},
+		{2048 << 40, "2048.0 TiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDownloaderMetrics(t *testing.T) {
+	server := newMediaServer(t, []string{"/wp-content/uploads/a.jpg", "/wp-content/uploads/b.jpg"}, nil)
+	metrics := &Metrics{}
+	d := Downloader{Metrics: metrics}
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if _, err := d.DownloadFile(server.URL+"/wp-content/uploads/"+name, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.DownloadFile(server.URL+"/wp-content/uploads/missing.jpg", filepath.Join(dir, "missing.jpg")); err == nil {
+		t.Error("downloading a missing file succeeded")
+	}
+	if got, want := metrics.Snapshot().BytesDownloaded, int64(2*len(jpegBytes)); got != want {
+		t.Errorf("counted %d bytes, want %d", got, want)
+	}
+}
@@ -0,0 +1,351 @@
+package wptomdx
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PathRegistry hands out unique output paths to posts and pages processed by
+// concurrent workers, so that two items never overwrite each other's files
+type PathRegistry struct {
+	mu     sync.Mutex
+	owners map[string]int
+}
+
+// NewPathRegistry creates an empty registry
+func NewPathRegistry() *PathRegistry {
+	return &PathRegistry{owners: make(map[string]int)}
+}
+
+// Claim reserves path for the item with the given ID and returns the path to
+// use. When another item already holds it, the ID is appended (plus a numeric
+// suffix if that is taken as well) and a warning is logged. Paths are compared
+// case-insensitively since many filesystems are.
+func (r *PathRegistry) Claim(path string, id int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owner, taken := r.owners[strings.ToLower(path)]
+	if !taken || owner == id {
+		r.owners[strings.ToLower(path)] = id
+		return path
+	}
+
+	candidate := fmt.Sprintf("%s-%d", path, id)
+	for n := 2; r.isTaken(candidate, id); n++ {
+		candidate = fmt.Sprintf("%s-%d-%d", path, id, n)
+	}
+	r.owners[strings.ToLower(candidate)] = id
+
+	log.Printf("Warning: output path %q of %d is already used by %d, writing to %q instead", path, id, owner, candidate)
+	return candidate
+}
+
+// isTaken reports whether path belongs to an item other than id
+func (r *PathRegistry) isTaken(path string, id int) bool {
+	owner, ok := r.owners[strings.ToLower(path)]
+	return ok && owner != id
+}
+
+// ParseIgnorePatterns splits a comma or newline separated list of glob
+// patterns, skipping blank entries and "#" comments
+func ParseIgnorePatterns(raw string) []string {
+	var patterns []string
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, pattern := range strings.Split(line, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
+
+// IsIgnoredPath reports whether p, a site path such as "shop/cart", matches one
+// of the glob patterns. Leading and trailing slashes are ignored, and like in
+// .gitignore a pattern matching a directory also matches everything below it,
+// so "/wp-admin/*" matches "wp-admin/options/general".
+func IsIgnoredPath(p string, patterns []string) bool {
+	p = strings.Trim(p, "/")
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		for candidate := p; candidate != "." && candidate != ""; candidate = path.Dir(candidate) {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// permalinkSlugRe matches the runs of characters WordPress replaces with a
+// hyphen when it builds a term slug from its name
+var permalinkSlugRe = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// PermalinkURL builds the URL WordPress serves an item at from the site's
+// permalink structure (e.g. "/%year%/%monthnum%/%postname%/"), for runs that
+// don't look permalinks up through the REST API. Pages always live at
+// "/%pagename%/", below the slugs of their parent pages; an empty structure
+// means plain "?p=<id>" links.
+func PermalinkURL(baseURL string, structure string, post Post) string {
+	slug := post.Slug
+	if slug == "" {
+		slug = strconv.Itoa(post.ID)
+	}
+	if post.PostType == "page" {
+		return baseURL + "/" + path.Join(post.ParentPath, slug) + "/"
+	}
+	if structure == "" {
+		return fmt.Sprintf("%s/?p=%d", baseURL, post.ID)
+	}
+
+	date, err := ParseWordPressDate(post.PublishedDate)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	category := "uncategorized"
+	if len(post.Categories) > 0 {
+		category = termSlug(post.Categories[0])
+	}
+
+	permalink := strings.NewReplacer(
+		"%year%", date.Format("2006"),
+		"%monthnum%", date.Format("01"),
+		"%day%", date.Format("02"),
+		"%hour%", date.Format("15"),
+		"%minute%", date.Format("04"),
+		"%second%", date.Format("05"),
+		"%post_id%", strconv.Itoa(post.ID),
+		"%postname%", slug,
+		"%pagename%", slug,
+		"%category%", category,
+	).Replace(structure)
+	if !strings.HasPrefix(permalink, "/") {
+		permalink = "/" + permalink
+	}
+	return baseURL + permalink
+}
+
+// PostSlugs returns the set of the slugs of posts, which internal links to
+// them end with
+func PostSlugs(posts []Post) map[string]bool {
+	slugs := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		if post.Slug != "" {
+			slugs[post.Slug] = true
+		}
+	}
+	return slugs
+}
+
+// URL resolution strategies, the entries of Config.PathResolutionOrder
+const (
+	// ResolveFromAPI looks the URL up through the REST API
+	ResolveFromAPI = "api"
+	// ResolveFromSlug builds it from the post_name and post_parent columns
+	ResolveFromSlug = "slug"
+	// ResolveFromGUID takes the path of the guid column
+	ResolveFromGUID = "guid"
+)
+
+// URLResolutionOrder returns the strategies the URLs of items are found with,
+// in the order they are tried: PathResolutionOrder when set, otherwise
+// only the slug when there's a permalink structure, or else only the API
+func (c Config) URLResolutionOrder() []string {
+	if len(c.PathResolutionOrder) > 0 {
+		return c.PathResolutionOrder
+	}
+	if c.PermalinkStructure != "" {
+		return []string{ResolveFromSlug}
+	}
+	return []string{ResolveFromAPI}
+}
+
+// ResolveURL returns the URL of post from the first strategy of order that
+// finds one. lookup is the REST API lookup of ResolveFromAPI; ResolveFromSlug
+// builds the URL from structure, or from the slugs alone ("/%postname%/") when
+// it is empty.
+func ResolveURL(order []string, baseURL string, structure string, post Post, lookup func(id int) (string, error)) (string, error) {
+	var failures []string
+	for _, strategy := range order {
+		var u string
+		var err error
+		switch strategy {
+		case ResolveFromAPI:
+			u, err = lookup(post.ID)
+		case ResolveFromSlug:
+			u, err = slugURL(baseURL, structure, post)
+		case ResolveFromGUID:
+			u, err = guidURL(baseURL, post.GUID)
+		default:
+			err = fmt.Errorf("unknown strategy")
+		}
+		// e.g. an API answer without a link
+		if err == nil && u == "" {
+			err = fmt.Errorf("no URL")
+		}
+		if err == nil {
+			return u, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", strategy, err))
+	}
+	return "", fmt.Errorf("no URL found for %d (%s)", post.ID, strings.Join(failures, "; "))
+}
+
+// slugURL builds the URL of post from its slug and those of its parent pages
+func slugURL(baseURL string, structure string, post Post) (string, error) {
+	if post.Slug == "" {
+		return "", fmt.Errorf("item has no slug")
+	}
+	if structure == "" {
+		structure = "/%postname%/"
+	}
+	return PermalinkURL(baseURL, structure, post), nil
+}
+
+// guidURL returns the URL of guid's path under baseURL; guids of the plain
+// "?p=123" form have none
+func guidURL(baseURL string, guid string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(guid))
+	if err != nil {
+		return "", fmt.Errorf("invalid guid %q: %v", guid, err)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return "", fmt.Errorf("guid %q has no path", guid)
+	}
+	return baseURL + "/" + strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// PageNode is a page's place in the page hierarchy
+type PageNode struct {
+	ID     int    `db:"ID"`
+	Slug   string `db:"slug"`
+	Parent int    `db:"parent"`
+}
+
+// ResolvePageParents sets the ParentPath of every page by walking the
+// post_parent chain through tree. A chain that loops back on itself is cut
+// where it repeats, with a warning, and one that reaches a page missing from
+// tree stops there.
+func ResolvePageParents(pages []Post, tree map[int]PageNode) {
+	for i := range pages {
+		var ancestors []string
+		seen := map[int]bool{pages[i].ID: true}
+		for parent := tree[pages[i].ID].Parent; parent != 0; {
+			if seen[parent] {
+				log.Printf("Warning: page %d has a cyclic parent chain through %d", pages[i].ID, parent)
+				break
+			}
+			seen[parent] = true
+			node, ok := tree[parent]
+			if !ok {
+				break
+			}
+			ancestors = append([]string{node.Slug}, ancestors...)
+			parent = node.Parent
+		}
+		pages[i].ParentPath = strings.Join(ancestors, "/")
+	}
+}
+
+// CleanOutputDirs removes the contents of every directory in dirs, keeping the
+// directories themselves, so files left by earlier runs under old slugs don't
+// linger. It refuses to touch anything that isn't strictly inside the working
+// directory, such as "/" or a path reached through "..".
+func CleanOutputDirs(dirs []string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get the working directory: %v", err)
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return fmt.Errorf("failed to resolve the working directory: %v", err)
+	}
+
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %v", dir, err)
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to resolve %s: %v", dir, err)
+		}
+		rel, err := filepath.Rel(wd, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("refusing to clean %s: not inside the working directory %s", dir, wd)
+		}
+
+		children, err := os.ReadDir(abs)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %v", dir, err)
+		}
+		for _, child := range children {
+			target := filepath.Join(dir, child.Name())
+			if err := os.RemoveAll(target); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", target, err)
+			}
+			log.Printf("Removed %s", target)
+		}
+	}
+	return nil
+}
+
+// FindOrphans returns the files in dirs that aren't among outputs, e.g. the
+// output of posts deleted or re-slugged in WordPress since an earlier run.
+// An output that is a directory covers everything inside it.
+func FindOrphans(dirs []string, outputs []string) ([]string, error) {
+	kept := make(map[string]bool, len(outputs))
+	for _, output := range outputs {
+		if abs, err := filepath.Abs(output); err == nil {
+			kept[abs] = true
+		}
+	}
+
+	var orphans []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			} else if err != nil {
+				return err
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			if kept[abs] {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && !seen[abs] {
+				seen[abs] = true
+				orphans = append(orphans, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %v", dir, err)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
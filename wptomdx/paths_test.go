@@ -0,0 +1,573 @@
+package wptomdx
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPathRegistryClaim(t *testing.T) {
+	type claim struct {
+		path string
+		id   int
+		want string
+	}
+	tests := []struct {
+		name   string
+		claims []claim
+	}{
+		{"distinct paths", []claim{{"a", 1, "a"}, {"b", 2, "b"}}},
+		{"same item twice", []claim{{"a", 1, "a"}, {"a", 1, "a"}}},
+		{"collision", []claim{{"a", 1, "a"}, {"a", 2, "a-2"}}},
+		{"case-insensitive", []claim{{"About", 1, "About"}, {"about", 2, "about-2"}}},
+		{"suffix taken", []claim{{"a-2", 1, "a-2"}, {"a", 3, "a"}, {"a", 2, "a-2-2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewPathRegistry()
+			for _, c := range tt.claims {
+				if got := r.Claim(c.path, c.id); got != c.want {
+					t.Errorf("Claim(%q, %d) = %q, want %q", c.path, c.id, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPathRegistryConcurrentClaims(t *testing.T) {
+	r := NewPathRegistry()
+	const n = 50
+	got := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = r.Claim("same", i+1)
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, p := range got {
+		if seen[p] {
+			t.Fatalf("path %q handed out twice: %q", p, got)
+		}
+		seen[p] = true
+	}
+	if !seen["same"] {
+		t.Errorf("no item got the original path: %q", got)
+	}
+}
+
+func TestProcessContentSlugCollision(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.PagesOutputDir = cfg.PostsOutputDir })
+	post := testPost(1, "about", "<p>The post</p>")
+	page := testPost(2, "about", "<p>The page</p>")
+	page.PostType = "page"
+
+	entries := append(c.ProcessContent([]Post{post}, false), c.ProcessContent([]Post{page}, true)...)
+	if len(entries) != 2 {
+		t.Fatalf("ProcessContent() returned %d entries, want 2", len(entries))
+	}
+	for i, name := range []string{"about.mdx", "about-2.mdx"} {
+		want := filepath.Join(c.Config.PostsOutputDir, name)
+		if entries[i].MDXPath != want {
+			t.Errorf("entry %d written to %q, want %q", entries[i].ID, entries[i].MDXPath, want)
+		}
+		if _, err := os.Stat(want); err != nil {
+			t.Error(err)
+		}
+	}
+	if entries[0].HTMLPath == entries[1].HTMLPath {
+		t.Errorf("both items saved their HTML at %q", entries[0].HTMLPath)
+	}
+}
+
+func TestParseIgnorePatterns(t *testing.T) {
+	raw := "/cart, /checkout\n# WooCommerce\n\n/wp-admin/*,,\n  my-account  "
+	want := []string{"/cart", "/checkout", "/wp-admin/*", "my-account"}
+	if got := ParseIgnorePatterns(raw); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseIgnorePatterns() = %q, want %q", got, want)
+	}
+}
+
+func TestIsIgnoredPath(t *testing.T) {
+	patterns := []string{"/wp-admin/*", "/cart", "shop/*/reviews"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"cart", true},
+		{"cart/", true},
+		{"/cart", true},
+		{"cart-tips", false},
+		{"wp-admin/options", true},
+		{"wp-admin/options/general", true},
+		{"wp-admin", false},
+		{"shop/shoes/reviews", true},
+		{"shop/shoes", false},
+		{"blog/cart", false},
+	}
+	for _, tt := range tests {
+		if got := IsIgnoredPath(tt.path, patterns); got != tt.want {
+			t.Errorf("IsIgnoredPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestProcessContentIgnorePaths(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.IgnorePaths = []string{"/wp-admin/*", "/cart"} })
+	posts := []Post{
+		testPost(1, "cart", `<p><img src="https://example.com/wp-content/uploads/cart.jpg" alt="Cart"></p>`),
+		testPost(2, "wp-admin/settings", "<p>Settings</p>"),
+		testPost(3, "kept", "<p>Kept</p>"),
+	}
+	entries := c.ProcessContent(posts, false)
+	if len(entries) != 1 || entries[0].ID != 3 {
+		t.Fatalf("ProcessContent() entries = %+v, want only item 3", entries)
+	}
+	// Nothing but the kept item is written, media included
+	root := filepath.Dir(c.Config.PostsOutputDir)
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if want := []string{"html/kept.html", "posts/kept.mdx"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("wrote %q, want %q", files, want)
+	}
+}
+
+func TestPermalinkURL(t *testing.T) {
+	post := Post{ID: 42, Slug: "hello-world", PostType: "post", PublishedDate: "2024-03-05 09:07:03", Categories: []string{"Café News"}}
+	tests := []struct {
+		name      string
+		structure string
+		post      Post
+		want      string
+	}{
+		{"postname", "/%postname%/", post, "https://example.com/hello-world/"},
+		{"year and month", "/%year%/%monthnum%/%postname%/", post, "https://example.com/2024/03/hello-world/"},
+		{"full date", "/%year%/%monthnum%/%day%/%hour%%minute%%second%/%postname%", post, "https://example.com/2024/03/05/090703/hello-world"},
+		{"post ID", "/archives/%post_id%", post, "https://example.com/archives/42"},
+		{"category", "/%category%/%postname%/", post, "https://example.com/café-news/hello-world/"},
+		{"uncategorized", "/%category%/%postname%/", Post{ID: 1, Slug: "a", PostType: "post", PublishedDate: "2024-03-05 09:07:03"}, "https://example.com/uncategorized/a/"},
+		{"no leading slash", "%postname%/", post, "https://example.com/hello-world/"},
+		{"plain", "", post, "https://example.com/?p=42"},
+		{"no slug", "/%postname%/", Post{ID: 7, PostType: "post", PublishedDate: "2024-03-05 09:07:03"}, "https://example.com/7/"},
+		{"page", "/%year%/%monthnum%/%postname%/", Post{ID: 3, Slug: "team", PostType: "page", ParentPath: "about"}, "https://example.com/about/team/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PermalinkURL("https://example.com", tt.structure, tt.post); got != tt.want {
+				t.Errorf("PermalinkURL(%q) = %q, want %q", tt.structure, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentPermalinkStructure(t *testing.T) {
+	tests := []struct {
+		structure string
+		want      string
+	}{
+		{"/%postname%/", "hello-world.mdx"},
+		{"/%year%/%monthnum%/%postname%/", "2024/03/hello-world.mdx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.structure, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.PermalinkStructure = tt.structure })
+			c.LookupURL = func(id int, isPage bool) (string, error) {
+				t.Errorf("looked up %d through the API", id)
+				return "", errors.New("offline")
+			}
+			post := testPost(42, "hello-world", "<p>Hello</p>")
+			post.URL = ""
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if want := filepath.Join(c.Config.PostsOutputDir, tt.want); entries[0].MDXPath != want {
+				t.Errorf("MDXPath = %q, want %q", entries[0].MDXPath, want)
+			}
+		})
+	}
+}
+
+func TestURLResolutionOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{"default", Config{}, []string{ResolveFromAPI}},
+		{"permalink structure", Config{PermalinkStructure: "/%postname%/"}, []string{ResolveFromSlug}},
+		{"configured", Config{PermalinkStructure: "/%postname%/", PathResolutionOrder: []string{ResolveFromAPI, ResolveFromGUID}}, []string{ResolveFromAPI, ResolveFromGUID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.URLResolutionOrder(); !slices.Equal(got, tt.want) {
+				t.Errorf("URLResolutionOrder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	const permalink = "https://example.com/2024/03/from-api/"
+	post := Post{ID: 42, Slug: "hello-world", PostType: "post", PublishedDate: "2024-03-05 09:07:03", GUID: "https://old.example.com/archives/hello/"}
+	apiDown := func(id int) (string, error) { return "", errors.New("connection refused") }
+	apiUp := func(id int) (string, error) { return permalink, nil }
+	noLink := func(id int) (string, error) { return "", nil }
+	full := []string{ResolveFromAPI, ResolveFromSlug, ResolveFromGUID}
+	tests := []struct {
+		name    string
+		order   []string
+		post    Post
+		lookup  func(id int) (string, error)
+		want    string
+		wantErr []string
+	}{
+		{name: "api", order: full, post: post, lookup: apiUp, want: permalink},
+		{name: "api down falls back to slug", order: full, post: post, lookup: apiDown, want: "https://example.com/hello-world/"},
+		{name: "api without link falls back to slug", order: full, post: post, lookup: noLink, want: "https://example.com/hello-world/"},
+		{name: "no slug falls back to guid", order: full, post: Post{ID: 42, GUID: post.GUID}, lookup: apiDown, want: "https://example.com/archives/hello/"},
+		{name: "slug before api", order: []string{ResolveFromSlug, ResolveFromAPI}, post: post, lookup: apiUp, want: "https://example.com/hello-world/"},
+		{name: "guid before slug", order: []string{ResolveFromGUID, ResolveFromSlug}, post: post, lookup: apiUp, want: "https://example.com/archives/hello/"},
+		{
+			name:    "every strategy fails",
+			order:   full,
+			post:    Post{ID: 42, GUID: "https://example.com/?p=42"},
+			lookup:  apiDown,
+			wantErr: []string{"no URL found for 42", "api: connection refused", "slug: item has no slug", `guid: guid "https://example.com/?p=42" has no path`},
+		},
+		{name: "unknown strategy", order: []string{"sitemap"}, post: post, lookup: apiUp, wantErr: []string{"sitemap: unknown strategy"}},
+		{name: "no strategies", post: post, lookup: apiUp, wantErr: []string{"no URL found for 42"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveURL(tt.order, "https://example.com", "", tt.post, tt.lookup)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("ResolveURL() = %q, want an error", got)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("ResolveURL() error = %q, want one mentioning %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentResolutionFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		post   Post
+		want   string
+	}{
+		{"api", http.StatusOK, `{"link": "https://example.com/2024/03/from-api/"}`, testPost(42, "hello-world", "<p>Hi</p>"), "2024/03/from-api.mdx"},
+		{"api error", http.StatusInternalServerError, "", testPost(42, "hello-world", "<p>Hi</p>"), "hello-world.mdx"},
+		{"api not found", http.StatusNotFound, "", testPost(42, "hello-world", "<p>Hi</p>"), "hello-world.mdx"},
+		{"api without link", http.StatusOK, `{}`, testPost(42, "hello-world", "<p>Hi</p>"), "hello-world.mdx"},
+		{"no slug", http.StatusInternalServerError, "", testPost(42, "", "<p>Hi</p>"), "archives/hello.mdx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/wp-json/wp/v2/posts/42" {
+					http.NotFound(w, r)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := testConverter(t, func(cfg *Config) {
+				cfg.APIBase = server.URL + "/wp-json/wp/v2"
+				cfg.APIRetry = RetryPolicy{Attempts: 1}
+				cfg.PathResolutionOrder = []string{ResolveFromAPI, ResolveFromSlug, ResolveFromGUID}
+			})
+			post := tt.post
+			post.URL = ""
+			post.GUID = "https://example.com/archives/hello/"
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if want := filepath.Join(c.Config.PostsOutputDir, tt.want); entries[0].MDXPath != want {
+				t.Errorf("MDXPath = %q, want %q", entries[0].MDXPath, want)
+			}
+		})
+	}
+}
+
+func TestProcessContentInternalLinkPrefix(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.Convert.InternalLinkPrefix = "/blog" })
+	posts := []Post{
+		testPost(1, "my-post", "<p>Hello</p>"),
+		testPost(2, "other-post", `<p>See <a href="https://example.com/my-post/">my post</a> and <a href="https://example.com/about/">about</a>.</p>`),
+	}
+	c.PostSlugs = PostSlugs(posts)
+	entries := c.ProcessContent(posts, false)
+	if len(entries) != 2 {
+		t.Fatalf("ProcessContent() returned %d entries, want 2", len(entries))
+	}
+	data, err := os.ReadFile(filepath.Join(c.Config.PostsOutputDir, "other-post.mdx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "See [my post](/blog/my-post/) and [about](/about/)."; !strings.Contains(string(data), want) {
+		t.Errorf("output doesn't contain %q:\n%s", want, data)
+	}
+}
+
+func TestPostSlugs(t *testing.T) {
+	got := PostSlugs([]Post{{Slug: "a"}, {Slug: ""}, {Slug: "b"}, {Slug: "a"}})
+	if want := map[string]bool{"a": true, "b": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PostSlugs() = %v, want %v", got, want)
+	}
+}
+
+func TestResolvePageParents(t *testing.T) {
+	tests := []struct {
+		name string
+		tree map[int]PageNode
+		want map[int]string
+	}{
+		{
+			name: "three levels",
+			tree: map[int]PageNode{1: {1, "about", 0}, 2: {2, "team", 1}, 3: {3, "bios", 2}},
+			want: map[int]string{1: "", 2: "about", 3: "about/team"},
+		},
+		{
+			name: "cycle",
+			tree: map[int]PageNode{1: {1, "a", 3}, 2: {2, "b", 1}, 3: {3, "c", 2}},
+			want: map[int]string{1: "b/c", 2: "c/a", 3: "a/b"},
+		},
+		{
+			name: "own parent",
+			tree: map[int]PageNode{1: {1, "a", 1}},
+			want: map[int]string{1: ""},
+		},
+		{
+			// Parents that aren't published pages end the chain
+			name: "missing parent",
+			tree: map[int]PageNode{2: {2, "team", 9}, 3: {3, "bios", 2}},
+			want: map[int]string{2: "", 3: "team"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages []Post
+			for id := range tt.want {
+				pages = append(pages, Post{ID: id, PostType: "page"})
+			}
+			ResolvePageParents(pages, tt.tree)
+			got := make(map[int]string)
+			for _, page := range pages {
+				got[page.ID] = page.ParentPath
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parent paths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentPageHierarchy(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.PathResolutionOrder = []string{ResolveFromSlug} })
+	tree := map[int]PageNode{1: {1, "about", 0}, 2: {2, "team", 1}, 3: {3, "bios", 2}}
+	var pages []Post
+	for _, node := range tree {
+		page := testPost(node.ID, node.Slug, "<p>Page</p>")
+		page.PostType, page.URL = "page", ""
+		pages = append(pages, page)
+	}
+	ResolvePageParents(pages, tree)
+
+	var got []string
+	for _, entry := range c.ProcessContent(pages, true) {
+		rel, err := filepath.Rel(c.Config.PagesOutputDir, entry.MDXPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.ToSlash(rel))
+	}
+	slices.Sort(got)
+	if want := []string{"about.mdx", "about/team.mdx", "about/team/bios.mdx"}; !slices.Equal(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+// chdir changes the working directory to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// writeFiles creates each of paths, with its directories
+func writeFiles(t *testing.T, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCleanOutputDirs(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+	writeFiles(t, "out/posts/renamed.mdx", "out/posts/2023/old.mdx", "out/media/wp-content/a.jpg", "keep/notes.txt")
+
+	c := testConverter(t, func(cfg *Config) {
+		cfg.PostsOutputDir = "out/posts"
+		cfg.MediaOutputDir = "out/media"
+	})
+	if err := CleanOutputDirs([]string{"out/posts", "out/media", "out/missing"}); err != nil {
+		t.Fatal(err)
+	}
+	entries := c.ProcessContent([]Post{testPost(1, "new-slug", "<p>New</p>")}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+
+	var got []string
+	err := filepath.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			got = append(got, filepath.ToSlash(p))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"keep/notes.txt", "out/posts/new-slug.mdx"}; !slices.Equal(got, want) {
+		t.Errorf("files after cleaning = %q, want %q", got, want)
+	}
+	for _, dir := range []string{"out/posts", "out/media"} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("cleaned directory %s was removed: %v", dir, err)
+		}
+	}
+}
+
+func TestCleanOutputDirsRefuses(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeFiles(t, filepath.Join(root, "work", "out", "a.mdx"), filepath.Join(outside, "b.mdx"))
+	chdir(t, filepath.Join(root, "work"))
+	if err := os.Symlink(outside, "link"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"/", ".", "..", "../work", "out/../..", outside, "link"} {
+		if err := CleanOutputDirs([]string{dir}); err == nil || !strings.Contains(err.Error(), "refusing to clean") {
+			t.Errorf("CleanOutputDirs(%q) error = %v, want a refusal", dir, err)
+		}
+	}
+	for _, p := range []string{"out/a.mdx", filepath.Join(outside, "b.mdx")} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("refused clean removed %s", p)
+		}
+	}
+}
+
+func TestProcessContentOrphans(t *testing.T) {
+	c := testConverter(t, nil)
+	stale := []string{
+		filepath.Join(c.Config.PostsOutputDir, "old-slug.mdx"),
+		filepath.Join(c.Config.HTMLOutputDir, "old-slug.html"),
+	}
+	writeFiles(t, stale...)
+	entries := c.ProcessContent([]Post{testPost(1, "current", "<p>Current</p>")}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+
+	dirs := []string{c.Config.PostsOutputDir, c.Config.PagesOutputDir, c.Config.HTMLOutputDir, c.Config.MediaOutputDir}
+	orphans, err := FindOrphans(dirs, c.Outputs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(stale)
+	if !slices.Equal(orphans, stale) {
+		t.Errorf("FindOrphans() = %q, want %q", orphans, stale)
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		outputs []string
+		want    []string
+	}{
+		{"all generated", []string{"posts/a.mdx", "posts/b.mdx"}, []string{"posts/a.mdx", "posts/b.mdx"}, nil},
+		{"stale", []string{"posts/a.mdx", "posts/2023/b.mdx"}, []string{"posts/a.mdx"}, []string{"posts/2023/b.mdx"}},
+		// A colocated post's folder holds its index file and media
+		{"directory output", []string{"posts/a/index.mdx", "posts/a/photo.jpg", "posts/b.mdx"}, []string{"posts/a"}, []string{"posts/b.mdx"}},
+		{"missing directory", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			writeFiles(t, tt.files...)
+			// Outputs may be absolute while the directories are relative
+			var outputs []string
+			for _, output := range tt.outputs {
+				abs, err := filepath.Abs(output)
+				if err != nil {
+					t.Fatal(err)
+				}
+				outputs = append(outputs, abs)
+			}
+			// A directory listed twice reports its files once
+			got, err := FindOrphans([]string{"posts", "posts", "media"}, outputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, p := range tt.want {
+				want = append(want, filepath.FromSlash(p))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("FindOrphans() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package wptomdx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parsePHPIntArray reads the values of a PHP-serialized array of integers,
+// such as a:2:{i:0;i:12;i:1;i:34;}, the format WordPress stores list options
+// in. Values serialized as numeric strings (s:2:"34";) are accepted too.
+func parsePHPIntArray(raw string) ([]int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	header, body, ok := strings.Cut(raw, ":{")
+	if !ok || !strings.HasPrefix(header, "a:") || !strings.HasSuffix(body, "}") {
+		return nil, fmt.Errorf("not a serialized array: %q", raw)
+	}
+	count, err := strconv.Atoi(strings.TrimPrefix(header, "a:"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid array length in %q", raw)
+	}
+
+	// Keys and values alternate, each ending with ";"
+	var values []int
+	rest := strings.TrimSuffix(body, "}")
+	for n := 0; rest != ""; n++ {
+		var token string
+		token, rest, err = nextPHPScalar(rest)
+		if err != nil {
+			return nil, err
+		}
+		if n%2 == 0 {
+			continue // key
+		}
+		value, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, fmt.Errorf("non-integer value %q in %q", token, raw)
+		}
+		values = append(values, value)
+	}
+	if len(values) != count {
+		return nil, fmt.Errorf("array of %d values has %d", count, len(values))
+	}
+	return values, nil
+}
+
+// nextPHPScalar reads one serialized integer (i:12;) or string (s:2:"ab";)
+// from the start of s and returns its value and what follows it
+func nextPHPScalar(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, "i:"):
+		value, rest, ok := strings.Cut(s[2:], ";")
+		if !ok {
+			return "", "", fmt.Errorf("unterminated integer in %q", s)
+		}
+		return value, rest, nil
+	case strings.HasPrefix(s, "s:"):
+		length, rest, ok := strings.Cut(s[2:], ":")
+		n, err := strconv.Atoi(length)
+		if !ok || err != nil || n < 0 || len(rest) < n+3 || rest[0] != '"' || rest[n+1:n+3] != `";` {
+			return "", "", fmt.Errorf("malformed string in %q", s)
+		}
+		return rest[1 : n+1], rest[n+3:], nil
+	default:
+		return "", "", fmt.Errorf("unsupported value in %q", s)
+	}
+}
@@ -0,0 +1,39 @@
+package wptomdx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePHPIntArray(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []int
+		wantErr bool
+	}{
+		{"empty option", "", nil, false},
+		{"empty array", "a:0:{}", nil, false},
+		{"integers", "a:2:{i:0;i:12;i:1;i:7;}", []int{12, 7}, false},
+		{"strings", `a:2:{i:0;s:2:"12";i:1;s:1:"7";}`, []int{12, 7}, false},
+		{"string keys", `a:1:{s:3:"one";i:5;}`, []int{5}, false},
+		{"surrounding space", " a:1:{i:0;i:3;}\n", []int{3}, false},
+		{"not an array", "i:5;", nil, true},
+		{"wrong length", "a:3:{i:0;i:12;i:1;i:7;}", nil, true},
+		{"non-integer value", `a:1:{i:0;s:3:"abc";}`, nil, true},
+		{"unsupported value", "a:1:{i:0;b:1;}", nil, true},
+		{"malformed string", `a:1:{i:0;s:5:"12";}`, nil, true},
+		{"unterminated integer", "a:1:{i:0;i:12}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePHPIntArray(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePHPIntArray(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parsePHPIntArray(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
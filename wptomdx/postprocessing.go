@@ -0,0 +1,283 @@
+package wptomdx
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PostProcessMarkdownLines rewrites shortcodes and YouTube links left in the
+// converted markdown, resolving gallery images through attachments and
+// relative media URLs against baseURL
+func PostProcessMarkdownLines(markdown string, baseURL string, hosts MediaHosts, attachments AttachmentResolver, shortcodes ShortcodeOptions) (string, []string) {
+	baseURL = NormalizeBaseURL(baseURL)
+	// Compile once
+	audioRe := regexp.MustCompile(`\[audio\s+mp3="([^"]+)"\]\s*\[/audio\]`)
+	videoRe := regexp.MustCompile(`\[video\s+width="(\d+)"\s+height="(\d+)"\s+mp4="([^"]+)"\]\s*\[/video\]`)
+	pdfRe := regexp.MustCompile(`\[pdf\](.*?)\[/pdf\]`)
+	pdfLinkRe := regexp.MustCompile(`^\[[^\]]*\]\(([^)\s]+)\)$`)
+
+	// post-processing for YouTube links...
+	var mediaURLs []string
+	splittedMd := strings.Split(markdown, "\n")
+	for i, line := range splittedMd {
+		line = unescapeHandledShortcodes(strings.TrimSpace(line))
+
+		parts := strings.SplitN(line, " ", 2)
+		link := parts[0]
+		rest := ""
+		if len(parts) > 1 {
+			rest = " " + parts[1]
+		}
+
+		if strings.HasPrefix(link, "https://") {
+			if video := parseYouTubeURL(link); video.ID != "" {
+				splittedMd[i] = youTubeComponent("https://youtu.be/"+video.ID, video) + rest
+			}
+		}
+
+		// gallery shortcode?
+		galleryRe := regexp.MustCompile(`\[gallery\s+.*?ids="[^"]+".*?\]`)
+		if galleryRe.MatchString(line) {
+			ids, err := parseGalleryIDs(line)
+			if err != nil {
+				log.Printf("Warning: error parsing gallery: %s", err)
+				continue
+			}
+
+			dbURLs, _ := attachments.AttachmentURLs(ids)
+
+			splittedMd[i] = ""
+
+			for _, url := range dbURLs {
+				// Strip base URL to make path relative
+				relativePath := relativeURL(url, baseURL, hosts)
+				if shortcodes.MarkdownImages {
+					splittedMd[i] += markdownImage(relativePath, "", "") + "\n\n"
+				} else {
+					splittedMd[i] += fmt.Sprintf("<img src=\"%s\"/>\n\n", relativePath)
+				}
+				mediaURLs = append(mediaURLs, url) // Keep full URL for download
+			}
+		}
+
+		// pdf shortcode? The URL may have been turned into a link
+		if pdfRe.MatchString(line) {
+			splittedMd[i] = pdfRe.ReplaceAllStringFunc(line, func(shortcode string) string {
+				src := strings.TrimSpace(pdfRe.FindStringSubmatch(shortcode)[1])
+				src = markdownEscapeRe.ReplaceAllString(src, "$1")
+				// Links were already made site-relative
+				if m := pdfLinkRe.FindStringSubmatch(src); m != nil {
+					src = m[1]
+					if strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+						src = baseURL + src
+					}
+				}
+				mediaURLs = append(mediaURLs, src) // Keep full URL for download
+
+				relativePath := relativeURL(src, baseURL, hosts)
+				if shortcodes.PDFComponent != "" {
+					return fmt.Sprintf("<%s src=\"%s\" />", shortcodes.PDFComponent, relativePath)
+				}
+				return fmt.Sprintf("[%s](%s)", path.Base(relativePath), relativePath)
+			})
+			continue
+		}
+
+		// audio shortcode?
+		// Only the shortcode is replaced, keeping the text around it
+		if audioRe.MatchString(line) {
+			splittedMd[i] = audioRe.ReplaceAllStringFunc(line, func(shortcode string) string {
+				src := audioRe.FindStringSubmatch(shortcode)[1]
+				// Strip base URL to make path relative
+				relativePath := relativeURL(src, baseURL, hosts)
+				mediaURLs = append(mediaURLs, src) // Keep full URL for download
+				return fmt.Sprintf(
+					`<audio controls>
+    <source src="%s" type="audio/mpeg"/>
+    Your browser does not support the audio element.
+</audio>`, relativePath,
+				)
+			})
+			fmt.Println("processed audio shortcode")
+			continue
+		}
+
+		// video shortcode?
+		if videoRe.MatchString(line) {
+			splittedMd[i] = videoRe.ReplaceAllStringFunc(line, func(shortcode string) string {
+				m := videoRe.FindStringSubmatch(shortcode)
+				width, height, src := m[1], m[2], m[3]
+				// Strip base URL to make path relative
+				relativePath := relativeURL(src, baseURL, hosts)
+				mediaURLs = append(mediaURLs, src) // Keep full URL for download
+				return fmt.Sprintf(
+					`<video controls width="%s" height="%s">
+    <source src="%s" type="video/mp4"/>
+    Your browser does not support the video tag.
+</video>`, width, height, relativePath,
+				)
+			})
+			fmt.Println("processed video shortcode")
+		}
+	}
+	markdown = strings.Join(splittedMd, "\n")
+
+	// Any shortcode still present wasn't handled above and would break the MDX build
+	markdown = ProcessUnknownShortcodes(markdown, shortcodes)
+
+	if strings.Contains(markdown, "<YouTube id=") {
+		markdown = fmt.Sprintf("import { YouTube } from 'astro-embed';\n\n%s", markdown)
+	}
+
+	if strings.Contains(markdown, "<Image") {
+		markdown = fmt.Sprintf("import { Image } from 'astro:assets';\n\n%s", markdown)
+	}
+
+	return markdown, mediaURLs
+}
+
+// handledShortcodeRe matches the tags of the shortcodes PostProcessMarkdownLines
+// converts, as escaped by the markdown converter
+var handledShortcodeRe = regexp.MustCompile(`\\?\[/?(?:gallery|pdf|audio|video)\b[^\]]*?\\?\]`)
+
+// unescapeHandledShortcodes undoes the markdown converter's escapes within the
+// tags of the shortcodes converted here, so brackets the author escaped in the
+// text stay escaped
+func unescapeHandledShortcodes(line string) string {
+	return handledShortcodeRe.ReplaceAllStringFunc(line, func(tag string) string {
+		return markdownEscapeRe.ReplaceAllString(tag, "$1")
+	})
+}
+
+// parseGalleryIDs extracts all numeric IDs from a string like:
+// [gallery columns="1" size="full" ids="3528,3529,3530,…"]
+func parseGalleryIDs(content string) ([]int, error) {
+	re := regexp.MustCompile(`ids="([^"]+)"`)
+	match := re.FindStringSubmatch(content)
+	if len(match) < 2 {
+		return nil, fmt.Errorf("no ids attribute found in gallery shortcode")
+	}
+	parts := strings.Split(match[1], ",")
+	var ids []int
+	for _, p := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", p, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// youTubeComponentRe matches the <YouTube id="..." /> components emitted by
+// the converter, which may carry player params
+var youTubeComponentRe = regexp.MustCompile(`<YouTube id="([^"]+)"(?: params="([^"]*)")? />`)
+
+// mdxImportRe matches the import statements added for MDX components
+var mdxImportRe = regexp.MustCompile(`(?m)^import .* from '[^']+';\n*`)
+
+// mdxCommentRe matches MDX comments such as {/* shortcode: ... */}
+var mdxCommentRe = regexp.MustCompile(`\{/\*(.*?)\*/\}`)
+
+// DegradeToMarkdown turns the MDX-only parts of the output into plain markdown:
+// import statements are dropped, YouTube components become links and MDX
+// comments become HTML comments
+func DegradeToMarkdown(markdown string) string {
+	markdown = mdxImportRe.ReplaceAllString(markdown, "")
+
+	markdown = youTubeComponentRe.ReplaceAllStringFunc(markdown, func(component string) string {
+		match := youTubeComponentRe.FindStringSubmatch(component)
+		id, params := match[1], match[2]
+		link := id
+		if !strings.HasPrefix(id, "http") {
+			link = "https://youtu.be/" + id
+		}
+		// Links take the start time as t
+		if params != "" {
+			params = strings.Replace(params, "start=", "t=", 1)
+			if strings.Contains(link, "?") {
+				link += "&" + params
+			} else {
+				link += "?" + params
+			}
+		}
+		return fmt.Sprintf("[Watch on YouTube](%s)", link)
+	})
+
+	return mdxCommentRe.ReplaceAllString(markdown, "<!--$1-->")
+}
+
+// EscapeMDXBraces escapes the literal braces of the text, which MDX would
+// otherwise evaluate as JavaScript expressions. Code blocks, code spans,
+// import lines, MDX comments and the attributes of tags are left alone.
+func EscapeMDXBraces(markdown string) string {
+	return mapOutsideCodeFences(markdown, func(chunk string) string {
+		lines := strings.SplitAfter(chunk, "\n")
+		for n, line := range lines {
+			if !strings.ContainsAny(line, "{}") || strings.HasPrefix(line, "import ") {
+				continue
+			}
+			lines[n] = escapeLineBraces(line)
+		}
+		return strings.Join(lines, "")
+	})
+}
+
+// escapeLineBraces escapes the braces of a single line of text
+func escapeLineBraces(line string) string {
+	runes := []rune(line)
+	var out strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			out.WriteRune(r)
+			i++
+			out.WriteRune(runes[i])
+		case r == '`':
+			end := skipCodeSpan(runes, i)
+			out.WriteString(string(runes[i : end+1]))
+			i = end
+		case r == '<' && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '/'):
+			end := tagEnd(runes, i)
+			out.WriteString(string(runes[i : end+1]))
+			i = end
+		case r == '{' && strings.HasPrefix(string(runes[i:]), "{/*") && strings.Contains(string(runes[i:]), "*/}"):
+			comment := string(runes[i:])
+			comment = comment[:strings.Index(comment, "*/}")+3]
+			out.WriteString(comment)
+			i += len([]rune(comment)) - 1
+		case r == '{' || r == '}':
+			out.WriteRune('\\')
+			out.WriteRune(r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// tagEnd returns the index of the ">" closing the tag that starts at i,
+// skipping quoted attribute values, or the last index when it isn't closed
+// on this line
+func tagEnd(runes []rune, i int) int {
+	var quote rune
+	for j := i + 1; j < len(runes); j++ {
+		switch {
+		case quote != 0:
+			if runes[j] == quote {
+				quote = 0
+			}
+		case runes[j] == '"' || runes[j] == '\'':
+			quote = runes[j]
+		case runes[j] == '>':
+			return j
+		}
+	}
+	return len(runes) - 1
+}
@@ -0,0 +1,167 @@
+package wptomdx
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDegradeToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"import dropped", "import { YouTube } from 'astro-embed';\n\nText", "Text"},
+		{"youtube id", `<YouTube id="abc123" />`, "[Watch on YouTube](https://youtu.be/abc123)"},
+		{"youtube url with start", `<YouTube id="https://youtu.be/abc123" params="start=30" />`, "[Watch on YouTube](https://youtu.be/abc123?t=30)"},
+		{"youtube url with query", `<YouTube id="https://youtu.be/abc123?si=x" params="start=30" />`, "[Watch on YouTube](https://youtu.be/abc123?si=x&t=30)"},
+		{"mdx comment", `{/* shortcode: [x] */}`, "<!-- shortcode: [x] -->"},
+		{"plain text", "Nothing {here}", "Nothing {here}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DegradeToMarkdown(tt.in); got != tt.want {
+				t.Errorf("DegradeToMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// jsxComponentRe matches the opening tag of a JSX component, which starts
+// with a capital letter unlike HTML tags
+var jsxComponentRe = regexp.MustCompile(`<[A-Z]\w*[\s/>]`)
+
+func TestProcessContentMarkdownOutput(t *testing.T) {
+	content := `<p>Intro {x}</p>` +
+		`<iframe src="https://www.youtube.com/embed/abc123?start=30"></iframe>` +
+		`<p>[youtube]https://www.youtube.com/watch?v=def456[/youtube]</p>` +
+		`<p>[unknown_code foo="1"]</p>`
+	tests := []struct {
+		extension string
+		wantFile  string
+		wantMDX   bool
+	}{
+		{"mdx", "video.mdx", true},
+		{".md", "video.md", false},
+		{"md", "video.md", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.extension, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.OutputExtension = tt.extension })
+			entries := c.ProcessContent([]Post{testPost(1, "video", content)}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if want := filepath.Join(c.Config.PostsOutputDir, tt.wantFile); entries[0].MDXPath != want {
+				t.Errorf("written to %q, want %q", entries[0].MDXPath, want)
+			}
+			data, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := string(data)
+
+			hasMDX := strings.Contains(out, "\nimport ") || jsxComponentRe.MatchString(out) || strings.Contains(out, "{/*")
+			if hasMDX != tt.wantMDX {
+				t.Errorf("output has imports, components or MDX comments = %v, want %v:\n%s", hasMDX, tt.wantMDX, out)
+			}
+			if !tt.wantMDX {
+				for _, want := range []string{"[Watch on YouTube](https://youtu.be/abc123?t=30)", "https://youtu.be/def456", "Intro {x}"} {
+					if !strings.Contains(out, want) {
+						t.Errorf("output does not contain %q:\n%s", want, out)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeMDXBraces(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"prose", "Use {name} in the template", `Use \{name\} in the template`},
+		{"already escaped", `Use \{name\}`, `Use \{name\}`},
+		{"inline code", "Use `{name}` or ``{{ x }}``", "Use `{name}` or ``{{ x }}``"},
+		{"unclosed code span", "a ` {b}", "a ` \\{b\\}"},
+		{"fenced code", "Text {a}\n\n```go\nfunc f() {}\n```\n\n{b}", "Text \\{a\\}\n\n```go\nfunc f() {}\n```\n\n\\{b\\}"},
+		{"component", `<YouTube id="{abc}" params="start=30" /> {x}`, `<YouTube id="{abc}" params="start=30" /> \{x\}`},
+		{"mdx comment", "{/* shortcode: [x] */} {y}", `{/* shortcode: [x] */} \{y\}`},
+		{"import line", "import { YouTube } from 'astro-embed';\n\n{z}", "import { YouTube } from 'astro-embed';\n\n\\{z\\}"},
+		{"bare less-than", "1 < 2 {x}", `1 < 2 \{x\}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EscapeMDXBraces(tt.in)
+			if got != tt.want {
+				t.Errorf("EscapeMDXBraces(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			for _, issue := range ValidateMDX(got) {
+				if strings.Contains(issue.Message, `"{"`) {
+					t.Errorf("escaped output still has an expression: %s", issue)
+				}
+			}
+		})
+	}
+}
+
+func TestUnescapeHandledShortcodes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"gallery", `\[gallery ids="1,2" link\_to="file"\]`, `[gallery ids="1,2" link_to="file"]`},
+		{"pdf", `\[pdf\]https://example.com/a\_b.pdf\[/pdf\]`, `[pdf]https://example.com/a\_b.pdf[/pdf]`},
+		{"audio", `\[audio mp3="/a.mp3"\]\[/audio\]`, `[audio mp3="/a.mp3"][/audio]`},
+		{"escaped prose", `See \[1\] and a\_b`, `See \[1\] and a\_b`},
+		{"other shortcode", `\[note\]x\[/note\]`, `\[note\]x\[/note\]`},
+		{"prefix of a name", `\[galleryx\]`, `\[galleryx\]`},
+		{"both", `\[sic\] \[video width="1" height="2" mp4="/v.mp4"\]\[/video\]`, `\[sic\] [video width="1" height="2" mp4="/v.mp4"][/video]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unescapeHandledShortcodes(tt.in); got != tt.want {
+				t.Errorf("unescapeHandledShortcodes(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertContentEscapedBrackets(t *testing.T) {
+	c := NewConverter(Config{BaseURL: testBaseURL})
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"brackets in prose", `<p>Array access: a[0] and [sic]</p>`, `Array access: a\[0\] and \[sic\]`},
+		{"brackets the author escaped", `<p>Type \[not a link\]</p>`, `Type \\\[not a link\\\]`},
+		{
+			name: "shortcode next to bracketed prose",
+			in:   `<p>[sic] [audio mp3="https://example.com/wp-content/uploads/a.mp3"][/audio]</p>`,
+			want: "\\[sic\\] <audio controls>\n    <source src=\"/wp-content/uploads/a.mp3\" type=\"audio/mpeg\"/>\n    Your browser does not support the audio element.\n</audio>",
+		},
+		{
+			name: "video between text",
+			in:   `<p>Before [video width="640" height="360" mp4="https://example.com/wp-content/uploads/v.mp4"][/video] after [1]</p>`,
+			want: "Before <video controls width=\"640\" height=\"360\">\n    <source src=\"/wp-content/uploads/v.mp4\" type=\"video/mp4\"/>\n    Your browser does not support the video tag.\n</video> after \\[1\\]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := c.ConvertContent(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ConvertContent(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
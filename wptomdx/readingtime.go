@@ -0,0 +1,57 @@
+package wptomdx
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// defaultReadingWPM is the reading speed assumed when none is configured
+const defaultReadingWPM = 200
+
+// markupTagRe matches HTML and JSX tags
+var markupTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// markdownLinkRe matches markdown links and images, capturing their text
+var markdownLinkRe = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+
+// CountWords counts the words of the text in converted markdown, leaving out
+// fenced code blocks, MDX imports and comments, tags and link targets
+func CountWords(markdown string) int {
+	var text strings.Builder
+	inFence := false
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || strings.HasPrefix(trimmed, "import ") {
+			continue
+		}
+		text.WriteString(line)
+		text.WriteString("\n")
+	}
+
+	plain := mdxCommentRe.ReplaceAllString(text.String(), " ")
+	plain = markupTagRe.ReplaceAllString(plain, " ")
+	plain = markdownLinkRe.ReplaceAllString(plain, "$1")
+
+	// Only count tokens holding a letter or digit, not list markers or rules
+	count := 0
+	for _, field := range strings.Fields(plain) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// ReadingTime returns the minutes needed to read words at wpm words per
+// minute, rounded up. Any non-empty text takes at least a minute.
+func ReadingTime(words int, wpm int) int {
+	if wpm <= 0 {
+		wpm = defaultReadingWPM
+	}
+	return (words + wpm - 1) / wpm
+}
@@ -0,0 +1,78 @@
+package wptomdx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     int
+	}{
+		{"empty", "", 0},
+		{"plain", "One two three.", 3},
+		{"markdown", "## A heading\n\n- **bold** _item_\n- [a link](https://example.com/x)\n\n---", 6},
+		{"code block", "Before\n\n```go\nfunc main() { fmt.Println(\"not counted\") }\n```\n\nAfter", 2},
+		{"imports and components", "import { YouTube } from 'astro-embed';\n\n<YouTube id=\"abc\" />\n\nWatch it", 2},
+		{"mdx comment", "{/* shortcode: [gallery ids=\"1\"] */}\n\nText", 1},
+		{"image alt", `![Team photo](/a.jpg) <img src="/b.jpg" alt="Ignored" />`, 2},
+		{"unicode", "Café naïve 日本語", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountWords(tt.markdown); got != tt.want {
+				t.Errorf("CountWords(%q) = %d, want %d", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := []struct {
+		words, wpm, want int
+	}{
+		{0, 200, 0},
+		{1, 200, 1},
+		{200, 200, 1},
+		{201, 200, 2},
+		{450, 0, 3},
+		{450, 150, 3},
+	}
+	for _, tt := range tests {
+		if got := ReadingTime(tt.words, tt.wpm); got != tt.want {
+			t.Errorf("ReadingTime(%d, %d) = %d, want %d", tt.words, tt.wpm, got, tt.want)
+		}
+	}
+}
+
+func TestProcessContentReadingTime(t *testing.T) {
+	// 450 words of text and a code block that isn't counted
+	content := "<p>" + strings.Repeat("word ", 450) + "</p><pre><code>" + strings.Repeat("code ", 100) + "</code></pre>"
+	tests := []struct {
+		name      string
+		configure func(cfg *Config)
+		wantWords string
+		wantTime  string
+	}{
+		{"off", nil, "", ""},
+		{"default speed", func(cfg *Config) { cfg.ReadingTime = true }, "450", "3"},
+		{"configured speed", func(cfg *Config) { cfg.ReadingTime, cfg.ReadingWPM = true, 100 }, "450", "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, tt.configure)
+			entries := c.ProcessContent([]Post{testPost(1, "long-read", content)}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "wordCount"); got != tt.wantWords {
+				t.Errorf("wordCount = %q, want %q", got, tt.wantWords)
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "readingTime"); got != tt.wantTime {
+				t.Errorf("readingTime = %q, want %q", got, tt.wantTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package wptomdx
+
+import (
+	"net/http"
+	"sync"
+)
+
+// maxRedirectRequests caps how many redirect lookups run at the same time
+// across all conversion workers
+const maxRedirectRequests = 4
+
+// RedirectResolver follows redirects to find the final URL of a link. Results
+// are cached by URL and at most a fixed number of requests are in flight.
+type RedirectResolver struct {
+	client *http.Client
+	sem    chan struct{}
+
+	mu    sync.Mutex
+	cache map[string]*redirectEntry
+}
+
+// redirectEntry is the cached result for one URL, filled in by the first lookup
+type redirectEntry struct {
+	once     sync.Once
+	finalURL string
+}
+
+// NewRedirectResolver returns a resolver issuing at most maxConcurrent requests
+// through client at once; a nil client uses http.DefaultClient
+func NewRedirectResolver(client *http.Client, maxConcurrent int) *RedirectResolver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &RedirectResolver{
+		client: client,
+		sem:    make(chan struct{}, max(maxConcurrent, 1)),
+		cache:  make(map[string]*redirectEntry),
+	}
+}
+
+// Resolve returns the URL href ends up at, or href itself when the request fails
+func (r *RedirectResolver) Resolve(href string) string {
+	r.mu.Lock()
+	entry, ok := r.cache[href]
+	if !ok {
+		entry = &redirectEntry{}
+		r.cache[href] = entry
+	}
+	r.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.finalURL = href
+
+		r.sem <- struct{}{}
+		defer func() { <-r.sem }()
+
+		resp, err := r.client.Get(href)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		entry.finalURL = resp.Request.URL.String()
+	})
+	return entry.finalURL
+}
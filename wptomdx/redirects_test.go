@@ -0,0 +1,223 @@
+package wptomdx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedirectResolverCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old/" {
+			requests.Add(1)
+			http.Redirect(w, r, "/new/", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewRedirectResolver(server.Client(), 4)
+	var wg sync.WaitGroup
+	results := make([]string, 20)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = resolver.Resolve(server.URL + "/old/")
+		}()
+	}
+	wg.Wait()
+
+	for _, got := range results {
+		if got != server.URL+"/new/" {
+			t.Errorf("Resolve() = %q, want %q", got, server.URL+"/new/")
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("sent %d requests for the same link, want 1", got)
+	}
+}
+
+func TestRedirectResolverConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	resolver := NewRedirectResolver(server.Client(), 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resolver.Resolve(fmt.Sprintf("%s/post-%d/", server.URL, i))
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 2 {
+		t.Errorf("%d requests in flight at once, want at most 2", got)
+	}
+}
+
+func TestRedirectResolverFailure(t *testing.T) {
+	resolver := NewRedirectResolver(&http.Client{}, 1)
+	const href = "http://127.0.0.1:0/unreachable/"
+	if got := resolver.Resolve(href); got != href {
+		t.Errorf("Resolve() of an unreachable link = %q, want it unchanged", got)
+	}
+}
+
+func TestConvertFollowLinkRedirects(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/archives/330" {
+			http.Redirect(w, r, "/2024/03/redirected-post/", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		follow       bool
+		want         string
+		wantRequests int32
+	}{
+		{"off", false, "[Old link](/archives/330)", 0},
+		{"on", true, "[Old link](/2024/03/redirected-post/)", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			// The second conversion of the link is answered from the cache
+			opts := ConvertOptions{FollowLinkRedirects: tt.follow, LinkRedirects: NewRedirectResolver(server.Client(), 1)}
+			in := `<p><a href="` + server.URL + `/archives/330">Old link</a></p>`
+			for i := 0; i < 2; i++ {
+				got, _, err := ConvertHTMLToMarkdown(in, server.URL, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("ConvertHTMLToMarkdown() = %q, want %q", got, tt.want)
+				}
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("sent %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestConvertFollowLinkRedirectsFragments(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/archives/340" {
+			http.Redirect(w, r, "/2024/03/moved-post/", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		href          string
+		want          string
+		wantRequested []string
+	}{
+		// In-page anchors are never looked up
+		{"section", "#Getting_Started", "[Link](#getting-started)", nil},
+		{"top of page", "#", "[Link](#)", nil},
+		{"post section", server.URL + "/archives/340#part-2", "[Link](/2024/03/moved-post/#part-2)", []string{"/archives/340", "/2024/03/moved-post/"}},
+		{"relative post section", "/archives/341#part-2", "[Link](/archives/341#part-2)", []string{"/archives/341"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			requested = nil
+			mu.Unlock()
+			in := `<h2 id="Getting_Started">Getting Started</h2><p><a href="` + tt.href + `">Link</a></p>`
+			got, _, err := ConvertHTMLToMarkdown(in, server.URL, ConvertOptions{FollowLinkRedirects: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "## Getting Started\n\n" + tt.want; got != want {
+				t.Errorf("ConvertHTMLToMarkdown() = %q, want %q", got, want)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if fmt.Sprint(requested) != fmt.Sprint(tt.wantRequested) {
+				t.Errorf("requested %q, want %q", requested, tt.wantRequested)
+			}
+		})
+	}
+}
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestConverterLinkRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/archives/330" {
+			http.Redirect(w, r, "/2024/03/redirected-post/", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		follow       bool
+		want         string
+		wantRequests int32
+	}{
+		{"off", false, "[Old link](/archives/330)", 0},
+		// Both conversions share the converter's resolver
+		{"on", true, "[Old link](/2024/03/redirected-post/)", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) {
+				cfg.BaseURL = server.URL
+				cfg.Convert.FollowLinkRedirects = tt.follow
+			})
+			transport := &countingTransport{}
+			c.Downloader.Client = &http.Client{Transport: transport}
+			in := `<p><a href="` + server.URL + `/archives/330">Old link</a></p>`
+			for i := 0; i < 2; i++ {
+				got, _, err := c.ConvertContent(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("ConvertContent() = %q, want %q", got, tt.want)
+				}
+			}
+			if got := transport.requests.Load(); got != tt.wantRequests {
+				t.Errorf("sent %d requests through the downloader's client, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package wptomdx
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SeriesOptions names the post meta keys a series plugin keeps a post's
+// series and its position in it under
+type SeriesOptions struct {
+	// MetaKey holds the series name; series are off when it is empty
+	MetaKey string `yaml:"meta_key"`
+	// OrderMetaKey holds the post's position in the series. Without it,
+	// posts are numbered by publish date.
+	OrderMetaKey string `yaml:"order_meta_key"`
+}
+
+// MetaKeys returns the post meta keys the series are read from
+func (s SeriesOptions) MetaKeys() []string {
+	var keys []string
+	for _, key := range []string{s.MetaKey, s.OrderMetaKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Read sets the series of a post and, when it is recorded, its order
+func (s SeriesOptions) Read(post *Post) {
+	if s.MetaKey == "" || post.PostType != "post" {
+		return
+	}
+	post.Series = strings.TrimSpace(post.Meta[s.MetaKey])
+	if post.Series == "" || s.OrderMetaKey == "" {
+		return
+	}
+	if order, err := strconv.Atoi(strings.TrimSpace(post.Meta[s.OrderMetaKey])); err == nil && order > 0 {
+		post.SeriesOrder = order
+	}
+}
+
+// Apply reads the series of every post. When there is no order meta key, the
+// posts of each series are numbered from 1 by publish date.
+func (s SeriesOptions) Apply(posts []Post) {
+	members := make(map[string][]*Post)
+	for i := range posts {
+		s.Read(&posts[i])
+		if posts[i].Series != "" {
+			members[posts[i].Series] = append(members[posts[i].Series], &posts[i])
+		}
+	}
+	if s.OrderMetaKey != "" {
+		return
+	}
+	for _, series := range members {
+		// WordPress dates ("2006-01-02 15:04:05") sort as strings
+		sort.SliceStable(series, func(i, j int) bool {
+			return series[i].PublishedDate < series[j].PublishedDate
+		})
+		for n, post := range series {
+			post.SeriesOrder = n + 1
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package wptomdx
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSeriesApply(t *testing.T) {
+	posts := func() []Post {
+		return []Post{
+			{ID: 1, PostType: "post", PublishedDate: "2024-03-10 10:00:00", Meta: map[string]string{"series": "Go basics", "part": "2"}},
+			{ID: 2, PostType: "post", PublishedDate: "2024-03-01 10:00:00", Meta: map[string]string{"series": " Go basics ", "part": "1"}},
+			{ID: 3, PostType: "post", PublishedDate: "2024-03-05 10:00:00", Meta: map[string]string{"series": "SQL", "part": "first"}},
+			{ID: 4, PostType: "post", PublishedDate: "2024-03-02 10:00:00", Meta: map[string]string{"part": "3"}},
+			{ID: 5, PostType: "page", PublishedDate: "2024-03-02 10:00:00", Meta: map[string]string{"series": "Go basics", "part": "3"}},
+		}
+	}
+	type series struct {
+		Name  string
+		Order int
+	}
+	tests := []struct {
+		name string
+		opts SeriesOptions
+		want []series
+	}{
+		{
+			name: "off",
+			opts: SeriesOptions{},
+			want: []series{{}, {}, {}, {}, {}},
+		},
+		{
+			name: "order meta key",
+			opts: SeriesOptions{MetaKey: "series", OrderMetaKey: "part"},
+			want: []series{{"Go basics", 2}, {"Go basics", 1}, {"SQL", 0}, {}, {}},
+		},
+		{
+			name: "numbered by date",
+			opts: SeriesOptions{MetaKey: "series"},
+			want: []series{{"Go basics", 2}, {"Go basics", 1}, {"SQL", 1}, {}, {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := posts()
+			tt.opts.Apply(items)
+			var got []series
+			for _, post := range items {
+				got = append(got, series{post.Series, post.SeriesOrder})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("series = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeriesMetaKeys(t *testing.T) {
+	tests := []struct {
+		opts SeriesOptions
+		want []string
+	}{
+		{SeriesOptions{}, nil},
+		{SeriesOptions{MetaKey: "series"}, []string{"series"}},
+		{SeriesOptions{MetaKey: "series", OrderMetaKey: "part"}, []string{"series", "part"}},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.MetaKeys(); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v.MetaKeys() = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestProcessContentSeries(t *testing.T) {
+	tests := []struct {
+		name      string
+		series    string
+		order     int
+		wantOrder string
+	}{
+		{"ordered", "Go basics", 2, "2"},
+		{"unordered", "Go basics", 0, ""},
+		{"no series", "", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, nil)
+			post := testPost(1, "part", "<p>Text</p>")
+			post.Series, post.SeriesOrder = tt.series, tt.order
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "series"); got != tt.series {
+				t.Errorf("series = %q, want %q", got, tt.series)
+			}
+			if got := frontmatterValue(t, entries[0].MDXPath, "seriesOrder"); got != tt.wantOrder {
+				t.Errorf("seriesOrder = %q, want %q", got, tt.wantOrder)
+			}
+		})
+	}
+}
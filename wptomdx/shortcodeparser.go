@@ -0,0 +1,135 @@
+package wptomdx
+
+import (
+	"regexp"
+	"strings"
+)
+
+// shortcodeTagRe matches an opening, self-closing or closing shortcode tag.
+// The converter escapes brackets and underscores, so they may be preceded by
+// a backslash. The groups are the closing slash, the name, the attributes and
+// the self-closing slash.
+var shortcodeTagRe = regexp.MustCompile(`\\?\[(/?)([A-Za-z](?:[\w-]|\\_)*)((?:\s[^\]]*?)?)\s*(/?)\\?\]`)
+
+// shortcodeNode is a node of a parsed shortcode tree: either plain text or a
+// shortcode with its attributes and, when it is enclosing, its children
+type shortcodeNode struct {
+	// Text is the source of a text node; Name is empty for text nodes
+	Text string
+	Name string
+	// Tag is the opening tag as written, without the converter's escapes,
+	// and Raw is its exact source
+	Tag   string
+	Raw   string
+	Attrs []shortcodeAttr
+	// Enclosing is set when the shortcode has a closing tag; Children is
+	// what lies between the tags
+	Enclosing bool
+	Children  []*shortcodeNode
+}
+
+// parseShortcodes parses text into a tree of text and shortcode nodes.
+// Shortcodes may nest, also within shortcodes of the same name. A closing tag
+// closes the innermost open shortcode of its name; the shortcodes opened
+// inside it that weren't closed become self-closing, with what followed them
+// moved up next to them. Closing tags that match nothing, "[text](url)"
+// markdown links and shortcodes escaped as [[name]] are kept as text.
+func parseShortcodes(text string) []*shortcodeNode {
+	root := &shortcodeNode{}
+	stack := []*shortcodeNode{root}
+	addText := func(s string) {
+		if s == "" {
+			return
+		}
+		parent := stack[len(stack)-1]
+		if n := len(parent.Children); n > 0 && parent.Children[n-1].Name == "" {
+			parent.Children[n-1].Text += s
+			return
+		}
+		parent.Children = append(parent.Children, &shortcodeNode{Text: s})
+	}
+
+	cursor := 0
+	for _, loc := range shortcodeTagRe.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start < cursor {
+			continue
+		}
+		raw := text[start:end]
+		closing := loc[3] > loc[2]
+		name := strings.ReplaceAll(text[loc[4]:loc[5]], `\_`, "_")
+		selfClosing := loc[9] > loc[8]
+
+		// WordPress shows [[name]] and [[name]...[/name]] as written, less
+		// the outer brackets
+		before := text[cursor:start]
+		opensEscape := !closing && (strings.HasSuffix(before, `\[`) || strings.HasSuffix(before, "["))
+		closesEscape := strings.HasPrefix(text[end:], `\]`) || strings.HasPrefix(text[end:], "]")
+		if opensEscape {
+			before = strings.TrimSuffix(strings.TrimSuffix(before, "["), `\`)
+		}
+		addText(before)
+		cursor = end
+
+		switch {
+		case opensEscape || (closing && closesEscape && !isOpen(stack, name)):
+			addText(raw)
+			if closesEscape {
+				cursor += strings.Index(text[end:], "]") + 1
+			}
+		case end < len(text) && text[end] == '(':
+			addText(raw)
+		case closing:
+			k := len(stack) - 1
+			for k > 0 && stack[k].Name != name {
+				k--
+			}
+			if k == 0 {
+				addText(raw)
+				continue
+			}
+			for j := len(stack) - 1; j > k; j-- {
+				flattenUnclosed(stack[j-1], stack[j])
+			}
+			stack[k].Enclosing = true
+			stack = stack[:k]
+		default:
+			tag := markdownEscapeRe.ReplaceAllString(strings.TrimPrefix(raw, `\`), "$1")
+			node := &shortcodeNode{
+				Name:  name,
+				Tag:   tag,
+				Raw:   raw,
+				Attrs: parseShortcodeAttrs(strings.TrimSpace(text[loc[6]:loc[7]])),
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+			if !selfClosing {
+				stack = append(stack, node)
+			}
+		}
+	}
+	addText(text[cursor:])
+
+	// Shortcodes still open at the end have no closing tag
+	for j := len(stack) - 1; j > 0; j-- {
+		flattenUnclosed(stack[j-1], stack[j])
+	}
+	return root.Children
+}
+
+// isOpen reports whether a shortcode named name is open on the stack
+func isOpen(stack []*shortcodeNode, name string) bool {
+	for _, node := range stack[1:] {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenUnclosed turns node, the last child of parent, into a self-closing
+// shortcode by moving its children up after it
+func flattenUnclosed(parent *shortcodeNode, node *shortcodeNode) {
+	parent.Children = append(parent.Children, node.Children...)
+	node.Children = nil
+}
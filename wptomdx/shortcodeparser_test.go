@@ -0,0 +1,83 @@
+package wptomdx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describeShortcodes renders a parsed tree compactly: text nodes quoted,
+// shortcodes as name(attrs), followed by {children} when enclosing
+func describeShortcodes(nodes []*shortcodeNode) string {
+	var parts []string
+	for _, node := range nodes {
+		if node.Name == "" {
+			parts = append(parts, fmt.Sprintf("%q", node.Text))
+			continue
+		}
+		var attrs []string
+		for _, attr := range node.Attrs {
+			attrs = append(attrs, attr.Key+"="+attr.Value)
+		}
+		part := node.Name + "(" + strings.Join(attrs, " ") + ")"
+		if node.Enclosing {
+			part += "{" + describeShortcodes(node.Children) + "}"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseShortcodes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "Just text", `"Just text"`},
+		{"self-closing", `a [gallery ids="1,2" size='large' link=file] b`, `"a " gallery(ids=1,2 size=large link=file) " b"`},
+		{"explicit self-closing", `[br /]`, `br()`},
+		{"enclosing", `[note type="tip"]Hi[/note]`, `note(type=tip){"Hi"}`},
+		{
+			name: "nested",
+			in:   `[su_tabs][su_tab title="One"]1[/su_tab][su_tab title="Two"]2[/su_tab][/su_tabs]`,
+			want: `su_tabs(){su_tab(title=One){"1"} su_tab(title=Two){"2"}}`,
+		},
+		{"nested same name", `[div][div]x[/div]y[/div]`, `div(){div(){"x"} "y"}`},
+		{"unclosed inside enclosing", `[outer][image id=1]x[/outer]`, `outer(){image(id=1) "x"}`},
+		{"unclosed at the end", `[a]x`, `a() "x"`},
+		{"unmatched closing tag", `x[/b]y`, `"x[/b]y"`},
+		{"markdown link", `[text](https://example.com) [x]`, `"[text](https://example.com) " x()`},
+		{"entities and query strings", `[button label="Go &gt;" url="/a?b=1&c=2"]`, `button(label=Go &gt; url=/a?b=1&c=2)`},
+		{"hyphenated name", `[contact-form-7 id="5" title="Contact us"]`, `contact-form-7(id=5 title=Contact us)`},
+		{"escaped self-closing", `Use [[gallery ids="1"]] here`, `"Use [gallery ids=\"1\"] here"`},
+		{"escaped enclosing", `[[note]x[/note]]`, `"[note]x[/note]"`},
+		{"escaped next to a shortcode", `[[br]] [note]x[/note]`, `"[br] " note(){"x"}`},
+		{"converter-escaped double brackets", `\[\[su\_note\]\]`, `"\\[su\\_note\\]"`},
+		{
+			name: "escaped by the converter",
+			in:   `\[su\_note note\_color="red"\]Hi\[/su\_note\]`,
+			want: `su_note(note_color=red){"Hi"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeShortcodes(parseShortcodes(tt.in)); got != tt.want {
+				t.Errorf("parseShortcodes(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseShortcodesTag(t *testing.T) {
+	nodes := parseShortcodes(`\[su\_box title="A \*b\*"\]x\[/su\_box\]`)
+	if len(nodes) != 1 {
+		t.Fatalf("parseShortcodes() returned %d nodes, want 1", len(nodes))
+	}
+	if want := `[su_box title="A *b*"]`; nodes[0].Tag != want {
+		t.Errorf("Tag = %q, want %q", nodes[0].Tag, want)
+	}
+	if want := `\[su\_box title="A \*b\*"\]`; nodes[0].Raw != want {
+		t.Errorf("Raw = %q, want %q", nodes[0].Raw, want)
+	}
+}
@@ -0,0 +1,214 @@
+package wptomdx
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// shortcodeAttrRe matches a single key="value", key='value' or key=value attribute
+var shortcodeAttrRe = regexp.MustCompile(`([A-Za-z_][\w-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"']+))`)
+
+// markdownEscapeRe matches backslash escapes added by the markdown converter
+var markdownEscapeRe = regexp.MustCompile("\\\\([!-/:-@\\[-`{-~])")
+
+// shortcodeAttr is a single attribute of a shortcode, in source order
+type shortcodeAttr struct {
+	Key   string
+	Value string
+}
+
+// ShortcodeOptions controls how shortcodes without a dedicated handler are rewritten
+type ShortcodeOptions struct {
+	// Components maps shortcode names to MDX components
+	Components map[string]string `yaml:"components"`
+	// Strip removes unknown shortcodes instead of wrapping them in comments
+	Strip bool `yaml:"strip_unknown"`
+	// PDFComponent renders [pdf]url[/pdf] as <PdfViewer src="..." />; when
+	// empty it becomes a link to the document
+	PDFComponent string `yaml:"pdf_component"`
+	// MarkdownImages emits gallery images as ![](src) instead of <img>
+	MarkdownImages bool `yaml:"-"`
+	// Ultimate converts the [su_*] shortcodes of the Shortcodes Ultimate
+	// plugin to the components in UltimateComponents, which Components
+	// override, and removes the unmapped ones keeping their content
+	Ultimate           bool              `yaml:"ultimate"`
+	UltimateComponents map[string]string `yaml:"ultimate_components"`
+}
+
+// DefaultUltimateComponents returns the components the common Shortcodes
+// Ultimate shortcodes become
+func DefaultUltimateComponents() map[string]string {
+	return map[string]string{
+		"su_note":      "Note",
+		"su_box":       "Box",
+		"su_tabs":      "Tabs",
+		"su_tab":       "Tab",
+		"su_accordion": "Accordion",
+		"su_spoiler":   "Spoiler",
+		"su_quote":     "Quote",
+		"su_button":    "Button",
+	}
+}
+
+// ProcessUnknownShortcodes rewrites every shortcode still left in the markdown
+// after the dedicated handlers ran. Shortcodes listed in opts.Components
+// become MDX components. All others are wrapped in MDX comments, or removed
+// when opts.Strip is set, so they don't end up as literal text in the output.
+// The content enclosed by a shortcode is kept in both cases.
+func ProcessUnknownShortcodes(markdown string, opts ShortcodeOptions) string {
+	components, stripPrefix := opts.Components, ""
+	if opts.Ultimate {
+		components = make(map[string]string)
+		for _, mapping := range []map[string]string{opts.UltimateComponents, opts.Components} {
+			for name, component := range mapping {
+				components[name] = component
+			}
+		}
+		stripPrefix = "su_"
+	}
+	return mapOutsideCodeFences(markdown, func(text string) string {
+		return rewriteShortcodes(text, components, opts.Strip, stripPrefix)
+	})
+}
+
+// rewriteShortcodes replaces every shortcode in text, recursing into enclosed
+// content. Unmapped shortcodes whose name starts with stripPrefix are removed
+// even when strip isn't set.
+func rewriteShortcodes(text string, components map[string]string, strip bool, stripPrefix string) string {
+	return renderShortcodeTree(parseShortcodes(text), components, strip, stripPrefix)
+}
+
+// renderShortcodeTree renders parsed shortcode nodes, see rewriteShortcodes
+func renderShortcodeTree(nodes []*shortcodeNode, components map[string]string, strip bool, stripPrefix string) string {
+	var out strings.Builder
+	for _, node := range nodes {
+		if node.Name == "" {
+			out.WriteString(node.Text)
+			continue
+		}
+
+		// Bracketed text without key=value attributes or a closing tag is most
+		// likely prose, unless it is a shortcode known by name
+		_, mapped := components[node.Name]
+		prefixed := stripPrefix != "" && strings.HasPrefix(node.Name, stripPrefix)
+		if len(node.Attrs) == 0 && !node.Enclosing && !mapped && !prefixed {
+			out.WriteString(node.Raw)
+			continue
+		}
+
+		inner := renderShortcodeTree(node.Children, components, strip, stripPrefix)
+		out.WriteString(renderShortcode(node.Name, node.Attrs, node.Tag, inner, node.Enclosing, components, strip || prefixed))
+	}
+	return out.String()
+}
+
+// renderShortcode emits the replacement for a single shortcode
+func renderShortcode(name string, attrs []shortcodeAttr, tag string, inner string, enclosing bool, components map[string]string, strip bool) string {
+	if component, ok := components[name]; ok {
+		props := renderJSXProps(attrs)
+		if !enclosing {
+			return fmt.Sprintf("<%s%s />", component, props)
+		}
+		return fmt.Sprintf("<%s%s>%s</%s>", component, props, inner, component)
+	}
+
+	if strip {
+		return inner
+	}
+
+	comment := fmt.Sprintf("{/* shortcode: %s */}", sanitizeMDXComment(tag))
+	if !enclosing {
+		return comment
+	}
+	return fmt.Sprintf("%s%s{/* /shortcode: %s */}", comment, inner, name)
+}
+
+// parseShortcodeAttrs extracts the key/value attributes of a shortcode
+func parseShortcodeAttrs(raw string) []shortcodeAttr {
+	raw = markdownEscapeRe.ReplaceAllString(raw, "$1")
+
+	var attrs []shortcodeAttr
+	for _, m := range shortcodeAttrRe.FindAllStringSubmatch(raw, -1) {
+		attrs = append(attrs, shortcodeAttr{Key: m[1], Value: m[2] + m[3] + m[4]})
+	}
+	return attrs
+}
+
+// renderJSXProps formats shortcode attributes as JSX string props
+func renderJSXProps(attrs []shortcodeAttr) string {
+	var b strings.Builder
+	for _, attr := range attrs {
+		value := strings.ReplaceAll(attr.Value, `"`, "&quot;")
+		fmt.Fprintf(&b, " %s=\"%s\"", attr.Key, value)
+	}
+	return b.String()
+}
+
+// ParseShortcodeMap parses "name=Component,other=Other" into a lookup table
+func ParseShortcodeMap(raw string) map[string]string {
+	components := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		name, component, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		name, component = strings.TrimSpace(name), strings.TrimSpace(component)
+		if name != "" && component != "" {
+			components[name] = component
+		}
+	}
+	return components
+}
+
+// sanitizeMDXComment makes sure text can't terminate the surrounding MDX comment early
+func sanitizeMDXComment(text string) string {
+	return strings.ReplaceAll(text, "*/", "* /")
+}
+
+// defaultCaptionShortcodes are the caption shortcodes expanded when
+// ConvertOptions.CaptionShortcodes is empty
+var defaultCaptionShortcodes = []string{"caption", "wp_caption"}
+
+// captionImageRe splits the content of a caption shortcode into the image,
+// possibly wrapped in a link, and the caption text after it
+var captionImageRe = regexp.MustCompile(`(?is)^\s*(<a\b[^>]*>\s*<img\b[^>]*>\s*</a>|<img\b[^>]*>)(.*)$`)
+
+// expandCaptionShortcodes turns [caption align="alignright"]<img/> Text[/caption]
+// and its aliases into the <div class="wp-caption"> markup WordPress renders
+// for it, so it is converted like any classic editor caption. Older content
+// keeps the text in a caption="..." attribute instead.
+func expandCaptionShortcodes(content string, names []string) string {
+	if len(names) == 0 {
+		names = defaultCaptionShortcodes
+	}
+	for _, name := range names {
+		re := regexp.MustCompile(`(?s)\[` + regexp.QuoteMeta(name) + `(\s[^\]]*)?\](.*?)\[/` + regexp.QuoteMeta(name) + `\]`)
+		content = re.ReplaceAllStringFunc(content, func(shortcode string) string {
+			m := re.FindStringSubmatch(shortcode)
+			parts := captionImageRe.FindStringSubmatch(m[2])
+			if parts == nil {
+				return shortcode
+			}
+
+			class := "wp-caption"
+			caption := strings.TrimSpace(parts[2])
+			for _, attr := range parseShortcodeAttrs(m[1]) {
+				switch attr.Key {
+				case "align":
+					class += " " + html.EscapeString(attr.Value)
+				case "caption":
+					if caption == "" {
+						caption = attr.Value
+					}
+				}
+			}
+			if caption == "" {
+				return fmt.Sprintf(`<div class="%s">%s</div>`, class, parts[1])
+			}
+			return fmt.Sprintf(`<div class="%s">%s<p class="wp-caption-text">%s</p></div>`, class, parts[1], caption)
+		})
+	}
+	return content
+}
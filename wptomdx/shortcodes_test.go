@@ -0,0 +1,318 @@
+package wptomdx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessUnknownShortcodes(t *testing.T) {
+	components := map[string]string{"contact-form-7": "ContactForm", "note": "Note"}
+	tests := []struct {
+		name string
+		in   string
+		opts ShortcodeOptions
+		want string
+	}{
+		{
+			name: "unknown self-closing",
+			in:   `[contact-form-7 id="123" title="Contact"]`,
+			want: `{/* shortcode: [contact-form-7 id="123" title="Contact"] */}`,
+		},
+		{
+			name: "unknown enclosing",
+			in:   `Before [note]Remember this[/note] after`,
+			want: `Before {/* shortcode: [note] */}Remember this{/* /shortcode: note */} after`,
+		},
+		{
+			name: "stripped",
+			in:   `Before [note]Remember this[/note] after [contact-form-7 id="1"]`,
+			opts: ShortcodeOptions{Strip: true},
+			want: `Before Remember this after `,
+		},
+		{
+			name: "mapped self-closing",
+			in:   `[contact-form-7 id="123" title="Contact"]`,
+			opts: ShortcodeOptions{Components: components},
+			want: `<ContactForm id="123" title="Contact" />`,
+		},
+		{
+			name: "mapped enclosing",
+			in:   `Before [note]Remember this[/note] after`,
+			opts: ShortcodeOptions{Components: components},
+			want: `Before <Note>Remember this</Note> after`,
+		},
+		{
+			name: "unmapped next to mapped",
+			in:   `[gallery-custom a="1"] [note]x[/note]`,
+			opts: ShortcodeOptions{Components: components},
+			want: `{/* shortcode: [gallery-custom a="1"] */} <Note>x</Note>`,
+		},
+		{
+			name: "escaped with double brackets",
+			in:   `Type [[contact-form-7 id="1"]] to embed a form`,
+			opts: ShortcodeOptions{Components: components},
+			want: `Type [contact-form-7 id="1"] to embed a form`,
+		},
+		{
+			name: "no shortcodes",
+			in:   `Plain [link](https://example.com) text`,
+			want: `Plain [link](https://example.com) text`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProcessUnknownShortcodes(tt.in, tt.opts); got != tt.want {
+				t.Errorf("ProcessUnknownShortcodes(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseShortcodeMap(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want map[string]string
+	}{
+		{"contact-form-7=ContactForm, button = Button", map[string]string{"contact-form-7": "ContactForm", "button": "Button"}},
+		{"bad,ok=Ok", map[string]string{"ok": "Ok"}},
+		{"", map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := ParseShortcodeMap(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseShortcodeMap(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestConvertPDFs(t *testing.T) {
+	const guide = "https://example.com/wp-content/uploads/2024/03/guide.pdf"
+	tests := []struct {
+		name      string
+		in        string
+		component string
+		want      string
+		wantMedia []string
+	}{
+		{
+			name:      "shortcode",
+			in:        `<p>[pdf]` + guide + `[/pdf]</p>`,
+			want:      "[guide.pdf](/wp-content/uploads/2024/03/guide.pdf)",
+			wantMedia: []string{guide},
+		},
+		{
+			name:      "shortcode component",
+			in:        `<p>[pdf]` + guide + `[/pdf]</p>`,
+			component: "PdfViewer",
+			want:      `<PdfViewer src="/wp-content/uploads/2024/03/guide.pdf" />`,
+			wantMedia: []string{guide},
+		},
+		{
+			name:      "bare link",
+			in:        `<p>Read <a href="` + guide + `">the guide</a> now</p>`,
+			want:      "Read [the guide](/wp-content/uploads/2024/03/guide.pdf) now",
+			wantMedia: []string{guide},
+		},
+		{
+			name:      "bare link with a component",
+			in:        `<p>Read <a href="` + guide + `">the guide</a> now</p>`,
+			component: "PdfViewer",
+			want:      "Read [the guide](/wp-content/uploads/2024/03/guide.pdf) now",
+			wantMedia: []string{guide},
+		},
+		{
+			name:      "upper case extension",
+			in:        `<p><a href="https://example.com/wp-content/uploads/Report.PDF">Report</a></p>`,
+			want:      "[Report](/wp-content/uploads/Report.PDF)",
+			wantMedia: []string{"https://example.com/wp-content/uploads/Report.PDF"},
+		},
+		{
+			name:      "other site",
+			in:        `<p><a href="https://other.org/paper.pdf">Paper</a></p>`,
+			want:      "[Paper](https://other.org/paper.pdf)",
+			wantMedia: []string{},
+		},
+		{
+			name:      "not a PDF",
+			in:        `<p><a href="https://example.com/wp-content/uploads/a.zip">Zip</a></p>`,
+			want:      "[Zip](/wp-content/uploads/a.zip)",
+			wantMedia: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConverter(Config{BaseURL: "https://example.com", Shortcodes: ShortcodeOptions{PDFComponent: tt.component}})
+			got, media, err := c.ConvertContent(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ConvertContent() = %q, want %q", got, tt.want)
+			}
+			if media == nil {
+				media = []string{}
+			}
+			if !reflect.DeepEqual(media, tt.wantMedia) {
+				t.Errorf("media = %q, want %q", media, tt.wantMedia)
+			}
+		})
+	}
+}
+
+func TestExpandCaptionShortcodes(t *testing.T) {
+	const img = `<img src="https://example.com/wp-content/uploads/cat.jpg" alt="Cat">`
+	tests := []struct {
+		name  string
+		in    string
+		names []string
+		want  string
+	}{
+		{
+			name: "caption",
+			in:   `[caption id="attachment_12" align="aligncenter" width="300"]` + img + ` A sleepy cat[/caption]`,
+			want: `<div class="wp-caption aligncenter">` + img + `<p class="wp-caption-text">A sleepy cat</p></div>`,
+		},
+		{
+			name: "default alias",
+			in:   `[wp_caption align="alignleft"]` + img + `Cat[/wp_caption]`,
+			want: `<div class="wp-caption alignleft">` + img + `<p class="wp-caption-text">Cat</p></div>`,
+		},
+		{
+			name:  "configured alias",
+			in:    `[img_caption]` + img + `Cat[/img_caption] [wp_caption]` + img + `Dog[/wp_caption]`,
+			names: []string{"img_caption"},
+			want:  `<div class="wp-caption">` + img + `<p class="wp-caption-text">Cat</p></div> [wp_caption]` + img + `Dog[/wp_caption]`,
+		},
+		{
+			name: "caption attribute",
+			in:   `[caption caption="Old style"]` + img + `[/caption]`,
+			want: `<div class="wp-caption">` + img + `<p class="wp-caption-text">Old style</p></div>`,
+		},
+		{
+			name: "linked image without caption",
+			in:   `[caption]<a href="/cat/">` + img + `</a>[/caption]`,
+			want: `<div class="wp-caption"><a href="/cat/">` + img + `</a></div>`,
+		},
+		{
+			name: "no image",
+			in:   `[caption]Just text[/caption]`,
+			want: `[caption]Just text[/caption]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandCaptionShortcodes(tt.in, tt.names); got != tt.want {
+				t.Errorf("expandCaptionShortcodes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertCaptionShortcodes(t *testing.T) {
+	const in = `[img_caption align="alignright"]<img src="https://example.com/wp-content/uploads/cat-300x200.jpg" alt="Cat">Sleepy[/img_caption]`
+	runConvertTests(t, []convertTest{
+		{
+			name:      "alias",
+			in:        in,
+			opts:      ConvertOptions{CaptionShortcodes: []string{"img_caption"}},
+			want:      "<figure data-align=\"right\">\n  <img src=\"/wp-content/uploads/cat.jpg\" alt=\"Cat\" />\n  <figcaption>Sleepy</figcaption>\n</figure>",
+			wantMedia: []string{"https://example.com/wp-content/uploads/cat.jpg"},
+		},
+	})
+}
+
+func TestProcessUltimateShortcodes(t *testing.T) {
+	ultimate := ShortcodeOptions{Ultimate: true, UltimateComponents: DefaultUltimateComponents()}
+	tests := []struct {
+		name string
+		in   string
+		opts ShortcodeOptions
+		want string
+	}{
+		{
+			name: "note with inner content",
+			in:   `[su_note note_color="#ff0"]Remember **this**[/su_note]`,
+			opts: ultimate,
+			want: `<Note note_color="#ff0">Remember **this**</Note>`,
+		},
+		{
+			name: "nested tabs",
+			in:   "[su_tabs]\n[su_tab title=\"One\"]First[/su_tab]\n[su_tab title=\"Two\"]Second[/su_tab]\n[/su_tabs]",
+			opts: ultimate,
+			want: "<Tabs>\n<Tab title=\"One\">First</Tab>\n<Tab title=\"Two\">Second</Tab>\n</Tabs>",
+		},
+		{
+			name: "accordion of spoilers",
+			in:   `[su_accordion][su_spoiler title="Q" open="yes"]A[/su_spoiler][/su_accordion]`,
+			opts: ultimate,
+			want: `<Accordion><Spoiler title="Q" open="yes">A</Spoiler></Accordion>`,
+		},
+		{
+			name: "self-closing",
+			in:   `[su_button url="/x"]`,
+			opts: ultimate,
+			want: `<Button url="/x" />`,
+		},
+		{
+			name: "unmapped stripped keeping content",
+			in:   `[su_highlight]marked[/su_highlight] and [su_divider]`,
+			opts: ultimate,
+			want: `marked and `,
+		},
+		{
+			name: "overridden component",
+			in:   `[su_note]x[/su_note]`,
+			opts: ShortcodeOptions{Ultimate: true, UltimateComponents: DefaultUltimateComponents(), Components: map[string]string{"su_note": "Callout"}},
+			want: `<Callout>x</Callout>`,
+		},
+		{
+			name: "other shortcodes are still commented",
+			in:   `[su_note]x[/su_note] [contact-form-7 id="1"]`,
+			opts: ultimate,
+			want: `<Note>x</Note> {/* shortcode: [contact-form-7 id="1"] */}`,
+		},
+		{
+			name: "off",
+			in:   `[su_note]x[/su_note]`,
+			want: `{/* shortcode: [su_note] */}x{/* /shortcode: su_note */}`,
+		},
+		{
+			name: "code fence left alone",
+			in:   "```\n[su_note]x[/su_note]\n```",
+			opts: ultimate,
+			want: "```\n[su_note]x[/su_note]\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProcessUnknownShortcodes(tt.in, tt.opts); got != tt.want {
+				t.Errorf("ProcessUnknownShortcodes(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertContentUltimateShortcodes(t *testing.T) {
+	c := NewConverter(Config{
+		BaseURL:    testBaseURL,
+		Shortcodes: ShortcodeOptions{Ultimate: true, UltimateComponents: DefaultUltimateComponents()},
+	})
+	got, _, err := c.ConvertContent(`<p>[su_tabs][su_tab title="One"]First[/su_tab][su_tab title="Two"]Second[/su_tab][/su_tabs]</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<Tabs><Tab title="One">First</Tab><Tab title="Two">Second</Tab></Tabs>`; !strings.Contains(got, want) {
+		t.Errorf("ConvertContent() = %q, want it to contain %q", got, want)
+	}
+}
+
+func TestConvertContentEscapedShortcodes(t *testing.T) {
+	c := NewConverter(Config{BaseURL: testBaseURL})
+	got, _, err := c.ConvertContent(`<p>Type [[gallery]] or [[note]x[/note]] to embed</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `Type \[gallery\] or \[note\]x\[/note\] to embed`; got != want {
+		t.Errorf("ConvertContent() = %q, want %q", got, want)
+	}
+}
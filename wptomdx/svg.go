@@ -0,0 +1,180 @@
+package wptomdx
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// svgCommentRe matches the comments (and XML declaration) of an SVG file,
+// which aren't valid inside MDX
+var svgCommentRe = regexp.MustCompile(`(?s)<!--.*?-->|<\?xml.*?\?>|<!DOCTYPE[^>]*>`)
+
+// inlineSmallSVGs replaces every image referencing an SVG under baseURL that
+// is smaller than maxBytes with the sanitized SVG markup itself, and returns
+// the media URLs that still need to be downloaded. The SVGs are fetched
+// through d. SVGs that can't be fetched, are larger, or (for MDX output)
+// contain braces that MDX would read as expressions stay plain images.
+func (d Downloader) inlineSmallSVGs(markdown string, mediaUrls []string, baseURL string, hosts MediaHosts, maxBytes int, mdx bool) (string, []string) {
+	var remaining []string
+	for _, u := range mediaUrls {
+		if !isSVG(u) {
+			remaining = append(remaining, u)
+			continue
+		}
+		svg, err := d.fetchSmallSVG(u, baseURL, hosts, maxBytes)
+		if err != nil {
+			log.Printf("Warning: not inlining %s: %v", u, err)
+			remaining = append(remaining, u)
+			continue
+		}
+		if svg == "" || (mdx && strings.ContainsAny(svg, "{}")) {
+			remaining = append(remaining, u)
+			continue
+		}
+
+		replaced := false
+		for _, ref := range []string{u, LocalMediaPath(u, baseURL, hosts)} {
+			re := regexp.MustCompile(`<img [^>]*src="` + regexp.QuoteMeta(ref) + `"[^>]*/>|!\[[^\]]*\]\(<?` + regexp.QuoteMeta(ref) + `>?(?: "[^"]*")?\)`)
+			markdown = re.ReplaceAllStringFunc(markdown, func(string) string {
+				replaced = true
+				return svg
+			})
+		}
+		if !replaced {
+			remaining = append(remaining, u)
+		}
+	}
+	return markdown, remaining
+}
+
+// isSVG reports whether u points at an SVG image
+func isSVG(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(path.Ext(parsed.Path), ".svg")
+}
+
+// fetchSmallSVG downloads src and returns its sanitized markup, or "" when
+// the file is maxBytes or larger or isn't media downloaded from its host
+func (d Downloader) fetchSmallSVG(src string, baseURL string, hosts MediaHosts, maxBytes int) (string, error) {
+	if LocalMediaPath(src, baseURL, hosts) == "" {
+		return "", nil
+	}
+	req, err := http.NewRequest(http.MethodGet, AbsoluteMediaURL(src, baseURL), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("bad status: %s", resp.Status)
+	}
+	if d.StrictContentType {
+		if err := checkMediaContentType(src, resp.Header.Get("Content-Type")); err != nil {
+			return "", err
+		}
+	}
+	if resp.ContentLength >= int64(maxBytes) {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(d.Bandwidth.Reader(resp.Body), int64(maxBytes)))
+	if err != nil {
+		return "", err
+	}
+	if len(data) >= maxBytes {
+		return "", nil
+	}
+	return sanitizeSVG(string(data))
+}
+
+// svgPresentationAttrs are the CSS properties that SVG also takes as
+// attributes, which inline styles are turned into
+var svgPresentationAttrs = map[string]bool{
+	"alignment-baseline": true, "baseline-shift": true, "clip-path": true, "clip-rule": true,
+	"color": true, "color-interpolation": true, "color-interpolation-filters": true,
+	"cursor": true, "direction": true, "display": true, "dominant-baseline": true,
+	"fill": true, "fill-opacity": true, "fill-rule": true, "filter": true,
+	"flood-color": true, "flood-opacity": true, "font-family": true, "font-size": true,
+	"font-size-adjust": true, "font-stretch": true, "font-style": true, "font-variant": true,
+	"font-weight": true, "image-rendering": true, "letter-spacing": true, "lighting-color": true,
+	"marker-end": true, "marker-mid": true, "marker-start": true, "mask": true,
+	"opacity": true, "overflow": true, "paint-order": true, "pointer-events": true,
+	"shape-rendering": true, "stop-color": true, "stop-opacity": true, "stroke": true,
+	"stroke-dasharray": true, "stroke-dashoffset": true, "stroke-linecap": true,
+	"stroke-linejoin": true, "stroke-miterlimit": true, "stroke-opacity": true,
+	"stroke-width": true, "text-anchor": true, "text-decoration": true, "text-rendering": true,
+	"unicode-bidi": true, "vector-effect": true, "visibility": true, "word-spacing": true,
+	"writing-mode": true,
+}
+
+// styleAttrs returns the presentation attributes, as name and value pairs,
+// set by an inline style, dropping the declarations SVG has no attribute for.
+// JSX only takes style as an object, which MDX would read as an expression.
+func styleAttrs(style string) [][2]string {
+	var attrs [][2]string
+	for _, declaration := range strings.Split(style, ";") {
+		name, value, ok := strings.Cut(declaration, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if !ok || value == "" || !svgPresentationAttrs[name] {
+			continue
+		}
+		attrs = append(attrs, [2]string{name, value})
+	}
+	return attrs
+}
+
+// sanitizeSVG strips what could run code from an SVG document: scripts,
+// foreign HTML content, event handler attributes and javascript: links.
+// Inline styles become presentation attributes.
+func sanitizeSVG(raw string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(svgCommentRe.ReplaceAllString(raw, "")))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SVG: %v", err)
+	}
+	svg := doc.Find("svg").First()
+	if svg.Length() == 0 {
+		return "", fmt.Errorf("no <svg> element")
+	}
+	// The parser keeps the SVG spelling "foreignObject", which selectors don't match
+	svg.Find("*").FilterFunction(func(_ int, el *goquery.Selection) bool {
+		name := strings.ToLower(goquery.NodeName(el))
+		return name == "script" || name == "foreignobject"
+	}).Remove()
+	svg.Find("*").AddSelection(svg).Each(func(_ int, el *goquery.Selection) {
+		node := el.Nodes[0]
+		attrs := node.Attr[:0]
+		var styled [][2]string
+		for _, attr := range node.Attr {
+			name := strings.ToLower(attr.Key)
+			value := strings.ToLower(strings.TrimSpace(attr.Val))
+			if strings.HasPrefix(name, "on") || (name == "href" && strings.HasPrefix(value, "javascript:")) {
+				continue
+			}
+			if name == "style" {
+				styled = styleAttrs(attr.Val)
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+		node.Attr = attrs
+		// The style wins over the attributes it repeats
+		for _, attr := range styled {
+			el.SetAttr(attr[0], attr[1])
+		}
+	})
+	return goquery.OuterHtml(svg)
+}
@@ -0,0 +1,115 @@
+package wptomdx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "clean",
+			raw:  `<?xml version="1.0"?><!-- logo --><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><path d="M0 0h10"/></svg>`,
+			want: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><path d="M0 0h10"></path></svg>`,
+		},
+		{
+			name: "scripts and handlers",
+			raw:  `<svg onload="alert(1)"><script>alert(1)</script><a href="javascript:alert(1)"><circle r="4" onClick="x()"/></a></svg>`,
+			want: `<svg><a><circle r="4"></circle></a></svg>`,
+		},
+		{
+			name: "foreign content",
+			raw:  `<svg><foreignObject><div>hi</div></foreignObject><rect width="1"/></svg>`,
+			want: `<svg><rect width="1"></rect></svg>`,
+		},
+		{
+			name: "safe links",
+			raw:  `<svg><a href="https://example.com/"><rect width="1"/></a></svg>`,
+			want: `<svg><a href="https://example.com/"><rect width="1"></rect></a></svg>`,
+		},
+		{
+			name: "inline styles",
+			raw:  `<svg style="display:block;margin: 0 auto"><rect fill="blue" style="fill: red; stroke-width:2px" width="1"/><g style=""/></svg>`,
+			want: `<svg display="block"><rect fill="red" width="1" stroke-width="2px"></rect><g></g></svg>`,
+		},
+		{name: "not an SVG", raw: `<html><body>Not found</body></html>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeSVG(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sanitizeSVG() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeSVG() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentInlineSVG(t *testing.T) {
+	files := map[string]string{
+		"/wp-content/uploads/small.svg":  `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10" onload="alert(1)"><circle cx="5" cy="5" r="4"/></svg>`,
+		"/wp-content/uploads/large.svg":  `<svg xmlns="http://www.w3.org/2000/svg">` + strings.Repeat(`<rect width="1" height="1"/>`, 100) + `</svg>`,
+		"/wp-content/uploads/braces.svg": `<svg xmlns="http://www.w3.org/2000/svg"><style>.a{fill:red}</style></svg>`,
+		"/wp-content/uploads/styled.svg": `<svg xmlns="http://www.w3.org/2000/svg"><circle r="4" style="fill:#c00;transition:fill 1s"/></svg>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The SVGs are fetched through the downloader, with its headers
+		if r.UserAgent() != "wp-to-mdx-test" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if svg, ok := files[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(svg))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	var content string
+	for _, name := range []string{"small", "styled", "large", "braces", "missing"} {
+		content += `<p><img src="` + server.URL + `/wp-content/uploads/` + name + `.svg" alt="` + name + `"></p>`
+	}
+	c := testConverter(t, func(cfg *Config) {
+		cfg.BaseURL = server.URL
+		cfg.InlineSVGUnderBytes = 1024
+	})
+	c.Downloader.Header = http.Header{"User-Agent": {"wp-to-mdx-test"}}
+	entries := c.ProcessContent([]Post{testPost(1, "logos", content)}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+	data, err := os.ReadFile(entries[0].MDXPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, _ := strings.Cut(string(data), "---\n\n")
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><circle cx="5" cy="5" r="4"></circle></svg>` + "\n\n" +
+		`<svg xmlns="http://www.w3.org/2000/svg"><circle r="4" fill="#c00"></circle></svg>` + "\n\n" +
+		// Too large, braces MDX would evaluate, and fetch failures stay images
+		`<img src="/wp-content/uploads/large.svg" alt="large" />` + "\n\n" +
+		`<img src="/wp-content/uploads/braces.svg" alt="braces" />` + "\n\n" +
+		`<img src="/wp-content/uploads/missing.svg" alt="missing" />`
+	if body != want {
+		t.Errorf("body =\n%s\nwant\n%s", body, want)
+	}
+
+	var downloads []string
+	for _, media := range entries[0].Media {
+		downloads = append(downloads, strings.TrimPrefix(media.URL, server.URL))
+	}
+	if want := "/wp-content/uploads/large.svg /wp-content/uploads/braces.svg /wp-content/uploads/missing.svg"; strings.Join(downloads, " ") != want {
+		t.Errorf("media = %q, want %s", downloads, want)
+	}
+}
@@ -0,0 +1,321 @@
+package wptomdx
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ParseWordPressDate attempts to parse a WordPress date string using multiple formats.
+// WordPress' unset date (0000-00-00 00:00:00) yields a zero time.Time and no error.
+func ParseWordPressDate(dateStr string) (time.Time, error) {
+	if isZeroWordPressDate(dateStr) {
+		return time.Time{}, nil
+	}
+
+	// List of possible date formats in WordPress
+	dateFormats := []string{
+		"2006-01-02 15:04:05",           // MySQL datetime format
+		time.RFC3339,                    // "2006-01-02T15:04:05Z07:00"
+		"2006-01-02T15:04:05-07:00",     // WordPress often uses this format
+		"2006-01-02T15:04:05.000-07:00", // With milliseconds
+		"2006-01-02T15:04:05.000Z",      // UTC with milliseconds
+	}
+
+	// Try each format until one works
+	for _, format := range dateFormats {
+		if date, err := time.Parse(format, dateStr); err == nil {
+			return date, nil
+		}
+	}
+
+	// None of the formats worked
+	return time.Time{}, fmt.Errorf("could not parse date using any known WordPress formats: %s", dateStr)
+}
+
+// zeroWordPressDate is what WordPress stores for dates that were never set
+const zeroWordPressDate = "0000-00-00 00:00:00"
+
+// isZeroWordPressDate reports whether dateStr is WordPress' unset date. With
+// parseTime enabled the MySQL driver hands it to us as Go's zero time instead.
+func isZeroWordPressDate(dateStr string) bool {
+	return dateStr == "" || dateStr == zeroWordPressDate || strings.HasPrefix(dateStr, "0001-01-01T00:00:00")
+}
+
+// ParseWordPressGMTDate parses one of the *_gmt date columns. The connection
+// uses loc=Local, so the driver labels these values with the local time zone
+// even though their wall clock time is UTC; the result is corrected to UTC.
+func ParseWordPressGMTDate(dateStr string) (time.Time, error) {
+	date, err := ParseWordPressDate(dateStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), time.UTC), nil
+}
+
+// PickWordPressDate parses the GMT value when useGMT is set and WordPress
+// stored one, falling back to the site-local value otherwise
+func PickWordPressDate(local string, gmt string, useGMT bool) (time.Time, error) {
+	if useGMT && !isZeroWordPressDate(gmt) {
+		return ParseWordPressGMTDate(gmt)
+	}
+	return ParseWordPressDate(local)
+}
+
+// OutputExtension normalizes the configured extension of generated files:
+// ".mdx" (the default) or ".md" for plain markdown
+func OutputExtension(value string) string {
+	if strings.TrimPrefix(value, ".") == "md" {
+		return ".md"
+	}
+	return ".mdx"
+}
+
+// SanitizeFilename removes characters that might cause problems in filenames
+func SanitizeFilename(filename string) string {
+	// Replace problematic characters with underscores
+	replacer := strings.NewReplacer(
+		"/", "_",
+		"\\", "_",
+		":", "_",
+		"*", "_",
+		"?", "_",
+		"\"", "_",
+		"<", "_",
+		">", "_",
+		"|", "_",
+	)
+	return replacer.Replace(filename)
+}
+
+// SanitizePath sanitizes every segment of a slash-separated path for use on
+// disk, optionally transliterating it to ASCII first. Segments that end up
+// empty (or are "." / "..") are dropped.
+func SanitizePath(path string, transliterate bool) string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if transliterate {
+			segment = Transliterate(segment)
+		}
+		segment = strings.TrimSpace(SanitizeFilename(segment))
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// normalizeSeparatorsRe matches the runs of underscores, whitespace and hyphens
+// NormalizePath turns into a single hyphen
+var normalizeSeparatorsRe = regexp.MustCompile(`[_\s-]+`)
+
+// NormalizePath lowercases every segment of a slash-separated path and turns
+// underscores and spaces into hyphens, for case-sensitive deploy targets:
+// "My_Post Title" becomes "my-post-title"
+func NormalizePath(path string) string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.Trim(normalizeSeparatorsRe.ReplaceAllString(strings.ToLower(segment), "-"), "-")
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Transliterate strips diacritics so that e.g. "café" becomes "cafe".
+// Characters without a plain-letter decomposition (such as CJK) are kept.
+func Transliterate(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	result, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return result
+}
+
+// unescapeEntities decodes the HTML entities WordPress stores in titles,
+// excerpts and term names (&#8217;, &amp;, ...) into the characters they
+// stand for. The content is left to the HTML converter.
+func unescapeEntities(post *Post) {
+	post.Title = html.UnescapeString(post.Title)
+	post.Excerpt = html.UnescapeString(post.Excerpt)
+	for _, names := range [][]string{post.Tags, post.Categories} {
+		for i := range names {
+			names[i] = html.UnescapeString(names[i])
+		}
+	}
+}
+
+// NormalizeBaseURL strips trailing slashes from the site URL, so that it joins
+// with site-relative paths the same way whether WP_BASE_URL ends in "/" or not
+func NormalizeBaseURL(baseURL string) string {
+	return strings.TrimRight(strings.TrimSpace(baseURL), "/")
+}
+
+// LocalMediaPath returns the site-relative path (e.g. "/wp-content/uploads/a.jpg")
+// a media URL is downloaded to, or "" when the URL is neither hosted under
+// baseURL nor on one of the allowed hosts, or is on a denied one, and therefore
+// isn't downloaded
+func LocalMediaPath(src string, baseURL string, hosts MediaHosts) string {
+	baseURL = NormalizeBaseURL(baseURL)
+	src = AbsoluteMediaURL(src, baseURL)
+	if u, err := url.Parse(src); err == nil && hosts.denies(u.Host) {
+		return ""
+	}
+	if baseURL == "" || !strings.HasPrefix(src, baseURL) {
+		return allowedHostPath(src, hosts)
+	}
+	// "https://example.com.evil" isn't under "https://example.com"
+	rest := strings.TrimPrefix(src, baseURL)
+	if rest != "" && !strings.ContainsAny(rest[:1], "/?#") {
+		return allowedHostPath(src, hosts)
+	}
+	return "/" + strings.TrimPrefix(rest, "/")
+}
+
+// AbsoluteMediaURL gives protocol-relative URLs ("//host/a.jpg") the scheme of
+// baseURL and root-relative ones ("/wp-content/a.jpg") its scheme and host,
+// leaving other URLs untouched
+func AbsoluteMediaURL(src string, baseURL string) string {
+	if !strings.HasPrefix(src, "/") {
+		return src
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		base = &url.URL{}
+	}
+	if !strings.HasPrefix(src, "//") {
+		if base.Scheme == "" || base.Host == "" {
+			return src
+		}
+		return base.Scheme + "://" + base.Host + src
+	}
+	scheme := "https"
+	if base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	return scheme + ":" + src
+}
+
+// MediaFilePath returns the path, below the media directory, that a media URL
+// is saved at: its URL path, whatever its host, without the path of a base URL
+// in a subdirectory (https://example.com/blog) or its query string
+func MediaFilePath(src string, baseURL string) (string, error) {
+	u, err := url.Parse(AbsoluteMediaURL(src, baseURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid media URL %s: %v", src, err)
+	}
+	p := u.Path
+	if base, err := url.Parse(NormalizeBaseURL(baseURL)); err == nil && base.Host == u.Host && base.Path != "" {
+		if rest := strings.TrimPrefix(p, base.Path); rest == "" || rest[0] == '/' {
+			p = rest
+		}
+	}
+	// Cleaning a rooted path also drops any ".." segments
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "", fmt.Errorf("media URL %s has no file path", src)
+	}
+	return p, nil
+}
+
+// relativeURL makes a URL under baseURL site-relative, leaving others untouched
+func relativeURL(u string, baseURL string, hosts MediaHosts) string {
+	if localPath := LocalMediaPath(u, baseURL, hosts); localPath != "" {
+		return localPath
+	}
+	return u
+}
+
+// mapOutsideCodeFences applies fn to every part of the markdown that isn't
+// inside a fenced (```) code block, leaving code blocks untouched
+func mapOutsideCodeFences(markdown string, fn func(string) string) string {
+	lines := strings.SplitAfter(markdown, "\n")
+
+	var out, chunk strings.Builder
+	inFence := false
+	for _, line := range lines {
+		isFence := strings.HasPrefix(strings.TrimSpace(line), "```")
+		if isFence && !inFence {
+			out.WriteString(fn(chunk.String()))
+			chunk.Reset()
+			inFence = true
+			out.WriteString(line)
+			continue
+		}
+		if inFence {
+			out.WriteString(line)
+			if isFence {
+				inFence = false
+			}
+			continue
+		}
+		chunk.WriteString(line)
+	}
+	out.WriteString(fn(chunk.String()))
+
+	return out.String()
+}
+
+// FormatWithCommand pipes content through an external shell command (e.g.
+// "prettier --parser mdx") and returns what it writes to stdout
+func FormatWithCommand(command string, content string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("format command %q failed: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// RetryPolicy controls how often a failed request is retried
+type RetryPolicy struct {
+	// Attempts is the total number of tries; 1 or less tries once
+	Attempts int `yaml:"attempts"`
+	// Backoff is the wait before the first retry, doubled for each one after
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+// retryDo sends a request with do until it gets a response worth keeping.
+// Network errors, 5xx and 429 responses are retried after the policy's
+// backoff, or a 429's Retry-After; any other response, including a 404, is
+// returned as is. The last response or error is returned once attempts run out.
+func retryDo(policy RetryPolicy, do func() (*http.Response, error)) (*http.Response, error) {
+	wait := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := do()
+		retryable := err != nil || retryableStatus(resp.StatusCode)
+		if !retryable || attempt >= policy.Attempts {
+			return resp, err
+		}
+
+		delay := wait
+		if err == nil {
+			if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds >= 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+		wait *= 2
+	}
+}
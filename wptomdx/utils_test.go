@@ -0,0 +1,456 @@
+package wptomdx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSanitizePath(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		transliterate bool
+		want          string
+	}{
+		{"plain", "2024/03/my-post", false, "2024/03/my-post"},
+		{"accented kept", "blog/café", false, "blog/café"},
+		{"accented transliterated", "blog/café-crème", true, "blog/cafe-creme"},
+		{"cjk kept", "blog/日本語", false, "blog/日本語"},
+		{"cjk transliterated", "blog/日本語", true, "blog/日本語"},
+		{"unsafe characters", `a:b/c*d?"e"`, false, "a_b/c_d__e_"},
+		{"empty segments", "a//b/", false, "a/b"},
+		{"dot segments", "./a/../b", false, "a/b"},
+		{"blank segment", "a/ /b", false, "a/b"},
+		{"nothing left", "../.", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizePath(tt.path, tt.transliterate); got != tt.want {
+				t.Errorf("SanitizePath(%q, %v) = %q, want %q", tt.path, tt.transliterate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentSlugPaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		transliterate bool
+		want          string
+	}{
+		{"accented", "https://example.com/caf%C3%A9/", false, "café.mdx"},
+		{"transliterated", "https://example.com/caf%C3%A9/", true, "cafe.mdx"},
+		{"cjk", "https://example.com/%E6%97%A5%E6%9C%AC/", true, "日本.mdx"},
+		{"empty after sanitizing", "https://example.com/%20/", false, "7.mdx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.TransliterateSlugs = tt.transliterate })
+			post := testPost(7, "slug", "<p>Text</p>")
+			post.URL = tt.url
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			if want := filepath.Join(c.Config.PostsOutputDir, tt.want); entries[0].MDXPath != want {
+				t.Errorf("MDXPath = %q, want %q", entries[0].MDXPath, want)
+			}
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"My_Post Title", "my-post-title"},
+		{"Blog/My_Post", "blog/my-post"},
+		{"2024/03/Already-Fine", "2024/03/already-fine"},
+		{"a__b  c--d", "a-b-c-d"},
+		{"_Leading/Trailing_", "leading/trailing"},
+		{"Café_Crème", "café-crème"},
+		{"a/_/b", "a/b"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizePath(tt.path); got != tt.want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestProcessContentNormalizeFilenames(t *testing.T) {
+	const sourceURL = "https://example.com/Blog/My_Post%20Title/"
+	tests := []struct {
+		name      string
+		normalize bool
+		want      string
+	}{
+		{"normalized", true, "blog/my-post-title"},
+		{"kept", false, "Blog/My_Post Title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.NormalizeFilenames = tt.normalize })
+			post := testPost(7, "My_Post Title", "<p>Text</p>")
+			post.URL = sourceURL
+			entries := c.ProcessContent([]Post{post}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			got := entries[0]
+			if want := filepath.Join(c.Config.PostsOutputDir, tt.want+".mdx"); got.MDXPath != want {
+				t.Errorf("MDXPath = %q, want %q", got.MDXPath, want)
+			}
+			if want := filepath.Join(c.Config.HTMLOutputDir, tt.want+".html"); got.HTMLPath != want {
+				t.Errorf("HTMLPath = %q, want %q", got.HTMLPath, want)
+			}
+			// The manifest maps the old URL to the new file
+			if got.SourceURL != sourceURL {
+				t.Errorf("SourceURL = %q, want %q", got.SourceURL, sourceURL)
+			}
+		})
+	}
+}
+
+func TestPickWordPressDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		local  string
+		gmt    string
+		useGMT bool
+		want   string
+	}{
+		{"local", "2024-03-01 12:30:00", "2024-03-01 10:30:00", false, "2024-03-01T12:30:00Z"},
+		{"gmt", "2024-03-01 12:30:00", "2024-03-01 10:30:00", true, "2024-03-01T10:30:00Z"},
+		{"gmt from the driver", "2024-03-01 12:30:00", "2024-03-01T10:30:00+02:00", true, "2024-03-01T10:30:00Z"},
+		{"zero gmt falls back", "2024-03-01 12:30:00", "0000-00-00 00:00:00", true, "2024-03-01T12:30:00Z"},
+		{"empty gmt falls back", "2024-03-01 12:30:00", "", true, "2024-03-01T12:30:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PickWordPressDate(tt.local, tt.gmt, tt.useGMT)
+			if err != nil {
+				t.Fatalf("PickWordPressDate() error = %v", err)
+			}
+			if got.Format(time.RFC3339) != tt.want {
+				t.Errorf("PickWordPressDate(%q, %q, %v) = %s, want %s", tt.local, tt.gmt, tt.useGMT, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentGMTDates(t *testing.T) {
+	c := testConverter(t, func(cfg *Config) { cfg.DateUseGMT = true })
+	post := testPost(1, "gmt-post", "<p>Text</p>")
+	post.PublishedDate, post.PublishedGMT = "2024-03-01 12:30:00", "2024-03-01 10:30:00"
+	post.UpdatedDate, post.UpdatedGMT = "2024-03-02 12:30:00", zeroWordPressDate
+	entries := c.ProcessContent([]Post{post}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+	for key, want := range map[string]string{"publishDate": "2024-03-01T10:30:00Z", "updatedDate": "2024-03-02T12:30:00Z"} {
+		if got := frontmatterValue(t, entries[0].MDXPath, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestParseWordPressDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"datetime", "2024-03-01 12:30:00", time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), false},
+		{"rfc3339", "2024-03-01T12:30:00Z", time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), false},
+		{"zero sentinel", "0000-00-00 00:00:00", time.Time{}, false},
+		{"zero from the driver", "0001-01-01T00:00:00Z", time.Time{}, false},
+		{"empty", "", time.Time{}, false},
+		{"garbage", "yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWordPressDate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWordPressDate(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseWordPressDate(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentZeroUpdatedDate(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	c := testConverter(t, nil)
+	post := testPost(1, "draft", "<p>Text</p>")
+	post.UpdatedDate = zeroWordPressDate
+	entries := c.ProcessContent([]Post{post}, false)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+	}
+	if got := frontmatterValue(t, entries[0].MDXPath, "updatedDate"); got != "" {
+		t.Errorf("updatedDate = %q, want it omitted", got)
+	}
+	if strings.Contains(logged.String(), "Warning") {
+		t.Errorf("zero date logged a warning:\n%s", logged.String())
+	}
+}
+
+func TestFormatWithCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+		wantErr string
+	}{
+		{"cat", "cat", "# Title\n\nText\n", ""},
+		{"transform", "tr a-z A-Z", "# TITLE\n\nTEXT\n", ""},
+		{"failure", "echo oops >&2; exit 3", "", "oops"},
+		{"missing command", "no-such-formatter-command", "", "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatWithCommand(tt.command, "# Title\n\nText\n")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FormatWithCommand(%q) error = %v, want one containing %q", tt.command, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatWithCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentFormatCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"formatted", "sed 's/Some text/Formatted text/'", "Formatted text"},
+		{"failure keeps the content", "exit 1", "Some text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConverter(t, func(cfg *Config) { cfg.FormatCommand = tt.command })
+			entries := c.ProcessContent([]Post{testPost(1, "formatted", "<p>Some text</p>")}, false)
+			if len(entries) != 1 {
+				t.Fatalf("ProcessContent() returned %d entries, want 1", len(entries))
+			}
+			data, err := os.ReadFile(entries[0].MDXPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("output does not contain %q:\n%s", tt.want, data)
+			}
+		})
+	}
+}
+
+func TestNormalizeBaseURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://example.com":       "https://example.com",
+		"https://example.com/":      "https://example.com",
+		" https://example.com// ":   "https://example.com",
+		"https://example.com/blog/": "https://example.com/blog",
+		"":                          "",
+	} {
+		if got := NormalizeBaseURL(in); got != want {
+			t.Errorf("NormalizeBaseURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLocalMediaPath(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"https://example.com/wp-content/uploads/a.jpg", "/wp-content/uploads/a.jpg"},
+		{"/wp-content/uploads/a.jpg", "/wp-content/uploads/a.jpg"},
+		{"https://example.com/wp-content/uploads/a.jpg?ver=2", "/wp-content/uploads/a.jpg?ver=2"},
+		{"https://example.com.evil/wp-content/uploads/a.jpg", ""},
+		{"https://cdn.example.org/a.jpg", ""},
+	}
+	for _, base := range []string{"https://example.com", "https://example.com/"} {
+		for _, tt := range tests {
+			if got := LocalMediaPath(tt.src, base, MediaHosts{}); got != tt.want {
+				t.Errorf("LocalMediaPath(%q, %q) = %q, want %q", tt.src, base, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestMediaFilePath(t *testing.T) {
+	tests := []struct {
+		src, baseURL, want string
+		wantErr            bool
+	}{
+		{"https://example.com/wp-content/uploads/a.jpg", "https://example.com", "/wp-content/uploads/a.jpg", false},
+		{"https://example.com/wp-content/uploads/a.jpg", "https://example.com/", "/wp-content/uploads/a.jpg", false},
+		{"https://example.com/blog/wp-content/uploads/a.jpg", "https://example.com/blog/", "/wp-content/uploads/a.jpg", false},
+		{"/wp-content/uploads/a.jpg", "https://example.com/", "/wp-content/uploads/a.jpg", false},
+		{"https://example.com/wp-content/../../etc/passwd", "https://example.com", "/etc/passwd", false},
+		{"//example.com/wp-content/uploads/a.jpg", "https://example.com", "/wp-content/uploads/a.jpg", false},
+		{"//cdn.example.net/wp-content/uploads/a.jpg", "https://example.com", "/wp-content/uploads/a.jpg", false},
+		{"https://cdn.example.net/wp-content/uploads/a.jpg?ver=2", "https://example.com", "/wp-content/uploads/a.jpg", false},
+		// Only the base URL's own host has its subdirectory removed
+		{"https://cdn.example.net/blog/wp-content/uploads/a.jpg", "https://example.com/blog", "/blog/wp-content/uploads/a.jpg", false},
+		{"https://example.com/blogroll/a.jpg", "https://example.com/blog", "/blogroll/a.jpg", false},
+		{"https://example.com/", "https://example.com", "", true},
+		{"https://example.com/%zz.jpg", "https://example.com", "", true},
+	}
+	for _, tt := range tests {
+		got, err := MediaFilePath(tt.src, tt.baseURL)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("MediaFilePath(%q, %q) error = %v, wantErr %v", tt.src, tt.baseURL, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("MediaFilePath(%q, %q) = %q, want %q", tt.src, tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestPostProcessTrailingSlash(t *testing.T) {
+	markdown := `[audio mp3="https://example.com/wp-content/uploads/a.mp3"][/audio]` + "\n\n" +
+		`[video width="640" height="360" mp4="https://example.com/wp-content/uploads/v.mp4"][/video]`
+	want, wantMedia := PostProcessMarkdownLines(markdown, "https://example.com", MediaHosts{}, nil, ShortcodeOptions{})
+	got, gotMedia := PostProcessMarkdownLines(markdown, "https://example.com/", MediaHosts{}, nil, ShortcodeOptions{})
+	if got != want || !reflect.DeepEqual(gotMedia, wantMedia) {
+		t.Errorf("output with a trailing slash =\n%q %q\nwithout\n%q %q", got, gotMedia, want, wantMedia)
+	}
+	for _, path := range []string{`"/wp-content/uploads/a.mp3"`, `"/wp-content/uploads/v.mp4"`} {
+		if !strings.Contains(want, path) {
+			t.Errorf("output does not reference %s:\n%s", path, want)
+		}
+	}
+}
+
+// statusServer answers its requests with statuses in turn, repeating the last
+// one, and counts them
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"link": "https://example.com/post-%d/"}`, n)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRetryDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		attempts     int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{"success", []int{200}, 3, 200, 1},
+		{"fails once", []int{503, 200}, 3, 200, 2},
+		{"rate limited", []int{429, 200}, 3, 200, 2},
+		{"not found", []int{404, 200}, 3, 404, 1},
+		{"attempts run out", []int{500}, 3, 500, 3},
+		{"single attempt", []int{500, 200}, 1, 500, 1},
+		{"no attempts", []int{500, 200}, 0, 500, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := statusServer(t, tt.statuses...)
+			resp, err := retryDo(RetryPolicy{Attempts: tt.attempts, Backoff: time.Millisecond}, func() (*http.Response, error) {
+				return http.Get(server.URL)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("sent %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryDoNetworkErrors(t *testing.T) {
+	tries := 0
+	resp, err := retryDo(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}, func() (*http.Response, error) {
+		tries++
+		if tries == 1 {
+			return nil, &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection reset")}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	if err != nil || resp.StatusCode != http.StatusOK || tries != 2 {
+		t.Errorf("retryDo() = %v, %v after %d tries, want a 200 after 2", resp, err, tries)
+	}
+
+	tries = 0
+	if _, err := retryDo(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}, func() (*http.Response, error) {
+		tries++
+		return nil, errors.New("connection refused")
+	}); err == nil || tries != 3 {
+		t.Errorf("retryDo() error = %v after %d tries, want an error after 3", err, tries)
+	}
+}
+
+func TestAbsoluteMediaURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		baseURL string
+		want    string
+	}{
+		{"absolute", "https://example.com/wp-content/uploads/a.jpg", "https://example.com", "https://example.com/wp-content/uploads/a.jpg"},
+		{"root-relative", "/wp-content/uploads/a.jpg", "https://example.com", "https://example.com/wp-content/uploads/a.jpg"},
+		{"root-relative under a subdirectory install", "/blog/wp-content/uploads/a.jpg", "https://example.com/blog", "https://example.com/blog/wp-content/uploads/a.jpg"},
+		{"protocol-relative", "//cdn.example.com/a.jpg", "https://example.com", "https://cdn.example.com/a.jpg"},
+		{"protocol-relative over http", "//example.com/a.jpg", "http://example.com", "http://example.com/a.jpg"},
+		{"no base URL", "/wp-content/uploads/a.jpg", "", "/wp-content/uploads/a.jpg"},
+		{"document-relative", "uploads/a.jpg", "https://example.com", "uploads/a.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AbsoluteMediaURL(tt.src, tt.baseURL); got != tt.want {
+				t.Errorf("AbsoluteMediaURL(%q, %q) = %q, want %q", tt.src, tt.baseURL, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package wptomdx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MDXIssue is a likely MDX syntax error at a 1-based line and column
+type MDXIssue struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (i MDXIssue) String() string {
+	return fmt.Sprintf("%d:%d: %s", i.Line, i.Column, i.Message)
+}
+
+// openComponent is a component tag waiting for its closing tag
+type openComponent struct {
+	name         string
+	line, column int
+}
+
+// ValidateMDX scans a generated MDX document for the mistakes that break the
+// MDX compiler: a "<" that doesn't start a tag, HTML comments, a "{" that
+// would be read as an expression, and components such as <YouTube> that are
+// never closed. Frontmatter, import/export lines, {/* */} comments, code
+// blocks and code spans are skipped. It is a heuristic, not a parser.
+func ValidateMDX(content string) []MDXIssue {
+	var issues []MDXIssue
+	report := func(line, column int, format string, args ...interface{}) {
+		issues = append(issues, MDXIssue{Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lines := strings.Split(content, "\n")
+	start := frontmatterEnd(lines)
+
+	var stack []openComponent
+	var tag *openComponent // the tag being read, which may span lines
+	var tagClosing bool
+	var quote rune
+	fence := ""
+	inComment := false // inside a {/* */} comment spanning lines
+	for n := start; n < len(lines); n++ {
+		line := lines[n]
+		trimmed := strings.TrimSpace(line)
+		from := 0
+		if inComment {
+			end := strings.Index(line, "*/}")
+			if end < 0 {
+				continue
+			}
+			inComment = false
+			from = len([]rune(line[:end+3]))
+		}
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if tag == nil && from == 0 {
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				fence = trimmed[:3]
+				continue
+			}
+			if strings.HasPrefix(line, "import ") || strings.HasPrefix(line, "export ") {
+				continue
+			}
+		}
+
+		runes := []rune(line)
+		for i := from; i < len(runes); i++ {
+			r := runes[i]
+			lineNo, column := n+1, i+1
+
+			// Inside a tag only quotes and its end matter
+			if tag != nil {
+				switch {
+				case quote != 0:
+					if r == quote {
+						quote = 0
+					}
+				case r == '"' || r == '\'':
+					quote = r
+				case r == '{':
+					report(lineNo, column, "expression in the attributes of <%s>", tag.name)
+				case r == '>':
+					selfClosing := i > 0 && runes[i-1] == '/'
+					if isComponentName(tag.name) {
+						stack = closeComponent(stack, *tag, tagClosing, selfClosing, report)
+					}
+					tag = nil
+				}
+				continue
+			}
+
+			switch r {
+			case '\\':
+				i++ // escaped character
+			case '`':
+				i = skipCodeSpan(runes, i)
+			case '<':
+				rest := runes[i+1:]
+				switch {
+				case strings.HasPrefix(string(rest), "!--"):
+					report(lineNo, column, "HTML comments aren't valid in MDX; use {/* */}")
+					if end := strings.Index(string(rest), "-->"); end >= 0 {
+						i += len([]rune(string(rest)[:end+3]))
+					}
+				case len(rest) > 0 && (unicode.IsLetter(rest[0]) || rest[0] == '/'):
+					tagClosing = rest[0] == '/'
+					j := i + 1
+					if tagClosing {
+						j++
+					}
+					k := j
+					for k < len(runes) && (unicode.IsLetter(runes[k]) || unicode.IsDigit(runes[k]) || strings.ContainsRune("-_.:", runes[k])) {
+						k++
+					}
+					tag = &openComponent{name: string(runes[j:k]), line: lineNo, column: column}
+					i = k - 1
+				default:
+					report(lineNo, column, "bare \"<\" is read as the start of a tag; escape it as \\<")
+				}
+			case '{':
+				if strings.HasPrefix(string(runes[i:]), "{/*") {
+					if end := strings.Index(string(runes[i:]), "*/}"); end >= 0 {
+						i += len([]rune(string(runes[i:])[:end+3])) - 1
+						continue
+					}
+					inComment = true
+					i = len(runes)
+					continue
+				}
+				report(lineNo, column, "\"{\" starts an MDX expression; escape it as \\{")
+			}
+		}
+	}
+
+	if tag != nil {
+		report(tag.line, tag.column, "<%s is never closed with \">\"", tag.name)
+	}
+	for _, open := range stack {
+		report(open.line, open.column, "<%s> is never closed", open.name)
+	}
+	return issues
+}
+
+// closeComponent updates the stack of open components for a finished tag
+func closeComponent(stack []openComponent, tag openComponent, closing bool, selfClosing bool, report func(int, int, string, ...interface{})) []openComponent {
+	switch {
+	case selfClosing:
+		return stack
+	case !closing:
+		return append(stack, tag)
+	}
+	for k := len(stack) - 1; k >= 0; k-- {
+		if stack[k].name != tag.name {
+			continue
+		}
+		// Components opened inside this one were left open
+		for _, open := range stack[k+1:] {
+			report(open.line, open.column, "<%s> is never closed before </%s>", open.name, tag.name)
+		}
+		return stack[:k]
+	}
+	report(tag.line, tag.column, "</%s> closes a component that isn't open", tag.name)
+	return stack
+}
+
+// isComponentName reports whether a tag is an MDX component rather than a
+// plain HTML element, which MDX allows to be left open
+func isComponentName(name string) bool {
+	return name != "" && unicode.IsUpper([]rune(name)[0])
+}
+
+// skipCodeSpan returns the index of the last backtick of the code span
+// starting at i, or of the opening backticks when the span isn't closed
+func skipCodeSpan(runes []rune, i int) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == '`' {
+		n++
+	}
+	delimiter := strings.Repeat("`", n)
+	rest := string(runes[i+n:])
+	end := strings.Index(rest, delimiter)
+	if end < 0 {
+		return i + n - 1
+	}
+	return i + n + len([]rune(rest[:end])) + n - 1
+}
+
+// frontmatterEnd returns the index of the first line after the frontmatter,
+// which is delimited by --- (yaml) or +++ (toml), or is a JSON object
+func frontmatterEnd(lines []string) int {
+	if len(lines) == 0 {
+		return 0
+	}
+	closing := map[string]string{"---": "---", "+++": "+++", "{": "}"}[strings.TrimSpace(lines[0])]
+	if closing == "" {
+		return 0
+	}
+	for n := 1; n < len(lines); n++ {
+		if strings.TrimSpace(lines[n]) == closing {
+			return n + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package wptomdx
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidateMDX(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "clean",
+			content: "---\ntitle: \"a < b {x}\"\n---\n\nimport YouTube from './YouTube'\n\n" +
+				"Escaped \\< and \\{braces\\}.\n\n<YouTube id=\"abc\" />\n\n<Note>\nText\n</Note>\n\n" +
+				"Code `a < b {c}` and\n\n```js\nif (a < b) { c() }\n```\n\n{/* a\ncomment */}\n<br>\n",
+		},
+		{
+			name:    "bare less-than",
+			content: "1 < 2\n",
+			want:    []string{`1:3: bare "<" is read as the start of a tag; escape it as \<`},
+		},
+		{
+			name:    "expression",
+			content: "Set {x} here\n",
+			want:    []string{`1:5: "{" starts an MDX expression; escape it as \{`},
+		},
+		{
+			name:    "HTML comment",
+			content: "a <!-- b --> c\n",
+			want:    []string{"1:3: HTML comments aren't valid in MDX; use {/* */}"},
+		},
+		{
+			name:    "unclosed component",
+			content: "Intro\n\n<YouTube id=\"abc\">\n\nmore\n",
+			want:    []string{"3:1: <YouTube> is never closed"},
+		},
+		{
+			name:    "unfinished tag",
+			content: "<YouTube id=\"abc\"\n",
+			want:    []string{`1:1: <YouTube is never closed with ">"`},
+		},
+		{
+			name:    "expression in attributes",
+			content: "<Note title={x} />\n",
+			want:    []string{"1:13: expression in the attributes of <Note>"},
+		},
+		{
+			name:    "mismatched components",
+			content: "<Note>\n<Tip>\n</Note>\n</Tip>\n",
+			want: []string{
+				"2:1: <Tip> is never closed before </Note>",
+				"4:1: </Tip> closes a component that isn't open",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, issue := range ValidateMDX(tt.content) {
+				got = append(got, issue.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ValidateMDX() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// The converter's own output must not trip the validator
+func TestValidateMDXGolden(t *testing.T) {
+	goldens, err := filepath.Glob(filepath.Join("testdata", "golden", "*.mdx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, golden := range goldens {
+		content, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range ValidateMDX(string(content)) {
+			t.Errorf("%s:%s", golden, issue)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package wptomdx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxErrorBody is how much of an error response is logged
+const maxErrorBody = 512
+
+// errorBody returns the start of an error response's body, for logging
+func errorBody(resp *http.Response) string {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody+1))
+	if err != nil {
+		return fmt.Sprintf("(failed to read body: %v)", err)
+	}
+	text := strings.TrimSpace(string(body))
+	if len(body) > maxErrorBody {
+		text = strings.TrimSpace(string(body[:maxErrorBody])) + "..."
+	}
+	return text
+}
+
+// APIMonitor notices a WordPress API that can't be reached, so a run can stop
+// instead of failing every URL lookup
+type APIMonitor struct {
+	// Threshold is how many lookups must fail to connect, before any
+	// succeeds, for the API to count as unreachable; 0 never gives up
+	Threshold int
+
+	mu        sync.Mutex
+	failures  int
+	reachable bool
+}
+
+// Observe records the result of a lookup and reports whether the API is
+// unreachable
+func (m *APIMonitor) Observe(err error) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var urlErr *url.Error
+	if err == nil || !errors.As(err, &urlErr) {
+		// Any response means the API is up, later failures are per item
+		m.reachable = true
+		return false
+	}
+	if m.reachable || m.Threshold <= 0 {
+		return false
+	}
+	m.failures++
+	return m.failures >= m.Threshold
+}
+
+// Unreachable reports whether enough lookups failed for the API to count as
+// unreachable
+func (m *APIMonitor) Unreachable() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.reachable && m.Threshold > 0 && m.failures >= m.Threshold
+}
+
+// APIClient looks up item URLs through the WordPress REST API
+type APIClient struct {
+	// Base is the REST API root, e.g. https://example.com/wp-json/wp/v2
+	Base string
+	// Retry is how failed requests are retried
+	Retry RetryPolicy
+}
+
+// GetPostURL fetches the full URL of a post using the WordPress REST API,
+// retrying with the default policy. Its errors are APILookupErrors.
+func GetPostURL(apiBase string, postID int) (string, error) {
+	return APIClient{Base: apiBase, Retry: DefaultConfig().APIRetry}.PostURL(postID)
+}
+
+// GetPageURL fetches the full URL of a page using the WordPress REST API,
+// retrying with the default policy. Its errors are APILookupErrors.
+func GetPageURL(apiBase string, pageID int) (string, error) {
+	return APIClient{Base: apiBase, Retry: DefaultConfig().APIRetry}.PageURL(pageID)
+}
+
+// PostURL fetches the full URL of a post. Its errors are APILookupErrors.
+func (a APIClient) PostURL(postID int) (string, error) {
+	client := &http.Client{}
+	url := fmt.Sprintf("%s/posts/%d", a.Base, postID)
+	log.Printf("Fetching post URL from: %s", url)
+
+	resp, err := retryDo(a.Retry, func() (*http.Response, error) { return client.Get(url) })
+	if err != nil {
+		return "", &APILookupError{URL: url, Err: fmt.Errorf("failed to fetch post URL: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	log.Printf("Post API response status: %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		body := errorBody(resp)
+		log.Printf("Post API error response body: %s", body)
+		return "", &APILookupError{URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, body)}
+	}
+
+	var result struct {
+		Link string `json:"link"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", &APILookupError{URL: url, Err: fmt.Errorf("failed to decode response: %v", err)}
+	}
+
+	log.Printf("Successfully fetched post URL: %s", result.Link)
+	return result.Link, nil
+}
+
+// PageURL fetches the full URL of a page. Its errors are APILookupErrors.
+func (a APIClient) PageURL(pageID int) (string, error) {
+	client := &http.Client{}
+	url := fmt.Sprintf("%s/pages/%d", a.Base, pageID)
+	log.Printf("Fetching page URL from: %s", url)
+
+	resp, err := retryDo(a.Retry, func() (*http.Response, error) { return client.Get(url) })
+	if err != nil {
+		return "", &APILookupError{URL: url, Err: fmt.Errorf("failed to fetch page URL: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	log.Printf("Page API response status: %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		body := errorBody(resp)
+		log.Printf("Page API error response body: %s", body)
+		return "", &APILookupError{URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, body)}
+	}
+
+	var result struct {
+		Link string `json:"link"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", &APILookupError{URL: url, Err: fmt.Errorf("failed to decode response: %v", err)}
+	}
+
+	log.Printf("Successfully fetched page URL: %s", result.Link)
+	return result.Link, nil
+}
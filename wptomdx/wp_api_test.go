@@ -0,0 +1,143 @@
+package wptomdx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIMonitor(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "https://example.com/wp-json/wp/v2/posts/1", Err: errors.New("connection refused")}
+	notFound := &APILookupError{StatusCode: http.StatusNotFound, Err: errors.New("unexpected status code: 404")}
+	tests := []struct {
+		name      string
+		threshold int
+		results   []error
+		want      bool
+	}{
+		{"below threshold", 3, []error{refused, refused}, false},
+		{"at threshold", 3, []error{refused, refused, refused}, true},
+		{"wrapped", 2, []error{fmt.Errorf("failed to fetch post URL: %w", refused), refused}, true},
+		{"reached before", 2, []error{nil, refused, refused, refused}, false},
+		{"response before", 2, []error{notFound, refused, refused}, false},
+		{"disabled", 0, []error{refused, refused, refused}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := &APIMonitor{Threshold: tt.threshold}
+			var observed bool
+			for _, err := range tt.results {
+				observed = monitor.Observe(err)
+			}
+			if observed != tt.want {
+				t.Errorf("Observe() = %v, want %v", observed, tt.want)
+			}
+			if got := monitor.Unreachable(); got != tt.want {
+				t.Errorf("Unreachable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIMonitorRefusedConnections(t *testing.T) {
+	// A closed server's address refuses connections
+	server := httptest.NewServer(http.NotFoundHandler())
+	api := APIClient{Base: server.URL + "/wp-json/wp/v2"}
+	server.Close()
+
+	const threshold = 3
+	monitor := &APIMonitor{Threshold: threshold}
+	lookups := 0
+	for id := 1; id <= 100 && !monitor.Unreachable(); id++ {
+		_, err := api.PostURL(id)
+		if err == nil {
+			t.Fatalf("PostURL(%d) succeeded against a closed server", id)
+		}
+		lookups++
+		monitor.Observe(err)
+	}
+	if lookups != threshold {
+		t.Errorf("gave up after %d lookups, want %d", lookups, threshold)
+	}
+}
+
+func TestAPIClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		want         string
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"fails once", []int{502, 200}, "https://example.com/post-2/", false, 2},
+		{"not found", []int{404}, "", true, 1},
+		{"always failing", []int{500}, "", true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := statusServer(t, tt.statuses...)
+			api := APIClient{Base: server.URL, Retry: RetryPolicy{Attempts: 3, Backoff: time.Millisecond}}
+			for _, lookup := range []func(int) (string, error){api.PostURL, api.PageURL} {
+				requests.Store(0)
+				got, err := lookup(1)
+				if (err != nil) != tt.wantErr || got != tt.want {
+					t.Errorf("lookup = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+				}
+				if n := requests.Load(); n != tt.wantRequests {
+					t.Errorf("sent %d requests, want %d", n, tt.wantRequests)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIClientErrorBody(t *testing.T) {
+	long := strings.Repeat("x", maxErrorBody+100)
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"forbidden", http.StatusForbidden, `{"code":"rest_forbidden","message":"Sorry"}`, `{"code":"rest_forbidden","message":"Sorry"}`},
+		{"not found", http.StatusNotFound, "  No route was found  \n", "No route was found"},
+		{"truncated", http.StatusBadRequest, long, strings.Repeat("x", maxErrorBody) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			defer log.SetOutput(os.Stderr)
+
+			api := APIClient{Base: server.URL}
+			for _, lookup := range []func(int) (string, error){api.PostURL, api.PageURL} {
+				logged.Reset()
+				_, err := lookup(1)
+				var lookupErr *APILookupError
+				if !errors.As(err, &lookupErr) || lookupErr.StatusCode != tt.status {
+					t.Fatalf("error = %v, want an APILookupError with status %d", err, tt.status)
+				}
+				if want := fmt.Sprintf("unexpected status code: %d: %s", tt.status, tt.want); !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+				if !strings.Contains(logged.String(), tt.want) {
+					t.Errorf("log %q does not contain %q", logged.String(), tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package wptomdx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// autopBlocks are the block-level tags wpautop doesn't wrap in paragraphs
+const autopBlocks = `(?:table|thead|tfoot|caption|col|colgroup|tbody|tr|td|th|div|dl|dd|dt|ul|ol|li|pre|form|map|area|blockquote|address|math|style|p|h[1-6]|hr|fieldset|legend|section|article|aside|hgroup|header|footer|nav|figure|figcaption|details|menu|summary)`
+
+var (
+	autopPreRe          = regexp.MustCompile(`(?is)<(pre|script)[\s>].*?</(?:pre|script)>`)
+	autopDoubleBrRe     = regexp.MustCompile(`(?i)<br\s*/?>\s*<br\s*/?>`)
+	autopBlockOpenRe    = regexp.MustCompile(`(?i)(<` + autopBlocks + `[\s/>])`)
+	autopBlockCloseRe   = regexp.MustCompile(`(?i)(</` + autopBlocks + `>)`)
+	autopHrRe           = regexp.MustCompile(`(?i)<hr\s*?/?>`)
+	autopManyNewlinesRe = regexp.MustCompile(`\n\n+`)
+	autopParagraphsRe   = regexp.MustCompile(`\n\s*\n`)
+	autopEmptyPRe       = regexp.MustCompile(`<p>\s*</p>`)
+	autopUnclosedPRe    = regexp.MustCompile(`(?i)<p>([^<]+)</(div|address|form)>`)
+	autopWrappedBlockRe = regexp.MustCompile(`(?i)<p>\s*(</?` + autopBlocks + `[^>]*>)\s*</p>`)
+	autopListItemRe     = regexp.MustCompile(`(?i)<p>(<li.+?)</p>`)
+	autopQuoteOpenRe    = regexp.MustCompile(`(?i)<p><blockquote([^>]*)>`)
+	autopQuoteCloseRe   = regexp.MustCompile(`(?i)</blockquote></p>`)
+	autopBlockAfterPRe  = regexp.MustCompile(`(?i)<p>\s*(</?` + autopBlocks + `[^>]*>)`)
+	autopBlockBeforePRe = regexp.MustCompile(`(?i)(</?` + autopBlocks + `[^>]*>)\s*</p>`)
+	autopTagRe          = regexp.MustCompile(`<[^<>]*>`)
+	autopNewlineRe      = regexp.MustCompile(`(?:<br />)?[ \t]*\n`)
+	autopBlockBrRe      = regexp.MustCompile(`(?i)(</?` + autopBlocks + `[^>]*>)\s*<br />`)
+	autopBrBlockRe      = regexp.MustCompile(`(?i)<br />(\s*</?(?:p|li|div|dl|dd|dt|th|pre|td|ul|ol)[^>]*>)`)
+)
+
+// wpautop adds the paragraphs WordPress adds to classic editor content when
+// rendering it, a port of its wpautop(): text blocks separated by blank lines
+// become <p> elements and single line breaks inside them <br />. Block editor
+// content, which WordPress doesn't run through wpautop, is returned as is, as
+// is the content of <pre> and <script> elements.
+func wpautop(content string) string {
+	if strings.TrimSpace(content) == "" || strings.Contains(content, "<!-- wp:") {
+		return content
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	// Set preformatted elements aside
+	var kept []string
+	content = autopPreRe.ReplaceAllStringFunc(content, func(m string) string {
+		kept = append(kept, m)
+		return fmt.Sprintf("<pre wp-pre-tag-%d></pre>", len(kept)-1)
+	})
+
+	content = autopDoubleBrRe.ReplaceAllString(content+"\n", "\n\n")
+	content = autopBlockOpenRe.ReplaceAllString(content, "\n\n$1")
+	content = autopBlockCloseRe.ReplaceAllString(content, "$1\n\n")
+	content = autopHrRe.ReplaceAllString(content, "$0\n\n")
+	content = autopManyNewlinesRe.ReplaceAllString(content, "\n\n")
+
+	var b strings.Builder
+	for _, chunk := range autopParagraphsRe.Split(content, -1) {
+		if chunk = strings.TrimSpace(chunk); chunk != "" {
+			b.WriteString("<p>" + chunk + "</p>\n")
+		}
+	}
+	content = b.String()
+
+	// Take the paragraphs back off the block elements
+	content = autopEmptyPRe.ReplaceAllString(content, "")
+	content = autopUnclosedPRe.ReplaceAllString(content, "<p>$1</p></$2>")
+	content = autopWrappedBlockRe.ReplaceAllString(content, "$1")
+	content = autopListItemRe.ReplaceAllString(content, "$1")
+	content = autopQuoteOpenRe.ReplaceAllString(content, "<blockquote$1><p>")
+	content = autopQuoteCloseRe.ReplaceAllString(content, "</p></blockquote>")
+	content = autopBlockAfterPRe.ReplaceAllString(content, "$1")
+	content = autopBlockBeforePRe.ReplaceAllString(content, "$1")
+
+	// Line breaks within tags aren't text
+	content = autopTagRe.ReplaceAllStringFunc(content, func(tag string) string {
+		return strings.ReplaceAll(tag, "\n", " ")
+	})
+	content = autopNewlineRe.ReplaceAllString(content, "<br />\n")
+	content = autopBlockBrRe.ReplaceAllString(content, "$1")
+	content = autopBrBlockRe.ReplaceAllString(content, "$1")
+	content = strings.TrimSuffix(strings.TrimSpace(content), "<br />")
+
+	for i, m := range kept {
+		content = strings.Replace(content, fmt.Sprintf("<pre wp-pre-tag-%d></pre>", i), m, 1)
+	}
+	return content
+}
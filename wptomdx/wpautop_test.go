@@ -0,0 +1,55 @@
+package wptomdx
+
+import "testing"
+
+func TestWpautop(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"paragraphs", "First paragraph.\n\nSecond paragraph.", "<p>First paragraph.</p>\n<p>Second paragraph.</p>"},
+		{"line break", "Line one\nline two", "<p>Line one<br />\nline two</p>"},
+		{"windows line endings", "Para\r\n\r\nNext", "<p>Para</p>\n<p>Next</p>"},
+		{"double br", "A<br><br>B", "<p>A</p>\n<p>B</p>"},
+		{"list", "Intro\n<ul>\n<li>One</li>\n<li>Two</li>\n</ul>\nAfter list", "<p>Intro</p>\n<ul>\n<li>One</li>\n<li>Two</li>\n</ul>\n<p>After list</p>"},
+		{"heading", "<h2>Heading</h2>\nBody text", "<h2>Heading</h2>\n<p>Body text</p>"},
+		{"horizontal rule", "Before<hr>After", "<p>Before</p>\n<hr>\n<p>After</p>"},
+		{"blockquote", "<blockquote>Quoted\n\nTwice</blockquote>", "<blockquote><p>Quoted</p>\n<p>Twice</p></blockquote>"},
+		{"pre kept", "Text\n<pre>keep\n\nthis</pre>\nMore", "<p>Text</p>\n<pre>keep\n\nthis</pre>\n<p>More</p>"},
+		{"newline in tag", "Text with <a\nhref=\"/x\">link</a>", "<p>Text with <a href=\"/x\">link</a></p>"},
+		{"block editor", "<!-- wp:paragraph -->\n<p>Block</p>\n<!-- /wp:paragraph -->", "<!-- wp:paragraph -->\n<p>Block</p>\n<!-- /wp:paragraph -->"},
+		{"blank", "  \n ", "  \n "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wpautop(tt.in); got != tt.want {
+				t.Errorf("wpautop(%q) =\n%q\nwant\n%q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertContentWpautop(t *testing.T) {
+	const classic = "First paragraph.\nSecond line.\n<ul><li>One</li></ul>\nLast <em>words</em>"
+	tests := []struct {
+		name  string
+		apply bool
+		want  string
+	}{
+		{"applied", true, "First paragraph.\n\nSecond line.\n\n- One\n\nLast _words_"},
+		{"not applied", false, "First paragraph.\nSecond line.\n\n- One\n\nLast _words_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConverter(Config{BaseURL: testBaseURL, ApplyWpautop: tt.apply})
+			got, _, err := c.ConvertContent(classic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ConvertContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package wptomdx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// wxrFile mirrors the parts of a WordPress eXtended RSS (WXR) export we use.
+// Elements are matched by local name so that every WXR version (1.0-1.2,
+// which differ in namespace URL) is accepted.
+type wxrFile struct {
+	Channel struct {
+		Authors []wxrAuthor `xml:"author"`
+		Items   []wxrItem   `xml:"item"`
+	} `xml:"channel"`
+}
+
+// wxrAuthor is a wp:author element; items name theirs by login in dc:creator
+type wxrAuthor struct {
+	ID          int    `xml:"author_id"`
+	Login       string `xml:"author_login"`
+	Email       string `xml:"author_email"`
+	DisplayName string `xml:"author_display_name"`
+}
+
+type wxrItem struct {
+	Title         string        `xml:"title"`
+	Creator       string        `xml:"creator"`
+	Link          string        `xml:"link"`
+	Encoded       []wxrEncoded  `xml:"encoded"`
+	PostID        int           `xml:"post_id"`
+	PostName      string        `xml:"post_name"`
+	PostParent    int           `xml:"post_parent"`
+	PostDate      string        `xml:"post_date"`
+	PostDateGMT   string        `xml:"post_date_gmt"`
+	PostModified  string        `xml:"post_modified"`
+	ModifiedGMT   string        `xml:"post_modified_gmt"`
+	PostType      string        `xml:"post_type"`
+	Status        string        `xml:"status"`
+	PostPassword  string        `xml:"post_password"`
+	IsSticky      string        `xml:"is_sticky"`
+	AttachmentURL string        `xml:"attachment_url"`
+	Categories    []wxrCategory `xml:"category"`
+	PostMeta      []wxrPostMeta `xml:"postmeta"`
+	Comments      []wxrComment  `xml:"comment"`
+}
+
+// wxrEncoded is a content:encoded or excerpt:encoded element, told apart by namespace
+type wxrEncoded struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wxrCategory struct {
+	Domain string `xml:"domain,attr"`
+	Name   string `xml:",chardata"`
+}
+
+type wxrComment struct {
+	ID        int    `xml:"comment_id"`
+	Parent    int    `xml:"comment_parent"`
+	Author    string `xml:"comment_author"`
+	AuthorURL string `xml:"comment_author_url"`
+	Date      string `xml:"comment_date"`
+	Content   string `xml:"comment_content"`
+	Approved  string `xml:"comment_approved"`
+	Type      string `xml:"comment_type"`
+}
+
+type wxrPostMeta struct {
+	Key   string `xml:"meta_key"`
+	Value string `xml:"meta_value"`
+}
+
+// WXRExport holds the published posts and pages of a WXR export, plus the URL
+// of every attachment by ID and the authors, which exports carry no bio for
+type WXRExport struct {
+	Posts       []Post
+	Pages       []Post
+	Attachments map[int]string
+	Authors     []Author
+}
+
+// ParseWXRFile reads and parses a WXR export file
+func ParseWXRFile(path string) (*WXRExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WXR file %s: %v", path, err)
+	}
+	return ParseWXR(data)
+}
+
+// ParseWXR parses a WXR export into Posts, filling the same fields the
+// database queries do
+func ParseWXR(data []byte) (*WXRExport, error) {
+	var file wxrFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse WXR: %v", err)
+	}
+
+	export := &WXRExport{Attachments: make(map[int]string)}
+	tree := make(map[int]PageNode)
+	authorIDs := make(map[string]int)
+	for _, author := range file.Channel.Authors {
+		authorIDs[author.Login] = author.ID
+		export.Authors = append(export.Authors, Author{
+			ID:     author.ID,
+			Slug:   termSlug(author.Login),
+			Name:   author.DisplayName,
+			Avatar: gravatarURL(author.Email),
+		})
+	}
+	for _, item := range file.Channel.Items {
+		if item.PostType == "attachment" && item.AttachmentURL != "" {
+			export.Attachments[item.PostID] = strings.TrimSpace(item.AttachmentURL)
+		}
+		if item.PostType == "page" {
+			tree[item.PostID] = PageNode{ID: item.PostID, Slug: item.PostName, Parent: item.PostParent}
+		}
+	}
+
+	for _, item := range file.Channel.Items {
+		if item.Status != "publish" || (item.PostType != "post" && item.PostType != "page") {
+			continue
+		}
+
+		post := Post{
+			ID:            item.PostID,
+			Title:         item.Title,
+			PublishedDate: item.PostDate,
+			UpdatedDate:   item.PostModified,
+			PublishedGMT:  item.PostDateGMT,
+			UpdatedGMT:    item.ModifiedGMT,
+			URL:           strings.TrimSpace(item.Link),
+			PostType:      item.PostType,
+			Status:        item.Status,
+			Password:      item.PostPassword,
+			Slug:          item.PostName,
+			AuthorID:      authorIDs[strings.TrimSpace(item.Creator)],
+			IsFeatured:    item.PostType == "post" && strings.TrimSpace(item.IsSticky) == "1",
+		}
+		for _, encoded := range item.Encoded {
+			if strings.Contains(encoded.XMLName.Space, "excerpt") {
+				post.Excerpt = encoded.Value
+			} else if strings.Contains(encoded.XMLName.Space, "content") {
+				post.Content = encoded.Value
+			}
+		}
+		for _, category := range item.Categories {
+			switch category.Domain {
+			case "category":
+				post.Categories = append(post.Categories, category.Name)
+			case "post_tag":
+				post.Tags = append(post.Tags, category.Name)
+			}
+		}
+		for _, meta := range item.PostMeta {
+			if post.Meta == nil {
+				post.Meta = make(map[string]string)
+			}
+			post.Meta[meta.Key] = meta.Value
+			if meta.Key != "_thumbnail_id" {
+				continue
+			}
+			if id, err := strconv.Atoi(strings.TrimSpace(meta.Value)); err == nil {
+				post.FeaturedImage = export.Attachments[id]
+			}
+		}
+
+		// Like comment_count, the count includes pingbacks, which aren't exported
+		for _, comment := range item.Comments {
+			if comment.Approved != "1" {
+				continue
+			}
+			post.CommentCount++
+			if comment.Type == "" || comment.Type == "comment" {
+				post.Comments = append(post.Comments, Comment{
+					ID:        comment.ID,
+					Parent:    comment.Parent,
+					Author:    comment.Author,
+					AuthorURL: comment.AuthorURL,
+					Date:      comment.Date,
+					Content:   comment.Content,
+				})
+			}
+		}
+
+		unescapeEntities(&post)
+
+		if item.PostType == "page" {
+			export.Pages = append(export.Pages, post)
+		} else {
+			export.Posts = append(export.Posts, post)
+		}
+	}
+
+	ResolvePageParents(export.Pages, tree)
+
+	// Newest first, like the database queries
+	for _, items := range [][]Post{export.Posts, export.Pages} {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].PublishedDate > items[j].PublishedDate })
+	}
+
+	return export, nil
+}
+
+// AttachmentURLs looks up attachment URLs from the export, like GetImageURLsFromDB
+func (e *WXRExport) AttachmentURLs(ids []int) ([]string, error) {
+	var urls []string
+	for _, id := range ids {
+		url, ok := e.Attachments[id]
+		if !ok {
+			return nil, fmt.Errorf("id %d: attachment not found in export", id)
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
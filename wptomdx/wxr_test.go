@@ -0,0 +1,73 @@
+package wptomdx
+
+import (
+	"reflect"
+	"testing"
+)
+
+// parseSampleWXR parses testdata/wxr/sample.xml: two published posts (one
+// with a tag, a featured image and comments), a draft, a page with a child
+// page and an attachment
+func parseSampleWXR(t *testing.T) *WXRExport {
+	t.Helper()
+	export, err := ParseWXRFile("testdata/wxr/sample.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return export
+}
+
+func TestParseWXR(t *testing.T) {
+	export := parseSampleWXR(t)
+
+	type fields struct {
+		ID                         int
+		Title, Content, Excerpt    string
+		PublishedDate, UpdatedDate string
+		PostType, Status, Slug     string
+		URL                        string
+		Tags, Categories           []string
+		IsFeatured                 bool
+	}
+	want := []fields{
+		{
+			ID: 11, Title: "Second post", Content: "<p>Second</p>",
+			PublishedDate: "2024-04-01 10:00:00", UpdatedDate: "2024-04-01 10:00:00",
+			PostType: "post", Status: "publish", Slug: "second", URL: "https://example.com/second/",
+			Categories: []string{"News"},
+		},
+		{
+			ID: 10, Title: "Hello & welcome", Content: "<p>First <strong>post</strong></p>", Excerpt: "The first one",
+			PublishedDate: "2024-03-01 10:00:00", UpdatedDate: "2024-03-05 10:00:00",
+			PostType: "post", Status: "publish", Slug: "hello", URL: "https://example.com/hello/",
+			Tags: []string{"Go"}, Categories: []string{"News"}, IsFeatured: true,
+		},
+	}
+	var got []fields
+	for _, p := range export.Posts {
+		got = append(got, fields{
+			p.ID, p.Title, p.Content, p.Excerpt, p.PublishedDate, p.UpdatedDate,
+			p.PostType, p.Status, p.Slug, p.URL, p.Tags, p.Categories, p.IsFeatured,
+		})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("posts =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if len(export.Pages) != 2 {
+		t.Errorf("got %d pages, want 2", len(export.Pages))
+	}
+	wantAttachments := map[int]string{30: "https://example.com/wp-content/uploads/2024/03/hero.jpg"}
+	if !reflect.DeepEqual(export.Attachments, wantAttachments) {
+		t.Errorf("attachments = %v, want %v", export.Attachments, wantAttachments)
+	}
+	if _, err := export.AttachmentURLs([]int{30, 99}); err == nil {
+		t.Error("AttachmentURLs() of a missing attachment succeeded, want an error")
+	}
+}
+
+func TestParseWXRInvalid(t *testing.T) {
+	if _, err := ParseWXR([]byte("<rss><channel><item>")); err == nil {
+		t.Error("ParseWXR() of truncated XML succeeded, want an error")
+	}
+}